@@ -0,0 +1,111 @@
+// Copyright 2024 Canonical Ltd.
+// Licensed under Apache 2.0, see LICENCE file for details.
+
+package sqlair
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Batch is a sequence of statements run one after another in a transaction.
+// It is started with [TX.Run] and extended with [Batch.Then]. Once a statement
+// fails the statements after it are not run.
+type Batch struct {
+	tx *TX
+	// steps is the number of statements run or attempted.
+	steps int
+	// result combines the results of the statements run.
+	result batchResult
+	err    error
+}
+
+// Run runs the statement with the input arguments in the transaction and
+// returns a [Batch] that further statements can be added to with
+// [Batch.Then]. Each statement is run with the context the transaction was
+// started with.
+//
+// For example:
+//
+//	err := tx.Run(createStmt).Then(insertStmt, people).Then(updateStmt, sqlair.M{"id": 1}).Err()
+func (tx *TX) Run(s *Statement, inputArgs ...any) *Batch {
+	b := &Batch{tx: tx}
+	return b.Then(s, inputArgs...)
+}
+
+// Then runs the statement with the input arguments in the transaction of the
+// batch if all of the previous statements succeeded. Otherwise it does
+// nothing.
+func (b *Batch) Then(s *Statement, inputArgs ...any) *Batch {
+	if b.err != nil {
+		return b
+	}
+	b.steps++
+	var outcome Outcome
+	if err := b.tx.Query(b.tx.ctx, s, inputArgs...).Get(&outcome); err != nil {
+		b.err = fmt.Errorf("cannot run statement %d of batch: %w", b.steps, err)
+		return b
+	}
+	if outcome.result != nil {
+		b.result.add(outcome.result)
+	}
+	return b
+}
+
+// Err returns the error of the first statement in the batch that failed, or
+// nil if they all succeeded.
+func (b *Batch) Err() error {
+	return b.err
+}
+
+// Outcome returns an [Outcome] combining the results of the statements run in
+// the batch along with the error of Err. RowsAffected is the total for all the
+// statements and LastInsertId is that of the last statement to report one.
+func (b *Batch) Outcome() (*Outcome, error) {
+	result := b.result
+	return &Outcome{result: &result}, b.err
+}
+
+// batchResult is a sql.Result that combines the results of several
+// statements.
+type batchResult struct {
+	rowsAffected    int64
+	rowsAffectedErr error
+	lastInsertID    int64
+	lastInsertIDErr error
+	hasLastInsertID bool
+}
+
+// add adds the result of a statement to the combined result. An error from a
+// driver that does not support RowsAffected is kept and returned by the
+// combined result.
+func (br *batchResult) add(result sql.Result) {
+	if n, err := result.RowsAffected(); err != nil {
+		br.rowsAffectedErr = err
+	} else {
+		br.rowsAffected += n
+	}
+	if id, err := result.LastInsertId(); err == nil {
+		br.lastInsertID, br.hasLastInsertID = id, true
+	} else if !br.hasLastInsertID {
+		br.lastInsertIDErr = err
+	}
+}
+
+// LastInsertId returns the last insert ID reported by the statements of the
+// batch.
+func (br *batchResult) LastInsertId() (int64, error) {
+	if br.hasLastInsertID {
+		return br.lastInsertID, nil
+	}
+	return 0, br.lastInsertIDErr
+}
+
+// RowsAffected returns the total number of rows affected by the statements of
+// the batch.
+func (br *batchResult) RowsAffected() (int64, error) {
+	if br.rowsAffectedErr != nil {
+		return 0, br.rowsAffectedErr
+	}
+	return br.rowsAffected, nil
+}
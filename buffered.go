@@ -0,0 +1,280 @@
+// Copyright 2023 Canonical Ltd.
+// Licensed under Apache 2.0, see LICENCE file for details.
+
+package sqlair
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// resultRows holds the results of a query. It is implemented by *sql.Rows and
+// by bufferedRows.
+type resultRows interface {
+	Next() bool
+	NextResultSet() bool
+	Columns() ([]string, error)
+	Scan(dest ...any) error
+	Close() error
+	Err() error
+}
+
+// bufferRows reads all the remaining rows of every result set from rows into
+// memory and closes it, releasing the connection.
+func bufferRows(rows *sql.Rows) (*bufferedRows, error) {
+	defer rows.Close()
+	br := &bufferedRows{pos: -1}
+	for {
+		cols, err := rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+		set := bufferedResultSet{cols: cols}
+		for rows.Next() {
+			// Scanning into a pointer to an empty interface stores the
+			// value returned by the driver without conversion. Byte slices
+			// are copied.
+			row := make([]any, len(cols))
+			ptrs := make([]any, len(cols))
+			for i := range row {
+				ptrs[i] = &row[i]
+			}
+			if err := rows.Scan(ptrs...); err != nil {
+				return nil, err
+			}
+			set.rows = append(set.rows, row)
+		}
+		br.sets = append(br.sets, set)
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	return br, nil
+}
+
+// bufferedRows replays the result sets of a query held in memory.
+type bufferedRows struct {
+	sets []bufferedResultSet
+	// set is the index of the current result set.
+	set int
+	// pos is the index of the current row in the current result set.
+	pos    int
+	closed bool
+}
+
+// bufferedResultSet holds the columns and rows of a result set.
+type bufferedResultSet struct {
+	cols []string
+	rows [][]any
+}
+
+// Next moves to the next row, returning false if there are no more rows.
+func (br *bufferedRows) Next() bool {
+	if br.closed || br.pos+1 >= len(br.sets[br.set].rows) {
+		return false
+	}
+	br.pos++
+	return true
+}
+
+// NextResultSet moves to the next result set, returning false if there are no
+// more result sets.
+func (br *bufferedRows) NextResultSet() bool {
+	if br.closed || br.set+1 >= len(br.sets) {
+		return false
+	}
+	br.set++
+	br.pos = -1
+	return true
+}
+
+// Columns returns the column names of the current result set.
+func (br *bufferedRows) Columns() ([]string, error) {
+	if br.closed {
+		return nil, errors.New("sql: Rows are closed")
+	}
+	return br.sets[br.set].cols, nil
+}
+
+// Scan copies the columns of the current row into dest, converting them in
+// the same way as [sql.Rows.Scan].
+func (br *bufferedRows) Scan(dest ...any) error {
+	if br.closed {
+		return errors.New("sql: Rows are closed")
+	}
+	set := br.sets[br.set]
+	if br.pos < 0 || br.pos >= len(set.rows) {
+		return errors.New("sql: Scan called without calling Next")
+	}
+	row := set.rows[br.pos]
+	if len(dest) != len(row) {
+		return fmt.Errorf("sql: expected %d destination arguments in Scan, not %d", len(row), len(dest))
+	}
+	for i, d := range dest {
+		if err := convertAssign(d, row[i]); err != nil {
+			return fmt.Errorf("sql: Scan error on column index %d, name %q: %w", i, set.cols[i], err)
+		}
+	}
+	return nil
+}
+
+// Close releases the buffered rows.
+func (br *bufferedRows) Close() error {
+	br.closed = true
+	br.sets = nil
+	return nil
+}
+
+// Err returns nil since any error reading the rows is returned when they are
+// buffered.
+func (br *bufferedRows) Err() error {
+	return nil
+}
+
+var bytesType = reflect.TypeOf([]byte(nil))
+
+// convertAssign stores the value returned by a driver in dest. It follows the
+// conversions made by database/sql when scanning rows.
+func convertAssign(dest, src any) error {
+	switch d := dest.(type) {
+	case sql.Scanner:
+		return d.Scan(src)
+	case *any:
+		if b, ok := src.([]byte); ok {
+			src = append([]byte(nil), b...)
+		}
+		*d = src
+		return nil
+	}
+
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Pointer {
+		return errors.New("destination not a pointer")
+	}
+	if dv.IsNil() {
+		return errors.New("destination pointer is nil")
+	}
+	dv = dv.Elem()
+
+	if src == nil {
+		switch dv.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+			dv.Set(reflect.Zero(dv.Type()))
+			return nil
+		}
+		return fmt.Errorf("converting NULL to %s is unsupported", dv.Kind())
+	}
+	if dv.Kind() == reflect.Pointer {
+		v := reflect.New(dv.Type().Elem())
+		if err := convertAssign(v.Interface(), src); err != nil {
+			return err
+		}
+		dv.Set(v)
+		return nil
+	}
+
+	sv := reflect.ValueOf(src)
+	if b, ok := src.([]byte); ok {
+		// The buffered value is shared between scans of the row.
+		sv = reflect.ValueOf(append([]byte(nil), b...))
+	}
+	if sv.Type().AssignableTo(dv.Type()) {
+		dv.Set(sv)
+		return nil
+	}
+	if dv.Kind() == sv.Kind() && sv.Type().ConvertibleTo(dv.Type()) {
+		dv.Set(sv.Convert(dv.Type()))
+		return nil
+	}
+
+	s, ok := asString(src)
+	switch dv.Kind() {
+	case reflect.String:
+		if ok {
+			dv.SetString(s)
+			return nil
+		}
+	case reflect.Slice:
+		if str, isString := src.(string); isString && dv.Type() == bytesType {
+			dv.SetBytes([]byte(str))
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if ok {
+			i, err := strconv.ParseInt(s, 10, dv.Type().Bits())
+			if err != nil {
+				return conversionError(src, s, dv.Kind(), err)
+			}
+			dv.SetInt(i)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if ok {
+			u, err := strconv.ParseUint(s, 10, dv.Type().Bits())
+			if err != nil {
+				return conversionError(src, s, dv.Kind(), err)
+			}
+			dv.SetUint(u)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if ok {
+			f, err := strconv.ParseFloat(s, dv.Type().Bits())
+			if err != nil {
+				return conversionError(src, s, dv.Kind(), err)
+			}
+			dv.SetFloat(f)
+			return nil
+		}
+	case reflect.Bool:
+		if ok {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return conversionError(src, s, dv.Kind(), err)
+			}
+			dv.SetBool(b)
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported Scan, storing driver.Value type %T into type %T", src, dest)
+}
+
+// asString returns the string form of a value returned by a driver and true,
+// or false if the value has no string form.
+func asString(src any) (string, bool) {
+	switch v := src.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case time.Time:
+		return v.Format(time.RFC3339Nano), true
+	}
+	return "", false
+}
+
+// conversionError returns the error for a value that cannot be parsed as the
+// kind of its destination.
+func conversionError(src any, s string, kind reflect.Kind, err error) error {
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		err = numErr.Err
+	}
+	return fmt.Errorf("converting driver.Value type %T (%q) to a %s: %v", src, s, kind, err)
+}
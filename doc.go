@@ -34,17 +34,73 @@ With SQLair one would write:
 
 Note that in the SQLair `db` tags (i.e. the column names) appear in the input/output expressions, not the field names.
 
+Tagged fields must be exported. The tagged fields of an embedded struct are
+members of the outer struct, even if the embedded struct is unexported, unless
+it is embedded by an unexported pointer which SQLair cannot set.
+
+Nullable columns can be mapped to pointer fields such as `Nickname *string`. A
+NULL column value is scanned as a nil pointer and a nil pointer is passed to the
+database as NULL. Pointers to pointers are not supported. To pass NULL in a map
+or an `any` field, set it to sqlair.Null. The sql.Null* types
+can also be used; struct fields and map values implementing driver.Valuer are
+passed to the database as the result of their Value method. Those that instead
+implement encoding.TextMarshaler, such as netip.Addr, are passed as the string
+from their MarshalText method, and those implementing encoding.TextUnmarshaler
+are read from text columns with their UnmarshalText method, a NULL column
+setting them to their zero value. A field of type `any` is set to whatever
+value the driver returns for the column. Byte slice
+fields, such as `[]byte` or `json.RawMessage`, are passed to the database as
+blobs and are copied when scanned so they remain valid after the next row is
+read; sql.RawBytes is not supported for this reason. Fixed-size byte arrays,
+such as a `[16]byte` UUID, are also passed as blobs and are scanned from a
+column of the same length, or for 16 byte arrays from the text form of a UUID.
+
+Named basic types, such as `type Port int` or time.Duration, need no tag
+options. Columns are converted to them as they would be to their underlying
+type. Those without methods are passed to the database as their underlying
+type, the others are passed as they are for the driver to convert.
+
+Maps must have string keys. Their values need not be `any`, a map such as
+`type Counts map[string]int64` converts scanned columns to its value type and
+stores a NULL column as the zero value of that type.
+
+The column name in a `db` tag is made up of letters, digits, underscores and,
+after the first character, dollar signs. Other column names, such as those
+containing dots or spaces or in mixed case, are written in double quotes, e.g.
+`db:"\"Mixed Case\""`. The quotes are part of the name, the column is
+written as "Mixed Case" in expressions such as $Type."Mixed Case" and in the
+SQL generated for asterisks. A prefix is placed inside the quotes.
+
+The column name in a `db` tag can be followed by options:
+  - omitempty: the column is left out of INSERT statements generated with an asterisk when the field has its zero value. A nil pointer field counts as zero.
+  - nullzero: a zero value of the field is stored as NULL and a NULL column is read as the zero value, e.g. `db:"nickname,nullzero"`. A NULL column is always read into a plain field, such as a string or int, as its zero value, with nullzero it is also read as the zero value into fields that would otherwise reject it, such as sql.Scanner types.
+  - default=value: a zero value of the field is replaced by the value when the field is stored, e.g. `db:"status,default=pending"`. The default applies to the inputs of insert expressions and to inputs assigned directly to a column in the SET clause of an UPDATE statement or upsert, e.g. "SET status = $Job.status". It does not apply to other inputs, so "WHERE status = $Job.status" with a zero status compares with the zero value rather than the default. The value is parsed as the type of the field, which must be a string, bool or number type, a type that implements encoding.TextUnmarshaler, such as time.Time, or a pointer to one of these. The value cannot contain a comma. It cannot be used with omitempty or nullzero.
+  - readonly: the field is only used as an output. It is left out of the columns generated for an input asterisk, such as in INSERT INTO t (*) VALUES ($Row.*), so that a column filled by the database, e.g. with a default, can still be read with &Row.*. Using the field in an explicit input expression is an error.
+  - redact: the values of the field are kept out of rendered queries and errors, e.g. `db:"password_hash,redact"`. They are replaced by [REDACTED] in the parameters returned by [Statement.Render] and in errors about the field that could contain its value, such as a failure to scan a column into it.
+  - json: the field is encoded as JSON when used as an input and decoded from JSON when used as an output, e.g. `db:"settings,json"`.
+    A nil pointer, slice or map is stored as NULL, and a NULL or empty column is read as the zero value.
+    A slice field such as `Tags []string` must have this option, or implement sql.Scanner, to be used as an output; it is then stored as a JSON array.
+    A slice field is always a single input, only slice arguments are expanded with [:].
+    With omitempty a zero value, such as an empty struct, is left out of INSERT statements rather than stored as JSON.
+  - layout=: the time.Time field is stored as text in the given time layout, e.g. `db:"day,layout=2006-01-02"`.
+    Without it, a time.Time field can be scanned from a time, from text in the formats written by SQLite, or from an integer holding Unix seconds.
+  - prefix: the field is a struct whose tagged fields are members of the outer struct with the column name as a prefix to their tags, e.g. `db:"addr_,prefix"` on an Address field gives addr_id and addr_street.
+
 # Syntax
 
 The SQLair expressions specify Go values to use as query inputs or outputs. The
-input expressions can take values from structs, maps and slices while the
-output expressions can scan into only structs and maps.
+input expressions can take values from structs, maps, slices and loose
+values while the output expressions can scan into only structs and maps.
+Type is the name of the Go type. Any named map type with string keys can be
+used in the same way as [M], e.g. `type Attrs map[string]any` is referenced as
+$Attrs.key, and several map types can be used in one query.
 
 SQLair input expressions take the following formats:
 
  1. $Type.col_name
     - If Type is a struct then col_name is a `db` tag on one of the structs fields.
     - If Type is a map then col_name is a key in the map.
+    - Fields of nested structs can be accessed with $Type.col_name.nested_col_name.
 
  2. $Type[:]
     - Type must be a named slice type.
@@ -54,6 +110,7 @@ SQLair input expressions take the following formats:
     - Follows an INSERT INTO ... clause.
     - Types followed by an asterisk must be structs.
     - Types followed by an asterisk insert all tagged fields of Type.
+    - The columns of each type followed by an asterisk are sorted by tag, or are in the order the fields are declared with the [WithColumnOrder] option, and come before the columns of types followed by a column name.
     - Types followed by a column name insert the matching member of Type.
 
  4. (col_name1, col_name2, ...) VALUES ($Type1.*, $Type2.col_name2, ...)
@@ -64,6 +121,14 @@ SQLair input expressions take the following formats:
     - Structs followed by an asterisk insert all tagged fields of Type.
     - Map followed by an asterisk collects the columns not accessed by the other types.
     - Types followed by a column name insert the matching member of Type.
+    - Passing a slice of structs or maps inserts one row per element.
+    - Every map in a slice must contain all of the columns.
+    - Without asterisks, values are matched to the columns by position and can be SQL kept as it is, e.g. (id, kind, created) VALUES ($Type.id, 'const', now()).
+    - Inputs inside a value, e.g. coalesce($Type.name, 'none'), are passed as single inputs and cannot be used with slices.
+
+ 5. $1, $2, ...
+    - Passes the Nth loose input argument as a query parameter, e.g. an int or a string.
+    - The loose arguments are those whose types are not used in other input expressions, in the order they are passed.
 
 SQLair output expressions can take the following formats:
 
@@ -71,10 +136,13 @@ SQLair output expressions can take the following formats:
     - Fetches col_name and sets it in Type.
     - If Type is a struct this will be the field tagged with col_name.
     - If Type is a map this will be the value with key "col_name".
+    - Fields of nested structs can be accessed with &Type.col_name.nested_col_name.
 
  2. &Type.*
     - Fetches and sets all the tagged fields of Type.
-    - This form cannot be used with maps.
+    - If Type is a map, all the columns of the results are fetched with * and stored at their names as reported by the database.
+    - A column name that appears twice in the results, such as id in a join, cannot be stored in a map; use table.* AS &Type.* instead.
+    - In a RETURNING clause a map stores every column returned, including those set by the database such as column defaults, e.g. INSERT INTO person (name) VALUES ($Person.name) RETURNING &M.*.
 
  3. table.* AS &Type.*
     - Does the same as 2 but prepends all columns with the table name.
@@ -86,6 +154,23 @@ SQLair output expressions can take the following formats:
  5. (col_name1, col_name2) AS (&Type.other_col1, &Type.other_col2)
     - Fetches the columns from the database and stores them at other_col1 and other_col2 in Type.
 
+ 6. func(col_name) AS &Type.*
+    - Type must be a map.
+    - Stores the result at the column name reported by the database, e.g. "count(*)" for count(*) in SQLite.
+
+ 7. sql_expression AS &Type.col_name
+    - Fetches the result of any SQL expression, e.g. lower(name) COLLATE NOCASE AS &Person.name.
+    - The expression is passed to the database as written and may contain input expressions.
+    - The expression may be a parenthesised subquery, e.g. (SELECT max(id) FROM person) AS &M.max_id.
+
 Multiple input and output expressions can be written in a single query.
+
+Result columns that are not read into any output, such as those of a
+"SELECT *" written alongside output expressions, are skipped. On a database
+created with [WithStrictColumns] they are an error instead, listing the
+columns, so that SQL and structs that have drifted apart are noticed. The
+[StrictColumns] prepare option overrides the setting of the database for a
+single statement and the [AllowUnmappedColumns] query option skips the columns
+for a single query.
 */
 package sqlair
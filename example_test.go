@@ -73,6 +73,28 @@ func ExampleQuery_Get_withInput() {
 	// Output: Employee: {ID:1 Name:Alastair Team:Juju}
 }
 
+func ExampleQuery_Get_singleValue() {
+	db, err := employeeDB()
+	if err != nil {
+		return
+	}
+
+	stmt, err := sqlair.Prepare("SELECT count(*) AS &M.count FROM employees", sqlair.M{})
+	if err != nil {
+		return
+	}
+
+	var count int
+	err = db.Query(context.Background(), stmt).Get(&count)
+	if err != nil {
+		return
+	}
+
+	fmt.Printf("Employees: %d", count)
+
+	// Output: Employees: 2
+}
+
 func ExampleQuery_GetAll() {
 	type Employee struct {
 		ID   int    `db:"employee_id"`
@@ -0,0 +1,36 @@
+// Copyright 2024 Canonical Ltd.
+// Licensed under Apache 2.0, see LICENCE file for details.
+
+package sqlair
+
+import (
+	"sort"
+
+	"github.com/canonical/sqlair/internal/typeinfo"
+)
+
+// ResetRegisteredTypes removes all the types registered with RegisterType.
+func ResetRegisteredTypes() {
+	typeinfo.ResetRegisteredTypes()
+}
+
+// CachedStmtSQL returns the SQL of the statements in the statement cache of
+// the DB.
+func CachedStmtSQL(db *DB) []string {
+	if db.stmts == nil {
+		return nil
+	}
+	db.stmts.mutex.Lock()
+	defer db.stmts.mutex.Unlock()
+	sqls := db.stmts.stmts.keys()
+	sort.Strings(sqls)
+	return sqls
+}
+
+// InlineStmtCacheLen returns the number of queries with statements in the
+// inline statement cache of the DB.
+func InlineStmtCacheLen(db *DB) int {
+	db.inlineStmtsMutex.Lock()
+	defer db.inlineStmtsMutex.Unlock()
+	return db.inlineStmts.len()
+}
@@ -0,0 +1,213 @@
+// Copyright 2024 Canonical Ltd.
+// Licensed under Apache 2.0, see LICENCE file for details.
+
+package sqlair
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+
+	"github.com/canonical/sqlair/internal/typeinfo"
+)
+
+// PrepareError is returned by [DB.Exec] and [DB.Get] when the query cannot be
+// prepared. It distinguishes errors in the query from errors running it.
+type PrepareError struct {
+	// Query is the query that could not be prepared.
+	Query string
+	// Err is the error returned by [Prepare].
+	Err error
+}
+
+// Error returns the error returned by Prepare.
+func (e *PrepareError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *PrepareError) Unwrap() error {
+	return e.Err
+}
+
+// Exec prepares the query using the types of the input arguments and runs it
+// on the database, disregarding any results. It returns the [sql.Result] of
+// the query.
+//
+// Statements are cached on the DB by their query and argument types, so each
+// combination is only prepared once. The cache holds the statements of the
+// most recently used queries, up to 1000 queries, so queries built
+// dynamically are prepared again each time they are run. If the query cannot
+// be prepared, a [*PrepareError] is returned.
+// [PrepareOption] and [QueryOption] values can be passed amongst the input
+// arguments.
+func (db *DB) Exec(ctx context.Context, query string, inputArgs ...any) (sql.Result, error) {
+	s, inputArgs, err := db.prepareInline(query, nil, inputArgs)
+	if err != nil {
+		return nil, err
+	}
+	var outcome Outcome
+	if err := db.Query(ctx, s, inputArgs...).Get(&outcome); err != nil {
+		return nil, err
+	}
+	return outcome.Result(), nil
+}
+
+// Get prepares the query using the types of the output argument and the input
+// arguments and decodes the first row returned into the output argument. It
+// returns [ErrNoRows] if no results were found.
+//
+// Statements are cached as in [DB.Exec]. If the query cannot be prepared, a
+// [*PrepareError] is returned.
+func (db *DB) Get(ctx context.Context, outputArg any, query string, inputArgs ...any) error {
+	s, inputArgs, err := db.prepareInline(query, outputArg, inputArgs)
+	if err != nil {
+		return err
+	}
+	return db.Query(ctx, s, inputArgs...).Get(outputArg)
+}
+
+// inlineStmtCacheSize is the number of queries the statements of which are
+// cached by DB.Exec and DB.Get.
+const inlineStmtCacheSize = 1000
+
+// inlineKey identifies the statements prepared by DB.Exec and DB.Get from a
+// query with a configuration.
+type inlineKey struct {
+	query  string
+	config prepareKey
+}
+
+// inlineStmt is a statement prepared by DB.Exec or DB.Get along with the
+// argument types it was prepared with.
+type inlineStmt struct {
+	keys []sampleKey
+	stmt *Statement
+}
+
+// sampleKey identifies the type sample generated from an argument.
+type sampleKey struct {
+	name string
+	t    reflect.Type
+}
+
+// prepareInline returns the statement for the query prepared with the types of
+// the arguments, from the cache if possible. It also returns the input
+// arguments with any PrepareOptions removed.
+func (db *DB) prepareInline(query string, outputArg any, inputArgs []any) (*Statement, []any, error) {
+	pc, inputArgs := extractPrepareOptions(inputArgs)
+	pc = db.config.prepareConfig(pc)
+	args := inputArgs
+	if outputArg != nil {
+		args = append(args[:len(args):len(args)], outputArg)
+	}
+
+	var samples []any
+	var keys []sampleKey
+	seen := map[sampleKey]bool{}
+	for _, arg := range args {
+		if _, ok := arg.(QueryOption); ok {
+			continue
+		}
+		sample, key := typeSample(arg)
+		if seen[key] || isLooseValue(key) {
+			continue
+		}
+		seen[key] = true
+		samples = append(samples, sample)
+		keys = append(keys, key)
+	}
+
+	// Statements prepared with configurations that cannot be compared are
+	// not cached.
+	config, cacheable := pc.key()
+	ik := inlineKey{query: query, config: config}
+	if cacheable {
+		if s := db.cachedInlineStmt(ik, keys); s != nil {
+			return s, inputArgs, nil
+		}
+	}
+	s, err := prepare(query, pc, samples)
+	if err != nil {
+		return nil, nil, &PrepareError{Query: query, Err: err}
+	}
+	if !cacheable {
+		return s, inputArgs, nil
+	}
+
+	db.inlineStmtsMutex.Lock()
+	stmts, _ := db.inlineStmts.get(ik)
+	db.inlineStmts.add(ik, append(stmts[:len(stmts):len(stmts)], inlineStmt{keys: keys, stmt: s}))
+	db.inlineStmtsMutex.Unlock()
+	return s, inputArgs, nil
+}
+
+// cachedInlineStmt returns the cached statement for the query and
+// configuration with the given argument types, or nil if there is none.
+func (db *DB) cachedInlineStmt(ik inlineKey, keys []sampleKey) *Statement {
+	db.inlineStmtsMutex.Lock()
+	defer db.inlineStmtsMutex.Unlock()
+	stmts, _ := db.inlineStmts.get(ik)
+	for _, is := range stmts {
+		if sameSampleKeys(is.keys, keys) {
+			return is.stmt
+		}
+	}
+	return nil
+}
+
+func sameSampleKeys(a, b []sampleKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var likePatternType = reflect.TypeOf(LikePattern{})
+
+// isLooseValue returns true if the argument the key was generated from is a
+// loose value for a positional input, such as an int or a string, rather than
+// a value of a type used in the query.
+func isLooseValue(key sampleKey) bool {
+	switch {
+	case key.name != "":
+		return false
+	case key.t == nil, key.t == likePatternType:
+		return true
+	}
+	switch key.t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice:
+		return false
+	}
+	return true
+}
+
+// typeSample generates a type sample for Prepare from an input or output
+// argument. Pointers are followed and unnamed slices, as used in bulk inserts,
+// are replaced by their element type.
+func typeSample(arg any) (any, sampleKey) {
+	if na, ok := arg.(typeinfo.NamedArg); ok {
+		sample, key := typeSample(na.Value)
+		key.name = na.Name
+		return Named(na.Name, sample), key
+	}
+	if arg == nil {
+		return nil, sampleKey{}
+	}
+	t := reflect.TypeOf(arg)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice && t.Name() == "" {
+		t = t.Elem()
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+	}
+	return reflect.Zero(t).Interface(), sampleKey{t: t}
+}
@@ -5,6 +5,9 @@ package expr
 
 import (
 	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
 
 	"github.com/canonical/sqlair/internal/typeinfo"
 )
@@ -13,6 +16,8 @@ import (
 // a query.
 type typedExpr interface {
 	addToQuery(*queryBuilder, typeinfo.TypeToValue) error
+	// fingerprint adds the expression to the fingerprint of the query.
+	fingerprint(*fingerprintWriter)
 }
 
 // TypeBoundExpr represents a SQLair statement bound to concrete Go types. It
@@ -20,40 +25,273 @@ type typedExpr interface {
 // the SQLair query.
 type TypeBoundExpr struct {
 	typedExprs []typedExpr
+	// styleChecks caches the result of checkStyle for each ParamStyle the
+	// inputs are bound with.
+	styleChecks sync.Map
+}
+
+// styleCheck holds the result of checking a TypeBoundExpr against a
+// ParamStyle.
+type styleCheck struct {
+	err error
+}
+
+// Inputs returns the locators of the Go values used as inputs in the query.
+// Each value is returned once, in the order it first appears.
+func (tbe *TypeBoundExpr) Inputs() []typeinfo.Input {
+	var inputs []typeinfo.Input
+	seen := map[string]bool{}
+	add := func(input typeinfo.Input) {
+		if !seen[input.Identifier()] {
+			seen[input.Identifier()] = true
+			inputs = append(inputs, input)
+		}
+	}
+	var addExprs func([]typedExpr)
+	addExprs = func(tes []typedExpr) {
+		for _, te := range tes {
+			switch te := te.(type) {
+			case *typedInputExpr:
+				add(te.input)
+			case *typedInsertExpr:
+				for _, c := range te.insertColumns {
+					if ic, ok := c.(insertColumn); ok {
+						add(ic.input)
+					}
+				}
+			case *typedOutputExpr:
+				for _, oc := range te.outputColumns {
+					addExprs(oc.exprs)
+				}
+			}
+		}
+	}
+	addExprs(tbe.typedExprs)
+	return inputs
+}
+
+// Outputs returns the locators of the Go values that the query results are
+// scanned into, in the order they appear.
+func (tbe *TypeBoundExpr) Outputs() []typeinfo.Output {
+	var outputs []typeinfo.Output
+	for _, te := range tbe.typedExprs {
+		if toe, ok := te.(*typedOutputExpr); ok && !toe.compound {
+			for _, oc := range toe.outputColumns {
+				outputs = append(outputs, oc.output)
+			}
+		}
+	}
+	return outputs
+}
+
+// ParamStyle specifies how query parameter placeholders are written in the
+// generated SQL.
+type ParamStyle struct {
+	// Prefix is written before the name of each named parameter, e.g. "@"
+	// for the placeholder "@sqlair_0".
+	Prefix string
+	// Positional is true if the placeholders are written as "?" and the
+	// parameters are passed to the database in order rather than by name.
+	Positional bool
+	// ReuseParams is true if an input member that appears more than once in
+	// the query is passed to the database as a single named parameter. It has
+	// no effect on positional parameters.
+	ReuseParams bool
+	// AllowUnusedArgs is true if arguments that are not used by the query
+	// are ignored rather than rejected.
+	AllowUnusedArgs bool
+	// Marker is the name that the named parameters and output marker
+	// columns start with, e.g. "myapp" for the placeholder "@myapp_0" and
+	// the column "_myapp_0". It is "sqlair" if empty.
+	Marker string
+}
+
+// DefaultParamStyle is the parameter style used by BindInputs.
+var DefaultParamStyle = ParamStyle{Prefix: "@"}
+
+// placeholderPrefix returns the string that starts every placeholder written
+// in this style.
+func (ps ParamStyle) placeholderPrefix() string {
+	if ps.Positional {
+		return "?"
+	}
+	return ps.Prefix + ps.inputPrefix()
+}
+
+// marker returns the name that the named parameters and output marker columns
+// start with in this style.
+func (ps ParamStyle) marker() string {
+	if ps.Marker == "" {
+		return defaultMarker
+	}
+	return ps.Marker
+}
+
+// inputPrefix returns the prefix of the names of the named parameters, e.g.
+// "sqlair_".
+func (ps ParamStyle) inputPrefix() string {
+	return ps.marker() + "_"
+}
+
+// outputPrefix returns the prefix of the names of the output marker columns,
+// e.g. "_sqlair_".
+func (ps ParamStyle) outputPrefix() string {
+	return "_" + ps.marker() + "_"
+}
+
+// CheckMarker returns an error if the marker is not a valid name for the
+// query parameters and output marker columns. It must be written in lower case
+// as some databases fold the case of the names of columns.
+func CheckMarker(marker string) error {
+	for i, c := range marker {
+		if !(c >= 'a' && c <= 'z' || c == '_' || i > 0 && c >= '0' && c <= '9') {
+			return fmt.Errorf("invalid marker %q: must start with a lower case letter or underscore and contain only lower case letters, digits and underscores", marker)
+		}
+	}
+	return nil
 }
 
 // BindInputs takes the SQLair input arguments and returns the PrimedQuery ready
 // for use with the database.
 func (tbe *TypeBoundExpr) BindInputs(args ...any) (pq *PrimedQuery, err error) {
+	return tbe.BindInputsWithStyle(DefaultParamStyle, args...)
+}
+
+// BindInputsWithStyle is the same as BindInputs except that the query
+// parameter placeholders are written in the given style.
+func (tbe *TypeBoundExpr) BindInputsWithStyle(style ParamStyle, args ...any) (pq *PrimedQuery, err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("invalid input parameter: %s", err)
 		}
 	}()
 
-	typeToValue, err := typeinfo.ValidateInputs(args)
+	if err := tbe.checkStyle(style); err != nil {
+		return nil, err
+	}
+
+	args, positionalArgs := tbe.splitPositionalArgs(args)
+	var argTypes []reflect.Type
+	for _, input := range tbe.Inputs() {
+		argTypes = append(argTypes, input.ArgType())
+	}
+	typeToValue, err := typeinfo.ValidateInputs(args, argTypes)
 	if err != nil {
 		return nil, err
 	}
 
-	qb := newQueryBuilder()
+	qb := newQueryBuilder(style)
+	qb.setPositionalArgs(positionalArgs)
 	for _, te := range tbe.typedExprs {
 		if err := te.addToQuery(qb, typeToValue); err != nil {
 			return nil, err
 		}
 	}
 
-	if err := qb.checkAllArgsUsed(typeToValue); err != nil {
-		return nil, err
+	if !style.AllowUnusedArgs {
+		if err := qb.checkAllArgsUsed(typeToValue); err != nil {
+			return nil, err
+		}
+	}
+
+	return &PrimedQuery{outputs: qb.outputs, outputPrefix: style.outputPrefix(), sql: qb.sqlBuilder.getSQL(), params: qb.namedInputs, redacted: qb.redactedInputs}, nil
+}
+
+// splitPositionalArgs separates the loose arguments used by positional
+// inputs from the arguments whose types are used in the query. If the query
+// has no positional inputs then all the arguments are returned as typed
+// arguments.
+func (tbe *TypeBoundExpr) splitPositionalArgs(args []any) (typedArgs []any, positionalArgs []any) {
+	hasPositional := false
+	for _, te := range tbe.typedExprs {
+		if _, ok := te.(*typedPositionalInputExpr); ok {
+			hasPositional = true
+			break
+		}
+	}
+	if !hasPositional {
+		return args, nil
+	}
+
+	argTypes := map[reflect.Type]bool{}
+	for _, input := range tbe.Inputs() {
+		argTypes[typeinfo.BaseType(input.ArgType())] = true
+	}
+	for _, arg := range args {
+		if _, ok := arg.(typeinfo.NamedArg); ok {
+			typedArgs = append(typedArgs, arg)
+			continue
+		}
+		// Bulk inserts take slices of the argument type.
+		t := reflect.TypeOf(arg)
+		for t != nil && t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t != nil && t.Kind() == reflect.Slice && t.Name() == "" {
+			t = t.Elem()
+			for t.Kind() == reflect.Pointer {
+				t = t.Elem()
+			}
+		}
+		if t != nil && argTypes[t] {
+			typedArgs = append(typedArgs, arg)
+		} else {
+			positionalArgs = append(positionalArgs, arg)
+		}
+	}
+	return typedArgs, positionalArgs
+}
+
+// checkStyle returns an error if the inputs of the expression cannot be bound
+// with the given style. The SQL of the expression is only scanned the first
+// time each style is checked.
+func (tbe *TypeBoundExpr) checkStyle(style ParamStyle) error {
+	if check, ok := tbe.styleChecks.Load(style); ok {
+		return check.(styleCheck).err
 	}
+	err := CheckMarker(style.Marker)
+	if err == nil {
+		err = tbe.checkPlaceholderCollision(style)
+	}
+	tbe.styleChecks.Store(style, styleCheck{err: err})
+	return err
+}
 
-	return &PrimedQuery{outputs: qb.outputs, sql: qb.sqlBuilder.getSQL(), params: qb.namedInputs}, nil
+// checkPlaceholderCollision returns an error if the SQL outside of the
+// SQLair expressions contains text that would be mistaken for a placeholder
+// written in the given style. In the positional style any "?" outside of
+// quotes is rejected, including the JSON operators "?", "?|" and "?&" of
+// PostgreSQL.
+func (tbe *TypeBoundExpr) checkPlaceholderCollision(style ParamStyle) error {
+	prefix := style.placeholderPrefix()
+	for _, te := range tbe.typedExprs {
+		if b, ok := te.(*bypass); ok && containsOutsideQuotes(b.chunk, prefix) {
+			return fmt.Errorf("query contains %q which clashes with the query parameter placeholders", prefix)
+		}
+	}
+	if style.marker() == defaultMarker {
+		// Aliases with the default prefix are rejected when the types are
+		// bound.
+		return nil
+	}
+	for _, te := range tbe.typedExprs {
+		if b, ok := te.(*bypass); ok {
+			if name, ok := findMarkerPrefix(b.chunk, style.outputPrefix()); ok {
+				return fmt.Errorf("column alias %q uses reserved prefix %s", name, style.outputPrefix())
+			}
+		}
+	}
+	return nil
 }
 
 // typedInputExpr stores information about a Go value to use as a standalone query
 // input.
 type typedInputExpr struct {
 	input typeinfo.Input
+	// withoutDefault is true if the default option of the field of the input
+	// has been dropped. The parameter is then not shared with inputs of the
+	// same field that use the default.
+	withoutDefault bool
 }
 
 // addToQuery adds the typed input expressions to the query builder.
@@ -70,15 +308,95 @@ func (te *typedInputExpr) addToQuery(qb *queryBuilder, typeToValue typeinfo.Type
 	}
 	qb.markArgUsed(params.ArgTypeUsed)
 
-	qb.addInputs(params.Vals)
+	if len(params.Vals) == 1 {
+		val, like := likeParam(params.Vals[0])
+		identifier := te.input.Identifier()
+		if te.withoutDefault {
+			identifier += " without default"
+		}
+		qb.addReusableInput(identifier, redactParams([]any{val}, params.Redact)[0])
+		if like {
+			qb.sqlBuilder.write(likeEscapeClause)
+		}
+		return nil
+	}
+	qb.addInputs(redactParams(params.Vals, params.Redact))
 	return nil
 }
 
+// redactedParam wraps a query parameter whose value must not be shown in
+// rendered queries. It is unwrapped when it is added to the query.
+type redactedParam struct {
+	val any
+}
+
+// redactParams wraps the values in redactedParams if redact is true.
+func redactParams(vals []any, redact bool) []any {
+	if !redact {
+		return vals
+	}
+	redacted := make([]any, len(vals))
+	for i, val := range vals {
+		redacted[i] = redactedParam{val: val}
+	}
+	return redacted
+}
+
+// likePattern is implemented by the LIKE pattern values of the sqlair
+// package. The pattern has its wildcards escaped with a backslash.
+type likePattern interface {
+	EscapedPattern() string
+}
+
+// likeEscapeClause is written after the placeholder of a LIKE pattern.
+const likeEscapeClause = ` ESCAPE '\'`
+
+// likeParam returns the query parameter for val and true if val is a LIKE
+// pattern, in which case the parameter is the escaped pattern.
+func likeParam(val any) (any, bool) {
+	if lp, ok := val.(likePattern); ok {
+		return lp.EscapedPattern(), true
+	}
+	return val, false
+}
+
+// fingerprint adds the input to the fingerprint.
+func (te *typedInputExpr) fingerprint(fw *fingerprintWriter) {
+	fw.write("input", te.input.Identifier())
+}
+
+// typedPositionalInputExpr stores the position of the loose input argument
+// to use as a query input.
+type typedPositionalInputExpr struct {
+	position int
+}
+
+// addToQuery adds the positional input to the query builder.
+func (te *typedPositionalInputExpr) addToQuery(qb *queryBuilder, _ typeinfo.TypeToValue) error {
+	val, err := qb.positionalArg(te.position)
+	if err != nil {
+		return err
+	}
+	val, like := likeParam(val)
+	qb.addInputs([]any{val})
+	if like {
+		qb.sqlBuilder.write(likeEscapeClause)
+	}
+	return nil
+}
+
+// fingerprint adds the position of the input to the fingerprint.
+func (te *typedPositionalInputExpr) fingerprint(fw *fingerprintWriter) {
+	fw.write("positional input", strconv.Itoa(te.position))
+}
+
 // typedColumn represents a column and input locator in an insert statement.
 type typedColumn interface {
 	// bindInputs binds a concrete value to a typedColumn to generate a
 	// boundInsertColumn.
 	bindInputs(tv typeinfo.TypeToValue, ia *inputAssigner) (*boundInsertColumn, error)
+	// fingerprint adds the column to the fingerprint.
+	fingerprint(fw *fingerprintWriter)
 }
 
 // typedInsertExpr stores information about the Go values to use as inputs inside
@@ -121,24 +439,53 @@ func (te *typedInsertExpr) addToQuery(qb *queryBuilder, typeToValue typeinfo.Typ
 	return qb.addInsert(boundColumns, numRows)
 }
 
+// fingerprint adds the insert columns to the fingerprint.
+func (te *typedInsertExpr) fingerprint(fw *fingerprintWriter) {
+	fw.write("insert", strconv.Itoa(len(te.insertColumns)))
+	for _, ic := range te.insertColumns {
+		ic.fingerprint(fw)
+	}
+}
+
 // typedOutputExpr contains the columns to fetch from the database and
 // information about the Go values to read the query results into.
 type typedOutputExpr struct {
 	outputColumns []outputColumn
+	// compound is true if the expression is in a SELECT after the first in a
+	// compound SELECT statement. The results are named after the columns of
+	// the first SELECT so the outputs are not scanned into.
+	compound bool
+	// statement is the index of the statement containing the expression in
+	// a query made up of several statements.
+	statement int
 }
 
 // addToQuery adds the typed output expressions to the query builder.
-func (te *typedOutputExpr) addToQuery(qb *queryBuilder, _ typeinfo.TypeToValue) error {
-	var columns []string
-	var outputs []typeinfo.Output
-	for _, oc := range te.outputColumns {
-		outputs = append(outputs, oc.output)
-		columns = append(columns, oc.column)
+func (te *typedOutputExpr) addToQuery(qb *queryBuilder, typeToValue typeinfo.TypeToValue) error {
+	for i, oc := range te.outputColumns {
+		if i > 0 {
+			qb.sqlBuilder.write(", ")
+		}
+		if err := qb.addOutput(oc, typeToValue, !te.compound, te.statement); err != nil {
+			return err
+		}
 	}
-	qb.addOutput(columns, outputs)
 	return nil
 }
 
+// fingerprint adds the output columns to the fingerprint.
+func (te *typedOutputExpr) fingerprint(fw *fingerprintWriter) {
+	fields := []string{}
+	for _, oc := range te.outputColumns {
+		column := oc.column
+		if oc.exprs != nil {
+			column = normalizeWhitespace(column)
+		}
+		fields = append(fields, column, oc.output.Identifier())
+	}
+	fw.write("output", fields...)
+}
+
 // insertColumn stores information about a single column of a row in an insert
 // statement.
 type insertColumn struct {
@@ -180,18 +527,23 @@ func (ic insertColumn) bindInputs(tv typeinfo.TypeToValue, ia *inputAssigner) (*
 		firstInputNum = ia.assignInputs(len(params.Vals))
 	}
 	bc := &boundInsertColumn{
-		vals:          params.Vals,
+		vals:          redactParams(params.Vals, params.Redact),
 		firstInputNum: firstInputNum,
 		omit:          params.Omit,
 		bulk:          params.Bulk,
 		argType:       params.ArgTypeUsed,
-		inputName:     ic.input.ArgType().Name(),
+		inputName:     typeinfo.PrettyTypeName(ic.input.ArgType()),
 		literal:       "",
 		column:        ic.column,
 	}
 	return bc, nil
 }
 
+// fingerprint adds the insert column to the fingerprint.
+func (ic insertColumn) fingerprint(fw *fingerprintWriter) {
+	fw.write("insertColumn", ic.column, ic.input.Identifier(), strconv.FormatBool(ic.explicit))
+}
+
 // literalColumn represents a column in an insert statement populated with a
 // literal value.
 type literalColumn struct {
@@ -215,6 +567,11 @@ func (lc literalColumn) bindInputs(_ typeinfo.TypeToValue, _ *inputAssigner) (*b
 	return bc, nil
 }
 
+// fingerprint adds the literal column to the fingerprint.
+func (lc literalColumn) fingerprint(fw *fingerprintWriter) {
+	fw.write("literalColumn", lc.column, lc.literal)
+}
+
 // newLiteralColumn builds a literal column.
 func newLiteralColumn(column, literal string) literalColumn {
 	return literalColumn{
@@ -228,6 +585,17 @@ func newLiteralColumn(column, literal string) literalColumn {
 type outputColumn struct {
 	output typeinfo.Output
 	column string
+	// exprs are the typed expressions that make up a column containing
+	// input expressions, such as a CASE expression. If set, they are added to
+	// the query in place of column.
+	exprs []typedExpr
+	// sourceInBypass is true if the column is the SQL expression written
+	// before the output in the query. Only the alias of the column is
+	// added to the query.
+	sourceInBypass bool
+	// allColumns is true if the output is read from all the result columns
+	// of an asterisk, such as "&M.*".
+	allColumns bool
 }
 
 // newOutputColumn generates an output column with the correct column string to
@@ -7,6 +7,8 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/canonical/sqlair/internal/typeinfo"
 )
@@ -14,7 +16,7 @@ import (
 // ParsedExpr is the AST representation of SQLair query. It contains only
 // information encoded in the SQLair query string.
 type ParsedExpr struct {
-	exprs []expression
+	ir *irProgram
 }
 
 // String returns a textual representation of the AST contained in the
@@ -22,41 +24,194 @@ type ParsedExpr struct {
 func (pe *ParsedExpr) String() string {
 	var out bytes.Buffer
 	out.WriteString("[")
-	for i, p := range pe.exprs {
+	for i, n := range pe.ir.nodes {
 		if i > 0 {
 			out.WriteString(" ")
 		}
-		out.WriteString(p.String())
+		out.WriteString(n.String())
 	}
 	out.WriteString("]")
 	return out.String()
 }
 
+// BindOptions configures how types are bound to the SQLair expressions of a
+// query.
+type BindOptions struct {
+	// ColumnMappers holds the functions that generate the columns of the
+	// members of types selected with an asterisk, keyed by the name of the
+	// type in the query.
+	ColumnMappers map[string]typeinfo.ColumnMapper
+	// Scanners holds the functions that set members of struct types from
+	// result columns, keyed by the name of the type in the query and then by
+	// the member.
+	Scanners map[string]map[string]typeinfo.MemberScanner
+	// FieldNames is true if struct fields with no db tag are referenced by
+	// the snake case of their field names.
+	FieldNames bool
+	// DeclarationOrder is true if the members of struct types selected with
+	// an asterisk are ordered as their fields are declared rather than
+	// sorted by tag.
+	DeclarationOrder bool
+}
+
 // BindTypes takes samples of all types mentioned in the SQLair expressions of
 // the query. The expressions are checked for validity and required information
 // is generated from the types.
 func (pe *ParsedExpr) BindTypes(args ...any) (tbe *TypeBoundExpr, err error) {
+	return pe.BindTypesWithOptions(BindOptions{}, args...)
+}
+
+// BindTypesWithOptions is the same as BindTypes except that the binding is
+// configured by opts.
+func (pe *ParsedExpr) BindTypesWithOptions(opts BindOptions, args ...any) (tbe *TypeBoundExpr, err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("cannot prepare statement: %s", err)
 		}
 	}()
 
+	exprs, err := pe.ir.expressions()
+	if err != nil {
+		return nil, err
+	}
 	argInfo, err := typeinfo.GenerateArgInfo(args)
 	if err != nil {
 		return nil, err
 	}
+	if err := opts.apply(argInfo); err != nil {
+		return nil, err
+	}
+	return bindExprs(exprs, argInfo)
+}
+
+// BindReflectTypes is the same as BindTypes except that it takes the types
+// mentioned in the SQLair expressions directly rather than samples of them.
+func (pe *ParsedExpr) BindReflectTypes(types []reflect.Type) (tbe *TypeBoundExpr, err error) {
+	return pe.BindReflectTypesWithOptions(BindOptions{}, types)
+}
+
+// BindReflectTypesWithOptions is the same as BindReflectTypes except that the
+// binding is configured by opts.
+func (pe *ParsedExpr) BindReflectTypesWithOptions(opts BindOptions, types []reflect.Type) (tbe *TypeBoundExpr, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("cannot prepare statement: %s", err)
+		}
+	}()
+
+	exprs, err := pe.ir.expressions()
+	if err != nil {
+		return nil, err
+	}
+	argInfo, err := typeinfo.GenerateArgInfoFromTypes(types)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.apply(argInfo); err != nil {
+		return nil, err
+	}
+	return bindExprs(exprs, argInfo)
+}
+
+// apply sets the options on the argument types.
+func (opts BindOptions) apply(argInfo typeinfo.ArgInfo) error {
+	if opts.FieldNames {
+		if err := argInfo.UseFieldNames(); err != nil {
+			return err
+		}
+	}
+	if opts.DeclarationOrder {
+		argInfo.UseDeclarationOrder()
+	}
+	// Sort for consistent error messages.
+	typeNames := make([]string, 0, len(opts.ColumnMappers))
+	for typeName := range opts.ColumnMappers {
+		typeNames = append(typeNames, typeName)
+	}
+	sort.Strings(typeNames)
+	for _, typeName := range typeNames {
+		if err := argInfo.MapColumns(typeName, opts.ColumnMappers[typeName]); err != nil {
+			return err
+		}
+	}
+	scannerTypeNames := make([]string, 0, len(opts.Scanners))
+	for typeName := range opts.Scanners {
+		scannerTypeNames = append(scannerTypeNames, typeName)
+	}
+	sort.Strings(scannerTypeNames)
+	for _, typeName := range scannerTypeNames {
+		members := make([]string, 0, len(opts.Scanners[typeName]))
+		for member := range opts.Scanners[typeName] {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		for _, member := range members {
+			if err := argInfo.RegisterScanner(typeName, member, opts.Scanners[typeName][member]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
+// bindExprs binds the types in argInfo to the expressions.
+func bindExprs(exprs []expression, argInfo typeinfo.ArgInfo) (*TypeBoundExpr, error) {
 	// Bind types to each expression.
 	var typedExprs []typedExpr
 	outputUsed := map[string]bool{}
-	for _, expr := range pe.exprs {
+	// preceding is the SQL of the bypass parts before the current expression.
+	var preceding strings.Builder
+	// depth is the depth of parentheses at the end of preceding.
+	depth := 0
+	// compound is true once the first SELECT of a compound SELECT statement
+	// has ended. Each SELECT can contain the same outputs.
+	compound := false
+	// firstOutputs is true if the first SELECT contains outputs.
+	firstOutputs := false
+	// statement is the index of the current statement in a query made up of
+	// several statements. Each statement returns its own result set so can
+	// contain the same outputs.
+	statement := 0
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case *bypass:
+			if name, ok := findMarkerPrefix(e.chunk, markerPrefix); ok {
+				return nil, fmt.Errorf("column alias %q uses reserved prefix %s", name, markerPrefix)
+			}
+			preceding.WriteString(e.chunk)
+			depth = scanWords(e.chunk, depth, func(word string, depth int) {
+				if depth != 0 {
+					return
+				}
+				switch {
+				case word == ";":
+					statement++
+					compound = false
+					firstOutputs = false
+					outputUsed = map[string]bool{}
+				case compoundOperators[word]:
+					compound = true
+					outputUsed = map[string]bool{}
+				}
+			})
+		case *asteriskInsertExpr, *columnsInsertExpr, *basicInsertExpr:
+			if kw := lastStatementKeyword(preceding.String()); kw != "INSERT" && kw != "REPLACE" {
+				return nil, fmt.Errorf("input expression: columns and VALUES are only valid in an INSERT statement: %s", expr.irNode().raw)
+			}
+		}
+
 		typedExpr, err := expr.bindTypes(argInfo)
 		if err != nil {
 			return nil, err
 		}
 
 		if toe, ok := typedExpr.(*typedOutputExpr); ok {
+			if compound && !firstOutputs {
+				return nil, fmt.Errorf("output expression: outputs of a compound SELECT must be in the first SELECT: %s", expr.irNode().raw)
+			}
+			firstOutputs = firstOutputs || !compound
+			toe.compound = compound
+			toe.statement = statement
 			for _, oc := range toe.outputColumns {
 				if ok := outputUsed[oc.output.Identifier()]; ok {
 					return nil, fmt.Errorf("%s appears more than once in output expressions", oc.output.Desc())
@@ -70,6 +225,85 @@ func (pe *ParsedExpr) BindTypes(args ...any) (tbe *TypeBoundExpr, err error) {
 	return &TypeBoundExpr{typedExprs: typedExprs}, nil
 }
 
+// statementKeywords are the keywords that start the different kinds of SQL
+// statement.
+var statementKeywords = map[string]bool{
+	"SELECT":  true,
+	"INSERT":  true,
+	"REPLACE": true,
+	"UPDATE":  true,
+	"DELETE":  true,
+}
+
+// compoundOperators are the keywords that join the SELECT statements of a
+// compound SELECT statement.
+var compoundOperators = map[string]bool{
+	"UNION":     true,
+	"INTERSECT": true,
+	"EXCEPT":    true,
+}
+
+// lastStatementKeyword returns the last keyword in the SQL that starts a
+// statement. It returns an empty string if there is none.
+func lastStatementKeyword(sql string) string {
+	last := ""
+	scanWords(sql, 0, func(word string, _ int) {
+		if statementKeywords[word] {
+			last = word
+		}
+	})
+	return last
+}
+
+// scanWords calls fn with each word of the SQL in upper case, and with ";" for
+// each semicolon, along with the depth of parentheses it is found at. Quoted strings, quoted identifiers and
+// comments are ignored. The depth at the start of the SQL is passed in and
+// the depth at the end is returned.
+func scanWords(sql string, depth int, fn func(word string, depth int)) int {
+	for i := 0; i < len(sql); i++ {
+		switch {
+		case sql[i] == '\'' || sql[i] == '"' || sql[i] == '`':
+			end := strings.IndexByte(sql[i+1:], sql[i])
+			if end == -1 {
+				return depth
+			}
+			i += end + 1
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end == -1 {
+				return depth
+			}
+			i += end
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end == -1 {
+				return depth
+			}
+			i += end + 3
+		case sql[i] == '(':
+			depth++
+		case sql[i] == ')':
+			depth--
+		case sql[i] == ';':
+			fn(";", depth)
+		case isNameByte(sql[i]):
+			start := i
+			for i < len(sql) && isNameByte(sql[i]) {
+				i++
+			}
+			fn(strings.ToUpper(sql[start:i]), depth)
+			i--
+		}
+	}
+	return depth
+}
+
+// isNameByte returns true if the byte can be part of a SQL keyword or
+// identifier.
+func isNameByte(b byte) bool {
+	return b == '_' || b >= 0x80 || ('0' <= b && b <= '9') || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
+
 // expression represents a parsed node of the SQLair query's AST.
 type expression interface {
 	// String returns a text representation for debugging and testing purposes.
@@ -78,6 +312,10 @@ type expression interface {
 	// bindTypes binds the types to the expression to generate either a
 	// *typedInputExpr or *typedOutputExpr.
 	bindTypes(typeinfo.ArgInfo) (typedExpr, error)
+
+	// irNode returns the IR node for the expression. The span of the node is
+	// set by the parser.
+	irNode() irNode
 }
 
 // bypass represents part of the expression that we want to pass to the backend
@@ -102,11 +340,22 @@ func (b *bypass) addToQuery(qb *queryBuilder, _ typeinfo.TypeToValue) error {
 	return qb.addBypass(b)
 }
 
+// fingerprint adds the bypass part with normalised whitespace to the
+// fingerprint. Bypass parts made up of only whitespace are left out.
+func (b *bypass) fingerprint(fw *fingerprintWriter) {
+	if chunk := normalizeWhitespace(b.chunk); chunk != "" {
+		fw.write("bypass", chunk)
+	}
+}
+
 // memberInputExpr is an input expression of the form "$Type.member" which
 // represents a query parameter contained in a member of a type.
 type memberInputExpr struct {
 	raw string
 	ma  memberAccessor
+	// assignment is true if the value of the input is assigned to a column,
+	// e.g. "SET col = $Type.member".
+	assignment bool
 }
 
 // String returns a text representation for debugging and testing purposes.
@@ -121,6 +370,13 @@ func (e *memberInputExpr) bindTypes(argInfo typeinfo.ArgInfo) (typedExpr, error)
 	if err != nil {
 		return nil, fmt.Errorf("input expression: %s: %s", err, e.raw)
 	}
+	// The default option of a field only applies where its value is stored,
+	// not where it is compared, e.g. in a WHERE clause.
+	if !e.assignment {
+		if without, ok := typeinfo.WithoutDefault(input); ok {
+			return &typedInputExpr{input: without, withoutDefault: true}, nil
+		}
+	}
 	return &typedInputExpr{input: input}, nil
 }
 
@@ -139,7 +395,9 @@ func (e *asteriskInsertExpr) String() string {
 }
 
 // bindTypes generates a *typedInsertExpr containing type information about the
-// asteriskInsertExpr.
+// asteriskInsertExpr. The columns of asterisk types are generated first and
+// the explicit columns are appended after them. It is an error for a column to
+// be provided by more than one source.
 func (e *asteriskInsertExpr) bindTypes(argInfo typeinfo.ArgInfo) (tie typedExpr, err error) {
 	defer func() {
 		if err != nil {
@@ -147,7 +405,19 @@ func (e *asteriskInsertExpr) bindTypes(argInfo typeinfo.ArgInfo) (tie typedExpr,
 		}
 	}()
 
-	var cols []typedColumn
+	// The columns generated from asterisk types come first, followed by the
+	// explicit columns.
+	var starCols, explicitCols []typedColumn
+	// colSource records the source that provides each column so that columns
+	// provided twice can be reported.
+	colSource := map[string]memberAccessor{}
+	addColumn := func(column string, source memberAccessor) error {
+		if prev, ok := colSource[column]; ok {
+			return fmt.Errorf("column %q is provided by both %s and %s", column, prev, source)
+		}
+		colSource[column] = source
+		return nil
+	}
 	for _, source := range e.sources {
 		if source.memberName == "*" {
 			inputs, tags, err := argInfo.AllStructInputs(source.typeName)
@@ -155,19 +425,26 @@ func (e *asteriskInsertExpr) bindTypes(argInfo typeinfo.ArgInfo) (tie typedExpr,
 				return nil, err
 			}
 			for i, input := range inputs {
-				c := newInsertColumn(input, tags[i], false)
-				cols = append(cols, c)
+				if err := addColumn(tags[i], source); err != nil {
+					return nil, err
+				}
+				starCols = append(starCols, newInsertColumn(input, tags[i], false))
 			}
-		} else {
+		}
+	}
+	for _, source := range e.sources {
+		if source.memberName != "*" {
 			input, err := argInfo.InputMember(source.typeName, source.memberName)
 			if err != nil {
 				return nil, err
 			}
-			c := newInsertColumn(input, source.memberName, true)
-			cols = append(cols, c)
+			if err := addColumn(source.memberName, source); err != nil {
+				return nil, err
+			}
+			explicitCols = append(explicitCols, newInsertColumn(input, source.memberName, true))
 		}
 	}
-	return &typedInsertExpr{insertColumns: cols}, nil
+	return &typedInsertExpr{insertColumns: append(starCols, explicitCols...)}, nil
 }
 
 // columnsInsertExpr is an input expression occurring within an INSERT statement
@@ -252,6 +529,14 @@ func (e *columnsInsertExpr) bindTypes(argInfo typeinfo.ArgInfo) (tie typedExpr,
 			}
 			input = []typeinfo.Input{inp}
 		} else if !ok {
+			// A struct with the column as a read only member does not
+			// provide it.
+			for _, source := range e.sources {
+				if source.memberName == "*" && argInfo.IsReadOnly(source.typeName, columnStr) {
+					_, err := argInfo.InputMember(source.typeName, columnStr)
+					return nil, err
+				}
+			}
 			return nil, fmt.Errorf("missing type that provides column %q", columnStr)
 		}
 		if len(input) > 1 {
@@ -321,7 +606,26 @@ func (e *sliceInputExpr) bindTypes(argInfo typeinfo.ArgInfo) (typedExpr, error)
 	if err != nil {
 		return nil, fmt.Errorf("input expression: %s: %s", err, e.raw)
 	}
-	return &typedInputExpr{input}, nil
+	return &typedInputExpr{input: input}, nil
+}
+
+// positionalInputExpr is an input expression of the form "$1" which
+// represents a query parameter passed as the loose input argument at the
+// position.
+type positionalInputExpr struct {
+	raw      string
+	position int
+}
+
+// String returns a text representation for debugging and testing purposes.
+func (e *positionalInputExpr) String() string {
+	return fmt.Sprintf("Input[$%d]", e.position)
+}
+
+// bindTypes generates a *typedPositionalInputExpr. Positional inputs do not
+// have a type.
+func (e *positionalInputExpr) bindTypes(typeinfo.ArgInfo) (typedExpr, error) {
+	return &typedPositionalInputExpr{position: e.position}, nil
 }
 
 // outputExpr represents columns to be read from the database and Go values to
@@ -329,7 +633,12 @@ func (e *sliceInputExpr) bindTypes(argInfo typeinfo.ArgInfo) (typedExpr, error)
 type outputExpr struct {
 	sourceColumns []columnAccessor
 	targetTypes   []memberAccessor
-	raw           string
+	// parentheses is true if the columns are enclosed in parentheses.
+	parentheses bool
+	// sourceInBypass is true if the source of the output is the SQL
+	// expression in the bypass chunk before it.
+	sourceInBypass bool
+	raw            string
 }
 
 // String returns a text representation for debugging and testing purposes.
@@ -364,6 +673,22 @@ func (e *outputExpr) bindTypes(argInfo typeinfo.ArgInfo) (te typedExpr, err erro
 
 		for _, t := range e.targetTypes {
 			if t.memberName == "*" {
+				kind, err := argInfo.Kind(t.typeName)
+				if err != nil {
+					return nil, err
+				}
+				if kind == reflect.Map {
+					// Every result column of the asterisk is read into the
+					// map at the key of its name, e.g. "&M.*".
+					oc := newOutputColumn(pref, "*", nil)
+					oc.output, err = argInfo.ColumnOutput(t.typeName, oc.column)
+					if err != nil {
+						return nil, err
+					}
+					oc.allColumns = true
+					toe.outputColumns = append(toe.outputColumns, oc)
+					continue
+				}
 				// Generate asterisk columns.
 				outputs, memberNames, err := argInfo.AllStructOutputs(t.typeName)
 				if err != nil {
@@ -380,6 +705,7 @@ func (e *outputExpr) bindTypes(argInfo typeinfo.ArgInfo) (te typedExpr, err erro
 					return nil, err
 				}
 				oc := newOutputColumn(pref, t.memberName, output)
+				oc.sourceInBypass = e.sourceInBypass
 				toe.outputColumns = append(toe.outputColumns, oc)
 			}
 		}
@@ -390,6 +716,16 @@ func (e *outputExpr) bindTypes(argInfo typeinfo.ArgInfo) (te typedExpr, err erro
 
 	// Case 2: Explicit columns, single asterisk type e.g. "(col1, t.col2) AS &P.*".
 	if starTypes == 1 && numTypes == 1 {
+		// A single function call, e.g. "count(*) AS &M.*", is read into a map
+		// at the key of its result column name.
+		if c, ok := e.sourceColumns[0].(sqlFunctionCall); ok && numColumns == 1 {
+			output, err := argInfo.ColumnOutput(e.targetTypes[0].typeName, c.raw)
+			if err != nil {
+				return nil, err
+			}
+			toe.outputColumns = append(toe.outputColumns, newOutputColumn("", c.raw, output))
+			return toe, nil
+		}
 		for _, c := range e.sourceColumns {
 			output, err := argInfo.OutputMember(e.targetTypes[0].typeName, c.columnName())
 			if err != nil {
@@ -412,6 +748,15 @@ func (e *outputExpr) bindTypes(argInfo typeinfo.ArgInfo) (te typedExpr, err erro
 				return nil, err
 			}
 			oc := newOutputColumn(c.tableName(), c.columnName(), output)
+			if ce, ok := c.(caseExpression); ok {
+				for _, expr := range ce.exprs {
+					te, err := expr.bindTypes(argInfo)
+					if err != nil {
+						return nil, err
+					}
+					oc.exprs = append(oc.exprs, te)
+				}
+			}
 			toe.outputColumns = append(toe.outputColumns, oc)
 		}
 	} else {
@@ -17,6 +17,13 @@ The parsing stage takes a SQLair query string and parses it into an AST. The
 parser only processes information already encoded in the syntax of the SQLair
 expressions.
 
+The AST is handed to the Type Binding stage as a small intermediate
+representation (IR). Each node of the IR records the kind of the expression,
+its raw text, its position in the query and any flags, such as whether an
+input is assigned to a column. The Type Binding stage refuses node kinds that
+it does not know. The tests check that converting the expressions to the IR and
+back gives the same expressions for every query in the test corpus.
+
 # Type Binding stage
 
 The Type Binding stage binds concrete Go types to the type names in the SQLair
@@ -0,0 +1,42 @@
+// Copyright 2024 Canonical Ltd.
+// Licensed under Apache 2.0, see LICENCE file for details.
+
+package expr
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// CheckIRRoundTrip checks that the nodes of the IR of pe cover its query in
+// order, that the raw text of each node matches its span, and that converting
+// the IR to expressions and back gives the same IR.
+func CheckIRRoundTrip(pe *ParsedExpr) error {
+	ir := pe.ir
+	end := 0
+	for i, n := range ir.nodes {
+		if n.span.start != end {
+			return fmt.Errorf("node %d starts at %d, expected %d", i, n.span.start, end)
+		}
+		if raw := ir.query[n.span.start:n.span.end]; raw != n.raw {
+			return fmt.Errorf("node %d has raw text %q but spans %q", i, n.raw, raw)
+		}
+		end = n.span.end
+	}
+	if end != len(ir.query) {
+		return fmt.Errorf("nodes end at %d, expected %d", end, len(ir.query))
+	}
+
+	exprs, err := ir.expressions()
+	if err != nil {
+		return err
+	}
+	spans := make([]irSpan, 0, len(ir.nodes))
+	for _, n := range ir.nodes {
+		spans = append(spans, n.span)
+	}
+	if roundTrip := newIRProgram(ir.query, exprs, spans); !reflect.DeepEqual(roundTrip, ir) {
+		return fmt.Errorf("IR changed in round trip:\nbefore: %+v\nafter:  %+v", ir, roundTrip)
+	}
+	return nil
+}
@@ -6,6 +6,9 @@ package expr_test
 import (
 	"database/sql"
 	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
@@ -122,6 +125,17 @@ type OmitEmptyID struct {
 	ID int `db:"id, omitempty"`
 }
 
+type NestedRow struct {
+	ID      int      `db:"id"`
+	Addr    Address  `db:"addr"`
+	AddrPtr *Address `db:"addr_ptr"`
+}
+
+type ReadOnlyRow struct {
+	ID      int    `db:"id"`
+	Created string `db:"created,readonly"`
+}
+
 var tests = []struct {
 	summary        string
 	query          string
@@ -333,6 +347,14 @@ AND z = @sqlair_0 -- The line with $Person.id on it
 	inputArgs:      []any{Person{Fullname: "Foo"}},
 	expectedParams: []any{"Foo", "Foo"},
 	expectedSQL:    `SELECT p.address_id AS _sqlair_0, p.id AS _sqlair_1, p.name AS _sqlair_2 FROM person WHERE p.name IN (SELECT name FROM table WHERE table.n = @sqlair_0) UNION SELECT a.district AS _sqlair_3, a.street AS _sqlair_4 FROM person WHERE p.name IN (SELECT name FROM table WHERE table.n = @sqlair_1)`,
+}, {
+	summary:        "complex query v4 with the same outputs in each branch",
+	query:          "WITH named AS (SELECT name FROM table WHERE table.n = $Person.name) SELECT p.* AS &Person.* FROM person WHERE p.name IN (SELECT name FROM named) UNION SELECT p.* AS &Person.* FROM manager WHERE p.name IN (SELECT name FROM named)",
+	expectedParsed: "[Bypass[WITH named AS (SELECT name FROM table WHERE table.n = ] Input[Person.name] Bypass[) SELECT ] Output[[p.*] [Person.*]] Bypass[ FROM person WHERE p.name IN (SELECT name FROM named) UNION SELECT ] Output[[p.*] [Person.*]] Bypass[ FROM manager WHERE p.name IN (SELECT name FROM named)]]",
+	typeSamples:    []any{Person{}},
+	inputArgs:      []any{Person{Fullname: "Foo"}},
+	expectedParams: []any{"Foo"},
+	expectedSQL:    `WITH named AS (SELECT name FROM table WHERE table.n = @sqlair_0) SELECT p.address_id AS _sqlair_0, p.id AS _sqlair_1, p.name AS _sqlair_2 FROM person WHERE p.name IN (SELECT name FROM named) UNION SELECT p.address_id AS _sqlair_3, p.id AS _sqlair_4, p.name AS _sqlair_5 FROM manager WHERE p.name IN (SELECT name FROM named)`,
 }, {
 	summary:        "complex query v5",
 	query:          "SELECT p.* AS &Person.* FROM person AS p JOIN address AS a ON p.address_id = a.id WHERE p.name = $Person.name AND p.address_id = $Person.address_id",
@@ -367,6 +389,34 @@ AND z = @sqlair_0 -- The line with $Person.id on it
 	expectedParsed: "[Bypass[SELECT $, dollerrow$ FROM moneytable$]]",
 	typeSamples:    []any{},
 	expectedSQL:    "SELECT $, dollerrow$ FROM moneytable$",
+}, {
+	summary:        "insert default values",
+	query:          "INSERT INTO person DEFAULT VALUES",
+	expectedParsed: "[Bypass[INSERT INTO person DEFAULT VALUES]]",
+	typeSamples:    []any{},
+	expectedSQL:    "INSERT INTO person DEFAULT VALUES",
+}, {
+	summary:        "insert default values returning",
+	query:          "INSERT INTO person DEFAULT VALUES RETURNING &Person.id;",
+	expectedParsed: "[Bypass[INSERT INTO person DEFAULT VALUES RETURNING ] Output[[] [Person.id]] Bypass[;]]",
+	typeSamples:    []any{Person{}},
+	expectedSQL:    "INSERT INTO person DEFAULT VALUES RETURNING id AS _sqlair_0;",
+}, {
+	summary:        "positional inputs",
+	query:          "SELECT name FROM person WHERE id = $1 AND name = $2 OR id = $1",
+	expectedParsed: "[Bypass[SELECT name FROM person WHERE id = ] Input[$1] Bypass[ AND name = ] Input[$2] Bypass[ OR id = ] Input[$1]]",
+	typeSamples:    []any{},
+	inputArgs:      []any{1, "Fred"},
+	expectedParams: []any{1, "Fred", 1},
+	expectedSQL:    "SELECT name FROM person WHERE id = @sqlair_0 AND name = @sqlair_1 OR id = @sqlair_2",
+}, {
+	summary:        "positional and typed inputs",
+	query:          "SELECT &Person.* FROM person WHERE id = $Person.id AND address_id IN ($1, $2)",
+	expectedParsed: "[Bypass[SELECT ] Output[[] [Person.*]] Bypass[ FROM person WHERE id = ] Input[Person.id] Bypass[ AND address_id IN (] Input[$1] Bypass[, ] Input[$2] Bypass[)]]",
+	typeSamples:    []any{Person{}},
+	inputArgs:      []any{1000, Person{ID: 30}, 1500},
+	expectedParams: []any{30, 1000, 1500},
+	expectedSQL:    "SELECT address_id AS _sqlair_0, id AS _sqlair_1, name AS _sqlair_2 FROM person WHERE id = @sqlair_0 AND address_id IN (@sqlair_1, @sqlair_2)",
 }, {
 	summary:        "escaped double quote",
 	query:          `SELECT foo FROM t WHERE t.p = "Jimmy ""Quickfingers"" Jones"`,
@@ -385,6 +435,30 @@ AND z = @sqlair_0 -- The line with $Person.id on it
 	expectedParsed: `[Bypass[SELECT ] Output[[*] [Person.*]] Bypass[ FROM person WHERE name IN ('Lorn', 'Onos T''oolan', '', ''' ''');]]`,
 	typeSamples:    []any{Person{}},
 	expectedSQL:    `SELECT address_id AS _sqlair_0, id AS _sqlair_1, name AS _sqlair_2 FROM person WHERE name IN ('Lorn', 'Onos T''oolan', '', ''' ''');`,
+}, {
+	summary:        "blob literals",
+	query:          `SELECT * AS &Person.* FROM person WHERE key = X'DEADBEEF' OR key = x'00' AND id = $Person.id`,
+	expectedParsed: `[Bypass[SELECT ] Output[[*] [Person.*]] Bypass[ FROM person WHERE key = X'DEADBEEF' OR key = x'00' AND id = ] Input[Person.id]]`,
+	typeSamples:    []any{Person{}},
+	inputArgs:      []any{Person{ID: 1}},
+	expectedParams: []any{1},
+	expectedSQL:    `SELECT address_id AS _sqlair_0, id AS _sqlair_1, name AS _sqlair_2 FROM person WHERE key = X'DEADBEEF' OR key = x'00' AND id = @sqlair_0`,
+}, {
+	summary:        "optimizer hints",
+	query:          "SELECT /*+ MAX_EXECUTION_TIME(1000) BKA(t1) */ &Person.* FROM person WHERE /*+ not $Person.name */ id = $Person.id",
+	expectedParsed: "[Bypass[SELECT /*+ MAX_EXECUTION_TIME(1000) BKA(t1) */ ] Output[[] [Person.*]] Bypass[ FROM person WHERE /*+ not $Person.name */ id = ] Input[Person.id]]",
+	typeSamples:    []any{Person{}},
+	inputArgs:      []any{Person{ID: 1}},
+	expectedParams: []any{1},
+	expectedSQL:    "SELECT /*+ MAX_EXECUTION_TIME(1000) BKA(t1) */ address_id AS _sqlair_0, id AS _sqlair_1, name AS _sqlair_2 FROM person WHERE /*+ not $Person.name */ id = @sqlair_0",
+}, {
+	summary:        "optimizer hint in insert",
+	query:          "INSERT /*+ SET_VAR(foreign_key_checks=OFF) */ INTO person (*) VALUES ($Person.*)",
+	expectedParsed: "[Bypass[INSERT /*+ SET_VAR(foreign_key_checks=OFF) */ INTO person ] AsteriskInsert[[*] [Person.*]]]",
+	typeSamples:    []any{Person{}},
+	inputArgs:      []any{Person{ID: 1, Fullname: "Fred", PostalCode: 1000}},
+	expectedParams: []any{1000, 1, "Fred"},
+	expectedSQL:    "INSERT /*+ SET_VAR(foreign_key_checks=OFF) */ INTO person (address_id, id, name) VALUES (@sqlair_0, @sqlair_1, @sqlair_2)",
 }, {
 	summary:        "update",
 	query:          "UPDATE person SET person.address_id = $Address.id WHERE person.id = $Person.id",
@@ -420,6 +494,46 @@ AND z = @sqlair_0 -- The line with $Person.id on it
 	inputArgs:      []any{},
 	expectedParams: []any{},
 	expectedSQL:    `SELECT max(AVG(id), AVG(address_id), length("((((''""((")) AS _sqlair_0, IFNULL(name, "Mr &Person.id of $M.name") AS _sqlair_1, random() AS _sqlair_2 FROM person`,
+}, {
+	summary:        "functions with arguments",
+	query:          `SELECT substr(p.name, 1, 3) AS &Person.name, lower(p.name) AS &M.lower FROM person AS p WHERE p.id = $Person.id`,
+	expectedParsed: `[Bypass[SELECT ] Output[[substr(p.name, 1, 3)] [Person.name]] Bypass[, ] Output[[lower(p.name)] [M.lower]] Bypass[ FROM person AS p WHERE p.id = ] Input[Person.id]]`,
+	typeSamples:    []any{Person{}, sqlair.M{}},
+	inputArgs:      []any{Person{ID: 3}},
+	expectedParams: []any{3},
+	expectedSQL:    `SELECT substr(p.name, 1, 3) AS _sqlair_0, lower(p.name) AS _sqlair_1 FROM person AS p WHERE p.id = @sqlair_0`,
+}, {
+	summary:        "collate",
+	query:          `SELECT lower(p.name) COLLATE NOCASE AS &Person.name, p.name COLLATE "C" AS &M.name, p.id AS &Person.id FROM person AS p`,
+	expectedParsed: `[Bypass[SELECT lower(p.name) COLLATE ] Output[[NOCASE] [Person.name]] Bypass[, p.name COLLATE "C"] Output[[] [M.name]] Bypass[, ] Output[[p.id] [Person.id]] Bypass[ FROM person AS p]]`,
+	typeSamples:    []any{Person{}, sqlair.M{}},
+	inputArgs:      []any{},
+	expectedParams: []any{},
+	expectedSQL:    `SELECT lower(p.name) COLLATE NOCASE AS _sqlair_0, p.name COLLATE "C" AS _sqlair_1, p.id AS _sqlair_2 FROM person AS p`,
+}, {
+	summary:        "scalar subquery source",
+	query:          `SELECT (SELECT max(a.id) FROM address AS a WHERE a.district = $M.district) AS &M.maxx, (SELECT count(*) FROM person WHERE (name) IN ((')'), ('(('))) AS &M.n, p.id AS &Person.id FROM person AS p`,
+	expectedParsed: `[Bypass[SELECT (SELECT max(a.id) FROM address AS a WHERE a.district = ] Input[M.district] Bypass[)] Output[[] [M.maxx]] Bypass[, (SELECT count(*) FROM person WHERE (name) IN ((')'), ('((')))] Output[[] [M.n]] Bypass[, ] Output[[p.id] [Person.id]] Bypass[ FROM person AS p]]`,
+	typeSamples:    []any{Person{}, sqlair.M{}},
+	inputArgs:      []any{sqlair.M{"district": "x"}},
+	expectedParams: []any{"x"},
+	expectedSQL:    `SELECT (SELECT max(a.id) FROM address AS a WHERE a.district = @sqlair_0) AS _sqlair_0, (SELECT count(*) FROM person WHERE (name) IN ((')'), ('(('))) AS _sqlair_1, p.id AS _sqlair_2 FROM person AS p`,
+}, {
+	summary:        "nested subquery source",
+	query:          `SELECT ( WITH t AS (SELECT (1)) SELECT (SELECT max(x) FROM (SELECT 2 AS x)) FROM t) AS &M.x`,
+	expectedParsed: `[Bypass[SELECT ( WITH t AS (SELECT (1)) SELECT (SELECT max(x) FROM (SELECT 2 AS x)) FROM t)] Output[[] [M.x]]]`,
+	typeSamples:    []any{sqlair.M{}},
+	inputArgs:      []any{},
+	expectedParams: []any{},
+	expectedSQL:    `SELECT ( WITH t AS (SELECT (1)) SELECT (SELECT max(x) FROM (SELECT 2 AS x)) FROM t) AS _sqlair_0`,
+}, {
+	summary:        "arbitrary expressions before output",
+	query:          `SELECT coalesce(p.name, 'none') || ' ' || $M.suffix as &Person.name, 'id: '||p.id AS &Person.id, CAST(p.address_id AS TEXT) AS &M.address FROM person AS p`,
+	expectedParsed: `[Bypass[SELECT coalesce(p.name, 'none') || ' ' || ] Input[M.suffix] Output[[] [Person.name]] Bypass[, 'id: '||] Output[[p.id] [Person.id]] Bypass[, ] Output[[CAST(p.address_id AS TEXT)] [M.address]] Bypass[ FROM person AS p]]`,
+	typeSamples:    []any{Person{}, sqlair.M{}},
+	inputArgs:      []any{sqlair.M{"suffix": "x"}},
+	expectedParams: []any{"x"},
+	expectedSQL:    `SELECT coalesce(p.name, 'none') || ' ' || @sqlair_0 AS _sqlair_0, 'id: '||p.id AS _sqlair_1, CAST(p.address_id AS TEXT) AS _sqlair_2 FROM person AS p`,
 }, {
 	summary:        "single slice",
 	query:          "SELECT name FROM person WHERE id IN ($S[:])",
@@ -480,8 +594,16 @@ AND z = @sqlair_0 -- The line with $Person.id on it
 	expectedParsed: "[Bypass[INSERT INTO person ] AsteriskInsert[[*] [Address.street Person.* M.team]]]",
 	typeSamples:    []any{Address{}, Person{}, sqlair.M{}},
 	inputArgs:      []any{Address{Street: "Wallaby Way"}, Person{ID: 34, Fullname: "Dory", PostalCode: 11111}, sqlair.M{"team": "OCTO"}},
-	expectedParams: []any{"Wallaby Way", 11111, 34, "Dory", "OCTO"},
-	expectedSQL:    "INSERT INTO person (street, address_id, id, name, team) VALUES (@sqlair_0, @sqlair_1, @sqlair_2, @sqlair_3, @sqlair_4)",
+	expectedParams: []any{11111, 34, "Dory", "Wallaby Way", "OCTO"},
+	expectedSQL:    "INSERT INTO person (address_id, id, name, street, team) VALUES (@sqlair_0, @sqlair_1, @sqlair_2, @sqlair_3, @sqlair_4)",
+}, {
+	summary:        "insert asterisk with map key",
+	query:          "INSERT INTO person (*) VALUES ($M.uuid, $Person.*)",
+	expectedParsed: "[Bypass[INSERT INTO person ] AsteriskInsert[[*] [M.uuid Person.*]]]",
+	typeSamples:    []any{Person{}, sqlair.M{}},
+	inputArgs:      []any{Person{ID: 34, Fullname: "Dory", PostalCode: 11111}, sqlair.M{"uuid": "a1b2"}},
+	expectedParams: []any{11111, 34, "Dory", "a1b2"},
+	expectedSQL:    "INSERT INTO person (address_id, id, name, uuid) VALUES (@sqlair_0, @sqlair_1, @sqlair_2, @sqlair_3)",
 }, {
 	summary:        "insert specified columns to single struct",
 	query:          "INSERT INTO person (id, street) VALUES ($Address.*)",
@@ -554,6 +676,14 @@ AND z = @sqlair_0 -- The line with $Person.id on it
 	inputArgs:      []any{Address{ID: 34, Street: "Wallaby Way", District: "Sydney"}},
 	expectedParams: []any{"Sydney", 34, "Wallaby Way"},
 	expectedSQL:    "INSERT INTO address(district, id, street) VALUES (@sqlair_0, @sqlair_1, @sqlair_2) RETURNING (district AS _sqlair_0, id AS _sqlair_1, street AS _sqlair_2)",
+}, {
+	summary:        "insert with returning clause into map",
+	query:          "INSERT INTO address(*) VALUES($Address.*) RETURNING &Address.id, &M.*",
+	expectedParsed: "[Bypass[INSERT INTO address] AsteriskInsert[[*] [Address.*]] Bypass[ RETURNING ] Output[[] [Address.id]] Bypass[, ] Output[[] [M.*]]]",
+	typeSamples:    []any{Address{}, sqlair.M{}},
+	inputArgs:      []any{Address{ID: 34, Street: "Wallaby Way", District: "Sydney"}},
+	expectedParams: []any{"Sydney", 34, "Wallaby Way"},
+	expectedSQL:    "INSERT INTO address(district, id, street) VALUES (@sqlair_0, @sqlair_1, @sqlair_2) RETURNING id AS _sqlair_0, *, NULL AS _sqlair_1",
 }, {
 	summary: "insert rename columns with standalone inputs",
 	query: `INSERT INTO person (id, random_string, random_thing, number, equation, street) VALUES ($Person.address_id, "random string", rand(), 1000, 
@@ -563,6 +693,34 @@ AND z = @sqlair_0 -- The line with $Person.id on it
 	inputArgs:      []any{Address{Street: "Wallaby Way"}, Person{PostalCode: 11111}},
 	expectedParams: []any{11111, "Wallaby Way"},
 	expectedSQL:    `INSERT INTO person (id, random_string, random_thing, number, equation, street) VALUES (@sqlair_0, "random string", rand(), 1000, 1+2+3, @sqlair_1)`,
+}, {
+	summary:        "insert with literals between inputs",
+	query:          `INSERT INTO person (id, kind, created, name, note) VALUES ($Person.id, 'const, with comma', now(), $Person.name, (SELECT 'x'))`,
+	expectedParsed: `[Bypass[INSERT INTO person ] BasicInsert[[id kind created name note] [Person.id 'const, with comma' now() Person.name (SELECT 'x')]]]`,
+	typeSamples:    []any{Person{}},
+	inputArgs:      []any{[]Person{{ID: 1, Fullname: "Al"}, {ID: 2, Fullname: "Albert"}}},
+	expectedParams: []any{1, 2, "Al", "Albert"},
+	expectedSQL:    `INSERT INTO person (id, kind, created, name, note) VALUES (@sqlair_0, 'const, with comma', now(), @sqlair_2, (SELECT 'x')), (@sqlair_1, 'const, with comma', now(), @sqlair_3, (SELECT 'x'))`,
+}, {
+	summary:        "insert with an input inside a function call",
+	query:          `INSERT INTO person (id, name, kind) VALUES ($Person.id, coalesce($Person.name, 'none'), 'const')`,
+	expectedParsed: `[Bypass[INSERT INTO person (id, name, kind) VALUES (] Input[Person.id] Bypass[, coalesce(] Input[Person.name] Bypass[, 'none'), 'const')]]`,
+	typeSamples:    []any{Person{}},
+	inputArgs:      []any{Person{ID: 1, Fullname: "Al"}},
+	expectedParams: []any{1, "Al"},
+	expectedSQL:    `INSERT INTO person (id, name, kind) VALUES (@sqlair_0, coalesce(@sqlair_1, 'none'), 'const')`,
+}, {
+	summary:        "all columns into map",
+	query:          "SELECT &M.* FROM person WHERE name = 'Fred'",
+	expectedParsed: "[Bypass[SELECT ] Output[[] [M.*]] Bypass[ FROM person WHERE name = 'Fred']]",
+	typeSamples:    []any{sqlair.M{}},
+	expectedSQL:    "SELECT *, NULL AS _sqlair_0 FROM person WHERE name = 'Fred'",
+}, {
+	summary:        "all columns of table into map",
+	query:          "SELECT p.* AS &M.*, a.id AS &Address.id, * AS &StringMap.* FROM person p, address a",
+	expectedParsed: "[Bypass[SELECT ] Output[[p.*] [M.*]] Bypass[, ] Output[[a.id] [Address.id]] Bypass[, ] Output[[*] [StringMap.*]] Bypass[ FROM person p, address a]]",
+	typeSamples:    []any{sqlair.M{}, Address{}, StringMap{}},
+	expectedSQL:    "SELECT p.*, NULL AS _sqlair_0, a.id AS _sqlair_1, *, NULL AS _sqlair_2 FROM person p, address a",
 }, {
 	summary:        "insert single value",
 	query:          "INSERT INTO person (name) VALUES ($Person.name)",
@@ -693,6 +851,20 @@ AND z = @sqlair_0 -- The line with $Person.id on it
 	inputArgs:      []any{[]OmitEmptyID{{ID: 1}, {ID: 2}}, M{"key": "val"}},
 	expectedParams: []any{1, 2, "val"},
 	expectedSQL:    `INSERT INTO person (id, key) VALUES (@sqlair_0, @sqlair_2), (@sqlair_1, @sqlair_2)`,
+}, {
+	summary:        "insert with read only field",
+	query:          `INSERT INTO t (*) VALUES ($ReadOnlyRow.*)`,
+	expectedParsed: `[Bypass[INSERT INTO t ] AsteriskInsert[[*] [ReadOnlyRow.*]]]`,
+	typeSamples:    []any{ReadOnlyRow{}},
+	inputArgs:      []any{ReadOnlyRow{ID: 1, Created: "today"}},
+	expectedParams: []any{1},
+	expectedSQL:    `INSERT INTO t (id) VALUES (@sqlair_0)`,
+}, {
+	summary:        "output of read only field",
+	query:          `SELECT &ReadOnlyRow.* FROM t`,
+	expectedParsed: `[Bypass[SELECT ] Output[[] [ReadOnlyRow.*]] Bypass[ FROM t]]`,
+	typeSamples:    []any{ReadOnlyRow{}},
+	expectedSQL:    `SELECT created AS _sqlair_0, id AS _sqlair_1 FROM t`,
 }, {
 	summary:        "bulk insert with multiple bulk inputs",
 	query:          `INSERT INTO person (*) VALUES ($Person.id, $M.key, $Address.street)`,
@@ -733,6 +905,198 @@ AND z = @sqlair_0 -- The line with $Person.id on it
 	inputArgs:      []any{[]Address{{Street: "Wallaby Way"}, {Street: "Platypus Place"}}, []Person{{PostalCode: 11111}, {PostalCode: 22222}}},
 	expectedParams: []any{11111, 22222, "Wallaby Way", "Platypus Place"},
 	expectedSQL:    `INSERT INTO person (id, random_string, random_thing, number, street) VALUES (@sqlair_0, "random string", rand(), 1000, @sqlair_2), (@sqlair_1, "random string", rand(), 1000, @sqlair_3)`,
+}, {
+	summary:        "nested struct members",
+	query:          `SELECT (addr_id, addr_street) AS (&NestedRow.addr.id, &NestedRow.addr.street) FROM t WHERE district = $NestedRow.addr_ptr.district`,
+	expectedParsed: `[Bypass[SELECT ] Output[[addr_id addr_street] [NestedRow.addr.id NestedRow.addr.street]] Bypass[ FROM t WHERE district = ] Input[NestedRow.addr_ptr.district]]`,
+	typeSamples:    []any{NestedRow{}},
+	inputArgs:      []any{NestedRow{AddrPtr: &Address{District: "Happy Land"}}},
+	expectedParams: []any{"Happy Land"},
+	expectedSQL:    `SELECT addr_id AS _sqlair_0, addr_street AS _sqlair_1 FROM t WHERE district = @sqlair_0`,
+}, {
+	summary:        "bitwise and before input",
+	query:          `SELECT flags&$M.mask FROM t`,
+	expectedParsed: `[Bypass[SELECT flags&] Input[M.mask] Bypass[ FROM t]]`,
+	typeSamples:    []any{sqlair.M{}},
+	inputArgs:      []any{sqlair.M{"mask": 4}},
+	expectedParams: []any{4},
+	expectedSQL:    `SELECT flags&@sqlair_0 FROM t`,
+}, {
+	summary:        "insert after common table expression",
+	query:          `WITH p AS (SELECT id FROM person) INSERT OR REPLACE INTO address (*) VALUES ($Address.*)`,
+	expectedParsed: `[Bypass[WITH p AS (SELECT id FROM person) INSERT OR REPLACE INTO address ] AsteriskInsert[[*] [Address.*]]]`,
+	typeSamples:    []any{Address{}},
+	inputArgs:      []any{Address{ID: 1, District: "Happy Land", Street: "Main Street"}},
+	expectedParams: []any{"Happy Land", 1, "Main Street"},
+	expectedSQL:    `WITH p AS (SELECT id FROM person) INSERT OR REPLACE INTO address (district, id, street) VALUES (@sqlair_0, @sqlair_1, @sqlair_2)`,
+}, {
+	summary:        "replace statement",
+	query:          `REPLACE INTO address (id) VALUES ($Address.id)`,
+	expectedParsed: `[Bypass[REPLACE INTO address ] BasicInsert[[id] [Address.id]]]`,
+	typeSamples:    []any{Address{}},
+	inputArgs:      []any{Address{ID: 1}},
+	expectedParams: []any{1},
+	expectedSQL:    `REPLACE INTO address (id) VALUES (@sqlair_0)`,
+}, {
+	summary:        "redundant parentheses around columns",
+	query:          `SELECT ((a.district), ( a.street ), id) AS (&Address.district, &Address.street, &Address.id) FROM address AS a`,
+	expectedParsed: `[Bypass[SELECT ] Output[[a.district a.street id] [Address.district Address.street Address.id]] Bypass[ FROM address AS a]]`,
+	typeSamples:    []any{Address{}},
+	expectedSQL:    `SELECT a.district AS _sqlair_0, a.street AS _sqlair_1, id AS _sqlair_2 FROM address AS a`,
+}, {
+	summary:        "redundant parentheses around columns with asterisk type",
+	query:          `SELECT ((district), (street)) AS (&Address.*) FROM address`,
+	expectedParsed: `[Bypass[SELECT ] Output[[district street] [Address.*]] Bypass[ FROM address]]`,
+	typeSamples:    []any{Address{}},
+	expectedSQL:    `SELECT district AS _sqlair_0, street AS _sqlair_1 FROM address`,
+}, {
+	summary:        "function call into map with asterisk",
+	query:          `SELECT count(*) AS &M.*, max(id) AS &M.* FROM person WHERE name = $M.name`,
+	expectedParsed: `[Bypass[SELECT ] Output[[count(*)] [M.*]] Bypass[, ] Output[[max(id)] [M.*]] Bypass[ FROM person WHERE name = ] Input[M.name]]`,
+	typeSamples:    []any{sqlair.M{}},
+	inputArgs:      []any{sqlair.M{"name": "Fred"}},
+	expectedParams: []any{"Fred"},
+	expectedSQL:    `SELECT count(*), NULL AS _sqlair_0, max(id), NULL AS _sqlair_1 FROM person WHERE name = @sqlair_0`,
+}, {
+	summary:        "input followed by concatenation operator",
+	query:          `SELECT name FROM person WHERE name LIKE $M.prefix||'%' OR name LIKE '%'||$M.suffix||'%'`,
+	expectedParsed: `[Bypass[SELECT name FROM person WHERE name LIKE ] Input[M.prefix] Bypass[||'%' OR name LIKE '%'||] Input[M.suffix] Bypass[||'%']]`,
+	typeSamples:    []any{sqlair.M{}},
+	inputArgs:      []any{sqlair.M{"prefix": "F", "suffix": "r"}},
+	expectedParams: []any{"F", "r"},
+	expectedSQL:    `SELECT name FROM person WHERE name LIKE @sqlair_0||'%' OR name LIKE '%'||@sqlair_1||'%'`,
+}, {
+	summary:        "inputs adjacent to operators and punctuation",
+	query:          `SELECT id FROM person WHERE id+$M.a=$M.b+1 AND (id,name)=($M.c,$M.d) AND address_id IN ($S[:],$M.e);`,
+	expectedParsed: `[Bypass[SELECT id FROM person WHERE id+] Input[M.a] Bypass[=] Input[M.b] Bypass[+1 AND (id,name)=(] Input[M.c] Bypass[,] Input[M.d] Bypass[) AND address_id IN (] Input[S[:]] Bypass[,] Input[M.e] Bypass[);]]`,
+	typeSamples:    []any{sqlair.M{}, sqlair.S{}},
+	inputArgs:      []any{sqlair.M{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}, sqlair.S{6, 7}},
+	expectedParams: []any{1, 2, 3, 4, 6, 7, 5},
+	expectedSQL:    `SELECT id FROM person WHERE id+@sqlair_0=@sqlair_1+1 AND (id,name)=(@sqlair_2,@sqlair_3) AND address_id IN (@sqlair_4, @sqlair_5,@sqlair_6);`,
+}, {
+	summary:        "dollar signs in names",
+	query:          `SELECT a1$b AS &M.x FROM t WHERE price$ = $M.a AND price$$=$M.b`,
+	expectedParsed: `[Bypass[SELECT ] Output[[a1$b] [M.x]] Bypass[ FROM t WHERE price$ = ] Input[M.a] Bypass[ AND price$$=] Input[M.b]]`,
+	typeSamples:    []any{sqlair.M{}},
+	inputArgs:      []any{sqlair.M{"a": 1, "b": 2}},
+	expectedParams: []any{1, 2},
+	expectedSQL:    `SELECT a1$b AS _sqlair_0 FROM t WHERE price$ = @sqlair_0 AND price$$=@sqlair_1`,
+}, {
+	summary:        "trailing semicolon and comments",
+	query:          "SELECT &Person.name FROM person WHERE id = $Person.id; -- get the name\n/* done */ ",
+	expectedParsed: `[Bypass[SELECT ] Output[[] [Person.name]] Bypass[ FROM person WHERE id = ] Input[Person.id] Bypass[;]]`,
+	typeSamples:    []any{Person{}},
+	inputArgs:      []any{Person{ID: 1}},
+	expectedParams: []any{1},
+	expectedSQL:    `SELECT name AS _sqlair_0 FROM person WHERE id = @sqlair_0;`,
+}, {
+	summary:        "semicolons in trigger",
+	query:          "CREATE TRIGGER t AFTER INSERT ON person BEGIN UPDATE person SET name = ';' WHERE id = 1; DELETE FROM address; END; -- trigger",
+	expectedParsed: "[Bypass[CREATE TRIGGER t AFTER INSERT ON person BEGIN UPDATE person SET name = ';' WHERE id = 1; DELETE FROM address; END;]]",
+	typeSamples:    []any{},
+	expectedSQL:    "CREATE TRIGGER t AFTER INSERT ON person BEGIN UPDATE person SET name = ';' WHERE id = 1; DELETE FROM address; END;",
+}, {
+	summary:        "semicolons in trigger after comment",
+	query:          "-- audit\nCREATE OR REPLACE TRIGGER t AFTER INSERT ON person BEGIN DELETE FROM address; END;",
+	expectedParsed: "[Bypass[-- audit\nCREATE OR REPLACE TRIGGER t AFTER INSERT ON person BEGIN DELETE FROM address; END;]]",
+	typeSamples:    []any{},
+	expectedSQL:    "-- audit\nCREATE OR REPLACE TRIGGER t AFTER INSERT ON person BEGIN DELETE FROM address; END;",
+}, {
+	summary:        "semicolons in procedure with nested blocks",
+	query:          "CREATE PROCEDURE p() BEGIN SELECT 1; IF x THEN BEGIN SELECT CASE WHEN y THEN 2 END; END; END IF; SELECT 2; END",
+	expectedParsed: "[Bypass[CREATE PROCEDURE p() BEGIN SELECT 1; IF x THEN BEGIN SELECT CASE WHEN y THEN 2 END; END; END IF; SELECT 2; END]]",
+	typeSamples:    []any{},
+	expectedSQL:    "CREATE PROCEDURE p() BEGIN SELECT 1; IF x THEN BEGIN SELECT CASE WHEN y THEN 2 END; END; END IF; SELECT 2; END",
+}, {
+	summary:        "semicolons in dollar quoted function body",
+	query:          "CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql",
+	expectedParsed: "[Bypass[CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql]]",
+	typeSamples:    []any{},
+	expectedSQL:    "CREATE FUNCTION f() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql",
+}, {
+	summary:        "semicolons in tagged dollar quoted function body",
+	query:          "CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql",
+	expectedParsed: "[Bypass[CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql]]",
+	typeSamples:    []any{},
+	expectedSQL:    "CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql",
+}, {
+	summary:        "input after dollar quoted string",
+	query:          "SELECT name AS &Person.name FROM person WHERE note = $q$it's $Person.id;$q$ AND id = $Person.id",
+	expectedParsed: "[Bypass[SELECT ] Output[[name] [Person.name]] Bypass[ FROM person WHERE note = $q$it's $Person.id;$q$ AND id = ] Input[Person.id]]",
+	typeSamples:    []any{Person{}},
+	inputArgs:      []any{Person{ID: 1}},
+	expectedParams: []any{1},
+	expectedSQL:    "SELECT name AS _sqlair_0 FROM person WHERE note = $q$it's $Person.id;$q$ AND id = @sqlair_0",
+}, {
+	summary:        "case expression with input",
+	query:          `SELECT CASE WHEN status = $M.status THEN 1 ELSE 0 END AS &M.flag FROM agent`,
+	expectedParsed: `[Bypass[SELECT ] Output[[CASE WHEN status = $M.status THEN 1 ELSE 0 END] [M.flag]] Bypass[ FROM agent]]`,
+	typeSamples:    []any{M{}},
+	inputArgs:      []any{M{"status": "alive"}},
+	expectedParams: []any{"alive"},
+	expectedSQL:    `SELECT CASE WHEN status = @sqlair_0 THEN 1 ELSE 0 END AS _sqlair_0 FROM agent`,
+}, {
+	summary:        "case expression with commas in column list",
+	query:          `SELECT (name, CASE WHEN id IN ($S[:]) THEN coalesce(a, 'x, y') WHEN id = $Person.id THEN CASE WHEN t.end = 'END' THEN 'a' END ELSE 'b' END) AS (&Person.name, &M.label) FROM person WHERE address_id = $Person.address_id`,
+	expectedParsed: `[Bypass[SELECT ] Output[[name CASE WHEN id IN ($S[:]) THEN coalesce(a, 'x, y') WHEN id = $Person.id THEN CASE WHEN t.end = 'END' THEN 'a' END ELSE 'b' END] [Person.name M.label]] Bypass[ FROM person WHERE address_id = ] Input[Person.address_id]]`,
+	typeSamples:    []any{Person{}, M{}, sqlair.S{}},
+	inputArgs:      []any{Person{ID: 1, PostalCode: 2}, sqlair.S{3, 4}},
+	expectedParams: []any{3, 4, 1, 2},
+	expectedSQL:    `SELECT name AS _sqlair_0, CASE WHEN id IN (@sqlair_0, @sqlair_1) THEN coalesce(a, 'x, y') WHEN id = @sqlair_2 THEN CASE WHEN t.end = 'END' THEN 'a' END ELSE 'b' END AS _sqlair_1 FROM person WHERE address_id = @sqlair_3`,
+}, {
+	summary:        "case expression outside of output expression",
+	query:          `SELECT name AS &Person.name FROM person WHERE case when id = $Person.id then 1 else 0 end = 1`,
+	expectedParsed: `[Bypass[SELECT ] Output[[name] [Person.name]] Bypass[ FROM person WHERE case when id = ] Input[Person.id] Bypass[ then 1 else 0 end = 1]]`,
+	typeSamples:    []any{Person{}},
+	inputArgs:      []any{Person{ID: 1}},
+	expectedParams: []any{1},
+	expectedSQL:    `SELECT name AS _sqlair_0 FROM person WHERE case when id = @sqlair_0 then 1 else 0 end = 1`,
+}, {
+	summary:        "distinct on",
+	query:          "SELECT DISTINCT ON (p.id) p.* AS &Person.* FROM person AS p",
+	expectedParsed: "[Bypass[SELECT DISTINCT ON (p.id) ] Output[[p.*] [Person.*]] Bypass[ FROM person AS p]]",
+	typeSamples:    []any{Person{}},
+	expectedSQL:    "SELECT DISTINCT ON (p.id) p.address_id AS _sqlair_0, p.id AS _sqlair_1, p.name AS _sqlair_2 FROM person AS p",
+}, {
+	summary:        "distinct on with no space before output",
+	query:          "SELECT DISTINCT ON (p.id)p.* AS &Person.* FROM person AS p",
+	expectedParsed: "[Bypass[SELECT DISTINCT ON (p.id)] Output[[p.*] [Person.*]] Bypass[ FROM person AS p]]",
+	typeSamples:    []any{Person{}},
+	expectedSQL:    "SELECT DISTINCT ON (p.id)p.address_id AS _sqlair_0, p.id AS _sqlair_1, p.name AS _sqlair_2 FROM person AS p",
+}, {
+	summary:        "distinct on with parenthesised columns",
+	query:          "SELECT DISTINCT ON (p.id, p.name) (p.name, p.id) AS (&Person.name, &Person.id) FROM person AS p",
+	expectedParsed: "[Bypass[SELECT DISTINCT ON (p.id, p.name) ] Output[[p.name p.id] [Person.name Person.id]] Bypass[ FROM person AS p]]",
+	typeSamples:    []any{Person{}},
+	expectedSQL:    "SELECT DISTINCT ON (p.id, p.name) p.name AS _sqlair_0, p.id AS _sqlair_1 FROM person AS p",
+}, {
+	summary:        "distinct on with asterisk output",
+	query:          "SELECT DISTINCT ON(p.id) &Person.* FROM person AS p",
+	expectedParsed: "[Bypass[SELECT DISTINCT ON(p.id) ] Output[[] [Person.*]] Bypass[ FROM person AS p]]",
+	typeSamples:    []any{Person{}},
+	expectedSQL:    "SELECT DISTINCT ON(p.id) address_id AS _sqlair_0, id AS _sqlair_1, name AS _sqlair_2 FROM person AS p",
+}, {
+	summary:        "numeric literal after input",
+	query:          "SELECT &Person.* FROM person LIMIT $M.limit OFFSET 10",
+	expectedParsed: "[Bypass[SELECT ] Output[[] [Person.*]] Bypass[ FROM person LIMIT ] Input[M.limit] Bypass[ OFFSET 10]]",
+	typeSamples:    []any{Person{}, sqlair.M{}},
+	inputArgs:      []any{sqlair.M{"limit": 5}},
+	expectedParams: []any{5},
+	expectedSQL:    "SELECT address_id AS _sqlair_0, id AS _sqlair_1, name AS _sqlair_2 FROM person LIMIT @sqlair_0 OFFSET 10",
+}, {
+	summary:        "bitwise and after name or number",
+	query:          "SELECT p.name AS &Person.name FROM person AS p, mask AS m WHERE p.flags&m.bits = 0 LIMIT 5 OFFSET 0&Person.id",
+	expectedParsed: "[Bypass[SELECT ] Output[[p.name] [Person.name]] Bypass[ FROM person AS p, mask AS m WHERE p.flags&m.bits = 0 LIMIT 5 OFFSET 0&Person.id]]",
+	typeSamples:    []any{Person{}},
+	expectedSQL:    "SELECT p.name AS _sqlair_0 FROM person AS p, mask AS m WHERE p.flags&m.bits = 0 LIMIT 5 OFFSET 0&Person.id",
+}, {
+	summary:        "numeric and boolean literals next to inputs",
+	query:          "SELECT 1, true, 1.5e10, 0x1F, &Person.name FROM person WHERE id = $M.id+1 AND active = TRUE OR id=2*$M.id",
+	expectedParsed: "[Bypass[SELECT 1, true, 1.5e10, 0x1F, ] Output[[] [Person.name]] Bypass[ FROM person WHERE id = ] Input[M.id] Bypass[+1 AND active = TRUE OR id=2*] Input[M.id]]",
+	typeSamples:    []any{Person{}, sqlair.M{}},
+	inputArgs:      []any{sqlair.M{"id": 3}},
+	expectedParams: []any{3, 3},
+	expectedSQL:    "SELECT 1, true, 1.5e10, 0x1F, name AS _sqlair_0 FROM person WHERE id = @sqlair_0+1 AND active = TRUE OR id=2*@sqlair_1",
 }}
 
 func (s *ExprSuite) TestExprPkg(c *C) {
@@ -783,11 +1147,54 @@ func (s *ExprSuite) TestExprPkg(c *C) {
 	}
 }
 
+func (s *ExprSuite) TestIRRoundTrip(c *C) {
+	parser := expr.NewParser()
+	for i, t := range tests {
+		parsedExpr, err := parser.Parse(t.query)
+		c.Assert(err, IsNil)
+		c.Check(expr.CheckIRRoundTrip(parsedExpr), IsNil,
+			Commentf("test %d failed:\nsummary: %s\nquery:   %s\n", i, t.summary, t.query))
+	}
+}
+
 func (s *ExprSuite) TestParseErrors(c *C) {
 	tests := []struct {
 		query string
 		err   string
 	}{{
+		query: "SELECT ((a.district), (a.street + 1)) AS (&Address.district, &Address.street) FROM t",
+		err:   "cannot parse expression: column 8: cannot parse columns of output expression",
+	}, {
+		query: "SELECT (((a.district))) AS (&Address.district) FROM t",
+		err:   "cannot parse expression: column 8: cannot parse columns of output expression",
+	}, {
+		query: "SELECT (a + b) AS &M.sum FROM t",
+		err:   "cannot parse expression: column 8: cannot parse columns of output expression",
+	}, {
+		query: "SELECT foo FROM t; DELETE FROM t",
+		err:   "cannot parse expression: column 18: multiple statements are not supported",
+	}, {
+		query: "BEGIN; DELETE FROM t",
+		err:   "cannot parse expression: column 6: multiple statements are not supported",
+	}, {
+		query: "CREATE TRIGGER t AFTER INSERT ON p BEGIN DELETE FROM a; END; /* next */ DROP TABLE p",
+		err:   "cannot parse expression: column 60: multiple statements are not supported",
+	}, {
+		query: "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql; DROP FUNCTION f",
+		err:   "cannot parse expression: column 64: multiple statements are not supported",
+	}, {
+		query: "SELECT begin_date FROM t; DELETE FROM t",
+		err:   "cannot parse expression: column 25: multiple statements are not supported",
+	}, {
+		query: "SELECT foo FROM t WHERE x = $0",
+		err:   `cannot parse expression: column 29: invalid positional input "$0", positions start at $1`,
+	}, {
+		query: "SELECT foo FROM t WHERE x = $99999999999999999999",
+		err:   `cannot parse expression: column 29: invalid positional input "$99999999999999999999", positions start at $1`,
+	}, {
+		query: "SELECT &Person.* FROM t WHERE id = $Person.id;\n-- comment\nSELECT 1",
+		err:   "cannot parse expression: line 1, column 46: multiple statements are not supported",
+	}, {
 		query: "SELECT foo FROM t WHERE x = 'dddd",
 		err:   "cannot parse expression: column 29: missing closing quote in string literal",
 	}, {
@@ -808,6 +1215,9 @@ func (s *ExprSuite) TestParseErrors(c *C) {
 	}, {
 		query: `SELECT foo FROM t WHERE x = """''`,
 		err:   "cannot parse expression: column 29: missing closing quote in string literal",
+	}, {
+		query: "SELECT foo FROM t WHERE x = X'dddd",
+		err:   "cannot parse expression: column 29: missing closing quote in blob literal",
 	}, {
 		query: `SELECT foo -- line comment
 FROM t /* multiline
@@ -898,12 +1308,27 @@ of three lines' AND id = $Person.*`,
 	}, {
 		query: "SELECT * FROM t WHERE id = $ids[]",
 		err:   `cannot parse expression: column 29: invalid slice: expected 'ids[:]'`,
-	}, {
-		query: "SELECT count(*) AS &M.* FROM t",
-		err:   `cannot parse expression: column 8: cannot read function call "count(*)" into asterisk`,
 	}, {
 		query: "SELECT (id, count(*)) AS (&M.*) FROM t",
 		err:   `cannot parse expression: column 8: cannot read function call "count(*)" into asterisk`,
+	}, {
+		query: "SELECT CASE WHEN id = $M.id THEN 1 END AS &M.* FROM t",
+		err:   `cannot parse expression: column 8: cannot read CASE expression "CASE WHEN id = $M.id THEN 1 END" into asterisk`,
+	}, {
+		query: "INSERT INTO person (person.name) VALUES ($Person.name)",
+		err:   `cannot parse expression: column 20: qualified column "person.name" is not valid in an INSERT column list`,
+	}, {
+		query: "INSERT INTO person (id, p.name) VALUES ($Person.*)",
+		err:   `cannot parse expression: column 20: qualified column "p.name" is not valid in an INSERT column list`,
+	}, {
+		query: "INSERT INTO person (person.*) VALUES ($Person.*)",
+		err:   `cannot parse expression: column 20: qualified column "person.*" is not valid in an INSERT column list`,
+	}, {
+		query: "INSERT INTO person (*, created) VALUES ($Person.*, now())",
+		err:   `cannot parse expression: column 41: cannot use asterisk input "$Person.*" with literal values, list the columns it provides`,
+	}, {
+		query: "INSERT INTO person (id, name) VALUES ('x', $Person.*)",
+		err:   `cannot parse expression: column 44: cannot use asterisk input "$Person.*" with literal values, list the columns it provides`,
 	}, {
 		query: "INSERT INTO person (*) VALUES $Address.*",
 		err:   `cannot parse expression: column 31: missing parentheses around types after "VALUES"`,
@@ -919,6 +1344,12 @@ of three lines' AND id = $Person.*`,
 	}, {
 		query: "INSERT INTO person VALUES ($Address.*)",
 		err:   `cannot parse expression: column 28: invalid asterisk placement in input "$Address.*"`,
+	}, {
+		query: "SELECT &NestedRow.addr.* FROM t",
+		err:   `cannot parse expression: column 24: cannot use asterisk with nested member`,
+	}, {
+		query: "SELECT * FROM t WHERE x = $NestedRow.addr.*",
+		err:   `cannot parse expression: column 43: cannot use asterisk with nested member`,
 	}}
 
 	for _, t := range tests {
@@ -933,15 +1364,632 @@ of three lines' AND id = $Person.*`,
 	}
 }
 
+// TestFingerprint checks fingerprints against golden values. Fingerprints are
+// stable across patch releases so these values must only be changed in a
+// minor or major release, with a note in the release notes.
+func (s *ExprSuite) TestFingerprint(c *C) {
+	tests := []struct {
+		query       string
+		typeSamples []any
+		fingerprint string
+	}{{
+		query:       "SELECT name FROM person",
+		fingerprint: "441fc1c058a974bd563319d39e9a660314262bed7274edcc48316a4b8f193044",
+	}, {
+		query:       "SELECT &Person.* FROM person WHERE id = $Person.id",
+		typeSamples: []any{Person{}},
+		fingerprint: "ccb5909562ca24491d6af313167013a705508f0eee7df2c755658c3664185f89",
+	}, {
+		query:       "SELECT p.* AS &Person.*, (a.district, a.street) AS (&Address.*) FROM person AS p JOIN address AS a WHERE p.name = 'Fred'",
+		typeSamples: []any{Person{}, Address{}},
+		fingerprint: "54824f5ec62bb9dce3abb834af2b913066e5ec6983cb310ab2c62e71288ebe5e",
+	}, {
+		query:       "SELECT &M.name FROM person WHERE id IN ($IntSlice[:])",
+		typeSamples: []any{sqlair.M{}, IntSlice{}},
+		fingerprint: "f83ef83140a6206d3a7aad6d19b7e7b9386c8932801e8db8ed23540dff5c1f14",
+	}, {
+		query:       "INSERT INTO person (*) VALUES ($Person.*)",
+		typeSamples: []any{Person{}},
+		fingerprint: "3e4a6b7b2d596f540616778b08738be19480ea76ae9eb15a700823e7ac3f0f76",
+	}, {
+		query:       `INSERT INTO person (name, id, team) VALUES ($M.name, $Person.id, "team")`,
+		typeSamples: []any{sqlair.M{}, Person{}},
+		fingerprint: "d2eae01469c80fd8a24159a952253e6df560c65b82b3165b31bb691e08223d57",
+	}}
+
+	for _, t := range tests {
+		parsedExpr, err := expr.NewParser().Parse(t.query)
+		c.Assert(err, IsNil)
+		typedExpr, err := parsedExpr.BindTypes(t.typeSamples...)
+		c.Assert(err, IsNil)
+		c.Check(typedExpr.Fingerprint(), Equals, t.fingerprint, Commentf("query: %s", t.query))
+	}
+}
+
+func (s *ExprSuite) TestFingerprintChanges(c *C) {
+	fingerprint := func(query string, typeSamples ...any) string {
+		parsedExpr, err := expr.NewParser().Parse(query)
+		c.Assert(err, IsNil)
+		typedExpr, err := parsedExpr.BindTypes(typeSamples...)
+		c.Assert(err, IsNil)
+		return typedExpr.Fingerprint()
+	}
+
+	base := fingerprint("SELECT &Person.* FROM person WHERE name = 'Fred  Flintstone' AND id = $Person.id", Person{})
+
+	// Whitespace outside of string literals does not change the fingerprint.
+	c.Check(fingerprint(`
+		SELECT  &Person.*
+		FROM    person
+		WHERE   name = 'Fred  Flintstone'
+		AND     id = $Person.id
+	`, Person{}), Equals, base)
+
+	// Changes to the SQL, literals or types do.
+	c.Check(fingerprint("SELECT &Person.* FROM people WHERE name = 'Fred  Flintstone' AND id = $Person.id", Person{}), Not(Equals), base)
+	c.Check(fingerprint("SELECT &Person.* FROM person WHERE name = 'Fred Flintstone' AND id = $Person.id", Person{}), Not(Equals), base)
+	c.Check(fingerprint("SELECT &Manager.* FROM person WHERE name = 'Fred  Flintstone' AND id = $Manager.id", Manager{}), Not(Equals), base)
+	c.Check(fingerprint("SELECT &Person.name FROM person WHERE name = 'Fred  Flintstone' AND id = $Person.id", Person{}), Not(Equals), base)
+}
+
+func (s *ExprSuite) TestBindInputsWithStyle(c *C) {
+	query := `INSERT INTO person (id, name, address_id) VALUES ($Person.id, $Person.name, $Address.id) RETURNING &Person.name`
+	parsedExpr, err := expr.NewParser().Parse(query)
+	c.Assert(err, IsNil)
+	typedExpr, err := parsedExpr.BindTypes(Person{}, Address{})
+	c.Assert(err, IsNil)
+
+	people := []Person{{ID: 1, Fullname: "Fred"}, {ID: 2, Fullname: "Mark"}}
+	address := Address{ID: 3}
+
+	tests := []struct {
+		style          expr.ParamStyle
+		expectedSQL    string
+		expectedParams []any
+	}{{
+		style:          expr.ParamStyle{Prefix: "@"},
+		expectedSQL:    `INSERT INTO person (id, name, address_id) VALUES (@sqlair_0, @sqlair_2, @sqlair_4), (@sqlair_1, @sqlair_3, @sqlair_4) RETURNING name AS _sqlair_0`,
+		expectedParams: []any{sql.Named("sqlair_0", 1), sql.Named("sqlair_2", "Fred"), sql.Named("sqlair_4", 3), sql.Named("sqlair_1", 2), sql.Named("sqlair_3", "Mark")},
+	}, {
+		style:          expr.ParamStyle{Prefix: ":"},
+		expectedSQL:    `INSERT INTO person (id, name, address_id) VALUES (:sqlair_0, :sqlair_2, :sqlair_4), (:sqlair_1, :sqlair_3, :sqlair_4) RETURNING name AS _sqlair_0`,
+		expectedParams: []any{sql.Named("sqlair_0", 1), sql.Named("sqlair_2", "Fred"), sql.Named("sqlair_4", 3), sql.Named("sqlair_1", 2), sql.Named("sqlair_3", "Mark")},
+	}, {
+		style:          expr.ParamStyle{Prefix: "$"},
+		expectedSQL:    `INSERT INTO person (id, name, address_id) VALUES ($sqlair_0, $sqlair_2, $sqlair_4), ($sqlair_1, $sqlair_3, $sqlair_4) RETURNING name AS _sqlair_0`,
+		expectedParams: []any{sql.Named("sqlair_0", 1), sql.Named("sqlair_2", "Fred"), sql.Named("sqlair_4", 3), sql.Named("sqlair_1", 2), sql.Named("sqlair_3", "Mark")},
+	}, {
+		// Positional parameters are passed in the order they appear in the
+		// SQL, with repeated values passed each time.
+		style:          expr.ParamStyle{Positional: true},
+		expectedSQL:    `INSERT INTO person (id, name, address_id) VALUES (?, ?, ?), (?, ?, ?) RETURNING name AS _sqlair_0`,
+		expectedParams: []any{1, "Fred", 3, 2, "Mark", 3},
+	}, {
+		// The marker names both the parameters and the output columns.
+		style:          expr.ParamStyle{Prefix: "@", Marker: "myapp"},
+		expectedSQL:    `INSERT INTO person (id, name, address_id) VALUES (@myapp_0, @myapp_2, @myapp_4), (@myapp_1, @myapp_3, @myapp_4) RETURNING name AS _myapp_0`,
+		expectedParams: []any{sql.Named("myapp_0", 1), sql.Named("myapp_2", "Fred"), sql.Named("myapp_4", 3), sql.Named("myapp_1", 2), sql.Named("myapp_3", "Mark")},
+	}}
+
+	for _, t := range tests {
+		pq, err := typedExpr.BindInputsWithStyle(t.style, people, address)
+		c.Assert(err, IsNil)
+		c.Check(pq.SQL(), Equals, t.expectedSQL)
+		c.Check(pq.Params(), DeepEquals, t.expectedParams)
+	}
+}
+
+type escapedPattern string
+
+func (p escapedPattern) EscapedPattern() string {
+	return string(p)
+}
+
+func (s *ExprSuite) TestBindInputsLikePattern(c *C) {
+	type Search struct {
+		Pattern escapedPattern `db:"pattern"`
+	}
+	query := `SELECT name FROM person WHERE name LIKE $Search.pattern OR name LIKE $1`
+	parsedExpr, err := expr.NewParser().Parse(query)
+	c.Assert(err, IsNil)
+	typedExpr, err := parsedExpr.BindTypes(Search{})
+	c.Assert(err, IsNil)
+
+	pq, err := typedExpr.BindInputs(Search{Pattern: `50\%%`}, escapedPattern(`a\_b`))
+	c.Assert(err, IsNil)
+	c.Check(pq.SQL(), Equals, `SELECT name FROM person WHERE name LIKE @sqlair_0 ESCAPE '\' OR name LIKE @sqlair_1 ESCAPE '\'`)
+	c.Check(pq.Params(), DeepEquals, []any{sql.Named("sqlair_0", `50\%%`), sql.Named("sqlair_1", `a\_b`)})
+}
+
+func (s *ExprSuite) TestBindInputsRedacted(c *C) {
+	type Login struct {
+		User     string `db:"user"`
+		Password string `db:"password,redact"`
+	}
+	query := `INSERT INTO login (*) VALUES ($Login.*) RETURNING &Login.user`
+	parsedExpr, err := expr.NewParser().Parse(query)
+	c.Assert(err, IsNil)
+	insertExpr, err := parsedExpr.BindTypes(Login{})
+	c.Assert(err, IsNil)
+	query = `SELECT &Login.user FROM login WHERE password = $Login.password OR password = $Login.password`
+	parsedExpr, err = expr.NewParser().Parse(query)
+	c.Assert(err, IsNil)
+	selectExpr, err := parsedExpr.BindTypes(Login{})
+	c.Assert(err, IsNil)
+
+	tests := []struct {
+		summary          string
+		typedExpr        *expr.TypeBoundExpr
+		style            expr.ParamStyle
+		arg              any
+		expectedParams   []any
+		expectedRedacted []any
+	}{{
+		summary:          "insert",
+		typedExpr:        insertExpr,
+		style:            expr.ParamStyle{Prefix: "@"},
+		arg:              Login{User: "fred", Password: "hunter2"},
+		expectedParams:   []any{sql.Named("sqlair_0", "hunter2"), sql.Named("sqlair_1", "fred")},
+		expectedRedacted: []any{sql.Named("sqlair_0", "[REDACTED]"), sql.Named("sqlair_1", "fred")},
+	}, {
+		summary:          "bulk insert",
+		typedExpr:        insertExpr,
+		style:            expr.ParamStyle{Positional: true},
+		arg:              []Login{{User: "fred", Password: "hunter2"}, {User: "mark", Password: "hunter3"}},
+		expectedParams:   []any{"hunter2", "fred", "hunter3", "mark"},
+		expectedRedacted: []any{"[REDACTED]", "fred", "[REDACTED]", "mark"},
+	}, {
+		summary:          "reused parameter",
+		typedExpr:        selectExpr,
+		style:            expr.ParamStyle{Prefix: "@", ReuseParams: true},
+		arg:              Login{Password: "hunter2"},
+		expectedParams:   []any{sql.Named("sqlair_0", "hunter2")},
+		expectedRedacted: []any{sql.Named("sqlair_0", "[REDACTED]")},
+	}, {
+		summary:          "positional parameters",
+		typedExpr:        selectExpr,
+		style:            expr.ParamStyle{Positional: true},
+		arg:              Login{Password: "hunter2"},
+		expectedParams:   []any{"hunter2", "hunter2"},
+		expectedRedacted: []any{"[REDACTED]", "[REDACTED]"},
+	}}
+	for _, t := range tests {
+		pq, err := t.typedExpr.BindInputsWithStyle(t.style, t.arg)
+		c.Assert(err, IsNil, Commentf(t.summary))
+		// The database is passed the values.
+		c.Check(pq.Params(), DeepEquals, t.expectedParams, Commentf(t.summary))
+		c.Check(pq.RedactedParams(), DeepEquals, t.expectedRedacted, Commentf(t.summary))
+		rendered := fmt.Sprint(pq.SQL(), pq.RedactedParams())
+		c.Check(strings.Contains(rendered, "hunter"), Equals, false, Commentf(t.summary))
+	}
+}
+
+func (s *ExprSuite) TestBindInputsReuseParams(c *C) {
+	query := `SELECT &Person.* FROM person WHERE name = $Person.name OR id = $Person.id OR nickname = $Person.name OR id IN ($IntSlice[:])`
+	parsedExpr, err := expr.NewParser().Parse(query)
+	c.Assert(err, IsNil)
+	typedExpr, err := parsedExpr.BindTypes(Person{}, IntSlice{})
+	c.Assert(err, IsNil)
+
+	person := Person{ID: 1, Fullname: "Fred"}
+	ids := IntSlice{1, 2}
+
+	tests := []struct {
+		summary        string
+		style          expr.ParamStyle
+		expectedSQL    string
+		expectedParams []any
+	}{{
+		summary:        "repeated members are separate parameters by default",
+		style:          expr.ParamStyle{Prefix: "@"},
+		expectedSQL:    `SELECT address_id AS _sqlair_0, id AS _sqlair_1, name AS _sqlair_2 FROM person WHERE name = @sqlair_0 OR id = @sqlair_1 OR nickname = @sqlair_2 OR id IN (@sqlair_3, @sqlair_4)`,
+		expectedParams: []any{sql.Named("sqlair_0", "Fred"), sql.Named("sqlair_1", 1), sql.Named("sqlair_2", "Fred"), sql.Named("sqlair_3", 1), sql.Named("sqlair_4", 2)},
+	}, {
+		summary:        "repeated members reuse a named parameter",
+		style:          expr.ParamStyle{Prefix: "@", ReuseParams: true},
+		expectedSQL:    `SELECT address_id AS _sqlair_0, id AS _sqlair_1, name AS _sqlair_2 FROM person WHERE name = @sqlair_0 OR id = @sqlair_1 OR nickname = @sqlair_0 OR id IN (@sqlair_2, @sqlair_3)`,
+		expectedParams: []any{sql.Named("sqlair_0", "Fred"), sql.Named("sqlair_1", 1), sql.Named("sqlair_2", 1), sql.Named("sqlair_3", 2)},
+	}, {
+		summary:        "positional parameters are not reused",
+		style:          expr.ParamStyle{Positional: true, ReuseParams: true},
+		expectedSQL:    `SELECT address_id AS _sqlair_0, id AS _sqlair_1, name AS _sqlair_2 FROM person WHERE name = ? OR id = ? OR nickname = ? OR id IN (?, ?)`,
+		expectedParams: []any{"Fred", 1, "Fred", 1, 2},
+	}}
+
+	for _, t := range tests {
+		pq, err := typedExpr.BindInputsWithStyle(t.style, person, ids)
+		c.Assert(err, IsNil, Commentf(t.summary))
+		c.Check(pq.SQL(), Equals, t.expectedSQL, Commentf(t.summary))
+		c.Check(pq.Params(), DeepEquals, t.expectedParams, Commentf(t.summary))
+	}
+}
+
+func (s *ExprSuite) TestBindInputsWithStylePlaceholderCollision(c *C) {
+	tests := []struct {
+		query string
+		style expr.ParamStyle
+		err   string
+	}{{
+		query: "SELECT * FROM person WHERE id = @sqlair_0 AND name = $Person.name",
+		style: expr.ParamStyle{Prefix: "@"},
+		err:   `invalid input parameter: query contains "@sqlair_" which clashes with the query parameter placeholders`,
+	}, {
+		query: "SELECT * FROM person WHERE id = :sqlair_0 AND name = $Person.name",
+		style: expr.ParamStyle{Prefix: ":"},
+		err:   `invalid input parameter: query contains ":sqlair_" which clashes with the query parameter placeholders`,
+	}, {
+		query: "SELECT * FROM person WHERE id = ? AND name = $Person.name",
+		style: expr.ParamStyle{Positional: true},
+		err:   `invalid input parameter: query contains "\?" which clashes with the query parameter placeholders`,
+	}, {
+		query: "SELECT * FROM person WHERE id = @myapp_0 AND name = $Person.name",
+		style: expr.ParamStyle{Prefix: "@", Marker: "myapp"},
+		err:   `invalid input parameter: query contains "@myapp_" which clashes with the query parameter placeholders`,
+	}, {
+		query: "SELECT name AS _myapp_0 FROM person WHERE name = $Person.name",
+		style: expr.ParamStyle{Prefix: "@", Marker: "myapp"},
+		err:   `invalid input parameter: column alias "_myapp_0" uses reserved prefix _myapp_`,
+	}, {
+		query: "SELECT * FROM person WHERE name = $Person.name",
+		style: expr.ParamStyle{Prefix: "@", Marker: "MyApp"},
+		err:   `invalid input parameter: invalid marker "MyApp": must start with a lower case letter or underscore and contain only lower case letters, digits and underscores`,
+	}}
+	for _, t := range tests {
+		parsedExpr, err := expr.NewParser().Parse(t.query)
+		c.Assert(err, IsNil)
+		typedExpr, err := parsedExpr.BindTypes(Person{})
+		c.Assert(err, IsNil)
+		_, err = typedExpr.BindInputsWithStyle(t.style, Person{})
+		c.Assert(err, ErrorMatches, t.err)
+	}
+
+	// Placeholders in quotes and comments do not clash.
+	query := `SELECT '?' AS "@sqlair_0" /* ? */ FROM person -- ?
+WHERE name = $Person.name`
+	parsedExpr, err := expr.NewParser().Parse(query)
+	c.Assert(err, IsNil)
+	typedExpr, err := parsedExpr.BindTypes(Person{})
+	c.Assert(err, IsNil)
+	for _, style := range []expr.ParamStyle{{Prefix: "@"}, {Positional: true}} {
+		_, err = typedExpr.BindInputsWithStyle(style, Person{})
+		c.Assert(err, IsNil)
+	}
+
+	// The PostgreSQL JSON operators only clash with positional placeholders.
+	query = "SELECT * FROM person WHERE data ? 'a' AND data ?| array['b'] AND data ?& array['c'] AND name = $Person.name"
+	parsedExpr, err = expr.NewParser().Parse(query)
+	c.Assert(err, IsNil)
+	typedExpr, err = parsedExpr.BindTypes(Person{})
+	c.Assert(err, IsNil)
+	for _, style := range []expr.ParamStyle{{Prefix: "@"}, {Prefix: ":"}, {Prefix: "$"}} {
+		_, err = typedExpr.BindInputsWithStyle(style, Person{})
+		c.Assert(err, IsNil)
+	}
+	// The result of the check is the same each time the style is used.
+	for i := 0; i < 2; i++ {
+		_, err = typedExpr.BindInputsWithStyle(expr.ParamStyle{Positional: true}, Person{})
+		c.Assert(err, ErrorMatches, `invalid input parameter: query contains "\?" which clashes with the query parameter placeholders`)
+	}
+}
+
+func (s *ExprSuite) TestOptimizerHintsVerbatim(c *C) {
+	hint := "/*+ MAX_EXECUTION_TIME(1000)  INDEX(person  idx) */"
+	queries := []string{
+		"SELECT " + hint + " &Person.* FROM person",
+		"SELECT" + hint + "&Person.* FROM person",
+		"SELECT &Person.*" + hint + " FROM person",
+		"SELECT p.* " + hint + " AS &Person.* FROM person",
+		"SELECT (" + hint + " id, name) AS (&Person.*) FROM person",
+	}
+	for _, query := range queries {
+		parsedExpr, err := expr.NewParser().Parse(query)
+		c.Assert(err, IsNil)
+		typedExpr, err := parsedExpr.BindTypes(Person{})
+		c.Assert(err, IsNil)
+		primedQuery, err := typedExpr.BindInputs()
+		c.Assert(err, IsNil)
+		c.Check(strings.Contains(primedQuery.SQL(), hint), Equals, true, Commentf("query: %s\nSQL: %s", query, primedQuery.SQL()))
+	}
+}
+
+func (s *ExprSuite) TestParseBackslashEscapes(c *C) {
+	tests := []struct {
+		query          string
+		expectedParsed string
+	}{{
+		query:          `SELECT name FROM person WHERE name = 'O\'Donnell' AND id = $Person.id`,
+		expectedParsed: `[Bypass[SELECT name FROM person WHERE name = 'O\'Donnell' AND id = ] Input[Person.id]]`,
+	}, {
+		query:          `SELECT name FROM person WHERE name = 'a\\' AND id = $Person.id`,
+		expectedParsed: `[Bypass[SELECT name FROM person WHERE name = 'a\\' AND id = ] Input[Person.id]]`,
+	}, {
+		query:          `SELECT name FROM person WHERE name = "\" $Person.id" AND id = $Person.id`,
+		expectedParsed: `[Bypass[SELECT name FROM person WHERE name = "\" $Person.id" AND id = ] Input[Person.id]]`,
+	}, {
+		// Blob literals are never scanned for escapes.
+		query:          `SELECT name FROM person WHERE key = X'\' AND id = $Person.id`,
+		expectedParsed: `[Bypass[SELECT name FROM person WHERE key = X'\' AND id = ] Input[Person.id]]`,
+	}}
+
+	parser := expr.NewParserWithOptions(expr.ParserOptions{BackslashEscapes: true})
+	for _, t := range tests {
+		parsedExpr, err := parser.Parse(t.query)
+		c.Assert(err, IsNil, Commentf("query: %s", t.query))
+		c.Check(parsedExpr.String(), Equals, t.expectedParsed)
+	}
+
+	// By default backslashes do not escape quotes.
+	_, err := expr.NewParser().Parse(`SELECT name FROM person WHERE name = 'O\'Donnell'`)
+	c.Assert(err, ErrorMatches, "cannot parse expression: column 49: missing closing quote in string literal")
+}
+
+func (s *ExprSuite) TestNumericLiterals(c *C) {
+	literals := []string{"0", "42", "1.5", ".5", "1.", "1e10", "1E10", "1.5e-3", "2.5E+4", "1_000_000", "0x1F", "0X1f"}
+	// Each template is formatted with the literal.
+	templates := []struct {
+		query          string
+		expectedParsed string
+		expectedSQL    string
+	}{{
+		query:          "SELECT x FROM t WHERE y = %[1]s AND z = $M.a",
+		expectedParsed: "[Bypass[SELECT x FROM t WHERE y = %[1]s AND z = ] Input[M.a]]",
+		expectedSQL:    "SELECT x FROM t WHERE y = %[1]s AND z = @sqlair_0",
+	}, {
+		query:          "SELECT x FROM t WHERE y = %[1]s+$M.a",
+		expectedParsed: "[Bypass[SELECT x FROM t WHERE y = %[1]s+] Input[M.a]]",
+		expectedSQL:    "SELECT x FROM t WHERE y = %[1]s+@sqlair_0",
+	}, {
+		query:          "SELECT x FROM t WHERE y = $M.a-%[1]s",
+		expectedParsed: "[Bypass[SELECT x FROM t WHERE y = ] Input[M.a] Bypass[-%[1]s]]",
+		expectedSQL:    "SELECT x FROM t WHERE y = @sqlair_0-%[1]s",
+	}, {
+		query:          "SELECT x FROM t WHERE y IN (%[1]s,$M.a,%[1]s)",
+		expectedParsed: "[Bypass[SELECT x FROM t WHERE y IN (%[1]s,] Input[M.a] Bypass[,%[1]s)]]",
+		expectedSQL:    "SELECT x FROM t WHERE y IN (%[1]s,@sqlair_0,%[1]s)",
+	}, {
+		query:          "SELECT x FROM t LIMIT %[1]s OFFSET $M.a",
+		expectedParsed: "[Bypass[SELECT x FROM t LIMIT %[1]s OFFSET ] Input[M.a]]",
+		expectedSQL:    "SELECT x FROM t LIMIT %[1]s OFFSET @sqlair_0",
+	}, {
+		query:          "SELECT %[1]s AS &M.a FROM t",
+		expectedParsed: "[Bypass[SELECT ] Output[[%[1]s] [M.a]] Bypass[ FROM t]]",
+		expectedSQL:    "SELECT %[1]s AS _sqlair_0 FROM t",
+	}, {
+		query:          "SELECT (%[1]s, x) AS (&M.a, &M.b) FROM t",
+		expectedParsed: "[Bypass[SELECT ] Output[[%[1]s x] [M.a M.b]] Bypass[ FROM t]]",
+		expectedSQL:    "SELECT %[1]s AS _sqlair_0, x AS _sqlair_1 FROM t",
+	}, {
+		query:          "SELECT &M.a, %[1]s*y FROM t",
+		expectedParsed: "[Bypass[SELECT ] Output[[] [M.a]] Bypass[, %[1]s*y FROM t]]",
+		expectedSQL:    "SELECT a AS _sqlair_0, %[1]s*y FROM t",
+	}}
+	for _, literal := range literals {
+		for _, t := range templates {
+			query := fmt.Sprintf(t.query, literal)
+			parsedExpr, err := expr.NewParser().Parse(query)
+			c.Assert(err, IsNil, Commentf("query: %s", query))
+			c.Check(parsedExpr.String(), Equals, fmt.Sprintf(t.expectedParsed, literal), Commentf("query: %s", query))
+			typedExpr, err := parsedExpr.BindTypes(sqlair.M{})
+			c.Assert(err, IsNil, Commentf("query: %s", query))
+			var inputArgs []any
+			if strings.Contains(query, "$") {
+				inputArgs = append(inputArgs, sqlair.M{"a": 1})
+			}
+			primedQuery, err := typedExpr.BindInputs(inputArgs...)
+			c.Assert(err, IsNil, Commentf("query: %s", query))
+			c.Check(primedQuery.SQL(), Equals, fmt.Sprintf(t.expectedSQL, literal), Commentf("query: %s", query))
+		}
+	}
+}
+
+func (s *ExprSuite) TestParseLimits(c *C) {
+	query := "SELECT &Person.* FROM person WHERE id = $Person.id OR id = $Person.id"
+
+	parser := expr.NewParserWithOptions(expr.ParserOptions{MaxQueryLength: len(query)})
+	_, err := parser.Parse(query)
+	c.Assert(err, IsNil)
+	parser = expr.NewParserWithOptions(expr.ParserOptions{MaxQueryLength: len(query) - 1})
+	_, err = parser.Parse(query)
+	c.Assert(err, ErrorMatches, "cannot parse expression: query is 69 bytes long, more than the limit of 68 bytes")
+
+	parser = expr.NewParserWithOptions(expr.ParserOptions{MaxExpressions: 3})
+	_, err = parser.Parse(query)
+	c.Assert(err, IsNil)
+	parser = expr.NewParserWithOptions(expr.ParserOptions{MaxExpressions: 2})
+	_, err = parser.Parse(query)
+	c.Assert(err, ErrorMatches, "cannot parse expression: column 60: query has more than 2 expressions")
+
+	// The default limits apply unless the limits are negative.
+	long := "SELECT * FROM t WHERE " + strings.Repeat("x_column = $M.a OR ", expr.DefaultMaxExpressions+1) + "1"
+	_, err = expr.NewParser().Parse(long)
+	c.Assert(err, ErrorMatches, "cannot parse expression: query is .* bytes long, more than the limit of 1048576 bytes")
+	_, err = expr.NewParserWithOptions(expr.ParserOptions{MaxQueryLength: -1}).Parse(long)
+	c.Assert(err, ErrorMatches, "cannot parse expression: column .*: query has more than 65536 expressions")
+	_, err = expr.NewParserWithOptions(expr.ParserOptions{MaxQueryLength: -1, MaxExpressions: -1}).Parse(long)
+	c.Assert(err, IsNil)
+}
+
+func (s *ExprSuite) TestMultipleStatements(c *C) {
+	query := "SELECT &Person.id FROM person UNION SELECT &Person.id FROM person; UPDATE person SET name = $Person.name; SELECT p.id AS &Person.id, a.id AS &Address.id FROM person AS p JOIN address AS a;"
+	parser := expr.NewParserWithOptions(expr.ParserOptions{MultipleStatements: true})
+	parsedExpr, err := parser.Parse(query)
+	c.Assert(err, IsNil)
+	typedExpr, err := parsedExpr.BindTypes(Person{}, Address{})
+	c.Assert(err, IsNil)
+	primedQuery, err := typedExpr.BindInputs(Person{ID: 1, Fullname: "Fred"})
+	c.Assert(err, IsNil)
+	c.Check(primedQuery.SQL(), Equals, "SELECT id AS _sqlair_0 FROM person UNION SELECT id AS _sqlair_1 FROM person; UPDATE person SET name = @sqlair_0; SELECT p.id AS _sqlair_2, a.id AS _sqlair_3 FROM person AS p JOIN address AS a;")
+
+	// Each result set is scanned into the outputs of its own statement.
+	_, _, err = primedQuery.ScanArgs([]string{"_sqlair_0"}, []any{&Person{}}, false)
+	c.Assert(err, IsNil)
+	_, _, err = primedQuery.ScanArgs([]string{"_sqlair_2", "_sqlair_3"}, []any{&Person{}, &Address{}}, false)
+	c.Assert(err, IsNil)
+	_, _, err = primedQuery.ScanArgs([]string{"_sqlair_2"}, []any{&Person{}}, false)
+	c.Assert(err, ErrorMatches, `query uses "&Address" outside of result context: no result column for tag "id" of struct "Address"`)
+	_, _, err = primedQuery.ScanArgs([]string{"_sqlair_1"}, []any{&Person{}}, false)
+	c.Assert(err, ErrorMatches, `internal error: sqlair column 1 is not scanned`)
+	_, _, err = primedQuery.ScanArgs([]string{"count"}, nil, false)
+	c.Assert(err, IsNil)
+
+	// Outputs can only appear once in each statement.
+	parsedExpr, err = parser.Parse("SELECT &Person.id FROM person; SELECT &Person.id, &Person.* FROM person")
+	c.Assert(err, IsNil)
+	_, err = parsedExpr.BindTypes(Person{})
+	c.Assert(err, ErrorMatches, `cannot prepare statement: tag "id" of struct "Person" appears more than once in output expressions`)
+
+	// Without the option only a single statement is allowed.
+	_, err = expr.NewParser().Parse(query)
+	c.Assert(err, ErrorMatches, "cannot parse expression: column 66: multiple statements are not supported")
+}
+
+func (s *ExprSuite) TestParsePathologicalQueries(c *C) {
+	// Each of these queries used to take time quadratic or exponential in
+	// its length to parse.
+	n := 10000
+	tests := []struct {
+		query          string
+		expectedParsed string
+	}{{
+		query:          "SELECT " + strings.Repeat("(", n) + "1 FROM t WHERE x = $M.a",
+		expectedParsed: "[Bypass[SELECT " + strings.Repeat("(", n) + "1 FROM t WHERE x = ] Input[M.a]]",
+	}, {
+		query:          "SELECT " + strings.Repeat("(a, ", n) + "b FROM t WHERE x = $M.a",
+		expectedParsed: "[Bypass[SELECT " + strings.Repeat("(a, ", n) + "b FROM t WHERE x = ] Input[M.a]]",
+	}, {
+		query:          "SELECT " + strings.Repeat("CASE WHEN x THEN ", n) + "1" + strings.Repeat(" END", n) + " FROM t WHERE x = $M.a",
+		expectedParsed: "[Bypass[SELECT " + strings.Repeat("CASE WHEN x THEN ", n) + "1" + strings.Repeat(" END", n) + " FROM t WHERE x = ] Input[M.a]]",
+	}, {
+		query:          "SELECT " + strings.Repeat("CASE WHEN x THEN ", n) + "1" + strings.Repeat(" END", n) + " AS &M.a FROM t",
+		expectedParsed: "[Bypass[SELECT ] Output[[" + strings.Repeat("CASE WHEN x THEN ", n) + "1" + strings.Repeat(" END", n) + "] [M.a]] Bypass[ FROM t]]",
+	}, {
+		query:          "SELECT " + strings.Repeat("f(", n) + "1" + strings.Repeat(")", n) + " AS &M.a FROM t",
+		expectedParsed: "[Bypass[SELECT ] Output[[" + strings.Repeat("f(", n) + "1" + strings.Repeat(")", n) + "] [M.a]] Bypass[ FROM t]]",
+	}}
+	for _, t := range tests {
+		parsedExpr, err := expr.NewParser().Parse(t.query)
+		c.Assert(err, IsNil)
+		c.Check(parsedExpr.String(), Equals, t.expectedParsed)
+	}
+}
+
+// BenchmarkParseInputs parses queries with increasing numbers of input
+// expressions. The time per input expression should stay about the same.
+func BenchmarkParseInputs(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		query := "SELECT * FROM t WHERE " + strings.Repeat("x = $M.a OR ", n) + "1"
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := expr.NewParser().Parse(query); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func FuzzParser(f *testing.F) {
 	// Add some values to the corpus.
 	for _, test := range tests {
-		f.Add(test.query)
+		f.Add(test.query, "")
 	}
-	f.Fuzz(func(t *testing.T, s string) {
-		// Loop forever or until it crashes.
+	f.Add(`SELECT * AS &Person.* FROM t WHERE key = X'DEADBEEF'`, "")
+	f.Add(`SELECT x'00', X'\'' FROM t WHERE a = $Person.id`, "")
+	f.Add(`SELECT X'`, "")
+	f.Add(`SELECT /*+ MAX_EXECUTION_TIME(1000) */ &Person.* FROM t`, "")
+	f.Add(`SELECT (/*+ $Person.id */ a, b) AS (&Person.*) /*+`, "")
+	f.Add(`CASE WHEN status = $M.status THEN 1 ELSE 0 END AS &M.flag`, "")
+	f.Add(`SELECT &Person.* FROM t WHERE id IN ($S[:]) AND x = $NestedRow.addr.id`, "")
+	f.Add(`INSERT INTO t (*) VALUES ($Person.*, $M.extra)`, "")
+	f.Add(`INSERT INTO t (id, name, col) VALUES ($Person.*, $M.*)`, "")
+	f.Add(`SELECT count(*) AS &M.*, (a, b) AS (&M.a, &Person.id) FROM t`, "")
+	f.Add(`SELECT .5 AS &M.a, 1.5e-3 AS &M.b FROM t WHERE x = 0x1F+$M.id AND price$ = 1e$M.id`, "")
+	f.Add(`SELECT &Person.* FROM t`, "_sqlair_0,_sqlair_1,_sqlair_2")
+	f.Add(`SELECT &Person.*, &M.name FROM t`, "_sqlair_0,extra,_sqlair_3")
+
+	// The type samples and arguments cover each kind of argument.
+	args := []any{
+		Person{ID: 1, Fullname: "Fred", PostalCode: 1000},
+		Address{ID: 1, District: "Happy Land", Street: "Main Street"},
+		OmitEmptyPerson{},
+		NestedRow{ID: 1, AddrPtr: &Address{ID: 2}},
+		Embeddings{},
+		sqlair.M{"id": 1, "name": "Fred", "extra": "x"},
+		sqlair.S{1, 2, 3},
+		IntSlice{},
+	}
+	zeroArgs := []any{Person{}, Address{}, OmitEmptyPerson{}, NestedRow{}, Embeddings{}, sqlair.M{}, sqlair.S{}, IntSlice{}}
+	f.Fuzz(func(t *testing.T, query string, columns string) {
+		// Loop forever or until it crashes. The whole pipeline must return
+		// errors rather than panic on any query that parses. The columns are
+		// a comma separated list of the result columns to scan.
 		parser := expr.NewParser()
-		parser.Parse(s)
+		parsedExpr, err := parser.Parse(query)
+		if err != nil {
+			return
+		}
+		if err := expr.CheckIRRoundTrip(parsedExpr); err != nil {
+			t.Fatal(err)
+		}
+		typedExpr, err := parsedExpr.BindTypes(args...)
+		if err != nil {
+			return
+		}
+		if fp := typedExpr.Fingerprint(); fp != typedExpr.Fingerprint() {
+			t.Fatalf("fingerprint of %q is not stable", query)
+		}
+		_, _ = typedExpr.BindInputs(zeroArgs...)
+		_, _ = typedExpr.BindInputsWithStyle(expr.ParamStyle{Positional: true}, args...)
+
+		// Arguments not used by the query are ignored so that the rest of
+		// the pipeline is run whichever sample types the query uses.
+		style := expr.ParamStyle{Prefix: "@", AllowUnusedArgs: true}
+		primedQuery, err := typedExpr.BindInputsWithStyle(style, args...)
+		if err != nil {
+			return
+		}
+		if primedQuery == nil {
+			t.Fatalf("no primed query or error for %q", query)
+		}
+		again, err := typedExpr.BindInputsWithStyle(style, args...)
+		if err != nil {
+			t.Fatalf("inputs of %q bound once, then failed: %s", query, err)
+		}
+		if again.SQL() != primedQuery.SQL() {
+			t.Fatalf("SQL of %q is not stable: %q then %q", query, primedQuery.SQL(), again.SQL())
+		}
+		for _, param := range primedQuery.Params() {
+			named, ok := param.(sql.NamedArg)
+			if !ok {
+				t.Fatalf("parameter %#v of %q is not named", param, query)
+			}
+			if !strings.Contains(primedQuery.SQL(), "@"+named.Name) {
+				t.Fatalf("parameter %q not in SQL %q", named.Name, primedQuery.SQL())
+			}
+		}
+
+		var columnNames []string
+		if columns != "" {
+			columnNames = strings.Split(columns, ",")
+		}
+		var outputArgs []any
+		seen := map[reflect.Type]bool{}
+		for _, output := range typedExpr.Outputs() {
+			argType := output.ArgType()
+			if seen[argType] {
+				continue
+			}
+			seen[argType] = true
+			if argType.Kind() == reflect.Map {
+				outputArgs = append(outputArgs, reflect.MakeMap(argType).Interface())
+			} else {
+				outputArgs = append(outputArgs, reflect.New(argType).Interface())
+			}
+		}
+		scanArgs, _, err := primedQuery.ScanArgs(columnNames, outputArgs, false)
+		if err == nil && len(scanArgs) != len(columnNames) {
+			t.Fatalf("got %d scan args for %d columns", len(scanArgs), len(columnNames))
+		}
 	})
 }
 
@@ -973,6 +2021,14 @@ func (s *ExprSuite) TestBindTypesErrors(c *C) {
 		typeSamples []any
 		err         string
 	}{{
+		query:       "SELECT 1 AS _sqlair_0, &Address.id FROM t",
+		typeSamples: []any{Address{}},
+		err:         `cannot prepare statement: column alias "_sqlair_0" uses reserved prefix _sqlair_`,
+	}, {
+		query:       `SELECT &Address.id, name AS "_SQLAIR_1" FROM t`,
+		typeSamples: []any{Address{}},
+		err:         `cannot prepare statement: column alias "_SQLAIR_1" uses reserved prefix _sqlair_`,
+	}, {
 		query:       "SELECT (p.name, t.id) AS (&Address.id) FROM t",
 		typeSamples: []any{Address{}},
 		err:         "cannot prepare statement: output expression: mismatched number of columns and target types: (p.name, t.id) AS (&Address.id)",
@@ -1044,18 +2100,14 @@ func (s *ExprSuite) TestBindTypesErrors(c *C) {
 		query:       "SELECT * AS &Person.* FROM t",
 		typeSamples: []any{func() {}},
 		err:         `cannot prepare statement: need supported type, got func`,
-	}, {
-		query:       "SELECT * AS &Person.* FROM t",
-		typeSamples: []any{&Person{}},
-		err:         `cannot prepare statement: need non-pointer type, got pointer to struct`,
 	}, {
 		query:       "SELECT * AS &Person.* FROM t",
 		typeSamples: []any{(*Person)(nil)},
-		err:         `cannot prepare statement: need non-pointer type, got pointer to struct`,
+		err:         `cannot prepare statement: need supported value, got nil pointer to struct`,
 	}, {
 		query:       "SELECT * AS &Person.* FROM t",
 		typeSamples: []any{map[string]any{}},
-		err:         `cannot prepare statement: cannot use anonymous map`,
+		err:         `cannot prepare statement: cannot use anonymous map, name it with sqlair.Named`,
 	}, {
 		query:       "SELECT * AS &Person.* FROM t",
 		typeSamples: []any{nil},
@@ -1063,11 +2115,19 @@ func (s *ExprSuite) TestBindTypesErrors(c *C) {
 	}, {
 		query:       "SELECT * AS &.* FROM t",
 		typeSamples: []any{struct{ f int }{f: 1}},
-		err:         `cannot prepare statement: cannot use anonymous struct`,
+		err:         `cannot prepare statement: cannot use anonymous struct, name it with sqlair.Named`,
 	}, {
 		query:       "SELECT &NoTags.* FROM t",
 		typeSamples: []any{NoTags{}},
 		err:         `cannot prepare statement: output expression: no "db" tags found in struct "NoTags": &NoTags.*`,
+	}, {
+		query:       "SELECT * AS &ReadOnlyRow.* FROM t WHERE created = $ReadOnlyRow.created",
+		typeSamples: []any{ReadOnlyRow{}},
+		err:         `cannot prepare statement: input expression: cannot use tag "created" of struct "ReadOnlyRow" as an input, it has the readonly option: $ReadOnlyRow.created`,
+	}, {
+		query:       "INSERT INTO t (id, created) VALUES ($ReadOnlyRow.*)",
+		typeSamples: []any{ReadOnlyRow{}},
+		err:         `cannot prepare statement: input expression: cannot use tag "created" of struct "ReadOnlyRow" as an input, it has the readonly option: (id, created) VALUES ($ReadOnlyRow.*)`,
 	}, {
 		query:       "SELECT street FROM t WHERE x = $Address[:]",
 		typeSamples: []any{Person{}, Manager{}, Address{}},
@@ -1087,11 +2147,47 @@ func (s *ExprSuite) TestBindTypesErrors(c *C) {
 	}, {
 		query:       "SELECT street FROM t WHERE x IN ($int[:])",
 		typeSamples: []any{[]int{}},
-		err:         `cannot prepare statement: cannot use anonymous slice`,
+		err:         `cannot prepare statement: cannot use anonymous slice, name it with sqlair.Named`,
+	}, {
+		query:       "SELECT count(*) AS &Person.* FROM person",
+		typeSamples: []any{Person{}},
+		err:         `cannot prepare statement: output expression: cannot read "count(*)" into asterisk of struct, a map is required: count(*) AS &Person.*`,
 	}, {
 		query:       "SELECT street FROM t WHERE x IN ($myArray[:])",
 		typeSamples: []any{myArray{}},
 		err:         `cannot prepare statement: need supported type, got array`,
+	}, {
+		query:       "SELECT (*) VALUES ($Person.*) FROM t",
+		typeSamples: []any{Person{}},
+		err:         `cannot prepare statement: input expression: columns and VALUES are only valid in an INSERT statement: (*) VALUES ($Person.*)`,
+	}, {
+		query:       "DELETE FROM t WHERE (id) VALUES ($Person.id)",
+		typeSamples: []any{Person{}},
+		err:         `cannot prepare statement: input expression: columns and VALUES are only valid in an INSERT statement: (id) VALUES ($Person.id)`,
+	}, {
+		query:       "UPDATE t SET (id, name) VALUES ($Person.*)",
+		typeSamples: []any{Person{}},
+		err:         `cannot prepare statement: input expression: columns and VALUES are only valid in an INSERT statement: (id, name) VALUES ($Person.*)`,
+	}, {
+		query:       "INSERT INTO t SELECT name FROM person WHERE (id) VALUES ($Person.id)",
+		typeSamples: []any{Person{}},
+		err:         `cannot prepare statement: input expression: columns and VALUES are only valid in an INSERT statement: (id) VALUES ($Person.id)`,
+	}, {
+		query:       "SELECT 'INSERT' /* INSERT */ FROM t WHERE (*) VALUES ($Person.*)",
+		typeSamples: []any{Person{}},
+		err:         `cannot prepare statement: input expression: columns and VALUES are only valid in an INSERT statement: (*) VALUES ($Person.*)`,
+	}, {
+		query:       "SELECT name FROM person UNION SELECT &Person.* FROM manager",
+		typeSamples: []any{Person{}},
+		err:         `cannot prepare statement: output expression: outputs of a compound SELECT must be in the first SELECT: &Person.*`,
+	}, {
+		query:       "SELECT &Person.* FROM person UNION SELECT &Person.*, &Person.id FROM manager",
+		typeSamples: []any{Person{}},
+		err:         `cannot prepare statement: tag "id" of struct "Person" appears more than once in output expressions`,
+	}, {
+		query:       "SELECT &Person.*, (SELECT 1 UNION SELECT 2), &Person.id FROM person",
+		typeSamples: []any{Person{}},
+		err:         `cannot prepare statement: tag "id" of struct "Person" appears more than once in output expressions`,
 	}, {
 		query:       "INSERT INTO t (*) VALUES ($M.*)",
 		typeSamples: []any{sqlair.M{}},
@@ -1108,6 +2204,18 @@ func (s *ExprSuite) TestBindTypesErrors(c *C) {
 		query:       "INSERT INTO t (col1, col2) VALUES ($S.*)",
 		typeSamples: []any{sqlair.S{}},
 		err:         `cannot prepare statement: input expression: cannot use slice with asterisk: (col1, col2) VALUES ($S.*)`,
+	}, {
+		query:       "INSERT INTO t (*) VALUES ($Person.*, $M.id)",
+		typeSamples: []any{Person{}, sqlair.M{}},
+		err:         `cannot prepare statement: input expression: column "id" is provided by both Person.* and M.id: (*) VALUES ($Person.*, $M.id)`,
+	}, {
+		query:       "INSERT INTO t (*) VALUES ($Address.street, $Person.*, $Address.*)",
+		typeSamples: []any{Person{}, Address{}},
+		err:         `cannot prepare statement: input expression: column "id" is provided by both Person.* and Address.*: (*) VALUES ($Address.street, $Person.*, $Address.*)`,
+	}, {
+		query:       "INSERT INTO t (*) VALUES ($Person.name, $M.name)",
+		typeSamples: []any{Person{}, sqlair.M{}},
+		err:         `cannot prepare statement: input expression: column "name" is provided by both Person.name and M.name: (*) VALUES ($Person.name, $M.name)`,
 	}, {
 		query:       "INSERT INTO t (*) VALUES ($Person.missing)",
 		typeSamples: []any{Person{}},
@@ -1127,11 +2235,11 @@ func (s *ExprSuite) TestBindTypesErrors(c *C) {
 	}, {
 		query:       "SELECT &AmbiguousTags.* FROM t",
 		typeSamples: []any{AmbiguousTags{}},
-		err:         `cannot prepare statement: db tag "id" appears in both field "ID2" and field "ID1" of struct "AmbiguousTags"`,
+		err:         `cannot prepare statement: duplicate db tag "id" on fields "ID1" and "ID2" of struct "AmbiguousTags"`,
 	}, {
 		query:       "SELECT &AmbiguousEmbeddedTags.* FROM t",
 		typeSamples: []any{AmbiguousEmbeddedTags{}},
-		err:         `cannot prepare statement: db tag "id" appears in both field "ID2" and field "ID1" of struct "AmbiguousEmbeddedTags"`,
+		err:         `cannot prepare statement: duplicate db tag "id" on fields "A1.ID1" and "A2.ID2" of struct "AmbiguousEmbeddedTags"`,
 	}, {
 		query:       "INSERT INTO t (id) VALUES ($Person.id, $Address.street)",
 		typeSamples: []any{Person{}, Address{}},
@@ -1140,6 +2248,18 @@ func (s *ExprSuite) TestBindTypesErrors(c *C) {
 		query:       "INSERT INTO t (id, street) VALUES ($Person.id)",
 		typeSamples: []any{Person{}, Address{}},
 		err:         `cannot prepare statement: input expression: mismatched number of columns and values: 2 != 1: (id, street) VALUES ($Person.id)`,
+	}, {
+		query:       "SELECT &NestedRow.addr.number FROM t",
+		typeSamples: []any{NestedRow{}},
+		err:         `cannot prepare statement: output expression: type "Address" has no "number" db tag: &NestedRow.addr.number`,
+	}, {
+		query:       "SELECT &NestedRow.id.number FROM t",
+		typeSamples: []any{NestedRow{}},
+		err:         `cannot prepare statement: output expression: cannot get member "number" of field "ID" with type int: &NestedRow.id.number`,
+	}, {
+		query:       "SELECT * FROM t WHERE x = $M.key.nested",
+		typeSamples: []any{sqlair.M{}},
+		err:         `cannot prepare statement: input expression: cannot get nested member "key.nested" of map "M": $M.key.nested`,
 	}}
 
 	for i, test := range tests {
@@ -1156,6 +2276,38 @@ func (s *ExprSuite) TestBindTypesErrors(c *C) {
 	}
 }
 
+func (s *ExprSuite) TestPointerTypeSamples(c *C) {
+	queries := []string{
+		"SELECT &Person.* FROM person WHERE id = $Address.id",
+		"SELECT p.* AS &Person.*, a.district AS &M.district FROM person p, address a WHERE a.id = $M.id",
+		"INSERT INTO person (*) VALUES ($Person.*)",
+	}
+	person, address, m := Person{}, Address{}, sqlair.M{}
+	style := expr.ParamStyle{Prefix: "@", AllowUnusedArgs: true}
+	for _, query := range queries {
+		parsedExpr, err := expr.NewParser().Parse(query)
+		c.Assert(err, IsNil)
+		valueExpr, err := parsedExpr.BindTypes(person, address, m)
+		c.Assert(err, IsNil)
+		pointerExpr, err := parsedExpr.BindTypes(&person, &address, &m)
+		c.Assert(err, IsNil)
+		c.Check(pointerExpr, DeepEquals, valueExpr, Commentf("query: %q", query))
+		c.Check(pointerExpr.Fingerprint(), Equals, valueExpr.Fingerprint())
+
+		pq, err := pointerExpr.BindInputsWithStyle(style, Person{ID: 1}, Address{ID: 2}, sqlair.M{"id": 3})
+		c.Assert(err, IsNil)
+		valuePQ, err := valueExpr.BindInputsWithStyle(style, Person{ID: 1}, Address{ID: 2}, sqlair.M{"id": 3})
+		c.Assert(err, IsNil)
+		c.Check(pq.SQL(), Equals, valuePQ.SQL())
+	}
+
+	// Named samples can be pointers too.
+	parsedExpr, err := expr.NewParser().Parse("SELECT &Boss.* FROM person")
+	c.Assert(err, IsNil)
+	_, err = parsedExpr.BindTypes(sqlair.Named("Boss", &person))
+	c.Assert(err, IsNil)
+}
+
 func (s *ExprSuite) TestMapError(c *C) {
 	type InvalidMap map[int]any
 	type CustomMap map[string]int
@@ -1168,21 +2320,6 @@ func (s *ExprSuite) TestMapError(c *C) {
 		args    []any
 		expect  string
 	}{{
-		"all output into map star",
-		"SELECT &M.* FROM person WHERE name = 'Fred'",
-		[]any{sqlair.M{}},
-		"cannot prepare statement: output expression: cannot use map with asterisk unless columns are specified: &M.*",
-	}, {
-		"all output into map star from table star",
-		"SELECT p.* AS &M.* FROM person WHERE name = 'Fred'",
-		[]any{sqlair.M{}},
-		"cannot prepare statement: output expression: cannot use map with asterisk unless columns are specified: p.* AS &M.*",
-	}, {
-		"all output into map star from lone star",
-		"SELECT * AS &CustomMap.* FROM person WHERE name = 'Fred'",
-		[]any{CustomMap{}},
-		"cannot prepare statement: output expression: cannot use map with asterisk unless columns are specified: * AS &CustomMap.*",
-	}, {
 		"invalid map",
 		"SELECT * AS &InvalidMap.* FROM person WHERE name = 'Fred'",
 		[]any{InvalidMap{}},
@@ -1191,7 +2328,7 @@ func (s *ExprSuite) TestMapError(c *C) {
 		"clashing map and struct names",
 		"SELECT * AS &M.* FROM person WHERE name = $M.id",
 		[]any{M{}, sqlair.M{}},
-		`cannot prepare statement: two types found with name "M": "expr_test.M" and "sqlair.M"`,
+		`cannot prepare statement: two types found with name "M": "expr_test.M" and "sqlair.M", name one of them with sqlair.Named`,
 	}}
 	for _, test := range tests {
 		parser := expr.NewParser()
@@ -1209,6 +2346,26 @@ func (s *ExprSuite) TestBindInputsError(c *C) {
 		inputArgs   []any
 		err         string
 	}{{
+		query:       "INSERT INTO person DEFAULT VALUES",
+		typeSamples: []any{Person{}},
+		inputArgs:   []any{Person{}},
+		err:         `invalid input parameter: argument of type "Person" not used by query`,
+	}, {
+		query:       "SELECT name FROM person WHERE id = $1 AND name = $2",
+		typeSamples: []any{},
+		inputArgs:   []any{1},
+		err:         `invalid input parameter: missing positional argument $2, got 1 positional arguments`,
+	}, {
+		query:       "SELECT name FROM person WHERE id = $1",
+		typeSamples: []any{},
+		inputArgs:   []any{1, 2},
+		err:         `invalid input parameter: positional argument $2 not used by query`,
+	}, {
+		query:       "SELECT name FROM person WHERE id = $1",
+		typeSamples: []any{Person{}},
+		inputArgs:   []any{1, Person{}},
+		err:         `invalid input parameter: positional argument $2 not used by query`,
+	}, {
 		query:       "SELECT street FROM t WHERE x = $Address.street, y = $Person.name",
 		typeSamples: []any{Address{}, Person{}},
 		inputArgs:   []any{Address{Street: "Dead end road"}},
@@ -1223,6 +2380,11 @@ func (s *ExprSuite) TestBindInputsError(c *C) {
 		typeSamples: []any{sqlair.M{}},
 		inputArgs:   []any{(sqlair.M)(nil)},
 		err:         "invalid input parameter: got nil M",
+	}, {
+		query:       "SELECT street FROM t WHERE x = $M.x",
+		typeSamples: []any{sqlair.M{}},
+		inputArgs:   []any{new(sqlair.M)},
+		err:         "invalid input parameter: got nil M",
 	}, {
 		query:       "SELECT street FROM t WHERE x = $Address.street, y = $Person.name",
 		typeSamples: []any{Address{}, Person{}},
@@ -1333,6 +2495,11 @@ func (s *ExprSuite) TestBindInputsError(c *C) {
 		typeSamples: []any{OmitEmptyID{}, M{}},
 		inputArgs:   []any{[]OmitEmptyID{{ID: 0}, {ID: 1}}, M{"key": "val"}},
 		err:         `invalid input parameter: got mix of zero and none zero values in tag "id" of struct "OmitEmptyID" which has the omitempty flag set, in a bulk insert, values must be all zero or all none zero`,
+	}, {
+		query:       "SELECT * FROM t WHERE x = $NestedRow.addr_ptr.district",
+		typeSamples: []any{NestedRow{}},
+		inputArgs:   []any{NestedRow{}},
+		err:         `invalid input parameter: cannot locate tag "addr_ptr.district" of struct "NestedRow": found nil pointer in path to field "AddrPtr.District"`,
 	}}
 
 	outerP := Person{}
@@ -1375,3 +2542,124 @@ func (s *ExprSuite) TestBindInputsError(c *C) {
 		}
 	}
 }
+
+func (s *ExprSuite) TestScanError(c *C) {
+	parsedExpr, err := expr.NewParser().Parse("SELECT p.name AS &Person.id, other FROM person AS p")
+	c.Assert(err, IsNil)
+	typedExpr, err := parsedExpr.BindTypes(Person{})
+	c.Assert(err, IsNil)
+	primedQuery, err := typedExpr.BindInputs()
+	c.Assert(err, IsNil)
+
+	columns := []string{"_sqlair_0", "other"}
+	convErr := errors.New("converting NULL to int is unsupported")
+	scanErr := fmt.Errorf("sql: Scan error on column index 0, name %q: %w", columns[0], convErr)
+	err = primedQuery.ScanError(columns, 0, scanErr)
+	c.Check(err, ErrorMatches, `cannot scan column "p.name" into tag "id" of struct "Person": converting NULL to int is unsupported`)
+	err = primedQuery.ScanError(columns, 1, convErr)
+	c.Check(err, ErrorMatches, `cannot scan column "other": converting NULL to int is unsupported`)
+}
+
+func (s *ExprSuite) TestCheckColumnsMapped(c *C) {
+	parsedExpr, err := expr.NewParser().Parse("SELECT name, &Person.id, count(*) AS &M.*, a.* AS &StringMap.* FROM person, address a")
+	c.Assert(err, IsNil)
+	typedExpr, err := parsedExpr.BindTypes(Person{}, sqlair.M{}, StringMap{})
+	c.Assert(err, IsNil)
+	primedQuery, err := typedExpr.BindInputs()
+	c.Assert(err, IsNil)
+	c.Check(primedQuery.SQL(), Equals, "SELECT name, id AS _sqlair_0, count(*), NULL AS _sqlair_1, a.*, NULL AS _sqlair_2 FROM person, address a")
+
+	// Columns read from the column before a marker or from all the columns
+	// before it are mapped.
+	err = primedQuery.CheckColumnsMapped([]string{"_sqlair_0", "count(*)", "_sqlair_1", "id", "street", "_sqlair_2"})
+	c.Assert(err, IsNil)
+	err = primedQuery.CheckColumnsMapped([]string{"name", "_sqlair_0", "count(*)", "_sqlair_1", "_sqlair_2", "extra"})
+	c.Assert(err, ErrorMatches, `result columns not read into any output: "name", "extra", .*`)
+
+	// A result set without output columns is not checked.
+	err = primedQuery.CheckColumnsMapped([]string{"name"})
+	c.Assert(err, IsNil)
+}
+
+func (s *ExprSuite) TestScanArgsInvalidColumns(c *C) {
+	parsedExpr, err := expr.NewParser().Parse("SELECT &Person.id FROM person")
+	c.Assert(err, IsNil)
+	typedExpr, err := parsedExpr.BindTypes(Person{})
+	c.Assert(err, IsNil)
+	primedQuery, err := typedExpr.BindInputs()
+	c.Assert(err, IsNil)
+
+	// Columns that look like out of range markers must not be used to index
+	// the outputs.
+	_, _, err = primedQuery.ScanArgs([]string{"_sqlair_-1"}, []any{&Person{}}, false)
+	c.Assert(err, ErrorMatches, `query uses "&Person" outside of result context: no result column for tag "id" of struct "Person", unmatched result columns: "_sqlair_-1"`)
+	_, _, err = primedQuery.ScanArgs([]string{"_sqlair_0", "_sqlair_99999999999999999999"}, []any{&Person{}}, false)
+	c.Assert(err, IsNil)
+	_, _, err = primedQuery.ScanArgs([]string{"_sqlair_1"}, []any{&Person{}}, false)
+	c.Assert(err, ErrorMatches, `internal error: sqlair column not in outputs \(1>=1\)`)
+}
+
+// TestFuzzCorpusErrors checks the errors returned for the entries of the
+// FuzzParser corpus in testdata/fuzz/FuzzParser that used to panic.
+func (s *ExprSuite) TestFuzzCorpusErrors(c *C) {
+	tests := []struct {
+		summary string
+		query   string
+		columns []string
+		// err is empty if the query is valid.
+		err string
+	}{{
+		summary: "negative marker column",
+		query:   "SELECT &Person.* FROM t",
+		columns: []string{"_sqlair_-1"},
+		err:     `query uses "&Person" outside of result context: no result column for tag "address_id" of struct "Person", tag "id" of struct "Person", tag "name" of struct "Person", unmatched result columns: "_sqlair_-1"`,
+	}, {
+		summary: "overflowing marker column",
+		query:   "SELECT &Person.* FROM t",
+		columns: []string{"_sqlair_0", "_sqlair_1", "_sqlair_2", "_sqlair_99999999999999999999"},
+	}, {
+		summary: "marker column out of range",
+		query:   "SELECT &Person.id FROM t",
+		columns: []string{"_sqlair_1"},
+		err:     `internal error: sqlair column not in outputs \(1>=1\)`,
+	}, {
+		summary: "empty output columns",
+		query:   "SELECT () AS &Person.* FROM t",
+		err:     `cannot parse expression: column 8: cannot parse columns of output expression`,
+	}, {
+		summary: "slice bounds overflow",
+		query:   "SELECT * FROM t WHERE x IN ($S[99999999999999999999:])",
+		err:     `cannot parse expression: column 30: invalid slice: expected 'S\[:\]'`,
+	}, {
+		summary: "input at end of query",
+		query:   "SELECT * FROM t WHERE x = $Person.",
+		err:     `cannot parse expression: column 35: invalid identifier suffix following "Person"`,
+	}, {
+		summary: "insert expression outside insert",
+		query:   "SELECT (*) VALUES ($Person.*) FROM t",
+		err:     `cannot prepare statement: input expression: columns and VALUES are only valid in an INSERT statement: \(\*\) VALUES \(\$Person.\*\)`,
+	}}
+	for _, t := range tests {
+		err := func() error {
+			parsedExpr, err := expr.NewParser().Parse(t.query)
+			if err != nil {
+				return err
+			}
+			typedExpr, err := parsedExpr.BindTypes(Person{})
+			if err != nil {
+				return err
+			}
+			primedQuery, err := typedExpr.BindInputs()
+			if err != nil {
+				return err
+			}
+			_, _, err = primedQuery.ScanArgs(t.columns, []any{&Person{}}, false)
+			return err
+		}()
+		if t.err == "" {
+			c.Check(err, IsNil, Commentf(t.summary))
+		} else {
+			c.Check(err, ErrorMatches, t.err, Commentf(t.summary))
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Canonical Ltd.
+// Licensed under Apache 2.0, see LICENCE file for details.
+
+package expr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// fingerprintVersion is hashed before the expressions. It must be bumped if
+// the encoding written by the fingerprintWriter changes.
+const fingerprintVersion = "sqlair-fingerprint-v1"
+
+// Fingerprint returns a hash of the structure of the type bound expression
+// and the SQL it generates that does not depend on the input arguments.
+// Whitespace outside of string literals does not affect the fingerprint.
+//
+// The fingerprint must remain stable across patch releases. The golden values
+// in TestFingerprint must only be changed along with a note in the release
+// notes.
+func (tbe *TypeBoundExpr) Fingerprint() string {
+	fw := newFingerprintWriter()
+	for _, te := range tbe.typedExprs {
+		te.fingerprint(fw)
+	}
+	return fw.sum()
+}
+
+// fingerprintWriter accumulates an unambiguous encoding of a type bound
+// expression into a hash.
+type fingerprintWriter struct {
+	h hash.Hash
+}
+
+// newFingerprintWriter returns a fingerprintWriter that has been initialised
+// with the fingerprint version.
+func newFingerprintWriter() *fingerprintWriter {
+	fw := &fingerprintWriter{h: sha256.New()}
+	fw.write(fingerprintVersion)
+	return fw
+}
+
+// write adds a node of the given kind with the given fields to the
+// fingerprint. Each string is prefixed with its length so that the encoding
+// of different nodes never collides.
+func (fw *fingerprintWriter) write(kind string, fields ...string) {
+	fw.writeString(kind)
+	fw.writeString(strconv.Itoa(len(fields)))
+	for _, f := range fields {
+		fw.writeString(f)
+	}
+}
+
+// writeString writes a length prefixed string to the hash.
+func (fw *fingerprintWriter) writeString(s string) {
+	fw.h.Write([]byte(strconv.Itoa(len(s))))
+	fw.h.Write([]byte{':'})
+	fw.h.Write([]byte(s))
+}
+
+// sum returns the hex encoded hash of everything written so far.
+func (fw *fingerprintWriter) sum() string {
+	return hex.EncodeToString(fw.h.Sum(nil))
+}
+
+// normalizeWhitespace replaces each run of whitespace in the SQL outside of
+// quotes with a single space and trims whitespace from both ends. A backslash
+// inside quotes is taken to escape the next character. When backslash escapes
+// are disabled this can only cause whitespace to be preserved where it could
+// have been collapsed.
+func normalizeWhitespace(sql string) string {
+	var sb strings.Builder
+	var quote rune
+	escaped := false
+	space := false
+	for _, c := range sql {
+		switch {
+		case quote != 0:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == quote:
+				quote = 0
+			}
+		case unicode.IsSpace(c):
+			space = true
+			continue
+		case c == '\'' || c == '"':
+			quote = c
+		}
+		if space {
+			sb.WriteRune(' ')
+			space = false
+		}
+		sb.WriteRune(c)
+	}
+	return strings.TrimSpace(sb.String())
+}
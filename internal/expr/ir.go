@@ -0,0 +1,205 @@
+// Copyright 2024 Canonical Ltd.
+// Licensed under Apache 2.0, see LICENCE file for details.
+
+package expr
+
+import (
+	"fmt"
+)
+
+// irKind is the kind of an IR node.
+type irKind int
+
+const (
+	irBypass irKind = iota + 1
+	irMemberInput
+	irSliceInput
+	irOutput
+	irAsteriskInsert
+	irColumnsInsert
+	irBasicInsert
+	irPositionalInput
+)
+
+func (k irKind) String() string {
+	switch k {
+	case irBypass:
+		return "bypass"
+	case irMemberInput:
+		return "member input"
+	case irSliceInput:
+		return "slice input"
+	case irOutput:
+		return "output"
+	case irAsteriskInsert:
+		return "asterisk insert"
+	case irColumnsInsert:
+		return "columns insert"
+	case irBasicInsert:
+		return "basic insert"
+	case irPositionalInput:
+		return "positional input"
+	}
+	return fmt.Sprintf("kind(%d)", int(k))
+}
+
+// irFlags record details of a node that are not held in its other fields,
+// such as how it is written or the clause it is in.
+type irFlags uint
+
+const (
+	// irParentheses is set on output nodes with columns enclosed in
+	// parentheses.
+	irParentheses irFlags = 1 << iota
+	// irSourceInBypass is set on output nodes with no columns that read the
+	// SQL expression in the bypass before them.
+	irSourceInBypass
+	// irAssignment is set on member input nodes whose value is assigned to
+	// a column.
+	irAssignment
+)
+
+// irSpan is the position of a node in the query as byte offsets.
+type irSpan struct {
+	start, end int
+}
+
+// irNode is a single node of the IR. Which of the fields are set depends on
+// the kind of the node.
+type irNode struct {
+	kind irKind
+	// raw is the text of the node in the query. The raw text of a bypass node
+	// is passed to the database verbatim.
+	raw   string
+	span  irSpan
+	flags irFlags
+	// columns are the columns of output and insert expressions.
+	columns []columnAccessor
+	// members are the member of a member input expression, the target types
+	// of an output expression or the sources of an insert expression.
+	members []memberAccessor
+	// values are the sources of a basic insert expression.
+	values []valueAccessor
+	// typeName is the type of a slice input expression.
+	typeName string
+	// position is the position of the argument of a positional input
+	// expression.
+	position int
+}
+
+// irProgram is the IR of a query. Its nodes cover the whole query in order.
+type irProgram struct {
+	query string
+	nodes []irNode
+}
+
+// newIRProgram generates the IR for the query from the parsed expressions and
+// their positions in the query.
+func newIRProgram(query string, exprs []expression, spans []irSpan) *irProgram {
+	nodes := make([]irNode, 0, len(exprs))
+	for i, expr := range exprs {
+		n := expr.irNode()
+		n.span = spans[i]
+		nodes = append(nodes, n)
+	}
+	return &irProgram{query: query, nodes: nodes}
+}
+
+// expressions converts the IR back into expressions for type binding. It
+// returns an error if the program contains a node of an unknown kind.
+func (ir *irProgram) expressions() ([]expression, error) {
+	exprs := make([]expression, 0, len(ir.nodes))
+	for _, n := range ir.nodes {
+		expr, err := n.expression()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+	return exprs, nil
+}
+
+// expression converts the node into the expression it represents.
+func (n *irNode) expression() (expression, error) {
+	switch n.kind {
+	case irBypass:
+		return &bypass{chunk: n.raw}, nil
+	case irMemberInput:
+		if len(n.members) != 1 {
+			return nil, fmt.Errorf("internal error: %s expression with %d members", n.kind, len(n.members))
+		}
+		return &memberInputExpr{ma: n.members[0], raw: n.raw, assignment: n.flags&irAssignment != 0}, nil
+	case irSliceInput:
+		return &sliceInputExpr{sliceTypeName: n.typeName, raw: n.raw}, nil
+	case irOutput:
+		return &outputExpr{
+			sourceColumns:  n.columns,
+			targetTypes:    n.members,
+			parentheses:    n.flags&irParentheses != 0,
+			sourceInBypass: n.flags&irSourceInBypass != 0,
+			raw:            n.raw,
+		}, nil
+	case irAsteriskInsert:
+		return &asteriskInsertExpr{sources: n.members, raw: n.raw}, nil
+	case irColumnsInsert:
+		return &columnsInsertExpr{columns: n.columns, sources: n.members, raw: n.raw}, nil
+	case irBasicInsert:
+		return &basicInsertExpr{columns: n.columns, sources: n.values, raw: n.raw}, nil
+	case irPositionalInput:
+		return &positionalInputExpr{position: n.position, raw: n.raw}, nil
+	}
+	return nil, fmt.Errorf("internal error: unknown expression kind %s", n.kind)
+}
+
+// String returns a text representation of the expression represented by the
+// node for debugging and testing purposes.
+func (n *irNode) String() string {
+	expr, err := n.expression()
+	if err != nil {
+		return "Invalid[" + err.Error() + "]"
+	}
+	return expr.String()
+}
+
+func (b *bypass) irNode() irNode {
+	return irNode{kind: irBypass, raw: b.chunk}
+}
+
+func (e *memberInputExpr) irNode() irNode {
+	n := irNode{kind: irMemberInput, raw: e.raw, members: []memberAccessor{e.ma}}
+	if e.assignment {
+		n.flags |= irAssignment
+	}
+	return n
+}
+
+func (e *sliceInputExpr) irNode() irNode {
+	return irNode{kind: irSliceInput, raw: e.raw, typeName: e.sliceTypeName}
+}
+
+func (e *outputExpr) irNode() irNode {
+	n := irNode{kind: irOutput, raw: e.raw, columns: e.sourceColumns, members: e.targetTypes}
+	if e.parentheses {
+		n.flags |= irParentheses
+	}
+	if e.sourceInBypass {
+		n.flags |= irSourceInBypass
+	}
+	return n
+}
+
+func (e *asteriskInsertExpr) irNode() irNode {
+	return irNode{kind: irAsteriskInsert, raw: e.raw, members: e.sources}
+}
+
+func (e *columnsInsertExpr) irNode() irNode {
+	return irNode{kind: irColumnsInsert, raw: e.raw, columns: e.columns, members: e.sources}
+}
+
+func (e *basicInsertExpr) irNode() irNode {
+	return irNode{kind: irBasicInsert, raw: e.raw, columns: e.columns, values: e.sources}
+}
+
+func (e *positionalInputExpr) irNode() irNode {
+	return irNode{kind: irPositionalInput, raw: e.raw, position: e.position}
+}
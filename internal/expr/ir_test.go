@@ -0,0 +1,87 @@
+// Copyright 2024 Canonical Ltd.
+// Licensed under Apache 2.0, see LICENCE file for details.
+
+package expr
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type irSuite struct{}
+
+var _ = Suite(&irSuite{})
+
+func (s irSuite) TestIRUnknownKind(c *C) {
+	pe, err := NewParser().Parse("SELECT &M.* FROM t WHERE x = $M.x")
+	c.Assert(err, IsNil)
+
+	// Node kinds unknown to the binder are refused.
+	unknown := *pe.ir
+	unknown.nodes = append([]irNode{{kind: irPositionalInput + 1}}, pe.ir.nodes...)
+	_, err = (&ParsedExpr{ir: &unknown}).BindTypes(map[string]any{})
+	c.Assert(err, ErrorMatches, `cannot prepare statement: internal error: unknown expression kind kind\(9\)`)
+}
+
+func (s irSuite) TestIRNodes(c *C) {
+	query := "SELECT (a, b) AS (&T.a, &T.b) FROM t WHERE c IN ($S[:]) AND d = $T.d"
+	pe, err := NewParser().Parse(query)
+	c.Assert(err, IsNil)
+
+	var kinds []irKind
+	for _, n := range pe.ir.nodes {
+		kinds = append(kinds, n.kind)
+	}
+	c.Assert(kinds, DeepEquals, []irKind{irBypass, irOutput, irBypass, irSliceInput, irBypass, irMemberInput})
+
+	output := pe.ir.nodes[1]
+	c.Check(output.raw, Equals, "(a, b) AS (&T.a, &T.b)")
+	c.Check(output.span, Equals, irSpan{start: 7, end: 29})
+	c.Check(output.flags&irParentheses, Equals, irParentheses)
+	c.Check(pe.ir.nodes[3].typeName, Equals, "S")
+	c.Check(pe.ir.nodes[5].members, DeepEquals, []memberAccessor{{typeName: "T", memberName: "d"}})
+}
+
+func (s irSuite) TestIRAssignments(c *C) {
+	tests := []struct {
+		query       string
+		assignments []bool
+	}{{
+		query:       "UPDATE t SET a = $T.a, t.b=$T.b WHERE c = $T.c AND d = $T.d",
+		assignments: []bool{true, true, false, false},
+	}, {
+		query:       "UPDATE t SET a = COALESCE($T.a, a), b = $T.b FROM u WHERE t.id = u.id, e = $T.e",
+		assignments: []bool{false, true, false},
+	}, {
+		query:       "INSERT INTO t (a) VALUES ($T.a) ON CONFLICT (a) DO UPDATE SET b = $T.b",
+		assignments: []bool{true},
+	}, {
+		query:       "INSERT INTO t (a) VALUES ($T.a) ON DUPLICATE KEY UPDATE b = $T.b, c = $T.c",
+		assignments: []bool{true, true},
+	}, {
+		query:       "SELECT a, b = $T.b FROM t WHERE offset = $T.c",
+		assignments: []bool{false, false},
+	}, {
+		query:       "SELECT a FROM t WHERE reset = $T.a",
+		assignments: []bool{false},
+	}, {
+		query:       "UPDATE job SET status = $T.status, x = (SELECT 1 FROM u WHERE y = 2), note = $T.note WHERE id = $T.id",
+		assignments: []bool{true, true, false},
+	}, {
+		query:       "UPDATE job SET x = 'WHERE', /* WHERE */ \"select\" = $T.a, note = $T.note",
+		assignments: []bool{true, true},
+	}, {
+		query:       "UPDATE t SET price$ = $T.a, u.b = CASE WHEN c = $T.c THEN 1 END, d = $T.d",
+		assignments: []bool{true, false, true},
+	}}
+	for _, t := range tests {
+		pe, err := NewParser().Parse(t.query)
+		c.Assert(err, IsNil)
+		var assignments []bool
+		for _, n := range pe.ir.nodes {
+			if n.kind == irMemberInput {
+				assignments = append(assignments, n.flags&irAssignment != 0)
+			}
+		}
+		c.Check(assignments, DeepEquals, t.assignments, Commentf("query: %s", t.query))
+	}
+}
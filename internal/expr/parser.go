@@ -5,6 +5,7 @@ package expr
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -14,6 +15,52 @@ func NewParser() *Parser {
 	return &Parser{}
 }
 
+// NewParserWithOptions returns a Parser that parses the SQL dialect described
+// by opts.
+func NewParserWithOptions(opts ParserOptions) *Parser {
+	return &Parser{options: opts}
+}
+
+// ParserOptions describes features of the SQL dialect that change how the
+// query is parsed.
+type ParserOptions struct {
+	// BackslashEscapes enables MySQL style backslash escapes within quoted
+	// string literals, e.g. 'O\'Donnell'.
+	BackslashEscapes bool
+	// MaxQueryLength is the maximum length of a query in bytes. If it is
+	// zero then DefaultMaxQueryLength is used, if it is negative there is no
+	// limit.
+	MaxQueryLength int
+	// MaxExpressions is the maximum number of SQLair expressions in a
+	// query. If it is zero then DefaultMaxExpressions is used, if it is
+	// negative there is no limit.
+	MaxExpressions int
+	// MultipleStatements allows the query to contain several statements
+	// separated by semicolons.
+	MultipleStatements bool
+}
+
+const (
+	// DefaultMaxQueryLength is the default maximum length of a query in
+	// bytes.
+	DefaultMaxQueryLength = 1 << 20
+	// DefaultMaxExpressions is the default maximum number of SQLair
+	// expressions in a query.
+	DefaultMaxExpressions = 1 << 16
+)
+
+// limit returns the limit to use given the configured value and the default.
+// It returns -1 if there is no limit.
+func limit(configured, defaultLimit int) int {
+	switch {
+	case configured == 0:
+		return defaultLimit
+	case configured < 0:
+		return -1
+	}
+	return configured
+}
+
 type Parser struct {
 	input string
 	pos   int
@@ -31,11 +78,28 @@ type Parser struct {
 	// exprs are the output of the parser. Expressions are added as they are
 	// parsed.
 	exprs []expression
+	// spans are the positions of exprs in the input.
+	spans []irSpan
 	// lineNum is the number of the current line of the input.
 	lineNum int
 	// lineStart is the position of the first char of the current line in the
 	// input.
 	lineStart int
+	// options are the dialect options used when parsing. They are not reset
+	// between calls to Parse.
+	options ParserOptions
+	// parens holds the position after the matching closing parenthesis of
+	// each opening parenthesis in the input. It is built on first use.
+	parens map[int]checkpoint
+	// caseEnds holds the position after the matching END keyword of each
+	// CASE keyword that has been scanned.
+	caseEnds map[int]checkpoint
+	// inCase is true if the parser is parsing the inside of a CASE
+	// expression.
+	inCase bool
+	// assignments holds the positions of the input expressions that are
+	// assigned to a column. It is built on first use.
+	assignments map[int]bool
 }
 
 // Parse takes an SQLair query string and returns a ParsedExpr.
@@ -46,11 +110,29 @@ func (p *Parser) Parse(input string) (pe *ParsedExpr, err error) {
 		}
 	}()
 
+	if maxLength := limit(p.options.MaxQueryLength, DefaultMaxQueryLength); maxLength >= 0 && len(input) > maxLength {
+		return nil, fmt.Errorf("query is %d bytes long, more than the limit of %d bytes", len(input), maxLength)
+	}
 	p.init(input)
+	end, err := p.statementEnd()
+	if err != nil {
+		return nil, err
+	}
+	p.init(input[:end])
+	if err := p.parseExprs(); err != nil {
+		return nil, err
+	}
+	return &ParsedExpr{ir: newIRProgram(p.input, p.exprs, p.spans)}, nil
+}
 
+// parseExprs parses expressions from the current position of the parser to the
+// end of the input and adds them to p.exprs.
+func (p *Parser) parseExprs() error {
+	maxExprs := limit(p.options.MaxExpressions, DefaultMaxExpressions)
+	numExprs := 0
 	for {
 		if err := p.advanceToNextExpression(); err != nil {
-			return nil, err
+			return err
 		}
 
 		p.currentExprStart = p.pos
@@ -59,28 +141,38 @@ func (p *Parser) Parse(input string) (pe *ParsedExpr, err error) {
 			break
 		}
 
+		var expr expression
+		start := p.save()
 		if out, ok, err := p.parseOutputExpr(); err != nil {
-			return nil, err
+			return err
 		} else if ok {
-			p.add(out)
-			continue
-		}
-
-		if in, ok, err := p.parseInputExpr(); err != nil {
-			return nil, err
+			expr = out
+		} else if in, ok, err := p.parseInputExpr(); err != nil {
+			return err
 		} else if ok {
-			p.add(in)
+			expr = in
+		}
+		if expr != nil {
+			numExprs++
+			if maxExprs >= 0 && numExprs > maxExprs {
+				return errorAt(fmt.Errorf("query has more than %d expressions", maxExprs), start.lineNum, start.colNum(), p.input)
+			}
+			p.add(expr)
 			continue
 		}
 
 		// No expression found, advance the parser. This prevents
-		// advanceToNextExpression finding the same char again.
-		p.advanceChar()
+		// advanceToNextExpression finding the same char again. A numeric
+		// literal is skipped whole so that an expression is not found
+		// part way through it, e.g. after the '-' in 1e-3.
+		if !p.skipNumericLiteral() {
+			p.advanceChar()
+		}
 	}
 
 	// Add any remaining unparsed string input to the parser.
 	p.add(nil)
-	return &ParsedExpr{exprs: p.exprs}, nil
+	return nil
 }
 
 type columnAccessor interface {
@@ -126,6 +218,27 @@ func (sfc sqlFunctionCall) String() string {
 	return sfc.raw
 }
 
+// caseExpression stores a CASE expression that is used in place of a column.
+// The expressions inside it may contain input expressions.
+type caseExpression struct {
+	raw   string
+	exprs []expression
+	// start is the position of the CASE keyword in the input.
+	start checkpoint
+}
+
+func (ce caseExpression) columnName() string {
+	return ce.raw
+}
+
+func (ce caseExpression) tableName() string {
+	return ""
+}
+
+func (ce caseExpression) String() string {
+	return ce.raw
+}
+
 // init resets the state of the parser and sets the input string.
 func (p *Parser) init(input string) {
 	p.input = input
@@ -135,8 +248,12 @@ func (p *Parser) init(input string) {
 	p.prevExprEnd = 0
 	p.currentExprStart = 0
 	p.exprs = []expression{}
+	p.spans = []irSpan{}
 	p.lineNum = 1
 	p.lineStart = 0
+	p.parens = nil
+	p.caseEnds = nil
+	p.assignments = nil
 	p.advanceChar()
 }
 
@@ -167,16 +284,35 @@ func (p *Parser) advanceChar() bool {
 
 // errorAt wraps an error with line and column information.
 func errorAt(err error, line int, column int, input string) error {
-	if strings.ContainsRune(input, '\n') {
-		return fmt.Errorf("line %d, column %d: %w", line, column, err)
-	} else {
-		return fmt.Errorf("column %d: %w", column, err)
+	return &positionError{err: err, line: line, column: column, input: input}
+}
+
+// positionError is an error with a line and column in the input. Many errors
+// are discarded while trying to parse the different expressions so the
+// message is not formatted until it is needed.
+type positionError struct {
+	err          error
+	line, column int
+	input        string
+}
+
+func (e *positionError) Error() string {
+	if strings.ContainsRune(e.input, '\n') {
+		return fmt.Sprintf("line %d, column %d: %s", e.line, e.column, e.err)
 	}
+	return fmt.Sprintf("column %d: %s", e.column, e.err)
+}
+
+func (e *positionError) Unwrap() error {
+	return e.err
 }
 
 // A checkpoint struct for saving parser state to restore later. We only use a
 // checkpoint within an attempted parsing of an expression, not at a higher
 // level since we don't keep track of the expressions in the checkpoint.
+// Checkpoints are taken on every char of some hot paths so they are kept
+// small and are not allocated on the heap. Expressions are only ever appended
+// to the parser so the checkpoint just stores how many there were.
 type checkpoint struct {
 	parser           *Parser
 	pos              int
@@ -184,22 +320,22 @@ type checkpoint struct {
 	char             rune
 	prevExprEnd      int
 	currentExprStart int
-	exprs            []expression
+	numExprs         int
 	lineNum          int
 	lineStart        int
 }
 
-// save takes a snapshot of the state of the parser and returns a pointer to a
-// checkpoint that represents it.
-func (p *Parser) save() *checkpoint {
-	return &checkpoint{
+// save takes a snapshot of the state of the parser and returns a checkpoint
+// that represents it.
+func (p *Parser) save() checkpoint {
+	return checkpoint{
 		parser:           p,
 		pos:              p.pos,
 		nextPos:          p.nextPos,
 		char:             p.char,
 		prevExprEnd:      p.prevExprEnd,
 		currentExprStart: p.currentExprStart,
-		exprs:            p.exprs,
+		numExprs:         len(p.exprs),
 		lineNum:          p.lineNum,
 		lineStart:        p.lineStart,
 	}
@@ -213,11 +349,22 @@ func (cp *checkpoint) restore() {
 	cp.parser.char = cp.char
 	cp.parser.prevExprEnd = cp.prevExprEnd
 	cp.parser.currentExprStart = cp.currentExprStart
-	cp.parser.exprs = cp.exprs
+	cp.parser.exprs = cp.parser.exprs[:cp.numExprs]
+	cp.parser.spans = cp.parser.spans[:cp.numExprs]
 	cp.parser.lineNum = cp.lineNum
 	cp.parser.lineStart = cp.lineStart
 }
 
+// apply sets the position of another parser over the same input to the
+// position stored in the checkpoint.
+func (cp *checkpoint) apply(p *Parser) {
+	p.pos = cp.pos
+	p.nextPos = cp.nextPos
+	p.char = cp.char
+	p.lineNum = cp.lineNum
+	p.lineStart = cp.lineStart
+}
+
 // colNum calculates the current column number taking into account line breaks.
 func (cp *checkpoint) colNum() int {
 	return cp.pos - cp.lineStart + 1
@@ -231,10 +378,12 @@ func (p *Parser) add(expr expression) {
 	if p.prevExprEnd != p.currentExprStart {
 		p.exprs = append(p.exprs,
 			&bypass{p.input[p.prevExprEnd:p.currentExprStart]})
+		p.spans = append(p.spans, irSpan{start: p.prevExprEnd, end: p.currentExprStart})
 	}
 
 	if expr != nil {
 		p.exprs = append(p.exprs, expr)
+		p.spans = append(p.spans, irSpan{start: p.currentExprStart, end: p.pos})
 	}
 
 	// Save this position at the end of the expression.
@@ -246,6 +395,9 @@ func (p *Parser) add(expr expression) {
 // skipComment jumps over comments as defined by the SQLite spec. If no comment
 // is found the parser state is left unchanged.
 func (p *Parser) skipComment() bool {
+	if p.char != '-' && p.char != '/' {
+		return false
+	}
 	cp := p.save()
 	c := p.char
 	if p.skipChar('-') || p.skipChar('/') {
@@ -278,6 +430,13 @@ func (p *Parser) skipComment() bool {
 	return false
 }
 
+// peekOptimizerHint returns true if the parser is at the start of an optimizer
+// hint comment, e.g. /*+ MAX_EXECUTION_TIME(1000) */. Hints are passed to the
+// database verbatim and their contents are never parsed.
+func (p *Parser) peekOptimizerHint() bool {
+	return strings.HasPrefix(p.input[p.pos:], "/*+")
+}
+
 // advanceToNextExpression advances the parser until it finds a character that
 // could be the start of an expression.
 func (p *Parser) advanceToNextExpression() error {
@@ -296,39 +455,169 @@ loop:
 		if ok := p.skipComment(); ok {
 			continue
 		}
+		if p.skipDollarQuotedLiteral() {
+			continue
+		}
 
 		switch p.char {
 		// These characters may be the start of an expression.
-		case '(', '*', '$', '&':
+		case '(', '*':
 			break loop
+		case '$', '&':
+			// A '$' after a name char is part of the name, e.g. "price$". A
+			// '&' after a name char or a number is the bitwise AND operator,
+			// e.g. "flags&Mask".
+			if prev, _ := utf8.DecodeLastRuneInString(p.input[:p.pos]); p.pos == 0 || !isNameChar(prev) {
+				break loop
+			}
 		// An expression can also start with a name char, e.g. an expression
 		// starting with a column name or a SQL function. Rather than testing
 		// for every name char (we would stop at every letter of every word),
 		// we look for chars that may come before the start of an expression
 		// and then check if the next char is an name char.
-		case ' ', '\t', '\n', '\r', '=', ',', '[', '>', '<', '+', '-', '/', '|', '%':
+		case ' ', '\t', '\n', '\r', '=', ',', '[', ')', '>', '<', '+', '-', '/', '|', '%':
 			p.advanceChar()
 			if p.pos >= len(p.input) {
 				return nil
 			}
-			if isNameChar(p.char) {
+			// A blob literal starts with a name char but cannot be the
+			// start of an expression.
+			if ok, err := p.skipBlobLiteral(); err != nil {
+				return err
+			} else if ok {
+				continue
+			}
+			// A numeric literal such as .5 may be the column of an output
+			// expression.
+			if isNameChar(p.char) || p.char == '.' && p.nextPos < len(p.input) && isDigit(rune(p.input[p.nextPos])) {
 				break loop
 			}
 			continue
 		}
 		p.advanceChar()
 	}
-	p.skipBlanks()
+	// Blanks, comments and optimizer hints before the expression are left in
+	// the bypass part.
+	for p.skipBlanks() || p.skipComment() {
+	}
 	return nil
 }
 
-// skipStringLiteral jumps over single and double quoted sections of input.
-// Doubled up quotes are escaped.
+// statementEnd returns the end of the statement at the start of the input,
+// just after the semicolon ending it. Blanks and comments after the semicolon
+// are not part of the statement, so a query is sent to the database in the
+// same way whether or not it ends with a semicolon. Semicolons inside
+// BEGIN ... END and CASE ... END blocks, such as those in the body of a
+// trigger or procedure, do not end the statement. If another statement
+// follows, an error is returned unless multiple statements are enabled, in
+// which case the statements run to the end of the input.
+//
+// Errors in string literals are left for the parser to report, the end of
+// the input is returned for them.
+func (p *Parser) statementEnd() (int, error) {
+	depth := 0
+	statementStart := true
+	for p.pos < len(p.input) {
+		if ok, err := p.skipStringLiteral(); err != nil {
+			return len(p.input), nil
+		} else if ok {
+			statementStart = false
+			continue
+		}
+		if p.skipComment() {
+			continue
+		}
+		if p.skipDollarQuotedLiteral() {
+			statementStart = false
+			continue
+		}
+		switch {
+		case p.char == ';':
+			startLine := p.lineNum
+			startCol := p.colNum()
+			p.advanceChar()
+			if depth > 0 {
+				statementStart = true
+				continue
+			}
+			end := p.pos
+			for p.skipBlanks() || p.skipComment() {
+			}
+			if p.pos == len(p.input) {
+				return end, nil
+			}
+			if !p.options.MultipleStatements {
+				return 0, errorAt(fmt.Errorf("multiple statements are not supported"), startLine, startCol, p.input)
+			}
+			statementStart = true
+		case isNameChar(p.char):
+			wordStart := p.pos
+			for p.pos < len(p.input) && isNameChar(p.char) {
+				p.advanceChar()
+			}
+			switch strings.ToUpper(p.input[wordStart:p.pos]) {
+			case "BEGIN":
+				// A BEGIN starting a statement outside of a block
+				// starts a transaction rather than a block.
+				if !statementStart || depth > 0 {
+					depth++
+				}
+			case "CASE":
+				depth++
+			case "END":
+				if depth > 0 && !p.endsControlStatement() {
+					depth--
+				}
+			}
+			statementStart = false
+		case p.char == ' ' || p.char == '\t' || p.char == '\r' || p.char == '\n':
+			p.advanceChar()
+		default:
+			p.advanceChar()
+			statementStart = false
+		}
+	}
+	return len(p.input), nil
+}
+
+// endsControlStatement returns true if the END keyword before the parser
+// closes a control statement that has no matching BEGIN or CASE, e.g. the
+// END IF of a stored procedure.
+func (p *Parser) endsControlStatement() bool {
+	cp := p.save()
+	defer cp.restore()
+	p.skipBlanks()
+	for _, keyword := range []string{"IF", "LOOP", "WHILE", "REPEAT", "FOR"} {
+		if p.skipKeyword(keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipStringLiteral jumps over single and double quoted sections of input and
+// hex blob literals.
+// Doubled up quotes are escaped. If the BackslashEscapes option is set, any
+// character preceded by a backslash is also escaped.
 func (p *Parser) skipStringLiteral() (bool, error) {
+	if ok, err := p.skipBlobLiteral(); err != nil || ok {
+		return ok, err
+	}
+	if p.char != '"' && p.char != '\'' {
+		return false, nil
+	}
+
 	cp := p.save()
 
 	c := p.char
 	if p.skipChar('"') || p.skipChar('\'') {
+		if p.options.BackslashEscapes {
+			if p.skipBackslashEscapedLiteral(c) {
+				return true, nil
+			}
+			cp.restore()
+			return false, errorAt(fmt.Errorf("missing closing quote in string literal"), p.lineNum, p.colNum(), p.input)
+		}
 
 		// We keep track of whether the next quote has been previously
 		// escaped. If not, it might be a closing quote.
@@ -349,6 +638,167 @@ func (p *Parser) skipStringLiteral() (bool, error) {
 	return false, nil
 }
 
+// skipBlobLiteral jumps over a hex blob literal such as X'DEADBEEF'. The
+// contents of the literal are skipped verbatim, they cannot contain quotes or
+// escapes.
+func (p *Parser) skipBlobLiteral() (bool, error) {
+	if p.char != 'X' && p.char != 'x' {
+		return false, nil
+	}
+	// The prefix must not be the end of a longer name.
+	if prev, _ := utf8.DecodeLastRuneInString(p.input[:p.pos]); p.pos > 0 && isNameChar(prev) {
+		return false, nil
+	}
+	if p.nextPos >= len(p.input) || p.input[p.nextPos] != '\'' {
+		return false, nil
+	}
+
+	cp := p.save()
+	p.advanceChar()
+	p.advanceChar()
+	if p.skipCharFind('\'') {
+		return true, nil
+	}
+	cp.restore()
+	return false, errorAt(fmt.Errorf("missing closing quote in blob literal"), p.lineNum, p.colNum(), p.input)
+}
+
+// skipDollarQuotedLiteral jumps over a PostgreSQL dollar quoted string such as
+// $$text$$ or $tag$text$tag$, often used for the bodies of functions. It
+// returns false if the parser is not at the start of a dollar quoted string or
+// the string is not closed.
+func (p *Parser) skipDollarQuotedLiteral() bool {
+	if p.char != '$' {
+		return false
+	}
+	// The opening dollar must not be part of a name, e.g. price$.
+	if prev, _ := utf8.DecodeLastRuneInString(p.input[:p.pos]); p.pos > 0 && isNameChar(prev) {
+		return false
+	}
+	tagEnd := p.pos + 1
+	for tagEnd < len(p.input) && p.input[tagEnd] != '$' {
+		c, size := utf8.DecodeRuneInString(p.input[tagEnd:])
+		if !(isNameChar(c) && (tagEnd > p.pos+1 || !unicode.IsDigit(c))) {
+			return false
+		}
+		tagEnd += size
+	}
+	if tagEnd >= len(p.input) {
+		return false
+	}
+	delimiter := p.input[p.pos : tagEnd+1]
+	closing := strings.Index(p.input[tagEnd+1:], delimiter)
+	if closing == -1 {
+		return false
+	}
+	end := tagEnd + 1 + closing + len(delimiter)
+	for p.pos < end {
+		p.advanceChar()
+	}
+	return true
+}
+
+// skipNumericLiteral jumps over a numeric literal such as 42, 1.5, .5, 1e-10,
+// 1_000 or 0x1F. It returns false if the parser is not at the start of a
+// numeric literal or if the literal runs into a name, e.g. 1abc.
+func (p *Parser) skipNumericLiteral() bool {
+	if prev, _ := utf8.DecodeLastRuneInString(p.input[:p.pos]); p.pos > 0 && (isNameChar(prev) || prev == '.') {
+		return false
+	}
+	cp := p.save()
+	if p.skipHexDigits("0x") || p.skipHexDigits("0X") {
+		if p.pos < len(p.input) && isNameChar(p.char) {
+			cp.restore()
+			return false
+		}
+		return true
+	}
+	digits := p.skipDigits()
+	if p.skipChar('.') {
+		if !p.skipDigits() && !digits {
+			cp.restore()
+			return false
+		}
+	} else if !digits {
+		return false
+	}
+	if p.char == 'e' || p.char == 'E' {
+		exp := p.save()
+		p.advanceChar()
+		if !p.skipChar('+') {
+			p.skipChar('-')
+		}
+		if !p.skipDigits() {
+			exp.restore()
+		}
+	}
+	if p.pos < len(p.input) && (isNameChar(p.char) || p.char == '.' || p.char == '$') {
+		cp.restore()
+		return false
+	}
+	return true
+}
+
+// skipDigits jumps over a run of decimal digits and underscores that starts
+// with a digit.
+func (p *Parser) skipDigits() bool {
+	if p.pos >= len(p.input) || !isDigit(p.char) {
+		return false
+	}
+	for p.pos < len(p.input) && (isDigit(p.char) || p.char == '_') {
+		p.advanceChar()
+	}
+	return true
+}
+
+// skipHexDigits jumps over the prefix and the run of hex digits and
+// underscores that follows it.
+func (p *Parser) skipHexDigits(prefix string) bool {
+	if !strings.HasPrefix(p.input[p.pos:], prefix) || len(p.input) <= p.pos+len(prefix) ||
+		!isHexDigit(rune(p.input[p.pos+len(prefix)])) {
+		return false
+	}
+	for range prefix {
+		p.advanceChar()
+	}
+	for p.pos < len(p.input) && (isHexDigit(p.char) || p.char == '_') {
+		p.advanceChar()
+	}
+	return true
+}
+
+func isDigit(c rune) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isHexDigit(c rune) bool {
+	return isDigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// skipBackslashEscapedLiteral advances the parser past the closing quote c of
+// a string literal whose opening quote has already been skipped. Characters
+// preceded by a backslash and doubled up quotes are escaped. It returns false
+// if the closing quote is not found.
+func (p *Parser) skipBackslashEscapedLiteral(c rune) bool {
+	for p.pos < len(p.input) {
+		switch p.char {
+		case '\\':
+			// Skip the backslash and the char it escapes.
+			p.advanceChar()
+			p.advanceChar()
+			continue
+		case c:
+			p.advanceChar()
+			if !p.skipChar(c) {
+				return true
+			}
+			continue
+		}
+		p.advanceChar()
+	}
+	return false
+}
+
 // peekChar returns true if the current char equals the one passed as parameter.
 func (p *Parser) peekChar(c rune) bool {
 	return p.pos < len(p.input) && p.char == c
@@ -381,11 +831,15 @@ func (p *Parser) skipCharFind(c rune) bool {
 	return false
 }
 
-// skipBlanks advances the parser past spaces, tabs and newlines. Returns
-// whether the parser position was changed.
+// skipBlanks advances the parser past spaces, tabs, newlines and comments.
+// Optimizer hints are not skipped since they cannot appear inside SQLair
+// expressions. Returns whether the parser position was changed.
 func (p *Parser) skipBlanks() bool {
 	mark := p.pos
 	for p.pos < len(p.input) {
+		if p.peekOptimizerHint() {
+			return p.pos != mark
+		}
 		if ok := p.skipComment(); ok {
 			continue
 		}
@@ -443,6 +897,21 @@ func (p *Parser) skipLiteralInList() (bool, error) {
 	return false, nil
 }
 
+// hasExpression returns true if the SQL contains any SQLair expressions.
+func (p *Parser) hasExpression(sql string) bool {
+	sub := &Parser{options: p.options}
+	sub.init(sql)
+	if err := sub.parseExprs(); err != nil {
+		return true
+	}
+	for _, expr := range sub.exprs {
+		if _, ok := expr.(*bypass); !ok {
+			return true
+		}
+	}
+	return false
+}
+
 // isNameChar returns true if the given char can be part of a name. It returns
 // false otherwise.
 func isNameChar(c rune) bool {
@@ -475,12 +944,24 @@ func (p *Parser) skipName() bool {
 // its closing ')', taking into account comments, string literals and nested
 // parentheses.
 func (p *Parser) skipEnclosedParentheses() (bool, error) {
-	cp := p.save()
-
-	if !p.skipChar('(') {
+	if !p.peekChar('(') {
 		return false, nil
 	}
+	if p.parens == nil {
+		p.parens = p.matchParentheses()
+	}
+	if end, ok := p.parens[p.pos]; ok {
+		if end.pos < 0 {
+			return false, errorAt(fmt.Errorf(`missing closing parenthesis`), p.lineNum, p.colNum(), p.input)
+		}
+		end.apply(p)
+		return true, nil
+	}
 
+	// The parenthesis was not found by matchParentheses, e.g. because it
+	// comes after an unterminated string literal.
+	cp := p.save()
+	p.advanceChar()
 	parenCount := 1
 	for parenCount > 0 && p.pos != len(p.input) {
 		if ok, err := p.skipStringLiteral(); err != nil {
@@ -510,6 +991,48 @@ func (p *Parser) skipEnclosedParentheses() (bool, error) {
 	return true, nil
 }
 
+// matchParentheses scans the whole input in the same way as
+// skipEnclosedParentheses and returns the parser position after the closing
+// parenthesis of each opening parenthesis found, keyed by the position of the
+// opening parenthesis. Opening parentheses that are never closed have a
+// position of -1. This means that skipping parentheses takes constant time
+// rather than a scan to the end of the input every time.
+func (p *Parser) matchParentheses() map[int]checkpoint {
+	scan := &Parser{options: p.options}
+	scan.init(p.input)
+	parens := map[int]checkpoint{}
+	var open []int
+	for scan.pos < len(scan.input) {
+		if ok, err := scan.skipStringLiteral(); err != nil {
+			// Parentheses from here on are matched by skipEnclosedParentheses
+			// so that it can return the error.
+			return parens
+		} else if ok {
+			continue
+		}
+		if ok := scan.skipComment(); ok {
+			continue
+		}
+
+		if scan.peekChar('(') {
+			open = append(open, scan.pos)
+			scan.advanceChar()
+			continue
+		} else if scan.skipChar(')') {
+			if len(open) > 0 {
+				parens[open[len(open)-1]] = scan.save()
+				open = open[:len(open)-1]
+			}
+			continue
+		}
+		scan.advanceChar()
+	}
+	for _, pos := range open {
+		parens[pos] = checkpoint{pos: -1}
+	}
+	return parens
+}
+
 // Functions with the prefix parse attempt to parse some construct. They return
 // the construct, and an error and/or a bool that indicates if the construct
 // was successfully parsed.
@@ -530,9 +1053,9 @@ func (p *Parser) parseIdentifierAsterisk() (string, bool, error) {
 	return p.parseIdentifier()
 }
 
-// parseIdentifier parses either a name made up of letters, digits and
-// underscores or any quoted name. This matches allowed SQL identifiers and db
-// tags allowed by SQLair.
+// parseIdentifier parses either a name made up of letters, digits,
+// underscores and, after the first char, dollar signs or any quoted name. This
+// matches allowed SQL identifiers and db tags allowed by SQLair.
 func (p *Parser) parseIdentifier() (string, bool, error) {
 	mark := p.pos
 
@@ -544,7 +1067,7 @@ func (p *Parser) parseIdentifier() (string, bool, error) {
 	}
 
 	// parse regular column names, including numeric literals.
-	for p.pos < len(p.input) && isNameChar(p.char) {
+	for p.pos < len(p.input) && (isNameChar(p.char) || p.char == '$' && p.pos > mark) {
 		p.advanceChar()
 	}
 
@@ -583,6 +1106,16 @@ func (p *Parser) parseColumnAccessor() (columnAccessor, bool, error) {
 		return basicColumn{column: "*"}, true, nil
 	}
 
+	if ce, ok, err := p.parseCaseExpression(); err != nil {
+		return nil, false, err
+	} else if ok {
+		return ce, true, nil
+	}
+
+	if p.skipNumericLiteral() {
+		return basicColumn{column: p.input[cp.pos:p.pos]}, true, nil
+	}
+
 	// Parse a SQL identifier. This could be a column or table name.
 	id, ok, err := p.parseIdentifier()
 	if !ok {
@@ -613,10 +1146,160 @@ func (p *Parser) parseColumnAccessor() (columnAccessor, bool, error) {
 	return basicColumn{column: id}, true, nil
 }
 
+// parseCaseExpression parses a CASE expression up to its matching END keyword.
+// The input expressions inside the CASE expression are parsed by
+// parseCaseInputs once it is known to be the column of an SQLair expression.
+func (p *Parser) parseCaseExpression() (columnAccessor, bool, error) {
+	// The expressions inside a CASE expression are found by a parser that
+	// does not look for nested CASE expressions. Otherwise each level of
+	// nesting would be parsed again by each enclosing level.
+	if p.inCase {
+		return nil, false, nil
+	}
+	cp := p.save()
+	if !p.skipKeyword("CASE") {
+		return nil, false, nil
+	}
+	if p.caseEnds == nil {
+		p.caseEnds = map[int]checkpoint{}
+	}
+	if _, ok := p.caseEnds[cp.pos]; !ok {
+		if err := p.matchCaseEnds(cp.pos); err != nil {
+			cp.restore()
+			return nil, false, err
+		}
+	}
+	end := p.caseEnds[cp.pos]
+	if end.pos < 0 {
+		cp.restore()
+		return nil, false, nil
+	}
+	end.apply(p)
+	return caseExpression{raw: p.input[cp.pos:p.pos], start: cp}, true, nil
+}
+
+// matchCaseEnds scans from just after the CASE keyword at start to its
+// matching END keyword. The position after the END keyword of the CASE
+// expression, and of any nested CASE expressions, is stored in p.caseEnds so
+// each CASE expression is only scanned once. CASE expressions that are never
+// ended have a position of -1.
+func (p *Parser) matchCaseEnds(start int) error {
+	open := []int{start}
+	for len(open) > 0 {
+		if p.pos >= len(p.input) {
+			break
+		}
+		if ok, err := p.skipStringLiteral(); err != nil {
+			for _, pos := range open {
+				p.caseEnds[pos] = checkpoint{pos: -1}
+			}
+			return err
+		} else if ok {
+			continue
+		}
+		if ok := p.skipComment(); ok {
+			continue
+		}
+		// Keywords cannot follow a '.', e.g. "t.end" or "$M.end".
+		if prev, _ := utf8.DecodeLastRuneInString(p.input[:p.pos]); prev != '.' {
+			pos := p.pos
+			if p.skipKeyword("CASE") {
+				open = append(open, pos)
+				continue
+			}
+			if p.skipKeyword("END") {
+				p.caseEnds[open[len(open)-1]] = p.save()
+				open = open[:len(open)-1]
+				continue
+			}
+		}
+		// Skip the rest of the name so that keywords are only found at
+		// the start of a name.
+		if isNameChar(p.char) {
+			for isNameChar(p.char) && p.advanceChar() {
+			}
+			continue
+		}
+		p.advanceChar()
+	}
+	for _, pos := range open {
+		p.caseEnds[pos] = checkpoint{pos: -1}
+	}
+	return nil
+}
+
+// parseCaseInputs parses the input expressions inside any CASE expressions
+// in the columns. It returns false if a CASE expression contains anything
+// other than input expressions.
+func (p *Parser) parseCaseInputs(cols []columnAccessor) bool {
+	for i, col := range cols {
+		ce, ok := col.(caseExpression)
+		if !ok {
+			continue
+		}
+		// Parse the input expressions in the CASE expression with a parser
+		// that starts after its CASE keyword and stops at its END keyword.
+		sub := &Parser{options: p.options, inCase: true}
+		sub.init(p.input[:ce.start.pos+len(ce.raw)])
+		ce.start.apply(sub)
+		sub.skipKeyword("CASE")
+		sub.prevExprEnd = ce.start.pos
+		sub.currentExprStart = ce.start.pos
+		if err := sub.parseExprs(); err != nil {
+			return false
+		}
+		for _, expr := range sub.exprs {
+			switch expr.(type) {
+			case *bypass, *memberInputExpr, *sliceInputExpr:
+			default:
+				return false
+			}
+		}
+		ce.exprs = sub.exprs
+		cols[i] = ce
+	}
+	return true
+}
+
+// isSubquery returns true if the parser is at a parenthesis opening a
+// subquery e.g. "(SELECT max(x) FROM y)". The state of the parser is left
+// unchanged.
+func (p *Parser) isSubquery() bool {
+	cp := p.save()
+	defer cp.restore()
+	if !p.skipChar('(') {
+		return false
+	}
+	p.skipBlanks()
+	for _, keyword := range []string{"SELECT", "WITH", "VALUES"} {
+		if p.skipKeyword(keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipKeyword advances the parser past the keyword if it is at the start of
+// the input and is not part of a longer name. The keyword is case insensitive.
+func (p *Parser) skipKeyword(keyword string) bool {
+	if prev, _ := utf8.DecodeLastRuneInString(p.input[:p.pos]); p.pos > 0 && isNameChar(prev) {
+		return false
+	}
+	end := p.pos + len(keyword)
+	if end > len(p.input) || !strings.EqualFold(p.input[p.pos:end], keyword) {
+		return false
+	}
+	if next, _ := utf8.DecodeRuneInString(p.input[end:]); end < len(p.input) && isNameChar(next) {
+		return false
+	}
+	return p.skipString(keyword)
+}
+
 func (p *Parser) parseTargetType() (memberAccessor, bool, error) {
 	startLine := p.lineNum
 	startCol := p.colNum()
 
+	cp := p.save()
 	if p.skipChar('&') {
 		// Using a slice as an output is an error, we add the case here to
 		// improve the error message.
@@ -625,7 +1308,11 @@ func (p *Parser) parseTargetType() (memberAccessor, bool, error) {
 		} else if err != nil {
 			return memberAccessor{}, false, errorAt(fmt.Errorf("cannot use slice syntax in output expression"), startLine, startCol, p.input)
 		}
-		return p.parseTypeAndMember()
+		ma, ok, err := p.parseTypeAndMember()
+		if !ok {
+			cp.restore()
+		}
+		return ma, ok, err
 	}
 
 	return memberAccessor{}, false, nil
@@ -673,13 +1360,46 @@ func (p *Parser) parseTypeAndMember() (memberAccessor, bool, error) {
 		} else if !ok {
 			return memberAccessor{}, false, errorAt(fmt.Errorf("invalid identifier suffix following %q", id), p.lineNum, p.colNum(), p.input)
 		}
-		return memberAccessor{typeName: id, memberName: idField}, true, nil
+		if idField == "*" {
+			return memberAccessor{typeName: id, memberName: idField}, true, nil
+		}
+
+		// Parse the path to a member of a nested struct, e.g.
+		// "Type.member.nested_member".
+		path, err := p.parseNestedMemberPath()
+		if err != nil {
+			return memberAccessor{}, false, err
+		}
+		return memberAccessor{typeName: id, memberName: idField + path}, true, nil
 	}
 
 	cp.restore()
 	return memberAccessor{}, false, nil
 }
 
+// parseNestedMemberPath parses any dot separated identifiers following a
+// member name and returns them, including the leading dots. If there are none,
+// the empty string is returned.
+func (p *Parser) parseNestedMemberPath() (string, error) {
+	mark := p.pos
+	for {
+		cp := p.save()
+		if !p.skipChar('.') {
+			break
+		}
+		if p.peekChar('*') {
+			return "", errorAt(fmt.Errorf("cannot use asterisk with nested member"), p.lineNum, p.colNum(), p.input)
+		}
+		if _, ok, err := p.parseIdentifier(); err != nil {
+			return "", err
+		} else if !ok {
+			cp.restore()
+			break
+		}
+	}
+	return p.input[mark:p.pos], nil
+}
+
 // parseList takes a parsing function that returns a T and parses a
 // bracketed, comma separated, list.
 func parseList[T any](p *Parser, parseFn func(p *Parser) (T, bool, error)) ([]T, bool, error) {
@@ -728,14 +1448,60 @@ func (p *Parser) parseColumns() (cols []columnAccessor, parentheses bool, ok boo
 		return []columnAccessor{col}, false, true
 	}
 
-	// Case 2: Multiple columns e.g. "(p.name, p.id)".
-	if cols, ok, _ := parseList(p, (*Parser).parseColumnAccessor); ok {
+	// Case 2: Multiple columns e.g. "(p.name, p.id)" or "((p.name), (p.id))".
+	if cols, ok, _ := parseList(p, (*Parser).parseListColumnAccessor); ok {
 		return cols, true, true
 	}
 
 	return nil, false, false
 }
 
+// parseListColumnAccessor parses a column in a list of columns. The column
+// may be enclosed in one level of redundant parentheses e.g. "(p.name)".
+func (p *Parser) parseListColumnAccessor() (columnAccessor, bool, error) {
+	cp := p.save()
+	if !p.skipChar('(') {
+		return p.parseColumnAccessor()
+	}
+	p.skipBlanks()
+	if col, ok, err := p.parseColumnAccessor(); err != nil {
+		return nil, false, err
+	} else if ok {
+		p.skipBlanks()
+		if p.skipChar(')') {
+			return col, true, nil
+		}
+	}
+	cp.restore()
+	return nil, false, nil
+}
+
+// isColumnsBeforeTargetTypes returns true if the parser is at a parenthesised
+// group that is followed by "AS" and output target types. Groups containing
+// optimizer hints are excluded as they are passed to the database verbatim,
+// as are subqueries which are the SQL expression source of a single output.
+// The state of the parser is left unchanged.
+func (p *Parser) isColumnsBeforeTargetTypes() bool {
+	cp := p.save()
+	defer cp.restore()
+	if p.isSubquery() {
+		return false
+	}
+	if ok, err := p.skipEnclosedParentheses(); !ok || err != nil {
+		return false
+	}
+	end := p.pos
+	p.skipBlanks()
+	if !p.skipKeyword("AS") {
+		return false
+	}
+	p.skipBlanks()
+	if p.skipChar('(') {
+		p.skipBlanks()
+	}
+	return p.char == '&' && !strings.Contains(p.input[cp.pos:end], "/*+")
+}
+
 // parseTargetTypes parses a single output type or a list of output types.
 // Lists of types must be enclosed in parentheses.
 func (p *Parser) parseTargetTypes() (types []memberAccessor, parentheses bool, ok bool, err error) {
@@ -774,6 +1540,17 @@ func (p *Parser) parseOutputExpr() (*outputExpr, bool, error) {
 	if targetType, ok, err := p.parseTargetType(); err != nil {
 		return nil, false, err
 	} else if ok {
+		// The source of the output column is an arbitrary SQL expression
+		// left in the bypass chunk e.g. "lower(p.name) COLLATE "C" AS &Person.name".
+		if end, ok := p.sourceBeforeAlias(start); ok && targetType.memberName != "*" {
+			p.currentExprStart = end
+			return &outputExpr{
+				sourceColumns:  []columnAccessor{},
+				targetTypes:    []memberAccessor{targetType},
+				sourceInBypass: true,
+				raw:            p.input[end:p.pos],
+			}, true, nil
+		}
 		return &outputExpr{
 			sourceColumns: []columnAccessor{},
 			targetTypes:   []memberAccessor{targetType},
@@ -791,6 +1568,12 @@ func (p *Parser) parseOutputExpr() (*outputExpr, bool, error) {
 			parenCol := p.colNum()
 			if targetTypes, parenTypes, ok, err := p.parseTargetTypes(); err != nil {
 				return nil, false, err
+			} else if ok && !p.parseCaseInputs(cols) {
+				cp.restore()
+				if parenCols {
+					return nil, false, errorAt(fmt.Errorf("cannot parse columns of output expression"), p.lineNum, p.colNum(), p.input)
+				}
+				return nil, false, nil
 			} else if ok {
 				if parenCols && !parenTypes {
 					return nil, false, errorAt(fmt.Errorf(`missing parentheses around types after "AS"`), p.lineNum, parenCol, p.input)
@@ -800,29 +1583,73 @@ func (p *Parser) parseOutputExpr() (*outputExpr, bool, error) {
 				}
 				if starCountTypes(targetTypes) > 0 {
 					for _, c := range cols {
-						if _, ok := c.(sqlFunctionCall); ok {
+						switch c.(type) {
+						case sqlFunctionCall:
+							// A single function call can be read into a
+							// map with an asterisk, the key is the name of
+							// the result column.
+							if len(cols) == 1 && len(targetTypes) == 1 {
+								continue
+							}
 							return nil, false, errorAt(fmt.Errorf(`cannot read function call %q into asterisk`, c), cp.lineNum, cp.colNum(), p.input)
+						case caseExpression:
+							return nil, false, errorAt(fmt.Errorf(`cannot read CASE expression %q into asterisk`, c), cp.lineNum, cp.colNum(), p.input)
 						}
 					}
 				}
 				return &outputExpr{
 					sourceColumns: cols,
 					targetTypes:   targetTypes,
+					parentheses:   parenCols,
 					raw:           p.input[start:p.pos],
 				}, true, nil
 			}
 		}
+	} else if p.isColumnsBeforeTargetTypes() {
+		// Do not silently pass the output expression to the database if its
+		// columns cannot be parsed.
+		return nil, false, errorAt(fmt.Errorf("cannot parse columns of output expression"), p.lineNum, p.colNum(), p.input)
 	}
 
 	cp.restore()
 	return nil, false, nil
 }
 
+// sourceBeforeAlias checks if the bypass chunk before the output expression
+// starting at start ends with the keyword "AS" preceded by a SQL expression
+// or an input expression. If so, it returns the end of the SQL expression.
+func (p *Parser) sourceBeforeAlias(start int) (int, bool) {
+	chunk := strings.TrimRightFunc(p.input[p.prevExprEnd:start], unicode.IsSpace)
+	if len(chunk) < 2 || !strings.EqualFold(chunk[len(chunk)-2:], "AS") {
+		return 0, false
+	}
+	if prev, _ := utf8.DecodeLastRuneInString(chunk[:len(chunk)-2]); isNameChar(prev) {
+		return 0, false
+	}
+	source := strings.TrimRightFunc(chunk[:len(chunk)-2], unicode.IsSpace)
+	if source == "" {
+		// The expression may end with an input e.g. "$M.prefix || $M.name AS &M.name".
+		if len(p.exprs) == 0 {
+			return 0, false
+		}
+		switch p.exprs[len(p.exprs)-1].(type) {
+		case *outputExpr, *bypass:
+			return 0, false
+		}
+		return p.prevExprEnd, true
+	}
+	if strings.HasSuffix(source, ",") || strings.HasSuffix(source, "(") {
+		return 0, false
+	}
+	return p.prevExprEnd + len(source), true
+}
+
 // parseInputExpr parses all forms of input expressions, that is, expressions
 // containing a "$".
 func (p *Parser) parseInputExpr() (expression, bool, error) {
 	inputExprParsers := []func(*Parser) (expression, bool, error){
 		(*Parser).parseSliceInputExpr,
+		(*Parser).parsePositionalInputExpr,
 		(*Parser).parseMemberInputExpr,
 		(*Parser).parseInsertExpr,
 	}
@@ -855,6 +1682,28 @@ func (p *Parser) parseSliceInputExpr() (expression, bool, error) {
 	return nil, false, nil
 }
 
+// parsePositionalInputExpr parses an input expression of the form "$1".
+func (p *Parser) parsePositionalInputExpr() (expression, bool, error) {
+	cp := p.save()
+	if !p.skipChar('$') {
+		return nil, false, nil
+	}
+	start := p.pos
+	for p.pos < len(p.input) && isDigit(p.char) {
+		p.advanceChar()
+	}
+	// Digits followed by a name char are not a position, e.g. "$1abc".
+	if p.pos == start || (p.pos < len(p.input) && (isNameChar(p.char) || p.char == '$')) {
+		cp.restore()
+		return nil, false, nil
+	}
+	position, err := strconv.Atoi(p.input[start:p.pos])
+	if err != nil || position == 0 {
+		return nil, false, errorAt(fmt.Errorf("invalid positional input %q, positions start at $1", p.input[cp.pos:p.pos]), cp.lineNum, cp.colNum(), p.input)
+	}
+	return &positionalInputExpr{position: position, raw: p.input[cp.pos:p.pos]}, true, nil
+}
+
 // parseMemberInputExpr parses an input expression of the form "$Type.member".
 func (p *Parser) parseMemberInputExpr() (expression, bool, error) {
 	cp := p.save()
@@ -867,7 +1716,140 @@ func (p *Parser) parseMemberInputExpr() (expression, bool, error) {
 		cp.restore()
 		return nil, false, errorAt(fmt.Errorf("invalid asterisk placement in input %q", "$"+ma.String()), cp.lineNum, cp.colNum(), p.input)
 	}
-	return &memberInputExpr{ma: ma, raw: p.input[cp.pos:p.pos]}, true, nil
+	return &memberInputExpr{ma: ma, raw: p.input[cp.pos:p.pos], assignment: p.isAssignment(cp.pos)}, true, nil
+}
+
+// isAssignment returns true if the input expression at pos is assigned to a
+// column, see findAssignments.
+func (p *Parser) isAssignment(pos int) bool {
+	if p.assignments == nil {
+		p.assignments = p.findAssignments()
+	}
+	return p.assignments[pos]
+}
+
+// Assignment states of findAssignments.
+const (
+	assignOther = iota
+	// assignItemStart is after a SET or UPDATE keyword or a comma in a SET
+	// clause, where an assignment can start.
+	assignItemStart
+	// assignColumn is after the column of an assignment.
+	assignColumn
+	// assignColumnDot is after the '.' of a qualified column.
+	assignColumnDot
+	// assignEquals is after the '=' of an assignment.
+	assignEquals
+)
+
+// findAssignments scans the whole input in the same way as matchParentheses
+// and returns the positions of the input expressions that are assigned to a
+// column in the SET clause of an UPDATE statement, or the UPDATE clause of an
+// upsert, e.g. "UPDATE t SET a = 1, b = $Type.member". Only inputs that are
+// the whole of the value assigned are recognised. The clauses are tracked for
+// each level of parentheses so that the keywords of subqueries do not end a
+// SET clause.
+func (p *Parser) findAssignments() map[int]bool {
+	type clause struct {
+		// set is true in a SET or UPDATE clause.
+		set   bool
+		state int
+	}
+	scan := &Parser{options: p.options}
+	scan.init(p.input)
+	assignments := map[int]bool{}
+	clauses := []clause{{}}
+	for scan.pos < len(scan.input) {
+		cl := &clauses[len(clauses)-1]
+		// A double quoted or backticked name may be the column.
+		if scan.char == '"' || scan.char == '`' {
+			quote := scan.char
+			scan.advanceChar()
+			if !scan.skipCharFind(quote) {
+				return assignments
+			}
+			if cl.state == assignItemStart || cl.state == assignColumnDot {
+				cl.state = assignColumn
+			} else {
+				cl.state = assignOther
+			}
+			continue
+		}
+		if ok, err := scan.skipStringLiteral(); err != nil {
+			return assignments
+		} else if ok {
+			cl.state = assignOther
+			continue
+		}
+		if scan.skipComment() {
+			continue
+		}
+		if scan.skipDollarQuotedLiteral() {
+			cl.state = assignOther
+			continue
+		}
+
+		switch {
+		case scan.char == ' ' || scan.char == '\t' || scan.char == '\r' || scan.char == '\n':
+		case scan.char == '(':
+			cl.state = assignOther
+			clauses = append(clauses, clause{})
+		case scan.char == ')':
+			if len(clauses) > 1 {
+				clauses = clauses[:len(clauses)-1]
+			}
+		case scan.char == ';':
+			clauses = []clause{{}}
+		case scan.char == ',':
+			if cl.set {
+				cl.state = assignItemStart
+			} else {
+				cl.state = assignOther
+			}
+		case scan.char == '=':
+			if cl.state == assignColumn {
+				cl.state = assignEquals
+			} else {
+				cl.state = assignOther
+			}
+		case scan.char == '.':
+			if cl.state == assignColumn {
+				cl.state = assignColumnDot
+			} else {
+				cl.state = assignOther
+			}
+		case scan.char == '$':
+			if cl.state == assignEquals {
+				assignments[scan.pos] = true
+			}
+			cl.state = assignOther
+		case isNameChar(scan.char):
+			// A '$' after a name char is part of the name, e.g. "price$".
+			start := scan.pos
+			for scan.pos < len(scan.input) && (isNameChar(scan.char) || scan.char == '$') {
+				scan.advanceChar()
+			}
+			switch strings.ToUpper(scan.input[start:scan.pos]) {
+			case "SET", "UPDATE":
+				cl.set = true
+				cl.state = assignItemStart
+			case "SELECT", "FROM", "WHERE", "VALUES", "RETURNING":
+				cl.set = false
+				cl.state = assignOther
+			default:
+				if cl.state == assignItemStart || cl.state == assignColumnDot {
+					cl.state = assignColumn
+				} else {
+					cl.state = assignOther
+				}
+			}
+			continue
+		default:
+			cl.state = assignOther
+		}
+		scan.advanceChar()
+	}
+	return assignments
 }
 
 // parseAsteriskInsertExpr parses an INSERT statement input expression where
@@ -920,12 +1902,20 @@ func (p *Parser) parseInsertExpr() (expression, bool, error) {
 		return nil, false, nil
 	}
 	p.skipBlanks()
-	if !p.skipString("VALUES") {
+	if !p.skipString("VALUES") || !p.parseCaseInputs(columns) {
 		cp.restore()
 		return nil, false, nil
 	}
 	p.skipBlanks()
 
+	for _, c := range columns {
+		if c.tableName() != "" {
+			err := errorAt(fmt.Errorf("qualified column %q is not valid in an INSERT column list", c), cp.lineNum, cp.colNum(), p.input)
+			cp.restore()
+			return nil, false, err
+		}
+	}
+
 	colcp := p.save()
 	// Ignore the errors here, let parseBasicInsertValues handle them
 	if sources, ok, _ := p.parseComplexInsertValues(); ok && starCountTypes(sources) != 0 {
@@ -989,17 +1979,27 @@ func (p *Parser) parseBasicInsertValues() ([]valueAccessor, bool, error) {
 		p.skipBlanks()
 		itemStart = p.pos
 
+		itemcp := p.save()
 		if ma, ok, err := p.parseInputMemberAccessor(); err != nil {
 			return nil, false, err
 		} else if ok {
 			inputParsed = true
 			if ma.memberName == "*" {
-				return nil, false, fmt.Errorf("internal error: cannot have asterisk accessor in renaming expression")
+				err := errorAt(fmt.Errorf("cannot use asterisk input %q with literal values, list the columns it provides", "$"+ma.String()), itemcp.lineNum, itemcp.colNum(), p.input)
+				cp.restore()
+				return nil, false, err
 			}
 			vs = append(vs, ma)
 		} else if ok, err = p.skipLiteralInList(); err != nil {
 			return nil, false, err
 		} else if ok {
+			// A value containing inputs, such as a function call on an
+			// input, is not a literal. The VALUES clause is then left to be
+			// parsed as regular input expressions.
+			if p.hasExpression(p.input[itemStart:p.pos]) {
+				cp.restore()
+				return nil, false, nil
+			}
 			lit := literal{p.input[itemStart:p.pos]}
 			vs = append(vs, lit)
 		} else {
@@ -164,6 +164,39 @@ func (s parseSuite) TestUnfinishedQuote(c *C) {
 	}
 }
 
+func (s parseSuite) TestBackslashEscapedQuotes(c *C) {
+	var p = NewParserWithOptions(ParserOptions{BackslashEscapes: true})
+
+	validQuotes := []string{
+		`'O\'Donnell'`,
+		`"J \"Quickfingers\" Johnson"`,
+		`'a\\'`,
+		`'\\\''`,
+		`'O''Flan'`,
+		`'\n\t'`,
+		`''`,
+	}
+	for _, q := range validQuotes {
+		p.init(q)
+		ok, err := p.skipStringLiteral()
+		c.Check(err, IsNil)
+		c.Check(ok, Equals, true, Commentf("%s is a valid quoted string", q))
+		c.Check(p.pos, Equals, len(q), Commentf("%s is a valid quoted string", q))
+	}
+
+	unfinishedQuotes := []string{
+		`'O\'`,
+		`'a\\\'`,
+		`"\"`,
+		`'\`,
+	}
+	for _, q := range unfinishedQuotes {
+		p.init(q)
+		_, err := p.skipStringLiteral()
+		c.Check(err, ErrorMatches, "column 1: missing closing quote in string literal", Commentf("%s is not a valid quoted string", q))
+	}
+}
+
 func (s parseSuite) TestRemoveComments(c *C) {
 	validComments := []string{
 		`-- Single line comment`,
@@ -4,8 +4,12 @@
 package expr
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 
 	"github.com/canonical/sqlair/internal/typeinfo"
 )
@@ -14,10 +18,31 @@ import (
 // database.
 type PrimedQuery struct {
 	sql string
+	// outputPrefix is the prefix of the names of the output marker columns.
+	outputPrefix string
 	// params are the query parameters to pass to the database.
 	params []any
-	// outputs specifies where to scan the query results.
-	outputs []typeinfo.Output
+	// redacted records the indexes of the params whose values must not be
+	// shown.
+	redacted map[int]bool
+	// outputs specifies where to scan the query results. It is indexed by
+	// the number of the output marker column.
+	outputs []primedOutput
+}
+
+// primedOutput is an output of a primed query.
+type primedOutput struct {
+	output typeinfo.Output
+	// column is the SQL of the column that the output is read from.
+	column string
+	// scan is false if the results are not scanned into the output.
+	scan bool
+	// statement is the index of the statement containing the output in a
+	// query made up of several statements.
+	statement int
+	// allColumns is true if the output is read from every result column
+	// between the previous marker column and its own.
+	allColumns bool
 }
 
 // Params returns the query parameters to pass with the SQL to a database.
@@ -25,10 +50,35 @@ func (pq *PrimedQuery) Params() []any {
 	return pq.params
 }
 
+// RedactedParams returns the query parameters with the values of members
+// that have the redact option replaced by a placeholder. They are for showing
+// the query, not for passing to a database.
+func (pq *PrimedQuery) RedactedParams() []any {
+	if len(pq.redacted) == 0 {
+		return pq.params
+	}
+	params := make([]any, len(pq.params))
+	for i, param := range pq.params {
+		if !pq.redacted[i] {
+			params[i] = param
+		} else if named, ok := param.(sql.NamedArg); ok {
+			params[i] = sql.Named(named.Name, typeinfo.Redacted)
+		} else {
+			params[i] = typeinfo.Redacted
+		}
+	}
+	return params
+}
+
 // HasOutputs returns true if the SQLair query contains at least one output
 // expression.
 func (pq *PrimedQuery) HasOutputs() bool {
-	return len(pq.outputs) > 0
+	for _, po := range pq.outputs {
+		if po.scan {
+			return true
+		}
+	}
+	return false
 }
 
 // SQL returns the SQL string to send to the database.
@@ -39,10 +89,18 @@ func (pq *PrimedQuery) SQL() string {
 // ScanArgs produces a list of pointers to be passed to rows.Scan. After a
 // successful call, the onSuccess function must be invoked. The outputArgs will
 // be populated with the query results. All the structs/maps/slices mentioned in
-// the query must be in outputArgs.
-func (pq *PrimedQuery) ScanArgs(columnNames []string, outputArgs []any) (scanArgs []any, onSuccess func(), err error) {
+// the query must be in outputArgs. If merge is true, NULL columns leave the
+// existing values in outputArgs unchanged.
+func (pq *PrimedQuery) ScanArgs(columnNames []string, outputArgs []any, merge bool) (scanArgs []any, onSuccess func(), err error) {
+	if len(outputArgs) == 1 && typeinfo.IsValueOutput(outputArgs[0]) {
+		return pq.scanValueArgs(columnNames, outputArgs[0], merge)
+	}
 
-	typeToValue, err := typeinfo.ValidateOutputs(outputArgs)
+	var argTypes []reflect.Type
+	for _, oc := range pq.outputs {
+		argTypes = append(argTypes, oc.output.ArgType())
+	}
+	typeToValue, err := typeinfo.ValidateOutputs(outputArgs, argTypes)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -50,42 +108,111 @@ func (pq *PrimedQuery) ScanArgs(columnNames []string, outputArgs []any) (scanArg
 	// Generate the pointers.
 	var ptrs []any
 	var scanProxies []typeinfo.ScanProxy
-	var columnInResult = make([]bool, len(columnNames))
+	var columnInResult = make([]bool, len(pq.outputs))
+	// statement is the statement that produced the result set, or -1 if the
+	// result set has no output columns.
+	statement := -1
 	argTypeUsed := map[reflect.Type]bool{}
-	for _, column := range columnNames {
-		idx, ok := markerIndex(column)
+	// unmatchedColumns are the result columns not read into an output.
+	var unmatchedColumns []string
+	for i, column := range columnNames {
+		idx, ok := markerIndex(pq.outputPrefix, column)
 		if !ok {
 			// Columns not mentioned in output expressions are scanned into x.
 			var x any
 			ptrs = append(ptrs, &x)
+			if !pq.readByColumnOutput(columnNames, i) {
+				unmatchedColumns = append(unmatchedColumns, column)
+			}
 			continue
 		}
 		if idx >= len(pq.outputs) {
 			return nil, nil, fmt.Errorf("internal error: sqlair column not in outputs (%d>=%d)", idx, len(pq.outputs))
 		}
+		if !pq.outputs[idx].scan {
+			return nil, nil, fmt.Errorf("internal error: sqlair column %d is not scanned", idx)
+		}
 		columnInResult[idx] = true
-		output := pq.outputs[idx]
-		ptr, scanProxy, err := output.LocateScanTarget(typeToValue)
+		statement = pq.outputs[idx].statement
+		output := pq.outputs[idx].output
+		co, isColumnOutput := output.(typeinfo.ColumnOutput)
+		if pq.outputs[idx].allColumns {
+			// Every column since the previous marker column is stored at
+			// the key of its name. The marker column itself is discarded.
+			start := i
+			for start > 0 {
+				if _, ok := markerIndex(pq.outputPrefix, columnNames[start-1]); ok {
+					break
+				}
+				start--
+			}
+			seen := map[string]bool{}
+			for j := start; j < i; j++ {
+				if seen[columnNames[j]] {
+					return nil, nil, fmt.Errorf("cannot read result column %q into %s more than once, select the columns of one table", columnNames[j], output.Desc())
+				}
+				seen[columnNames[j]] = true
+				ptr, scanProxy, err := co.ForColumn(columnNames[j]).LocateScanTarget(typeToValue, merge)
+				if err != nil {
+					return nil, nil, err
+				}
+				ptrs[j] = ptr
+				if scanProxy != nil {
+					scanProxies = append(scanProxies, *scanProxy)
+				}
+			}
+			argTypeUsed[output.ArgType()] = true
+			var x any
+			ptrs = append(ptrs, &x)
+			continue
+		}
+		if isColumnOutput {
+			// The value is in the column before the marker column and is
+			// stored at the key of its name.
+			if i == 0 {
+				return nil, nil, fmt.Errorf("internal error: no result column for %s", output.Desc())
+			}
+			if _, ok := markerIndex(pq.outputPrefix, columnNames[i-1]); ok {
+				return nil, nil, fmt.Errorf("internal error: no result column for %s", output.Desc())
+			}
+			output = co.ForColumn(columnNames[i-1])
+		}
+		ptr, scanProxy, err := output.LocateScanTarget(typeToValue, merge)
 		if err != nil {
 			return nil, nil, err
 		}
 		argTypeUsed[output.ArgType()] = true
 
+		if isColumnOutput {
+			// The marker column itself is discarded.
+			ptrs[i-1] = ptr
+			var x any
+			ptr = &x
+		}
 		ptrs = append(ptrs, ptr)
 		if scanProxy != nil {
 			scanProxies = append(scanProxies, *scanProxy)
 		}
 	}
 
-	for i := 0; i < len(pq.outputs); i++ {
-		if !columnInResult[i] {
-			return nil, nil, fmt.Errorf(`query uses "&%s" outside of result context`, pq.outputs[i].ArgType().Name())
+	// In a query made up of several statements each result set only contains
+	// the outputs of the statement that produced it.
+	if statement == -1 && !pq.multipleStatements() {
+		statement = 0
+	}
+	var missing []typeinfo.Output
+	for i, po := range pq.outputs {
+		if po.scan && po.statement == statement && !columnInResult[i] {
+			missing = append(missing, po.output)
 		}
 	}
+	if len(missing) > 0 {
+		return nil, nil, missingOutputsError(missing, unmatchedColumns)
+	}
 
 	for argType := range typeToValue {
 		if !argTypeUsed[argType] {
-			return nil, nil, fmt.Errorf("%q not referenced in query", argType.Name())
+			return nil, nil, fmt.Errorf("%q not referenced in query", typeinfo.PrettyTypeName(argType))
 		}
 	}
 
@@ -97,3 +224,142 @@ func (pq *PrimedQuery) ScanArgs(columnNames []string, outputArgs []any) (scanArg
 
 	return ptrs, onSuccess, nil
 }
+
+// scanValueArgs produces the pointers to be passed to rows.Scan to scan the
+// single output column of the result set into the value that outputArg points
+// to, such as a *string.
+func (pq *PrimedQuery) scanValueArgs(columnNames []string, outputArg any, merge bool) (scanArgs []any, onSuccess func(), err error) {
+	var ptrs []any
+	var scanProxy *typeinfo.ScanProxy
+	outputColumns := 0
+	for i, column := range columnNames {
+		idx, ok := markerIndex(pq.outputPrefix, column)
+		if !ok {
+			var x any
+			ptrs = append(ptrs, &x)
+			continue
+		}
+		if idx >= len(pq.outputs) {
+			return nil, nil, fmt.Errorf("internal error: sqlair column not in outputs (%d>=%d)", idx, len(pq.outputs))
+		}
+		outputColumns++
+		var ptr any
+		ptr, scanProxy = typeinfo.ValueScanTarget(outputArg, merge)
+		if _, ok := pq.outputs[idx].output.(typeinfo.ColumnOutput); ok {
+			// The value is in the column before the marker column, which
+			// is discarded.
+			if i == 0 {
+				return nil, nil, fmt.Errorf("internal error: no result column for %s", pq.outputs[idx].output.Desc())
+			}
+			ptrs[i-1] = ptr
+			var x any
+			ptr = &x
+		}
+		ptrs = append(ptrs, ptr)
+	}
+	if outputColumns != 1 {
+		return nil, nil, fmt.Errorf("cannot scan into %s: query must have one output column, found %d", typeinfo.PrettyTypeName(reflect.TypeOf(outputArg)), outputColumns)
+	}
+	onSuccess = func() {
+		if scanProxy != nil {
+			scanProxy.OnSuccess()
+		}
+	}
+	return ptrs, onSuccess, nil
+}
+
+// multipleStatements returns true if the outputs of the query are in more
+// than one statement.
+func (pq *PrimedQuery) multipleStatements() bool {
+	for _, po := range pq.outputs {
+		if po.statement != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ScanError returns an error describing the failure, err, to scan the result
+// column at index i. If the column is read into an output, the error names
+// the column in the query and the member of the output argument rather than
+// the generated column name.
+func (pq *PrimedQuery) ScanError(columnNames []string, i int, err error) error {
+	// Drop the context added by database/sql, it names the generated column.
+	if inner := errors.Unwrap(err); inner != nil {
+		err = inner
+	}
+	if i < 0 || i >= len(columnNames) {
+		return err
+	}
+	idx, ok := markerIndex(pq.outputPrefix, columnNames[i])
+	if !ok || idx >= len(pq.outputs) {
+		return fmt.Errorf("cannot scan column %q: %s", columnNames[i], err)
+	}
+	po := pq.outputs[idx]
+	if typeinfo.IsRedacted(po.output) {
+		// The error may contain the value of the column.
+		return fmt.Errorf("cannot scan column %q into %s: %s", po.column, po.output.Desc(), typeinfo.Redacted)
+	}
+	return fmt.Errorf("cannot scan column %q into %s: %s", po.column, po.output.Desc(), err)
+}
+
+// CheckColumnsMapped returns an error listing the result columns that are not
+// read into any output. A result set with no output columns, such as that of
+// a statement with no output expressions, is not checked.
+func (pq *PrimedQuery) CheckColumnsMapped(columnNames []string) error {
+	var unmapped []string
+	hasOutputs := false
+	for i, column := range columnNames {
+		if _, ok := markerIndex(pq.outputPrefix, column); ok {
+			hasOutputs = true
+		} else if !pq.readByColumnOutput(columnNames, i) {
+			unmapped = append(unmapped, strconv.Quote(column))
+		}
+	}
+	if !hasOutputs || len(unmapped) == 0 {
+		return nil
+	}
+	return fmt.Errorf("result columns not read into any output: %s, read them with output expressions or use sqlair.AllowUnmappedColumns to skip them", strings.Join(unmapped, ", "))
+}
+
+// readByColumnOutput returns true if the result column at index i is read
+// into an output by a marker column after it. This is either the marker column
+// directly after it, of an output read from the column before it, or the next
+// marker column, of an output read from all the columns before it.
+func (pq *PrimedQuery) readByColumnOutput(columnNames []string, i int) bool {
+	for j := i + 1; j < len(columnNames); j++ {
+		idx, ok := markerIndex(pq.outputPrefix, columnNames[j])
+		if !ok {
+			continue
+		}
+		if idx >= len(pq.outputs) {
+			return false
+		}
+		if pq.outputs[idx].allColumns {
+			return true
+		}
+		_, ok = pq.outputs[idx].output.(typeinfo.ColumnOutput)
+		return ok && j == i+1
+	}
+	return false
+}
+
+// missingOutputsError returns an error for outputs of a query that have no
+// column in the results. The result columns not read into any output are
+// listed as the outputs may have been expected in one of them.
+func missingOutputsError(missing []typeinfo.Output, unmatchedColumns []string) error {
+	descs := make([]string, len(missing))
+	for i, output := range missing {
+		descs[i] = output.Desc()
+	}
+	err := fmt.Errorf(`query uses "&%s" outside of result context: no result column for %s`,
+		typeinfo.PrettyTypeName(missing[0].ArgType()), strings.Join(descs, ", "))
+	if len(unmatchedColumns) > 0 {
+		quoted := make([]string, len(unmatchedColumns))
+		for i, column := range unmatchedColumns {
+			quoted[i] = strconv.Quote(column)
+		}
+		err = fmt.Errorf("%s, unmatched result columns: %s", err, strings.Join(quoted, ", "))
+	}
+	return err
+}
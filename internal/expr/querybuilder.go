@@ -30,19 +30,35 @@ type queryBuilder struct {
 	// namedInputs are the named input values corresponding to the placeholders
 	// in the SQL. They will be passed to the database at query time.
 	namedInputs []any
-	// outputs are the output value locators to be used when the SQL is scanned.
-	outputs []typeinfo.Output
+	// redactedInputs records the indexes of the namedInputs whose values
+	// must not be shown in rendered queries.
+	redactedInputs map[int]bool
+	// outputs are the output value locators to be used when the SQL is
+	// scanned. They are indexed by the output number.
+	outputs []primedOutput
+	// style specifies how input placeholders are written in the SQL.
+	style ParamStyle
+	// positionalArgs are the loose input arguments used by positional
+	// inputs, and positionalUsed records which of them have been used.
+	positionalArgs []any
+	positionalUsed []bool
+	// reusedParams maps the identifier of an input member to its placeholder
+	// when parameters are reused.
+	reusedParams map[string]string
 }
 
-// newQueryBuilder builds a new queryBuilder with the inputs in typeToValue.
-func newQueryBuilder() *queryBuilder {
+// newQueryBuilder builds a new queryBuilder that writes input placeholders in
+// the given style.
+func newQueryBuilder(style ParamStyle) *queryBuilder {
 	return &queryBuilder{
+		style:         style,
 		sqlBuilder:    sqlBuilder{},
 		inputAssigner: &inputAssigner{},
 		outputCount:   0,
 		argUsed:       map[reflect.Type]bool{},
 		namedInputs:   []any{},
-		outputs:       []typeinfo.Output{},
+		outputs:       []primedOutput{},
+		reusedParams:  map[string]string{},
 	}
 }
 
@@ -51,14 +67,73 @@ func (qb *queryBuilder) markArgUsed(t reflect.Type) {
 	qb.argUsed[t] = true
 }
 
+// setPositionalArgs sets the loose input arguments used by positional
+// inputs.
+func (qb *queryBuilder) setPositionalArgs(args []any) {
+	qb.positionalArgs = args
+	qb.positionalUsed = make([]bool, len(args))
+}
+
+// positionalArg returns the loose input argument at the position, counting
+// from 1, and marks it as used.
+func (qb *queryBuilder) positionalArg(position int) (any, error) {
+	if position > len(qb.positionalArgs) {
+		return nil, fmt.Errorf("missing positional argument $%d, got %d positional arguments", position, len(qb.positionalArgs))
+	}
+	qb.positionalUsed[position-1] = true
+	return qb.positionalArgs[position-1], nil
+}
+
 // addInputs adds input placeholders and argument values to the query.
 func (qb *queryBuilder) addInputs(inputVals []any) {
 	firstInputNum := qb.inputAssigner.assignInputs(len(inputVals))
+	placeholders := make([]string, len(inputVals))
 	for i, val := range inputVals {
-		namedInput := sql.Named("sqlair_"+strconv.Itoa(firstInputNum+i), val)
-		qb.namedInputs = append(qb.namedInputs, namedInput)
+		placeholders[i] = qb.addParam(firstInputNum+i, val, true)
 	}
-	qb.sqlBuilder.writeInputs(firstInputNum, len(inputVals))
+	qb.sqlBuilder.writeInputs(placeholders)
+}
+
+// addReusableInput adds an input placeholder and argument value for the input
+// member with the given identifier. If the style reuses parameters and the
+// member has already been added then its placeholder is written again and no
+// new parameter is added.
+func (qb *queryBuilder) addReusableInput(identifier string, val any) {
+	if !qb.style.ReuseParams || qb.style.Positional {
+		qb.addInputs([]any{val})
+		return
+	}
+	placeholder, ok := qb.reusedParams[identifier]
+	if !ok {
+		placeholder = qb.addParam(qb.inputAssigner.assignInputs(1), val, true)
+		qb.reusedParams[identifier] = placeholder
+	}
+	qb.sqlBuilder.writeInputs([]string{placeholder})
+}
+
+// addParam adds the value of input number inputNum to the query parameters and
+// returns the placeholder to write in the SQL. Named parameters that appear
+// more than once in the SQL are only added the first time, when newParam is
+// true. Positional parameters are added each time they appear.
+func (qb *queryBuilder) addParam(inputNum int, val any, newParam bool) string {
+	if r, ok := val.(redactedParam); ok {
+		val = r.val
+		if newParam || qb.style.Positional {
+			if qb.redactedInputs == nil {
+				qb.redactedInputs = map[int]bool{}
+			}
+			qb.redactedInputs[len(qb.namedInputs)] = true
+		}
+	}
+	if qb.style.Positional {
+		qb.namedInputs = append(qb.namedInputs, val)
+		return "?"
+	}
+	name := qb.style.inputPrefix() + strconv.Itoa(inputNum)
+	if newParam {
+		qb.namedInputs = append(qb.namedInputs, sql.Named(name, val))
+	}
+	return qb.style.Prefix + name
 }
 
 // addInsert adds a typedInsertExpr to the queryBuilder
@@ -69,14 +144,15 @@ func (qb *queryBuilder) addInsert(boundColumns []*boundInsertColumn, numRows int
 		var rowSQL []string
 		for _, bc := range boundColumns {
 			if !bc.omit {
-				valueSQL, namedInput, newParam, err := bc.parameter(rowNum)
+				literal, inputNum, val, newParam, err := bc.parameter(rowNum)
 				if err != nil {
 					return err
 				}
-				rowSQL = append(rowSQL, valueSQL)
-				if newParam {
-					qb.namedInputs = append(qb.namedInputs, namedInput)
+				if literal != "" {
+					rowSQL = append(rowSQL, literal)
+					continue
 				}
+				rowSQL = append(rowSQL, qb.addParam(inputNum, val, newParam))
 			}
 		}
 		rowsSQL = append(rowsSQL, rowSQL)
@@ -90,11 +166,28 @@ func (qb *queryBuilder) addInsert(boundColumns []*boundInsertColumn, numRows int
 	return nil
 }
 
-// addOutput adds a typedOutputExpr to the queryBuilder
-func (qb *queryBuilder) addOutput(columns []string, outputs []typeinfo.Output) {
-	qb.sqlBuilder.writeOutput(qb.outputCount, columns)
-	qb.outputCount += len(columns)
-	qb.outputs = append(qb.outputs, outputs...)
+// addOutput adds an output column of a typedOutputExpr in the given statement
+// to the queryBuilder. If scan is false the column is written but the results
+// are not scanned into its output.
+func (qb *queryBuilder) addOutput(oc outputColumn, typeToValue typeinfo.TypeToValue, scan bool, statement int) error {
+	if oc.exprs == nil && !oc.sourceInBypass {
+		qb.sqlBuilder.write(oc.column)
+	}
+	for _, te := range oc.exprs {
+		if err := te.addToQuery(qb, typeToValue); err != nil {
+			return err
+		}
+	}
+	if _, ok := oc.output.(typeinfo.ColumnOutput); ok {
+		// The column is not renamed so that the database reports its name.
+		// It is followed by a marker column to locate it in the results. The
+		// columns of an asterisk are all those before the marker column.
+		qb.sqlBuilder.write(", NULL")
+	}
+	qb.sqlBuilder.writeOutput(markerName(qb.style.outputPrefix(), qb.outputCount))
+	qb.outputCount++
+	qb.outputs = append(qb.outputs, primedOutput{output: oc.output, column: oc.column, scan: scan, statement: statement, allColumns: oc.allColumns})
+	return nil
 }
 
 // addBypass adds a bypass part to the queryBuilder
@@ -111,6 +204,11 @@ func (qb *queryBuilder) checkAllArgsUsed(typeToValue typeinfo.TypeToValue) error
 			return notReferencedInQueryError(argType)
 		}
 	}
+	for i, used := range qb.positionalUsed {
+		if !used {
+			return fmt.Errorf("positional argument $%d not used by query", i+1)
+		}
+	}
 	return nil
 }
 
@@ -155,24 +253,20 @@ type boundInsertColumn struct {
 	column string
 }
 
-// parameter returns the value to be inserted into the boundInsertColumn in the given
-// row. The inputCount it used to generate the parameter name.
-func (bc *boundInsertColumn) parameter(row int) (name string, v any, newParam bool, err error) {
+// parameter returns the value to be inserted into the boundInsertColumn in the
+// given row. If the column is a literal, the literal is returned. Otherwise the
+// input number and value of the parameter are returned along with whether this
+// is the first use of the parameter.
+func (bc *boundInsertColumn) parameter(row int) (literal string, inputNum int, v any, newParam bool, err error) {
 	switch {
 	case len(bc.vals) == 0:
-		return bc.literal, nil, false, nil
+		return bc.literal, 0, nil, false, nil
 	case len(bc.vals) == 1:
-		name = "sqlair_" + strconv.Itoa(bc.firstInputNum)
-		newParam = false
-		if row == 0 {
-			newParam = true
-		}
-		return "@" + name, sql.Named(name, bc.vals[0]), newParam, nil
+		return "", bc.firstInputNum, bc.vals[0], row == 0, nil
 	case row < len(bc.vals):
-		name = "sqlair_" + strconv.Itoa(bc.firstInputNum+row)
-		return "@" + name, sql.Named(name, bc.vals[row]), true, nil
+		return "", bc.firstInputNum + row, bc.vals[row], true, nil
 	default:
-		return "", nil, false, fmt.Errorf("internal error: no bulk insert value for row %d, only have %d values", row, len(bc.vals))
+		return "", 0, nil, false, fmt.Errorf("internal error: no bulk insert value for row %d, only have %d values", row, len(bc.vals))
 	}
 }
 
@@ -204,17 +298,15 @@ func (b *sqlBuilder) writeInsert(columns []string, rows [][]string) {
 }
 
 // writeInputs writes the SQL for input placeholders to the sqlBuilder.
-func (b *sqlBuilder) writeInputs(inputCount, num int) {
-	b.writeCommaSeparatedList(make([]string, num), func(i int, column string) string {
-		return "@sqlair_" + strconv.Itoa(inputCount+i)
+func (b *sqlBuilder) writeInputs(placeholders []string) {
+	b.writeCommaSeparatedList(placeholders, func(_ int, placeholder string) string {
+		return placeholder
 	})
 }
 
-// writeOutput writes the SQL for output columns to the sqlBuilder.
-func (b *sqlBuilder) writeOutput(outputCount int, columns []string) {
-	b.writeCommaSeparatedList(columns, func(i int, column string) string {
-		return column + " AS " + markerName(outputCount+i)
-	})
+// writeOutput writes the marker alias of an output column to the sqlBuilder.
+func (b *sqlBuilder) writeOutput(marker string) {
+	b.buf.WriteString(" AS " + marker)
 }
 
 // writeCommaSeparatedList writes out the provided list using the writer to
@@ -238,23 +330,102 @@ func (b *sqlBuilder) getSQL() string {
 	return b.buf.String()
 }
 
-const markerPrefix = "_sqlair_"
+// defaultMarker is the name that input parameters and output marker columns
+// start with when the parameter style does not set one.
+const defaultMarker = "sqlair"
+
+// markerPrefix is the prefix of the output marker columns with the default
+// marker. Column aliases starting with it are rejected whatever the marker of
+// the style the query is bound with.
+const markerPrefix = "_" + defaultMarker + "_"
 
-func markerName(n int) string {
-	return markerPrefix + strconv.Itoa(n)
+// markerName returns the name of output marker column n, e.g. "_sqlair_0"
+// for the prefix "_sqlair_".
+func markerName(prefix string, n int) string {
+	return prefix + strconv.Itoa(n)
 }
 
-// markerIndex returns the int X from the string "_sqlair_X".
-func markerIndex(s string) (int, bool) {
-	if strings.HasPrefix(s, markerPrefix) {
-		n, err := strconv.Atoi(s[len(markerPrefix):])
-		if err == nil {
+// markerIndex returns the int X from the string prefix+"X", e.g. "_sqlair_X".
+func markerIndex(prefix string, s string) (int, bool) {
+	if strings.HasPrefix(s, prefix) {
+		n, err := strconv.Atoi(s[len(prefix):])
+		if err == nil && n >= 0 {
 			return n, true
 		}
 	}
 	return 0, false
 }
 
+// findMarkerPrefix returns the first name in sql, outside of string literals
+// and comments, that starts with prefix, the prefix of the output marker
+// columns. The
+// prefix is matched regardless of case as some databases fold the case of
+// names. Quoted identifiers are checked as they can be used as column aliases.
+func findMarkerPrefix(sql string, prefix string) (string, bool) {
+	isNameChar := func(c byte) bool {
+		return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+	for i := 0; i < len(sql); i++ {
+		switch {
+		case sql[i] == '\'':
+			end := strings.IndexByte(sql[i+1:], '\'')
+			if end == -1 {
+				return "", false
+			}
+			i += end + 1
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end == -1 {
+				return "", false
+			}
+			i += end
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end == -1 {
+				return "", false
+			}
+			i += end + 3
+		case (i == 0 || !isNameChar(sql[i-1])) && len(sql)-i >= len(prefix) && strings.EqualFold(sql[i:i+len(prefix)], prefix):
+			end := i
+			for end < len(sql) && isNameChar(sql[end]) {
+				end++
+			}
+			return sql[i:end], true
+		}
+	}
+	return "", false
+}
+
 func notReferencedInQueryError(t reflect.Type) error {
 	return fmt.Errorf(`argument of type %q not used by query`, typeinfo.PrettyTypeName(t))
 }
+
+// containsOutsideQuotes returns true if s appears in sql outside of quoted
+// strings, quoted identifiers and comments.
+func containsOutsideQuotes(sql string, s string) bool {
+	for i := 0; i < len(sql); i++ {
+		switch {
+		case sql[i] == '\'' || sql[i] == '"':
+			end := strings.IndexByte(sql[i+1:], sql[i])
+			if end == -1 {
+				return false
+			}
+			i += end + 1
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end == -1 {
+				return false
+			}
+			i += end
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end == -1 {
+				return false
+			}
+			i += end + 3
+		case strings.HasPrefix(sql[i:], s):
+			return true
+		}
+	}
+	return false
+}
@@ -4,9 +4,12 @@
 package typeinfo
 
 import (
+	"database/sql"
+	"encoding"
 	"fmt"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"unicode"
@@ -21,40 +24,230 @@ import (
 // map.
 type ArgInfo map[string]arg
 
+// NamedArg is an argument that is referenced in SQLair expressions by Name
+// rather than by the name of its type. This allows values of anonymous types
+// to be used as arguments.
+type NamedArg struct {
+	Name  string
+	Value any
+}
+
+// unwrapNamedArg returns the value and name of a SQLair argument. If the
+// argument is not a NamedArg, the name is the empty string.
+func unwrapNamedArg(arg any) (any, string) {
+	if na, ok := arg.(NamedArg); ok {
+		return na.Value, na.Name
+	}
+	return arg, ""
+}
+
+// aliasedType is the type of a map or struct argument that is given a name
+// other than the name of its type. The argument is referenced by that name, so
+// maps or structs of the same type with different names are different
+// arguments.
+type aliasedType struct {
+	reflect.Type
+	alias string
+}
+
+// Name returns the name given to the argument.
+func (at aliasedType) Name() string {
+	return at.alias
+}
+
+// argType returns the type under which an argument of type t with the given
+// name is stored. A map or struct given a name other than the name of its type
+// is stored under an aliasedType.
+func argType(t reflect.Type, name string) reflect.Type {
+	if (t.Kind() == reflect.Map || t.Kind() == reflect.Struct) && name != "" && name != t.Name() {
+		return aliasedType{Type: t, alias: name}
+	}
+	return t
+}
+
+// BaseType returns the Go type of an argument type, removing the name given
+// to a map or struct argument.
+func BaseType(t reflect.Type) reflect.Type {
+	if at, ok := t.(aliasedType); ok {
+		return at.Type
+	}
+	return t
+}
+
+// registeredArgs holds the argument types registered with RegisterTypes.
+var registeredArgsMutex sync.RWMutex
+var registeredArgs = ArgInfo{}
+
+// RegisterTypes takes sample instantiations of argument types and registers
+// them so that they are included in every ArgInfo generated. Registering a
+// type again has no effect. It is an error to register a type with the same
+// name as a different registered type.
+func RegisterTypes(typeSamples []any) error {
+	argInfo, err := generateArgInfo(typeSamples)
+	if err != nil {
+		return err
+	}
+	registeredArgsMutex.Lock()
+	defer registeredArgsMutex.Unlock()
+	for name, arg := range argInfo {
+		if registered, ok := registeredArgs[name]; ok && registered.typ() != arg.typ() {
+			return fmt.Errorf("cannot register type %q with name %q, type %q is registered with the same name", arg.typ().String(), name, registered.typ().String())
+		}
+	}
+	for name, arg := range argInfo {
+		registeredArgs[name] = arg
+	}
+	return nil
+}
+
+// ResetRegisteredTypes removes all the types registered with RegisterTypes.
+func ResetRegisteredTypes() {
+	registeredArgsMutex.Lock()
+	defer registeredArgsMutex.Unlock()
+	registeredArgs = ArgInfo{}
+}
+
+// addRegistered adds the registered argument types to the ArgInfo. A type
+// already in the ArgInfo with the same name takes precedence.
+func (argInfo ArgInfo) addRegistered() {
+	registeredArgsMutex.RLock()
+	defer registeredArgsMutex.RUnlock()
+	for name, arg := range registeredArgs {
+		if _, ok := argInfo[name]; !ok {
+			argInfo[name] = arg
+		}
+	}
+}
+
 // GenerateArgInfo takes sample instantiations of argument types and uses
-// reflection to generate an ArgInfo containing the types.
+// reflection to generate an ArgInfo containing the types along with the types
+// registered with RegisterTypes. A pointer to a sample is treated as the
+// sample itself.
 func GenerateArgInfo(typeSamples []any) (ArgInfo, error) {
+	argInfo, err := generateArgInfo(typeSamples)
+	if err != nil {
+		return nil, err
+	}
+	argInfo.addRegistered()
+	return argInfo, nil
+}
+
+// generateArgInfo generates an ArgInfo containing only the types of the
+// samples.
+func generateArgInfo(typeSamples []any) (ArgInfo, error) {
 	argInfo := ArgInfo{}
 	for _, typeSample := range typeSamples {
+		typeSample, name := unwrapNamedArg(typeSample)
 		if typeSample == nil {
 			return nil, fmt.Errorf("need supported value, got nil")
 		}
-		t := reflect.TypeOf(typeSample)
-		switch t.Kind() {
-		case reflect.Struct, reflect.Map, reflect.Slice:
-			if t.Name() == "" {
-				return nil, fmt.Errorf("cannot use anonymous %s", t.Kind())
-			}
-			info, err := getArgInfo(t)
-			if err != nil {
-				return nil, err
-			}
-			if dupeArg, ok := argInfo[t.Name()]; ok {
-				if dupeArg.typ() == t {
-					return nil, fmt.Errorf("found multiple instances of type %q", t.Name())
-				}
-				return nil, fmt.Errorf("two types found with name %q: %q and %q", t.Name(), dupeArg.typ().String(), t.String())
-			}
-			argInfo[t.Name()] = info
-		case reflect.Pointer:
-			return nil, fmt.Errorf("need non-pointer type, got pointer to %s", t.Elem().Kind())
-		default:
-			return nil, fmt.Errorf("need supported type, got %s", t.Kind())
+		t, err := sampleType(typeSample)
+		if err != nil {
+			return nil, err
+		}
+		if err := argInfo.add(t, name); err != nil {
+			return nil, err
+		}
+	}
+	return argInfo, nil
+}
+
+// sampleType returns the type of the type sample. Pointers are followed so
+// that the pointer passed as an output argument can also be used as a sample.
+func sampleType(typeSample any) (reflect.Type, error) {
+	v := reflect.ValueOf(typeSample)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, fmt.Errorf("need supported value, got nil pointer to %s", v.Type().Elem().Kind())
+		}
+		v = v.Elem()
+	}
+	return v.Type(), nil
+}
+
+// GenerateArgInfoFromTypes is the same as GenerateArgInfo except that it
+// takes the argument types directly rather than samples of them.
+func GenerateArgInfoFromTypes(types []reflect.Type) (ArgInfo, error) {
+	argInfo := ArgInfo{}
+	for _, t := range types {
+		if t == nil {
+			return nil, fmt.Errorf("need supported type, got nil")
+		}
+		if err := argInfo.add(t, ""); err != nil {
+			return nil, err
 		}
 	}
+	argInfo.addRegistered()
 	return argInfo, nil
 }
 
+// add adds the argument type t to the ArgInfo. If name is empty the name of
+// the type is used.
+func (argInfo ArgInfo) add(t reflect.Type, name string) error {
+	if isByteSlice(t) {
+		return byteSliceArgError(t)
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice:
+		if name == "" {
+			name = t.Name()
+		} else if err := validateArgName(name); err != nil {
+			return err
+		}
+		if name == "" {
+			return fmt.Errorf("cannot use anonymous %s, name it with sqlair.Named", t.Kind())
+		}
+		// The name of an instantiated generic type, such as Box[int], is
+		// not a valid name in a SQLair expression.
+		if strings.ContainsRune(name, '[') {
+			return fmt.Errorf("cannot use generic type %q without a name, name it with sqlair.Named", name)
+		}
+		info, err := getArgInfo(argType(t, name))
+		if err != nil {
+			return err
+		}
+		if dupeArg, ok := argInfo[name]; ok {
+			if dupeArg.typ() == t {
+				return fmt.Errorf("found multiple instances of type %q", name)
+			}
+			return fmt.Errorf("two types found with name %q: %q and %q, name one of them with sqlair.Named", name, dupeArg.typ().String(), t.String())
+		}
+		argInfo[name] = info
+	case reflect.Pointer:
+		return fmt.Errorf("need non-pointer type, got pointer to %s", t.Elem().Kind())
+	default:
+		return fmt.Errorf("need supported type, got %s", t.Kind())
+	}
+	return nil
+}
+
+// rawBytesType is the type of sql.RawBytes. It refers to memory owned by the
+// driver so it cannot be scanned into a value that outlives the row.
+var rawBytesType = reflect.TypeOf(sql.RawBytes{})
+
+// isByteSlice returns true if t is a slice of bytes, such as []byte or
+// json.RawMessage. Byte slices hold a single value and are passed to the
+// driver whole rather than treated as a list of values. They are copied when
+// scanned so they remain valid after the next row is read.
+func isByteSlice(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+}
+
+func byteSliceArgError(t reflect.Type) error {
+	return fmt.Errorf("cannot use byte slice %q as an argument, byte slices can only be used as struct fields or map values", PrettyTypeName(t))
+}
+
+// validateArgName checks that a name given to an argument can be used in place
+// of a type name in SQLair expressions.
+func validateArgName(name string) error {
+	for i, c := range name {
+		if !(unicode.IsLetter(c) || c == '_' || (i > 0 && unicode.IsDigit(c))) {
+			return fmt.Errorf("invalid argument name %q", name)
+		}
+	}
+	return nil
+}
+
 // Kind looks up the type name and returns its kind.
 func (argInfo ArgInfo) Kind(typeName string) (reflect.Kind, error) {
 	arg, ok := argInfo[typeName]
@@ -74,12 +267,41 @@ func (argInfo ArgInfo) InputMember(typeName string, memberName string) (Input, e
 	if !ok {
 		return nil, fmt.Errorf("internal error: %s cannot be used as input", vl.ArgType().Kind())
 	}
+	if f, ok := input.(*structField); ok && f.readOnly {
+		return nil, fmt.Errorf("cannot use %s as an input, it has the readonly option", f.Desc())
+	}
 	return input, nil
 }
 
+// WithoutDefault returns a copy of the input that passes a zero value as it is
+// rather than replacing it with the value of the default option of its field.
+// It returns false if the input has no default, in which case the input is
+// returned unchanged.
+func WithoutDefault(input Input) (Input, bool) {
+	f, ok := input.(*structField)
+	if !ok || !f.defaultValue.IsValid() {
+		return input, false
+	}
+	withoutDefault := *f
+	withoutDefault.defaultValue = reflect.Value{}
+	return &withoutDefault, true
+}
+
+// IsReadOnly returns true if the member of the named type is a struct field
+// with the readonly option.
+func (argInfo ArgInfo) IsReadOnly(typeName string, memberName string) bool {
+	vl, err := argInfo.getMember(typeName, memberName)
+	if err != nil {
+		return false
+	}
+	f, ok := vl.(*structField)
+	return ok && f.readOnly
+}
+
 // AllStructInputs returns a list of inputs locators that locate every member
-// of the named type along with the names of the members. If the type is not a
-// struct an error is returned.
+// of the named type along with the names of the members. Members with the
+// readonly option are left out. If the type is not a struct, or all of its
+// members are read only, an error is returned.
 func (argInfo ArgInfo) AllStructInputs(typeName string) ([]Input, []string, error) {
 	si, err := argInfo.getAllStructMembers(typeName)
 	if err != nil {
@@ -87,14 +309,26 @@ func (argInfo ArgInfo) AllStructInputs(typeName string) ([]Input, []string, erro
 	}
 
 	var inputs []Input
+	var tags []string
 	for _, tag := range si.tags {
-		inputs = append(inputs, si.tagToField[tag])
+		if f := si.tagToField[tag]; !f.readOnly {
+			inputs = append(inputs, f)
+			tags = append(tags, tag)
+		}
 	}
-	return inputs, si.tags, nil
+	if len(inputs) == 0 {
+		return nil, nil, fmt.Errorf(`no "db" tags without the readonly option found in struct %q`, PrettyTypeName(si.structType))
+	}
+	return inputs, tags, nil
 }
 
 // OutputMember returns an output locator for a member of a struct or map.
 func (argInfo ArgInfo) OutputMember(typeName string, memberName string) (Output, error) {
+	if si, ok := argInfo[typeName].(*structInfo); ok {
+		if scanner, ok := si.scanners[memberName]; ok {
+			return &scannerMember{member: memberName, structType: si.structType, scanner: scanner}, nil
+		}
+	}
 	vl, err := argInfo.getMember(typeName, memberName)
 	if err != nil {
 		return nil, err
@@ -103,12 +337,18 @@ func (argInfo ArgInfo) OutputMember(typeName string, memberName string) (Output,
 	if !ok {
 		return nil, fmt.Errorf("internal error: %s cannot be used as output", vl.ArgType().Kind())
 	}
+	if f, ok := output.(*structField); ok {
+		if err := f.checkOutput(); err != nil {
+			return nil, err
+		}
+	}
 	return output, nil
 }
 
 // AllStructOutputs returns a list of output locators that locate every member
-// of the named type along with the names of the members. If the type is not a
-// struct an error is returned.
+// of the named type along with the names of the columns to read them from.
+// The column names are the names of the members unless a ColumnMapper is set
+// for the type. If the type is not a struct an error is returned.
 func (argInfo ArgInfo) AllStructOutputs(typeName string) ([]Output, []string, error) {
 	si, err := argInfo.getAllStructMembers(typeName)
 	if err != nil {
@@ -116,10 +356,104 @@ func (argInfo ArgInfo) AllStructOutputs(typeName string) ([]Output, []string, er
 	}
 
 	var outputs []Output
-	for _, tag := range si.tags {
-		outputs = append(outputs, si.tagToField[tag])
+	columns := si.tags
+	if si.columnMapper != nil {
+		columns = make([]string, len(si.tags))
+	}
+	for i, tag := range si.tags {
+		if scanner, ok := si.scanners[tag]; ok {
+			outputs = append(outputs, &scannerMember{member: tag, structType: si.structType, scanner: scanner})
+		} else {
+			if err := si.tagToField[tag].checkOutput(); err != nil {
+				return nil, nil, err
+			}
+			outputs = append(outputs, si.tagToField[tag])
+		}
+		if si.columnMapper != nil {
+			columns[i] = si.columnMapper(typeName, tag)
+			if columns[i] == "" {
+				return nil, nil, fmt.Errorf("column mapper of %q returned no column for %q", typeName, tag)
+			}
+			// Two members read from the same column would silently get the
+			// same value.
+			for j := 0; j < i; j++ {
+				if columns[j] == columns[i] {
+					return nil, nil, fmt.Errorf("column mapper of %q returned column %q for both %q and %q", typeName, columns[i], si.tags[j], tag)
+				}
+			}
+		}
+	}
+	return outputs, columns, nil
+}
+
+// ColumnMapper generates the name of the column for a member of a type when
+// the members of the type are selected with an asterisk.
+type ColumnMapper func(typeName string, memberTag string) string
+
+// MapColumns sets the ColumnMapper used to generate the columns of the
+// members of the named struct type in AllStructOutputs.
+func (argInfo ArgInfo) MapColumns(typeName string, mapper ColumnMapper) error {
+	arg, ok := argInfo[typeName]
+	if !ok {
+		return nameNotFoundError(argInfo, typeName)
+	}
+	si, ok := arg.(*structInfo)
+	if !ok {
+		return fmt.Errorf("cannot map columns of %s %q, a struct is required", arg.typ().Kind(), typeName)
+	}
+	// The structInfo is shared between queries so is copied.
+	mapped := *si
+	mapped.columnMapper = mapper
+	argInfo[typeName] = &mapped
+	return nil
+}
+
+// MemberScanner sets a member of a struct from the value of a result column.
+// dest is a pointer to the struct and v is the value of the column as
+// returned by the driver.
+type MemberScanner func(dest any, v any) error
+
+// RegisterScanner sets the MemberScanner used to scan results into the member
+// of the named struct type. If the member is a db tag of the struct then the
+// scanner is used in place of setting the tagged field. Otherwise the member
+// can only be used in output expressions that name it.
+func (argInfo ArgInfo) RegisterScanner(typeName string, member string, scanner MemberScanner) error {
+	arg, ok := argInfo[typeName]
+	if !ok {
+		return nameNotFoundError(argInfo, typeName)
+	}
+	si, ok := arg.(*structInfo)
+	if !ok {
+		return fmt.Errorf("cannot register scanner for %s %q, a struct is required", arg.typ().Kind(), typeName)
+	}
+	if scanner == nil {
+		return fmt.Errorf("cannot register nil scanner for member %q of %q", member, typeName)
+	}
+	// The structInfo and its scanners are shared between queries so are
+	// copied.
+	withScanner := *si
+	withScanner.scanners = map[string]MemberScanner{member: scanner}
+	for m, sc := range si.scanners {
+		if m != member {
+			withScanner.scanners[m] = sc
+		}
+	}
+	argInfo[typeName] = &withScanner
+	return nil
+}
+
+// ColumnOutput returns an Output for the named map type that stores the
+// result of the column at the key of its name as reported by the database.
+func (argInfo ArgInfo) ColumnOutput(typeName string, column string) (ColumnOutput, error) {
+	arg, ok := argInfo[typeName]
+	if !ok {
+		return nil, nameNotFoundError(argInfo, typeName)
 	}
-	return outputs, si.tags, nil
+	mi, ok := arg.(*mapInfo)
+	if !ok {
+		return nil, fmt.Errorf("cannot read %q into asterisk of %s, a map is required", column, arg.typ().Kind())
+	}
+	return &columnKey{column: column, mapType: mi.mapType}, nil
 }
 
 // getMember finds a type and a member of it and returns a locator for the
@@ -131,12 +465,17 @@ func (argInfo ArgInfo) getMember(typeName string, memberName string) (ValueLocat
 	}
 	switch arg := arg.(type) {
 	case *structInfo:
-		structField, ok := arg.tagToField[memberName]
-		if !ok {
-			return nil, fmt.Errorf(`type %q has no %q db tag`, arg.structType.Name(), memberName)
+		if structField, ok := arg.tagToField[memberName]; ok {
+			return structField, nil
+		}
+		if path := splitMemberPath(memberName); len(path) > 1 {
+			return arg.nestedField(path)
 		}
-		return structField, nil
+		return nil, fmt.Errorf(`type %q has no %q db tag`, PrettyTypeName(arg.structType), memberName)
 	case *mapInfo:
+		if path := splitMemberPath(memberName); len(path) > 1 {
+			return nil, fmt.Errorf("cannot get nested member %q of map %q", memberName, PrettyTypeName(arg.mapType))
+		}
 		return &mapKey{name: memberName, mapType: arg.mapType}, nil
 	default:
 		return nil, fmt.Errorf("cannot get named member of %s", arg.typ().Kind())
@@ -162,7 +501,7 @@ func (argInfo ArgInfo) getAllStructMembers(typeName string) (*structInfo, error)
 		}
 	}
 	if len(si.tags) == 0 {
-		return nil, fmt.Errorf(`no "db" tags found in struct %q`, si.structType.Name())
+		return nil, fmt.Errorf(`no "db" tags found in struct %q`, PrettyTypeName(si.structType))
 	}
 	return si, nil
 }
@@ -185,6 +524,101 @@ type arg interface {
 	typ() reflect.Type
 }
 
+// getStructInfo returns the structInfo of the struct type t. If fieldNames is
+// true then exported fields with no db tag are included under the snake case
+// of their field names.
+func getStructInfo(t reflect.Type, fieldNames bool) (*structInfo, error) {
+	info := structInfo{
+		tagToField: make(map[string]*structField),
+		structType: t,
+	}
+	tags := []string{}
+
+	fields, err := getStructFields(t, fieldNames, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Check for duplicate tags.
+	for _, field := range fields {
+		tags = append(tags, field.tag)
+		if dup, ok := info.tagToField[field.tag]; ok {
+			if dup.fromName {
+				field, dup = dup, field
+			}
+			if field.fromName {
+				return nil, fmt.Errorf("name %q of field %q collides with db tag of field %q of struct %q",
+					field.tag, field.name, dup.name, t.Name())
+			}
+			return nil, fmt.Errorf("duplicate db tag %q on fields %q and %q of struct %q",
+				field.tag, dup.name, field.name, t.Name())
+		}
+		info.tagToField[field.tag] = field
+	}
+
+	info.declaredTags = append([]string{}, tags...)
+	sort.Strings(tags)
+	info.tags = tags
+	return &info, nil
+}
+
+// UseDeclarationOrder orders the members of every struct type in the ArgInfo
+// in the order their fields are declared, rather than sorted by tag, when
+// they are selected with an asterisk. The fields of an embedded struct take
+// the place of the embedded field.
+func (argInfo ArgInfo) UseDeclarationOrder() {
+	for name, arg := range argInfo {
+		si, ok := arg.(*structInfo)
+		if !ok {
+			continue
+		}
+		// The structInfo is shared between queries so is copied.
+		ordered := *si
+		ordered.tags = si.declaredTags
+		argInfo[name] = &ordered
+	}
+}
+
+// UseFieldNames includes the exported fields with no db tag of every struct
+// type in the ArgInfo. They are referenced by the snake case of their field
+// names, e.g. a field FullName is referenced as full_name. Explicit db tags
+// are unchanged, a field name that collides with one is an error.
+func (argInfo ArgInfo) UseFieldNames() error {
+	for name, arg := range argInfo {
+		si, ok := arg.(*structInfo)
+		if !ok {
+			continue
+		}
+		withNames, err := getStructInfo(si.structType, true)
+		if err != nil {
+			return err
+		}
+		withNames.columnMapper = si.columnMapper
+		withNames.scanners = si.scanners
+		argInfo[name] = withNames
+	}
+	return nil
+}
+
+// snakeCase converts a Go field name to snake case, e.g. FullName to
+// full_name and UserID to user_id.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// Start a new word at an upper case letter that follows a lower
+			// case letter or digit, or that ends a run of upper case letters.
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) && runes[i-1] != '_' {
+				sb.WriteRune('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
 // structInfo stores information useful for SQLair about struct types.
 type structInfo struct {
 	structType reflect.Type
@@ -192,13 +626,69 @@ type structInfo struct {
 	// Ordered list of tags
 	tags []string
 
+	// declaredTags are the tags in the order their fields are declared.
+	declaredTags []string
+
 	tagToField map[string]*structField
+
+	// columnMapper generates the columns of the members when they are
+	// selected with an asterisk. It is nil if the columns are the tags.
+	columnMapper ColumnMapper
+
+	// scanners are the MemberScanners registered for members of the struct.
+	scanners map[string]MemberScanner
 }
 
 func (si *structInfo) typ() reflect.Type {
 	return si.structType
 }
 
+// nestedField follows a path of db tags through nested struct fields and
+// returns a structField that locates the final member from the outer struct.
+func (si *structInfo) nestedField(path []string) (*structField, error) {
+	fullPath := strings.Join(path, ".")
+	current := si
+	var names []string
+	var index []int
+	for i, tag := range path {
+		field, ok := current.tagToField[tag]
+		if !ok {
+			return nil, fmt.Errorf(`type %q has no %q db tag`, current.structType.Name(), tag)
+		}
+		names = append(names, field.name)
+		index = append(index, field.index...)
+		if i == len(path)-1 {
+			return &structField{
+				name:         strings.Join(names, "."),
+				structType:   si.structType,
+				index:        index,
+				tag:          fullPath,
+				omitEmpty:    field.omitEmpty,
+				nullZero:     field.nullZero,
+				readOnly:     field.readOnly,
+				redact:       field.redact,
+				json:         field.json,
+				layout:       field.layout,
+				defaultValue: field.defaultValue,
+			}, nil
+		}
+
+		fieldType := current.structType.FieldByIndex(field.index).Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("cannot get member %q of field %q with type %s", path[i+1], field.name, fieldType.Kind())
+		}
+		info, err := getArgInfo(fieldType)
+		if err != nil {
+			return nil, err
+		}
+		current = info.(*structInfo)
+	}
+	return nil, fmt.Errorf("internal error: empty member path")
+}
+
 // mapInfo stores a map type.
 type mapInfo struct {
 	mapType reflect.Type
@@ -237,33 +727,16 @@ func getArgInfo(t reflect.Type) (arg, error) {
 		if t.Key().Kind() != reflect.String {
 			return nil, fmt.Errorf(`map type %s must have key type string, found type %s`, t.Name(), t.Key().Kind())
 		}
+		if err := checkMapValueType(t); err != nil {
+			return nil, err
+		}
 		typeInfo = &mapInfo{mapType: t}
 	case reflect.Struct:
-		info := structInfo{
-			tagToField: make(map[string]*structField),
-			structType: t,
-		}
-		tags := []string{}
-
-		fields, err := getStructFields(t)
+		info, err := getStructInfo(t, false)
 		if err != nil {
 			return nil, err
 		}
-
-		// Check for duplicate tags.
-		for _, field := range fields {
-			tags = append(tags, field.tag)
-			if dup, ok := info.tagToField[field.tag]; ok {
-				return nil, fmt.Errorf("db tag %q appears in both field %q and field %q of struct %q",
-					field.tag, field.name, dup.name, t.Name())
-			}
-			info.tagToField[field.tag] = field
-		}
-
-		sort.Strings(tags)
-		info.tags = tags
-
-		typeInfo = &info
+		typeInfo = info
 	case reflect.Slice:
 		return &sliceInfo{sliceType: t}, nil
 	default:
@@ -278,35 +751,156 @@ func getArgInfo(t reflect.Type) (arg, error) {
 	return typeInfo, nil
 }
 
+// splitMemberPath splits a dot separated path of db tags into its elements.
+// Dots within quoted tags are not treated as separators.
+func splitMemberPath(memberName string) []string {
+	var path []string
+	var quote rune
+	start := 0
+	for i, c := range memberName {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '.':
+			path = append(path, memberName[start:i])
+			start = i + 1
+		}
+	}
+	return append(path, memberName[start:])
+}
+
+// tagOptions holds the options set in a "db" tag after the column name.
+type tagOptions struct {
+	// omitEmpty is true if the "omitempty" option is set.
+	omitEmpty bool
+	// nullZero is true if the "nullzero" option is set.
+	nullZero bool
+	// readOnly is true if the "readonly" option is set.
+	readOnly bool
+	// redact is true if the "redact" option is set.
+	redact bool
+	// json is true if the "json" option is set.
+	json bool
+	// prefix is true if the "prefix" option is set.
+	prefix bool
+	// layout is the time layout set with the "layout=" option.
+	layout string
+	// defaultValue is the text of the value set with the "default=" option.
+	// hasDefault is true if the option is set.
+	defaultValue string
+	hasDefault   bool
+}
+
+// parseDefault returns the value of type t written as s in the "default="
+// option of a tag. Types that implement encoding.TextUnmarshaler, such as
+// time.Time, are unmarshalled from s. Otherwise t must be a string, bool or
+// number type. For a pointer type a pointer to the value is returned.
+func parseDefault(t reflect.Type, s string) (reflect.Value, error) {
+	if t.Kind() == reflect.Pointer {
+		v, err := parseDefault(t.Elem(), s)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(v)
+		return ptr, nil
+	}
+	v := reflect.New(t).Elem()
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(s)); err != nil {
+			return reflect.Value{}, fmt.Errorf("cannot unmarshal %q into %s: %s", s, t, err)
+		}
+		return v, nil
+	}
+	var err error
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(s)
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		n, err = strconv.ParseInt(s, 10, t.Bits())
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		n, err = strconv.ParseUint(s, 10, t.Bits())
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(s, t.Bits())
+		v.SetFloat(f)
+	default:
+		return reflect.Value{}, fmt.Errorf("fields of type %s cannot have a default", t)
+	}
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("cannot parse %q as %s", s, t)
+	}
+	return v, nil
+}
+
 // parseTag parses the input tag string and returns its
-// name and whether it contains the "omitempty" option.
-func parseTag(tag string) (string, bool, error) {
+// name and the options it contains.
+func parseTag(tag string) (string, tagOptions, error) {
 	options := strings.Split(tag, ",")
 
-	var omitEmpty bool
+	var opts tagOptions
 	if len(options) > 1 {
 		for _, flag := range options[1:] {
-			if strings.TrimSpace(flag) == "omitempty" {
-				omitEmpty = true
-			} else {
-				return "", omitEmpty, fmt.Errorf("unsupported flag %q in tag %q", flag, tag)
+			if flag := strings.TrimSpace(flag); strings.HasPrefix(flag, "layout=") {
+				layout := strings.TrimPrefix(flag, "layout=")
+				if layout == "" {
+					return "", opts, fmt.Errorf("empty layout in tag %q", tag)
+				}
+				opts.layout = layout
+				continue
+			}
+			if flag := strings.TrimSpace(flag); strings.HasPrefix(flag, "default=") {
+				defaultValue := strings.TrimPrefix(flag, "default=")
+				if defaultValue == "" {
+					return "", opts, fmt.Errorf("empty default in tag %q", tag)
+				}
+				opts.defaultValue, opts.hasDefault = defaultValue, true
+				continue
+			}
+			switch strings.TrimSpace(flag) {
+			case "omitempty":
+				opts.omitEmpty = true
+			case "nullzero":
+				opts.nullZero = true
+			case "readonly":
+				opts.readOnly = true
+			case "redact":
+				opts.redact = true
+			case "json":
+				opts.json = true
+			case "prefix":
+				opts.prefix = true
+			default:
+				return "", opts, fmt.Errorf("unsupported flag %q in tag %q", flag, tag)
 			}
 		}
 	}
 
 	name := options[0]
 	if len(name) == 0 {
-		return "", false, fmt.Errorf("empty db tag")
+		return "", opts, fmt.Errorf("empty db tag")
 	}
 
 	// Check the tag is a valid column name.
 
 	if name[0] == '"' || name[0] == '\'' {
 		if name[len(name)-1] != name[0] {
-			return "", false, fmt.Errorf("missing quotes at end of 'db' tag: %q", name)
+			return "", opts, fmt.Errorf("missing quotes at end of 'db' tag: %q", name)
 		}
 		// No need to validate chars in quotes.
-		return name, omitEmpty, nil
+		return name, opts, nil
 	}
 
 	char, size := utf8.DecodeRuneInString(name)
@@ -317,28 +911,53 @@ func parseTag(tag string) (string, bool, error) {
 		// If it starts with a digit, check the tag is a number.
 		checker = unicode.IsDigit
 	case unicode.IsLetter(char) || char == '_':
-		// Otherwise make sure it is made up of letters, digits and underscore.
+		// Otherwise make sure it is made up of letters, digits, underscores
+		// and dollar signs, as allowed in unquoted identifiers by some
+		// databases. Other names must be quoted.
 		checker = func(char rune) bool {
-			return unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_'
+			return unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_' || char == '$'
 		}
 	default:
-		return "", false, fmt.Errorf("invalid column name in 'db' tag: %q", name)
+		return "", opts, fmt.Errorf("invalid column name in 'db' tag: %q", name)
 	}
 	for nextPos < len(name) {
 		char, size = utf8.DecodeRuneInString(name[nextPos:])
 		nextPos += size
 		if !(checker(char)) {
-			return "", false, fmt.Errorf("invalid column name in 'db' tag: %q", name)
+			return "", opts, fmt.Errorf("invalid column name in 'db' tag: %q", name)
 		}
 	}
 
-	return name, omitEmpty, nil
+	return name, opts, nil
+}
+
+// checkMapValueType returns an error if values of the value type of the map
+// cannot be passed to or scanned from the database.
+func checkMapValueType(mapType reflect.Type) error {
+	valueType := mapType.Elem()
+	if valueType == rawBytesType {
+		return fmt.Errorf("map type %s has value type sql.RawBytes which is only valid until the next row is read, use []byte", mapType.Name())
+	}
+	switch valueType.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return fmt.Errorf("map type %s has unsupported value type %s", mapType.Name(), valueType)
+	case reflect.Pointer:
+		if valueType.Elem().Kind() == reflect.Pointer {
+			return fmt.Errorf("map type %s has unsupported double pointer value type %s", mapType.Name(), valueType)
+		}
+	}
+	return nil
 }
 
 // getStructFields returns relevant reflection information about all struct
 // fields included embedded fields. The caller must check that structType is a
-// struct.
-func getStructFields(structType reflect.Type) ([]*structField, error) {
+// struct. If fieldNames is true then exported fields with no db tag are
+// included with the snake case of their name as their tag. visiting holds the struct types whose fields are being found, an
+// embedded struct of one of these types is skipped as its fields are shadowed
+// by the fields of the outer struct.
+func getStructFields(structType reflect.Type, fieldNames bool, visiting map[reflect.Type]bool) ([]*structField, error) {
+	visiting[structType] = true
+	defer delete(visiting, structType)
 	var fields []*structField
 	for i := 0; i < structType.NumField(); i++ {
 		field := structType.Field(i)
@@ -350,53 +969,158 @@ func getStructFields(structType reflect.Type) ([]*structField, error) {
 			// we pass it straight to the driver. This means it must implement the
 			// Valuer or Scanner interface (for inputs/outputs respectively) or the
 			// driver will reject it with a panic.
-			if !field.IsExported() {
-				continue
-			}
-
 			fieldType := field.Type
 			if fieldType.Kind() == reflect.Pointer {
 				fieldType = fieldType.Elem()
 			}
-			if fieldType.Kind() != reflect.Struct {
+			if fieldType.Kind() != reflect.Struct || visiting[fieldType] {
 				continue
 			}
 			// Promote the embedded struct fields into the current parent struct
 			// scope, making sure to update the Index list for navigation back
 			// to the original nested location.
-			nestedFields, err := getStructFields(fieldType)
+			nestedFields, err := getStructFields(fieldType, fieldNames, visiting)
 			if err != nil {
 				return nil, err
 			}
+			// The exported fields of an unexported embedded struct can be set
+			// through it, but an unexported embedded pointer cannot be
+			// allocated so its fields cannot be reached.
+			if !field.IsExported() && field.Type.Kind() == reflect.Pointer {
+				for _, nestedField := range nestedFields {
+					if !nestedField.fromName {
+						return nil, fmt.Errorf("field %q of struct %s has db tag but embedded pointer %q is not exported", field.Name+"."+nestedField.name, structType.Name(), field.Name)
+					}
+				}
+				continue
+			}
 			for _, nestedField := range nestedFields {
 				nestedField.index = append([]int{i}, nestedField.index...)
 				nestedField.structType = structType
+				// The name is the path to the field so that errors can tell
+				// apart fields of different embedded structs.
+				nestedField.name = field.Name + "." + nestedField.name
 			}
 			fields = append(fields, nestedFields...)
 		} else {
-			// Fields without a "db" tag are outside of SQLair's remit.
+			// Fields without a "db" tag are outside of SQLair's remit unless
+			// field names are used.
 			if tag == "" {
+				if fieldNames && field.IsExported() {
+					fields = append(fields, &structField{
+						name:       field.Name,
+						index:      field.Index,
+						tag:        snakeCase(field.Name),
+						structType: structType,
+						fromName:   true,
+					})
+				}
 				continue
 			}
 			if !field.IsExported() {
 				return nil, fmt.Errorf("field %q of struct %s not exported", field.Name, structType.Name())
 			}
-			tag, omitEmpty, err := parseTag(tag)
+			tag, opts, err := parseTag(tag)
 			if err != nil {
 				return nil, fmt.Errorf("cannot parse tag for field %s.%s: %s", structType.Name(), field.Name, err)
 			}
+			// A pointer field maps NULL to nil. A pointer to a pointer has no
+			// sensible mapping so it is rejected.
+			if field.Type.Kind() == reflect.Pointer && field.Type.Elem().Kind() == reflect.Pointer {
+				return nil, fmt.Errorf("field %q of struct %s has unsupported double pointer type %s", field.Name, structType.Name(), field.Type)
+			}
+			if field.Type == rawBytesType {
+				return nil, fmt.Errorf("field %q of struct %s has type sql.RawBytes which is only valid until the next row is read, use []byte", field.Name, structType.Name())
+			}
+			// An interface field can hold any value returned by the driver
+			// unless it has methods, in which case it must hold a sql.Scanner.
+			if field.Type.Kind() == reflect.Interface && field.Type.NumMethod() > 0 && !field.Type.Implements(scannerInterface) {
+				return nil, fmt.Errorf("field %q of struct %s has interface type %s with methods that is not a sql.Scanner", field.Name, structType.Name(), field.Type)
+			}
+			if opts.prefix {
+				prefixedFields, err := getPrefixedFields(structType, field, tag, opts, fieldNames, visiting)
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, prefixedFields...)
+				continue
+			}
+			if opts.layout != "" {
+				if opts.json {
+					return nil, fmt.Errorf("cannot parse tag for field %s.%s: layout option cannot be used with json option", structType.Name(), field.Name)
+				}
+				if !isTimeType(field.Type) {
+					return nil, fmt.Errorf("cannot use layout option on field %s.%s of type %s, a time.Time is required", structType.Name(), field.Name, field.Type)
+				}
+			}
+			var defaultValue reflect.Value
+			if opts.hasDefault {
+				// The default replaces zero values so it contradicts the
+				// options that give them a meaning of their own.
+				if opts.omitEmpty || opts.nullZero {
+					return nil, fmt.Errorf("cannot parse tag for field %s.%s: default option cannot be used with omitempty or nullzero options", structType.Name(), field.Name)
+				}
+				defaultValue, err = parseDefault(field.Type, opts.defaultValue)
+				if err != nil {
+					return nil, fmt.Errorf("cannot use default option on field %s.%s: %s", structType.Name(), field.Name, err)
+				}
+			}
 			fields = append(fields, &structField{
-				name:       field.Name,
-				index:      field.Index,
-				omitEmpty:  omitEmpty,
-				tag:        tag,
-				structType: structType,
+				name:         field.Name,
+				index:        field.Index,
+				omitEmpty:    opts.omitEmpty,
+				nullZero:     opts.nullZero,
+				readOnly:     opts.readOnly,
+				redact:       opts.redact,
+				json:         opts.json,
+				layout:       opts.layout,
+				defaultValue: defaultValue,
+				tag:          tag,
+				structType:   structType,
 			})
 		}
 	}
 	return fields, nil
 }
 
+// getPrefixedFields returns the fields of the struct in the field of
+// structType with the "prefix" option set. The tags of the fields are the
+// prefix followed by their own tags.
+func getPrefixedFields(structType reflect.Type, field reflect.StructField, prefix string, opts tagOptions, fieldNames bool, visiting map[reflect.Type]bool) ([]*structField, error) {
+	if opts.omitEmpty || opts.nullZero || opts.readOnly || opts.redact || opts.json || opts.layout != "" || opts.hasDefault {
+		return nil, fmt.Errorf("cannot parse tag for field %s.%s: prefix option cannot be used with other options", structType.Name(), field.Name)
+	}
+	if c, _ := utf8.DecodeRuneInString(prefix); !unicode.IsLetter(c) && c != '_' {
+		return nil, fmt.Errorf("cannot parse tag for field %s.%s: prefix %q must start with a letter or underscore", structType.Name(), field.Name, prefix)
+	}
+	fieldType := field.Type
+	if fieldType.Kind() == reflect.Pointer {
+		fieldType = fieldType.Elem()
+	}
+	if fieldType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot use prefix option on field %s.%s of type %s, a struct is required", structType.Name(), field.Name, field.Type.Kind())
+	}
+	if visiting[fieldType] {
+		return nil, fmt.Errorf("cannot use prefix option on field %s.%s, struct %q contains itself", structType.Name(), field.Name, fieldType.Name())
+	}
+	nestedFields, err := getStructFields(fieldType, fieldNames, visiting)
+	if err != nil {
+		return nil, err
+	}
+	for _, nestedField := range nestedFields {
+		nestedField.index = append(append([]int{}, field.Index...), nestedField.index...)
+		nestedField.name = field.Name + "." + nestedField.name
+		if quote := nestedField.tag[0]; quote == '"' || quote == '\'' {
+			// The prefix goes inside the quotes of a quoted tag.
+			nestedField.tag = string(quote) + prefix + nestedField.tag[1:]
+		} else {
+			nestedField.tag = prefix + nestedField.tag
+		}
+		nestedField.structType = structType
+	}
+	return nestedFields, nil
+}
+
 // nameNotFoundError generates the arguments present and returns a typeMissingError
 func nameNotFoundError(argInfo ArgInfo, missingTypeName string) error {
 	// Get names of the arguments we have from the ArgInfo keys.
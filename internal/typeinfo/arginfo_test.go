@@ -4,8 +4,14 @@
 package typeinfo
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/netip"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	. "gopkg.in/check.v1"
 )
@@ -116,6 +122,322 @@ func (s *typeInfoSuite) TestArgInfoStruct(c *C) {
 	}
 }
 
+func (s *typeInfoSuite) TestArgInfoJSONTagOption(c *C) {
+	type payload struct {
+		Key string `json:"key"`
+	}
+	type myStruct struct {
+		Payload     payload  `db:"payload,json"`
+		PayloadPtr  *payload `db:"payload_ptr,omitempty,json"`
+		Unsupported func()   `db:"unsupported,json"`
+	}
+
+	argInfo, err := GenerateArgInfo([]any{myStruct{}})
+	c.Assert(err, IsNil)
+	input, err := argInfo.InputMember("myStruct", "payload_ptr")
+	c.Assert(err, IsNil)
+	c.Check(input, DeepEquals, &structField{
+		name:       "PayloadPtr",
+		structType: reflect.TypeOf(myStruct{}),
+		index:      []int{1},
+		tag:        "payload_ptr",
+		omitEmpty:  true,
+		json:       true,
+	})
+
+	typeToValue := TypeToValue{reflect.TypeOf(myStruct{}): reflect.ValueOf(myStruct{Payload: payload{Key: "value"}})}
+
+	// Values are encoded as JSON.
+	input, err = argInfo.InputMember("myStruct", "payload")
+	c.Assert(err, IsNil)
+	params, err := input.LocateParams(typeToValue)
+	c.Assert(err, IsNil)
+	c.Check(params.Vals, DeepEquals, []any{`{"key":"value"}`})
+
+	// Nil pointers are passed as NULL.
+	input, err = argInfo.InputMember("myStruct", "payload_ptr")
+	c.Assert(err, IsNil)
+	params, err = input.LocateParams(typeToValue)
+	c.Assert(err, IsNil)
+	c.Check(params.Vals, DeepEquals, []any{nil})
+	c.Check(params.Omit, Equals, true)
+
+	input, err = argInfo.InputMember("myStruct", "unsupported")
+	c.Assert(err, IsNil)
+	_, err = input.LocateParams(typeToValue)
+	c.Assert(err, ErrorMatches, `cannot encode tag "unsupported" of struct "myStruct" as JSON: json: unsupported type: func\(\)`)
+
+	// Output values are decoded from JSON.
+	out := myStruct{}
+	outputToValue := TypeToValue{reflect.TypeOf(myStruct{}): reflect.ValueOf(&out).Elem()}
+	output, err := argInfo.OutputMember("myStruct", "payload")
+	c.Assert(err, IsNil)
+	target, proxy, err := output.LocateScanTarget(outputToValue, false)
+	c.Assert(err, IsNil)
+	c.Check(proxy, IsNil)
+	scanner, ok := target.(sql.Scanner)
+	c.Assert(ok, Equals, true)
+	c.Assert(scanner.Scan([]byte(`{"key":"value"}`)), IsNil)
+	c.Check(out.Payload, Equals, payload{Key: "value"})
+	c.Assert(scanner.Scan(`{"key":`), ErrorMatches, `cannot decode tag "payload" of struct "myStruct" from JSON: unexpected end of JSON input`)
+	c.Check(out.Payload, Equals, payload{Key: "value"})
+	c.Assert(scanner.Scan(nil), IsNil)
+	c.Check(out.Payload, Equals, payload{})
+}
+
+// strictScanner is a sql.Scanner that rejects NULL.
+type strictScanner struct {
+	s string
+}
+
+func (ss *strictScanner) Scan(src any) error {
+	if src == nil {
+		return fmt.Errorf("unexpected NULL")
+	}
+	ss.s = fmt.Sprint(src)
+	return nil
+}
+
+func (s *typeInfoSuite) TestArgInfoNullZero(c *C) {
+	type myStruct struct {
+		Nickname string        `db:"nickname,nullzero"`
+		Count    int           `db:"count,nullzero,omitempty"`
+		Strict   strictScanner `db:"strict,nullzero"`
+	}
+	argInfo, err := GenerateArgInfo([]any{myStruct{}})
+	c.Assert(err, IsNil)
+
+	// Zero values are passed as NULL.
+	typeToValue := TypeToValue{reflect.TypeOf(myStruct{}): reflect.ValueOf(myStruct{Count: 2})}
+	input, err := argInfo.InputMember("myStruct", "nickname")
+	c.Assert(err, IsNil)
+	params, err := input.LocateParams(typeToValue)
+	c.Assert(err, IsNil)
+	c.Check(params.Vals, DeepEquals, []any{nil})
+	c.Check(params.Omit, Equals, false)
+	input, err = argInfo.InputMember("myStruct", "count")
+	c.Assert(err, IsNil)
+	params, err = input.LocateParams(typeToValue)
+	c.Assert(err, IsNil)
+	c.Check(params.Vals, DeepEquals, []any{2})
+
+	// NULL is not passed to a sql.Scanner field, it is set to its zero
+	// value.
+	out := myStruct{Strict: strictScanner{s: "old"}}
+	outputToValue := TypeToValue{reflect.TypeOf(myStruct{}): reflect.ValueOf(&out).Elem()}
+	output, err := argInfo.OutputMember("myStruct", "strict")
+	c.Assert(err, IsNil)
+	target, proxy, err := output.LocateScanTarget(outputToValue, false)
+	c.Assert(err, IsNil)
+	c.Check(proxy, IsNil)
+	scanner, ok := target.(sql.Scanner)
+	c.Assert(ok, Equals, true)
+	c.Assert(scanner.Scan(nil), IsNil)
+	c.Check(out.Strict, Equals, strictScanner{})
+	c.Assert(scanner.Scan("new"), IsNil)
+	c.Check(out.Strict, Equals, strictScanner{s: "new"})
+
+	// The option cannot be used with prefix.
+	type withPrefix struct {
+		Inner myStruct `db:"inner_,prefix,nullzero"`
+	}
+	_, err = GenerateArgInfo([]any{withPrefix{}})
+	c.Assert(err, ErrorMatches, `cannot parse tag for field withPrefix.Inner: prefix option cannot be used with other options`)
+}
+
+func (s *typeInfoSuite) TestArgInfoReadOnly(c *C) {
+	type myStruct struct {
+		ID      int    `db:"id"`
+		Created string `db:"created,readonly"`
+	}
+	argInfo, err := GenerateArgInfo([]any{myStruct{}})
+	c.Assert(err, IsNil)
+
+	// Read only fields are left out of all the inputs of the struct.
+	inputs, tags, err := argInfo.AllStructInputs("myStruct")
+	c.Assert(err, IsNil)
+	c.Check(inputs, HasLen, 1)
+	c.Check(tags, DeepEquals, []string{"id"})
+	c.Check(argInfo.IsReadOnly("myStruct", "created"), Equals, true)
+	c.Check(argInfo.IsReadOnly("myStruct", "id"), Equals, false)
+
+	// They cannot be used as an input on their own.
+	_, err = argInfo.InputMember("myStruct", "created")
+	c.Assert(err, ErrorMatches, `cannot use tag "created" of struct "myStruct" as an input, it has the readonly option`)
+
+	// They can still be used as outputs.
+	outputs, tags, err := argInfo.AllStructOutputs("myStruct")
+	c.Assert(err, IsNil)
+	c.Check(outputs, HasLen, 2)
+	c.Check(tags, DeepEquals, []string{"created", "id"})
+
+	// A struct with only read only fields has no inputs.
+	type allReadOnly struct {
+		Created string `db:"created,readonly"`
+	}
+	argInfo, err = GenerateArgInfo([]any{allReadOnly{}})
+	c.Assert(err, IsNil)
+	_, _, err = argInfo.AllStructInputs("allReadOnly")
+	c.Assert(err, ErrorMatches, `no "db" tags without the readonly option found in struct "allReadOnly"`)
+
+	// The option cannot be used with prefix.
+	type withPrefix struct {
+		Inner myStruct `db:"inner_,prefix,readonly"`
+	}
+	_, err = GenerateArgInfo([]any{withPrefix{}})
+	c.Assert(err, ErrorMatches, `cannot parse tag for field withPrefix.Inner: prefix option cannot be used with other options`)
+}
+
+func (s *typeInfoSuite) TestArgInfoDefault(c *C) {
+	type myStruct struct {
+		Status  string     `db:"status,default=pending"`
+		Count   int8       `db:"count,default=-3"`
+		Ratio   float64    `db:"ratio,default=0.5"`
+		Active  *bool      `db:"active,default=true"`
+		Created time.Time  `db:"created,default=2024-03-01T12:00:00Z"`
+		Addr    netip.Addr `db:"addr,default=10.0.0.1"`
+	}
+	argInfo, err := GenerateArgInfo([]any{myStruct{}})
+	c.Assert(err, IsNil)
+
+	// Zero values are replaced by the default.
+	active := true
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	expected := map[string]any{
+		"status":  "pending",
+		"count":   int8(-3),
+		"ratio":   0.5,
+		"active":  &active,
+		"created": created,
+		"addr":    "10.0.0.1",
+	}
+	typeToValue := TypeToValue{reflect.TypeOf(myStruct{}): reflect.ValueOf(myStruct{})}
+	for tag, val := range expected {
+		input, err := argInfo.InputMember("myStruct", tag)
+		c.Assert(err, IsNil)
+		params, err := input.LocateParams(typeToValue)
+		c.Assert(err, IsNil)
+		c.Check(params.Vals, DeepEquals, []any{val}, Commentf(tag))
+	}
+
+	// Other values are passed as they are.
+	typeToValue = TypeToValue{reflect.TypeOf(myStruct{}): reflect.ValueOf(myStruct{Status: "done"})}
+	input, err := argInfo.InputMember("myStruct", "status")
+	c.Assert(err, IsNil)
+	params, err := input.LocateParams(typeToValue)
+	c.Assert(err, IsNil)
+	c.Check(params.Vals, DeepEquals, []any{"done"})
+}
+
+func (s *typeInfoSuite) TestArgInfoDefaultError(c *C) {
+	type badInt struct {
+		Count int `db:"count,default=many"`
+	}
+	type overflow struct {
+		Count uint8 `db:"count,default=256"`
+	}
+	type badTime struct {
+		Created time.Time `db:"created,default=today"`
+	}
+	type badType struct {
+		Tags []string `db:"tags,default=a"`
+	}
+	type empty struct {
+		Status string `db:"status,default="`
+	}
+	type withOmitEmpty struct {
+		Status string `db:"status,omitempty,default=pending"`
+	}
+	type withNullZero struct {
+		Status string `db:"status,default=pending,nullzero"`
+	}
+	type withPrefix struct {
+		Inner badInt `db:"inner_,prefix,default=x"`
+	}
+	tests := []struct {
+		sample any
+		err    string
+	}{{
+		sample: badInt{},
+		err:    `cannot use default option on field badInt.Count: cannot parse "many" as int`,
+	}, {
+		sample: overflow{},
+		err:    `cannot use default option on field overflow.Count: cannot parse "256" as uint8`,
+	}, {
+		sample: badTime{},
+		err:    `cannot use default option on field badTime.Created: cannot unmarshal "today" into time.Time: .*`,
+	}, {
+		sample: badType{},
+		err:    `cannot use default option on field badType.Tags: fields of type \[\]string cannot have a default`,
+	}, {
+		sample: empty{},
+		err:    `cannot parse tag for field empty.Status: empty default in tag "status,default="`,
+	}, {
+		sample: withOmitEmpty{},
+		err:    `cannot parse tag for field withOmitEmpty.Status: default option cannot be used with omitempty or nullzero options`,
+	}, {
+		sample: withNullZero{},
+		err:    `cannot parse tag for field withNullZero.Status: default option cannot be used with omitempty or nullzero options`,
+	}, {
+		sample: withPrefix{},
+		err:    `cannot parse tag for field withPrefix.Inner: prefix option cannot be used with other options`,
+	}}
+	for _, t := range tests {
+		_, err := GenerateArgInfo([]any{t.sample})
+		c.Check(err, ErrorMatches, t.err)
+	}
+}
+
+// failingValuer is a driver.Valuer whose error contains its value.
+type failingValuer string
+
+func (v failingValuer) Value() (driver.Value, error) {
+	return nil, fmt.Errorf("bad value %q", string(v))
+}
+
+func (s *typeInfoSuite) TestArgInfoRedact(c *C) {
+	type myStruct struct {
+		Token  failingValuer `db:"token,redact"`
+		Public failingValuer `db:"public"`
+		Secret string        `db:"secret,redact"`
+	}
+	argInfo, err := GenerateArgInfo([]any{myStruct{}})
+	c.Assert(err, IsNil)
+	typeToValue := TypeToValue{reflect.TypeOf(myStruct{}): reflect.ValueOf(myStruct{Token: "hunter2", Public: "visible", Secret: "hunter2"})}
+
+	// The params of the field are marked to be redacted.
+	input, err := argInfo.InputMember("myStruct", "secret")
+	c.Assert(err, IsNil)
+	c.Check(IsRedacted(input), Equals, true)
+	params, err := input.LocateParams(typeToValue)
+	c.Assert(err, IsNil)
+	c.Check(params.Vals, DeepEquals, []any{"hunter2"})
+	c.Check(params.Redact, Equals, true)
+
+	// Errors do not include the value.
+	input, err = argInfo.InputMember("myStruct", "token")
+	c.Assert(err, IsNil)
+	_, err = input.LocateParams(typeToValue)
+	c.Assert(err, ErrorMatches, `cannot get value of tag "token" of struct "myStruct": \[REDACTED\]`)
+	c.Check(strings.Contains(err.Error(), "hunter2"), Equals, false)
+	input, err = argInfo.InputMember("myStruct", "public")
+	c.Assert(err, IsNil)
+	c.Check(IsRedacted(input), Equals, false)
+	_, err = input.LocateParams(typeToValue)
+	c.Assert(err, ErrorMatches, `cannot get value of tag "public" of struct "myStruct": bad value "visible"`)
+
+	output, err := argInfo.OutputMember("myStruct", "secret")
+	c.Assert(err, IsNil)
+	c.Check(IsRedacted(output), Equals, true)
+
+	// The option cannot be used with prefix.
+	type withPrefix struct {
+		Inner myStruct `db:"inner_,prefix,redact"`
+	}
+	_, err = GenerateArgInfo([]any{withPrefix{}})
+	c.Assert(err, ErrorMatches, `cannot parse tag for field withPrefix.Inner: prefix option cannot be used with other options`)
+}
+
 func (s *typeInfoSuite) TestArgInfoMap(c *C) {
 	type myMap map[string]any
 
@@ -137,6 +459,320 @@ func (s *typeInfoSuite) TestArgInfoMap(c *C) {
 	c.Check(kind, DeepEquals, reflect.Map)
 }
 
+func (s *typeInfoSuite) TestArgInfoNamedArg(c *C) {
+	filter := struct {
+		ID int `db:"id"`
+	}{}
+	argInfo, err := GenerateArgInfo([]any{NamedArg{Name: "Filter", Value: filter}, NamedArg{Name: "Extra", Value: map[string]any{}}})
+	c.Assert(err, IsNil)
+
+	input, err := argInfo.InputMember("Filter", "id")
+	c.Assert(err, IsNil)
+	c.Check(input, DeepEquals, &structField{
+		name:       "ID",
+		structType: argType(reflect.TypeOf(filter), "Filter"),
+		index:      []int{0},
+		tag:        "id",
+	})
+
+	kind, err := argInfo.Kind("Extra")
+	c.Assert(err, IsNil)
+	c.Check(kind, Equals, reflect.Map)
+
+	_, err = argInfo.Kind("struct")
+	c.Assert(err, ErrorMatches, `parameter with type "struct" missing \(have "Extra", "Filter"\)`)
+}
+
+func (s *typeInfoSuite) TestArgInfoNamedMaps(c *C) {
+	type myMap map[string]any
+	argInfo, err := GenerateArgInfo([]any{NamedArg{Name: "Filter", Value: myMap{}}, NamedArg{Name: "Update", Value: myMap{}}, myMap{}})
+	c.Assert(err, IsNil)
+
+	// Each name refers to a different argument of the same map type.
+	filter, err := argInfo.InputMember("Filter", "id")
+	c.Assert(err, IsNil)
+	update, err := argInfo.InputMember("Update", "id")
+	c.Assert(err, IsNil)
+	plain, err := argInfo.InputMember("myMap", "id")
+	c.Assert(err, IsNil)
+	c.Check(filter.ArgType(), Not(Equals), update.ArgType())
+	c.Check(filter.ArgType(), Not(Equals), plain.ArgType())
+	c.Check(BaseType(filter.ArgType()), Equals, reflect.TypeOf(myMap{}))
+	c.Check(BaseType(plain.ArgType()), Equals, reflect.TypeOf(myMap{}))
+
+	typeToValue, err := ValidateInputs([]any{NamedArg{Name: "Filter", Value: myMap{"id": 1}}, NamedArg{Name: "Update", Value: myMap{"id": 2}}}, nil)
+	c.Assert(err, IsNil)
+	params, err := update.LocateParams(typeToValue)
+	c.Assert(err, IsNil)
+	c.Check(params.Vals, DeepEquals, []any{2})
+	_, err = plain.LocateParams(typeToValue)
+	c.Assert(err, ErrorMatches, `parameter with type "myMap" missing \(have "Filter", "Update"\)`)
+}
+
+func (s *typeInfoSuite) TestArgInfoNamedStructs(c *C) {
+	type myStruct struct {
+		ID int `db:"id"`
+	}
+	argInfo, err := GenerateArgInfo([]any{NamedArg{Name: "Emp", Value: myStruct{}}, NamedArg{Name: "Boss", Value: myStruct{}}})
+	c.Assert(err, IsNil)
+	emp, err := argInfo.OutputMember("Emp", "id")
+	c.Assert(err, IsNil)
+	boss, err := argInfo.OutputMember("Boss", "id")
+	c.Assert(err, IsNil)
+	c.Check(emp.ArgType(), Not(Equals), boss.ArgType())
+	c.Check(emp.Identifier(), Equals, "Emp.id")
+
+	// Unnamed values are assigned to the names in the order they are used.
+	first, second := &myStruct{}, &myStruct{}
+	typeToValue, err := ValidateOutputs([]any{first, second}, []reflect.Type{boss.ArgType(), emp.ArgType(), boss.ArgType()})
+	c.Assert(err, IsNil)
+	c.Check(typeToValue[boss.ArgType()].Addr().Interface(), Equals, first)
+	c.Check(typeToValue[emp.ArgType()].Addr().Interface(), Equals, second)
+
+	// Named values take their names first.
+	typeToValue, err = ValidateOutputs([]any{first, NamedArg{Name: "Boss", Value: second}}, []reflect.Type{boss.ArgType(), emp.ArgType()})
+	c.Assert(err, IsNil)
+	c.Check(typeToValue[boss.ArgType()].Addr().Interface(), Equals, second)
+	c.Check(typeToValue[emp.ArgType()].Addr().Interface(), Equals, first)
+
+	_, err = ValidateOutputs([]any{first, second, &myStruct{}}, []reflect.Type{boss.ArgType(), emp.ArgType()})
+	c.Assert(err, ErrorMatches, `type "myStruct" provided more than once`)
+}
+
+func (s *typeInfoSuite) TestArgInfoUseFieldNames(c *C) {
+	type myStruct struct {
+		ID       int `db:"id"`
+		FullName string
+		UserID   int
+		internal int
+	}
+	argInfo, err := GenerateArgInfo([]any{myStruct{}})
+	c.Assert(err, IsNil)
+	_, err = argInfo.InputMember("myStruct", "full_name")
+	c.Assert(err, ErrorMatches, `type "myStruct" has no "full_name" db tag`)
+
+	c.Assert(argInfo.UseFieldNames(), IsNil)
+	input, err := argInfo.InputMember("myStruct", "full_name")
+	c.Assert(err, IsNil)
+	c.Check(input, DeepEquals, &structField{
+		name:       "FullName",
+		structType: reflect.TypeOf(myStruct{}),
+		index:      []int{1},
+		tag:        "full_name",
+		fromName:   true,
+	})
+	_, err = argInfo.InputMember("myStruct", "user_id")
+	c.Assert(err, IsNil)
+	_, err = argInfo.InputMember("myStruct", "internal")
+	c.Assert(err, ErrorMatches, `type "myStruct" has no "internal" db tag`)
+
+	// A generated name cannot be the same as a db tag.
+	type collision struct {
+		Name     string
+		Nickname string `db:"name"`
+	}
+	argInfo, err = GenerateArgInfo([]any{collision{}})
+	c.Assert(err, IsNil)
+	err = argInfo.UseFieldNames()
+	c.Assert(err, ErrorMatches, `name "name" of field "Name" collides with db tag of field "Nickname" of struct "collision"`)
+}
+
+func (s *typeInfoSuite) TestSnakeCase(c *C) {
+	for name, expected := range map[string]string{
+		"ID":         "id",
+		"FullName":   "full_name",
+		"UserID":     "user_id",
+		"HTTPServer": "http_server",
+		"Field_Name": "field_name",
+		"Address2":   "address2",
+	} {
+		c.Check(snakeCase(name), Equals, expected)
+	}
+}
+
+func (s *typeInfoSuite) TestRegisterTypes(c *C) {
+	defer ResetRegisteredTypes()
+	type registered struct {
+		ID int `db:"id"`
+	}
+	type other struct {
+		Name string `db:"name"`
+	}
+	c.Assert(RegisterTypes([]any{registered{}}), IsNil)
+	// Registering a type again has no effect.
+	c.Assert(RegisterTypes([]any{registered{}}), IsNil)
+
+	argInfo, err := GenerateArgInfo([]any{other{}})
+	c.Assert(err, IsNil)
+	_, err = argInfo.InputMember("registered", "id")
+	c.Assert(err, IsNil)
+	_, err = argInfo.InputMember("other", "name")
+	c.Assert(err, IsNil)
+
+	argInfo, err = GenerateArgInfoFromTypes(nil)
+	c.Assert(err, IsNil)
+	_, err = argInfo.InputMember("registered", "id")
+	c.Assert(err, IsNil)
+
+	// A type passed explicitly takes precedence over a registered type with
+	// the same name.
+	argInfo, err = GenerateArgInfo([]any{NamedArg{Name: "registered", Value: other{}}})
+	c.Assert(err, IsNil)
+	_, err = argInfo.InputMember("registered", "name")
+	c.Assert(err, IsNil)
+
+	err = RegisterTypes([]any{NamedArg{Name: "registered", Value: other{}}})
+	c.Assert(err, ErrorMatches, `cannot register type "typeinfo.other" with name "registered", type "typeinfo.registered" is registered with the same name`)
+
+	ResetRegisteredTypes()
+	argInfo, err = GenerateArgInfo(nil)
+	c.Assert(err, IsNil)
+	_, err = argInfo.InputMember("registered", "id")
+	c.Assert(err, ErrorMatches, `parameter with type "registered" missing`)
+}
+
+func (s *typeInfoSuite) TestArgInfoMapColumns(c *C) {
+	type myStruct struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+	type myMap map[string]any
+	argInfo, err := GenerateArgInfo([]any{myStruct{}, myMap{}})
+	c.Assert(err, IsNil)
+	other, err := GenerateArgInfo([]any{myStruct{}})
+	c.Assert(err, IsNil)
+
+	err = argInfo.MapColumns("myStruct", func(typeName string, memberTag string) string {
+		return typeName + "_" + memberTag
+	})
+	c.Assert(err, IsNil)
+	_, columns, err := argInfo.AllStructOutputs("myStruct")
+	c.Assert(err, IsNil)
+	c.Check(columns, DeepEquals, []string{"myStruct_id", "myStruct_name"})
+
+	// The inputs and other ArgInfos are unaffected.
+	_, tags, err := argInfo.AllStructInputs("myStruct")
+	c.Assert(err, IsNil)
+	c.Check(tags, DeepEquals, []string{"id", "name"})
+	_, columns, err = other.AllStructOutputs("myStruct")
+	c.Assert(err, IsNil)
+	c.Check(columns, DeepEquals, []string{"id", "name"})
+
+	err = argInfo.MapColumns("myStruct", func(string, string) string { return "" })
+	c.Assert(err, IsNil)
+	_, _, err = argInfo.AllStructOutputs("myStruct")
+	c.Assert(err, ErrorMatches, `column mapper of "myStruct" returned no column for "id"`)
+
+	// Two members cannot be read from the same column.
+	err = argInfo.MapColumns("myStruct", func(string, string) string { return "col" })
+	c.Assert(err, IsNil)
+	_, _, err = argInfo.AllStructOutputs("myStruct")
+	c.Assert(err, ErrorMatches, `column mapper of "myStruct" returned column "col" for both "id" and "name"`)
+
+	err = argInfo.MapColumns("myMap", nil)
+	c.Assert(err, ErrorMatches, `cannot map columns of map "myMap", a struct is required`)
+	err = argInfo.MapColumns("other", nil)
+	c.Assert(err, ErrorMatches, `parameter with type "other" missing \(have "myMap", "myStruct"\)`)
+}
+
+func (s *typeInfoSuite) TestArgInfoDeclarationOrder(c *C) {
+	type embedded struct {
+		Kind string `db:"kind"`
+	}
+	type myStruct struct {
+		Tenant string `db:"tenant"`
+		embedded
+		ID   int    `db:"id"`
+		Name string `db:"name,readonly"`
+	}
+	argInfo, err := GenerateArgInfo([]any{myStruct{}})
+	c.Assert(err, IsNil)
+	other, err := GenerateArgInfo([]any{myStruct{}})
+	c.Assert(err, IsNil)
+
+	argInfo.UseDeclarationOrder()
+	_, tags, err := argInfo.AllStructInputs("myStruct")
+	c.Assert(err, IsNil)
+	c.Check(tags, DeepEquals, []string{"tenant", "kind", "id"})
+	_, columns, err := argInfo.AllStructOutputs("myStruct")
+	c.Assert(err, IsNil)
+	c.Check(columns, DeepEquals, []string{"tenant", "kind", "id", "name"})
+
+	// Other ArgInfos are still sorted by tag.
+	_, columns, err = other.AllStructOutputs("myStruct")
+	c.Assert(err, IsNil)
+	c.Check(columns, DeepEquals, []string{"id", "kind", "name", "tenant"})
+}
+
+func (s *typeInfoSuite) TestArgInfoRegisterScanner(c *C) {
+	type myStruct struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+	type myMap map[string]any
+	argInfo, err := GenerateArgInfo([]any{myStruct{}, myMap{}})
+	c.Assert(err, IsNil)
+	other, err := GenerateArgInfo([]any{myStruct{}})
+	c.Assert(err, IsNil)
+
+	upper := func(dest any, v any) error {
+		dest.(*myStruct).Name = strings.ToUpper(v.(string))
+		return nil
+	}
+	c.Assert(argInfo.RegisterScanner("myStruct", "name", upper), IsNil)
+	c.Assert(argInfo.RegisterScanner("myStruct", "shout", upper), IsNil)
+
+	ms := myStruct{}
+	typeToValue := map[reflect.Type]reflect.Value{reflect.TypeOf(ms): reflect.ValueOf(&ms).Elem()}
+
+	// A tagged member uses the scanner when it is named and with an asterisk.
+	output, err := argInfo.OutputMember("myStruct", "name")
+	c.Assert(err, IsNil)
+	ptr, _, err := output.LocateScanTarget(typeToValue, false)
+	c.Assert(err, IsNil)
+	c.Assert(ptr.(sql.Scanner).Scan("fred"), IsNil)
+	c.Check(ms.Name, Equals, "FRED")
+
+	outputs, columns, err := argInfo.AllStructOutputs("myStruct")
+	c.Assert(err, IsNil)
+	c.Check(columns, DeepEquals, []string{"id", "name"})
+	ptr, _, err = outputs[1].LocateScanTarget(typeToValue, false)
+	c.Assert(err, IsNil)
+	c.Assert(ptr.(sql.Scanner).Scan("mark"), IsNil)
+	c.Check(ms.Name, Equals, "MARK")
+
+	// A member that is not a tag can be named as an output.
+	output, err = argInfo.OutputMember("myStruct", "shout")
+	c.Assert(err, IsNil)
+	c.Check(output.Desc(), Equals, `member "shout" of struct "myStruct"`)
+	ptr, _, err = output.LocateScanTarget(typeToValue, false)
+	c.Assert(err, IsNil)
+	c.Assert(ptr.(sql.Scanner).Scan("mary"), IsNil)
+	c.Check(ms.Name, Equals, "MARY")
+
+	// Errors from the scanner are returned.
+	c.Assert(argInfo.RegisterScanner("myStruct", "id", func(any, any) error { return fmt.Errorf("bad id") }), IsNil)
+	output, err = argInfo.OutputMember("myStruct", "id")
+	c.Assert(err, IsNil)
+	ptr, _, err = output.LocateScanTarget(typeToValue, false)
+	c.Assert(err, IsNil)
+	c.Assert(ptr.(sql.Scanner).Scan(int64(1)), ErrorMatches, `bad id`)
+
+	// The inputs and other ArgInfos are unaffected.
+	_, err = argInfo.InputMember("myStruct", "shout")
+	c.Assert(err, ErrorMatches, `type "myStruct" has no "shout" db tag`)
+	output, err = other.OutputMember("myStruct", "name")
+	c.Assert(err, IsNil)
+	c.Check(output.Desc(), Equals, `tag "name" of struct "myStruct"`)
+
+	err = argInfo.RegisterScanner("myMap", "foo", upper)
+	c.Assert(err, ErrorMatches, `cannot register scanner for map "myMap", a struct is required`)
+	err = argInfo.RegisterScanner("myStruct", "foo", nil)
+	c.Assert(err, ErrorMatches, `cannot register nil scanner for member "foo" of "myStruct"`)
+	err = argInfo.RegisterScanner("other", "foo", upper)
+	c.Assert(err, ErrorMatches, `parameter with type "other" missing \(have "myMap", "myStruct"\)`)
+}
+
 func (s *typeInfoSuite) TestArgInfoEmbeddedStruct(c *C) {
 	type EmbeddedString string
 	type TaggedStruct struct {
@@ -174,19 +810,19 @@ func (s *typeInfoSuite) TestArgInfoEmbeddedStruct(c *C) {
 		tag:        "col0",
 		omitEmpty:  false,
 	}, {
-		name:       "F1",
+		name:       "Embedded1.F1",
 		structType: structType,
 		index:      []int{2, 0},
 		tag:        "col1",
 		omitEmpty:  false,
 	}, {
-		name:       "F2",
+		name:       "Embedded2.F2",
 		structType: structType,
 		index:      []int{3, 0},
 		tag:        "col2",
 		omitEmpty:  false,
 	}, {
-		name:       "F3",
+		name:       "Embedded2.Embedded3.F3",
 		structType: structType,
 		index:      []int{3, 1, 0},
 		tag:        "col3",
@@ -209,6 +845,118 @@ func (s *typeInfoSuite) TestArgInfoEmbeddedStruct(c *C) {
 	c.Check(fields, DeepEquals, expectedStructFields)
 }
 
+func (s *typeInfoSuite) TestArgInfoRecursiveEmbeddedStruct(c *C) {
+	// The fields of an embedded struct of the same type as an outer struct
+	// are shadowed by those of the outer struct.
+	type Node struct {
+		*Node
+		ID int `db:"id"`
+	}
+	argInfo, err := GenerateArgInfo([]any{Node{}})
+	c.Assert(err, IsNil)
+	_, tags, err := argInfo.AllStructOutputs("Node")
+	c.Assert(err, IsNil)
+	c.Check(tags, DeepEquals, []string{"id"})
+	output, err := argInfo.OutputMember("Node", "id")
+	c.Assert(err, IsNil)
+	c.Check(output.(*structField).index, DeepEquals, []int{1})
+}
+
+func (s *typeInfoSuite) TestArgInfoPrefixedStruct(c *C) {
+	type Address struct {
+		ID     int    `db:"id"`
+		Street string `db:"street,omitempty"`
+	}
+	type Row struct {
+		ID   int      `db:"id"`
+		Addr Address  `db:"addr_,prefix"`
+		Prev *Address `db:"prev_,prefix"`
+	}
+	structType := reflect.TypeOf(Row{})
+
+	argInfo, err := GenerateArgInfo([]any{Row{}})
+	c.Assert(err, IsNil)
+
+	expectedStructFields := []*structField{{
+		name:       "Addr.ID",
+		structType: structType,
+		index:      []int{1, 0},
+		tag:        "addr_id",
+	}, {
+		name:       "Addr.Street",
+		structType: structType,
+		index:      []int{1, 1},
+		tag:        "addr_street",
+		omitEmpty:  true,
+	}, {
+		name:       "ID",
+		structType: structType,
+		index:      []int{0},
+		tag:        "id",
+	}, {
+		name:       "Prev.ID",
+		structType: structType,
+		index:      []int{2, 0},
+		tag:        "prev_id",
+	}, {
+		name:       "Prev.Street",
+		structType: structType,
+		index:      []int{2, 1},
+		tag:        "prev_street",
+		omitEmpty:  true,
+	}}
+
+	outputs, tags, err := argInfo.AllStructOutputs("Row")
+	c.Assert(err, IsNil)
+	c.Check(tags, DeepEquals, []string{"addr_id", "addr_street", "id", "prev_id", "prev_street"})
+	c.Assert(outputs, HasLen, len(expectedStructFields))
+	for i, output := range outputs {
+		c.Check(output, DeepEquals, expectedStructFields[i])
+	}
+	input, err := argInfo.InputMember("Row", "addr_street")
+	c.Assert(err, IsNil)
+	c.Check(input, DeepEquals, expectedStructFields[1])
+
+	// Prefixed tags cannot collide with other tags.
+	type Collision struct {
+		AddrID int     `db:"addr_id"`
+		Addr   Address `db:"addr_,prefix"`
+	}
+	_, err = GenerateArgInfo([]any{Collision{}})
+	c.Assert(err, ErrorMatches, `duplicate db tag "addr_id" on fields "AddrID" and "Addr.ID" of struct "Collision"`)
+	type PrefixCollision struct {
+		A Address `db:"a,prefix"`
+		B Address `db:"a,prefix"`
+	}
+	_, err = GenerateArgInfo([]any{PrefixCollision{}})
+	c.Assert(err, ErrorMatches, `duplicate db tag "aid" on fields "A.ID" and "B.ID" of struct "PrefixCollision"`)
+}
+
+func (s *typeInfoSuite) TestArgInfoQuotedTags(c *C) {
+	type Path struct {
+		Value string `db:"\"json.path\""`
+	}
+	type Legacy struct {
+		Cost  int    `db:"cost$"`
+		Mixed string `db:"\"Mixed Case\""`
+		Path  Path   `db:"p_,prefix"`
+	}
+	argInfo, err := GenerateArgInfo([]any{Legacy{}})
+	c.Assert(err, IsNil)
+
+	_, tags, err := argInfo.AllStructOutputs("Legacy")
+	c.Assert(err, IsNil)
+	c.Check(tags, DeepEquals, []string{`"Mixed Case"`, `"p_json.path"`, "cost$"})
+
+	// Quoted tags are members of the struct as they are written, with their
+	// quotes.
+	input, err := argInfo.InputMember("Legacy", `"p_json.path"`)
+	c.Assert(err, IsNil)
+	c.Check(input.(*structField).name, Equals, "Path.Value")
+	_, err = argInfo.InputMember("Legacy", "Mixed Case")
+	c.Assert(err, ErrorMatches, `type "Legacy" has no "Mixed Case" db tag`)
+}
+
 // This struct is used to test shadowed types in TestGenerateArgInfoInvalidTypeErrors
 type T struct{ foo int }
 
@@ -217,6 +965,7 @@ var t = T{}
 func (s *typeInfoSuite) TestGenerateArgInfoInvalidTypeErrors(c *C) {
 	type T struct{ foo int }
 	type M map[string]any
+	type Blob []byte
 
 	tests := []struct {
 		args []any
@@ -228,22 +977,22 @@ func (s *typeInfoSuite) TestGenerateArgInfoInvalidTypeErrors(c *C) {
 	}, {
 
 		args: []any{struct{ foo int }{}},
-		err:  "cannot use anonymous struct",
+		err:  "cannot use anonymous struct, name it with sqlair.Named",
 	}, {
 
 		args: []any{map[string]any{}},
-		err:  "cannot use anonymous map",
+		err:  "cannot use anonymous map, name it with sqlair.Named",
 	}, {
 		args: []any{T{}, T{}},
 		err:  `found multiple instances of type "T"`,
 	}, {
 
 		args: []any{(*T)(nil)},
-		err:  "need non-pointer type, got pointer to struct",
+		err:  "need supported value, got nil pointer to struct",
 	}, {
 
 		args: []any{(*M)(nil)},
-		err:  "need non-pointer type, got pointer to map",
+		err:  "need supported value, got nil pointer to map",
 	}, {
 
 		args: []any{""},
@@ -255,9 +1004,24 @@ func (s *typeInfoSuite) TestGenerateArgInfoInvalidTypeErrors(c *C) {
 	}, {
 		args: []any{[10]int{}},
 		err:  "need supported type, got array",
+	}, {
+		args: []any{[]byte{}},
+		err:  `cannot use byte slice "\[\]uint8" as an argument, byte slices can only be used as struct fields or map values`,
+	}, {
+		args: []any{Blob{}},
+		err:  `cannot use byte slice "Blob" as an argument, byte slices can only be used as struct fields or map values`,
 	}, {
 		args: []any{t, T{}},
-		err:  `two types found with name "T": "typeinfo.T" and "typeinfo.T"`,
+		err:  `two types found with name "T": "typeinfo.T" and "typeinfo.T", name one of them with sqlair.Named`,
+	}, {
+		args: []any{NamedArg{Name: "1Filter", Value: struct{}{}}},
+		err:  `invalid argument name "1Filter"`,
+	}, {
+		args: []any{NamedArg{Name: "T", Value: map[string]any{}}, T{}},
+		err:  `two types found with name "T": "map\[string\]interface {}" and "typeinfo.T", name one of them with sqlair.Named`,
+	}, {
+		args: []any{genericBox[int]{}},
+		err:  `cannot use generic type "genericBox\[int\]" without a name, name it with sqlair.Named`,
 	}}
 
 	for _, t := range tests {
@@ -266,6 +1030,64 @@ func (s *typeInfoSuite) TestGenerateArgInfoInvalidTypeErrors(c *C) {
 	}
 }
 
+type genericBox[T any] struct {
+	Value T `db:"value"`
+}
+
+func (s *typeInfoSuite) TestGenerateArgInfoGenericType(c *C) {
+	argInfo, err := GenerateArgInfo([]any{NamedArg{Name: "IntBox", Value: genericBox[int]{}}})
+	c.Assert(err, IsNil)
+	output, err := argInfo.OutputMember("IntBox", "value")
+	c.Assert(err, IsNil)
+	c.Check(output.ArgType().Name(), Equals, "IntBox")
+	c.Check(BaseType(output.ArgType()), Equals, reflect.TypeOf(genericBox[int]{}))
+}
+
+func (s *typeInfoSuite) TestGenerateArgInfoDuplicateTags(c *C) {
+	type Direct struct {
+		ID    int `db:"id"`
+		Name  string
+		OldID int `db:"id"`
+	}
+	_, err := GenerateArgInfo([]any{Direct{}})
+	c.Assert(err, ErrorMatches, `duplicate db tag "id" on fields "ID" and "OldID" of struct "Direct"`)
+
+	type Base struct {
+		ID int `db:"id"`
+	}
+	type Outer struct {
+		Base
+		Key int `db:"id"`
+	}
+	_, err = GenerateArgInfo([]any{Outer{}})
+	c.Assert(err, ErrorMatches, `duplicate db tag "id" on fields "Base.ID" and "Key" of struct "Outer"`)
+
+	// Fields with the same name in the outer struct are still duplicates.
+	type Shadowed struct {
+		ID int `db:"id"`
+		*Base
+	}
+	_, err = GenerateArgInfo([]any{Shadowed{}})
+	c.Assert(err, ErrorMatches, `duplicate db tag "id" on fields "ID" and "Base.ID" of struct "Shadowed"`)
+
+	type Middle struct {
+		Base
+	}
+	type Deep struct {
+		Middle
+		Other Base `db:"other,prefix"`
+		Code  int  `db:"otherid"`
+	}
+	_, err = GenerateArgInfo([]any{Deep{}})
+	c.Assert(err, ErrorMatches, `duplicate db tag "otherid" on fields "Other.ID" and "Code" of struct "Deep"`)
+	type DeepEmbedded struct {
+		Middle
+		ID int `db:"id"`
+	}
+	_, err = GenerateArgInfo([]any{DeepEmbedded{}})
+	c.Assert(err, ErrorMatches, `duplicate db tag "id" on fields "Middle.Base.ID" and "ID" of struct "DeepEmbedded"`)
+}
+
 func (s *typeInfoSuite) TestGenerateArgInfoStructError(c *C) {
 	type S1 struct {
 		unexp int `db:"unexp"`
@@ -273,6 +1095,22 @@ func (s *typeInfoSuite) TestGenerateArgInfoStructError(c *C) {
 	_, err := GenerateArgInfo([]any{S1{}})
 	c.Assert(err, ErrorMatches, `field "unexp" of struct S1 not exported`)
 
+	// Tagged unexported fields of embedded structs are not ignored.
+	type EmbedsS1 struct {
+		S1
+	}
+	_, err = GenerateArgInfo([]any{EmbedsS1{}})
+	c.Assert(err, ErrorMatches, `field "unexp" of struct S1 not exported`)
+
+	type inner struct {
+		ID int `db:"id"`
+	}
+	type EmbedsPointer struct {
+		*inner
+	}
+	_, err = GenerateArgInfo([]any{EmbedsPointer{}})
+	c.Assert(err, ErrorMatches, `field "inner.ID" of struct EmbedsPointer has db tag but embedded pointer "inner" is not exported`)
+
 	type S2 struct {
 		Foo int `db:"id,bad-juju"`
 	}
@@ -298,10 +1136,10 @@ func (s *typeInfoSuite) TestGenerateArgInfoStructError(c *C) {
 	c.Assert(err.Error(), Equals, `cannot parse tag for field S5.Foo: invalid column name in 'db' tag: "+id"`)
 
 	type S6 struct {
-		Foo int `db:"id$$"`
+		Foo int `db:"$id"`
 	}
 	_, err = GenerateArgInfo([]any{S6{}})
-	c.Assert(err.Error(), Equals, `cannot parse tag for field S6.Foo: invalid column name in 'db' tag: "id$$"`)
+	c.Assert(err.Error(), Equals, `cannot parse tag for field S6.Foo: invalid column name in 'db' tag: "$id"`)
 
 	type S7 struct {
 		Foo int `db:"\"!)*)£*("`
@@ -315,12 +1153,68 @@ func (s *typeInfoSuite) TestGenerateArgInfoStructError(c *C) {
 	_, err = GenerateArgInfo([]any{S8{}})
 	c.Assert(err.Error(), Equals, `cannot parse tag for field S8.Foo: missing quotes at end of 'db' tag: "'!)*)£*("`)
 
+	type S9 struct {
+		Foo int `db:"foo_,prefix"`
+	}
+	_, err = GenerateArgInfo([]any{S9{}})
+	c.Assert(err.Error(), Equals, `cannot use prefix option on field S9.Foo of type int, a struct is required`)
+
+	type S10 struct {
+		Foo S1 `db:"5,prefix"`
+	}
+	_, err = GenerateArgInfo([]any{S10{}})
+	c.Assert(err.Error(), Equals, `cannot parse tag for field S10.Foo: prefix "5" must start with a letter or underscore`)
+
+	type S11 struct {
+		Foo S2 `db:"foo_,prefix,omitempty"`
+	}
+	_, err = GenerateArgInfo([]any{S11{}})
+	c.Assert(err.Error(), Equals, `cannot parse tag for field S11.Foo: prefix option cannot be used with other options`)
+
+	type S12 struct {
+		Foo S7 `db:"foo_,prefix"`
+	}
+	_, err = GenerateArgInfo([]any{S12{}})
+	c.Assert(err.Error(), Equals, `cannot parse tag for field S7.Foo: missing quotes at end of 'db' tag: "\"!)*)£*("`)
+
+	type S14 struct {
+		Foo **int `db:"foo"`
+	}
+	_, err = GenerateArgInfo([]any{S14{}})
+	c.Assert(err.Error(), Equals, `field "Foo" of struct S14 has unsupported double pointer type **int`)
+
+	type S15 struct {
+		Foo int `db:"foo,layout=2006-01-02"`
+	}
+	_, err = GenerateArgInfo([]any{S15{}})
+	c.Assert(err.Error(), Equals, `cannot use layout option on field S15.Foo of type int, a time.Time is required`)
+
+	type S16 struct {
+		Foo time.Time `db:"foo,json,layout=2006-01-02"`
+	}
+	_, err = GenerateArgInfo([]any{S16{}})
+	c.Assert(err.Error(), Equals, `cannot parse tag for field S16.Foo: layout option cannot be used with json option`)
+
+	type S17 struct {
+		Foo time.Time `db:"foo,layout="`
+	}
+	_, err = GenerateArgInfo([]any{S17{}})
+	c.Assert(err.Error(), Equals, `cannot parse tag for field S17.Foo: empty layout in tag "foo,layout="`)
+
 	type badMap map[int]any
 	_, err = GenerateArgInfo([]any{badMap{}})
 	c.Assert(err, ErrorMatches, "map type badMap must have key type string, found type int")
 
+	type chanMap map[string]chan int
+	_, err = GenerateArgInfo([]any{chanMap{}})
+	c.Assert(err, ErrorMatches, "map type chanMap has unsupported value type chan int")
+
+	type doublePointerMap map[string]**int
+	_, err = GenerateArgInfo([]any{doublePointerMap{}})
+	c.Assert(err, ErrorMatches, `map type doublePointerMap has unsupported double pointer value type \*\*int`)
+
 	_, err = GenerateArgInfo([]any{[]int{}})
-	c.Assert(err, ErrorMatches, "cannot use anonymous slice")
+	c.Assert(err, ErrorMatches, "cannot use anonymous slice, name it with sqlair.Named")
 }
 
 func (*typeInfoSuite) TestInputAndOutputMemberError(c *C) {
@@ -420,3 +1314,26 @@ func (*typeInfoSuite) TestSliceInputError(c *C) {
 		c.Check(err.Error(), Equals, test.err)
 	}
 }
+
+func (s *typeInfoSuite) TestGenerateArgInfoFromTypes(c *C) {
+	type myStruct struct {
+		ID int `db:"id"`
+	}
+	type myMap map[string]any
+
+	argInfo, err := GenerateArgInfoFromTypes([]reflect.Type{reflect.TypeOf(myStruct{}), reflect.TypeOf(myMap{})})
+	c.Assert(err, IsNil)
+
+	kind, err := argInfo.Kind("myStruct")
+	c.Assert(err, IsNil)
+	c.Check(kind, Equals, reflect.Struct)
+	kind, err = argInfo.Kind("myMap")
+	c.Assert(err, IsNil)
+	c.Check(kind, Equals, reflect.Map)
+
+	_, err = GenerateArgInfoFromTypes([]reflect.Type{nil})
+	c.Assert(err, ErrorMatches, "need supported type, got nil")
+
+	_, err = GenerateArgInfoFromTypes([]reflect.Type{reflect.TypeOf(&myStruct{})})
+	c.Assert(err, ErrorMatches, "need non-pointer type, got pointer to struct")
+}
@@ -3,7 +3,16 @@
 
 package typeinfo
 
-import "reflect"
+import (
+	"bytes"
+	"database/sql"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
 
 // ScanProxy is a shim for scanning query results
 // into struct fields or map keys.
@@ -18,6 +27,10 @@ type ScanProxy struct {
 	// key when valid indicates that this proxy is
 	// for a key in the map indicated by original.
 	key reflect.Value
+
+	// merge is true if scan is a pointer that is left nil by a NULL
+	// column, in which case original is left unchanged.
+	merge bool
 }
 
 // OnSuccess is run after using rows.Scan to read a single query column
@@ -25,15 +38,391 @@ type ScanProxy struct {
 // When the ScanProxy is for a map key, we set the map's value for the key.
 // When the proxy is for a struct field, we set that field.
 func (sp ScanProxy) OnSuccess() {
+	targetType := sp.original.Type()
 	if sp.key.IsValid() {
-		sp.original.SetMapIndex(sp.key, sp.scan)
+		targetType = targetType.Elem()
+	}
+	if sp.merge {
+		if sp.scan.IsNil() {
+			return
+		}
+		sp.set(sp.scan.Elem())
+		return
+	}
+	if sp.key.IsValid() && sp.scan.Type() == targetType {
+		sp.set(sp.scan)
+	} else if !sp.scan.IsNil() {
+		sp.set(sp.scan.Elem())
+	} else {
+		sp.set(reflect.Zero(targetType))
+	}
+}
+
+// set stores val in the map key or struct field of the proxy. A value scanned
+// into the basic type underlying a named type is converted to the named type.
+func (sp ScanProxy) set(val reflect.Value) {
+	if sp.key.IsValid() {
+		sp.original.SetMapIndex(sp.key, convertScanned(val, sp.original.Type().Elem()))
+	} else {
+		sp.original.Set(convertScanned(val, sp.original.Type()))
+	}
+}
+
+// convertScanned converts val to the type t, which is either the type of val,
+// a type val is convertible to, or a pointer to such a type.
+func convertScanned(val reflect.Value, t reflect.Type) reflect.Value {
+	if val.Type() == t {
+		return val
+	}
+	if t.Kind() != reflect.Pointer {
+		return val.Convert(t)
+	}
+	if val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return reflect.Zero(t)
+		}
+		val = val.Elem()
+	}
+	ptr := reflect.New(t.Elem())
+	ptr.Elem().Set(val.Convert(t.Elem()))
+	return ptr
+}
+
+// basicTypes holds the predeclared Go type of each basic kind.
+var basicTypes = map[reflect.Kind]reflect.Type{
+	reflect.Bool:    reflect.TypeOf(false),
+	reflect.Int:     reflect.TypeOf(int(0)),
+	reflect.Int8:    reflect.TypeOf(int8(0)),
+	reflect.Int16:   reflect.TypeOf(int16(0)),
+	reflect.Int32:   reflect.TypeOf(int32(0)),
+	reflect.Int64:   reflect.TypeOf(int64(0)),
+	reflect.Uint:    reflect.TypeOf(uint(0)),
+	reflect.Uint8:   reflect.TypeOf(uint8(0)),
+	reflect.Uint16:  reflect.TypeOf(uint16(0)),
+	reflect.Uint32:  reflect.TypeOf(uint32(0)),
+	reflect.Uint64:  reflect.TypeOf(uint64(0)),
+	reflect.Float32: reflect.TypeOf(float32(0)),
+	reflect.Float64: reflect.TypeOf(float64(0)),
+	reflect.String:  reflect.TypeOf(""),
+}
+
+// underlyingBasicType returns the predeclared type underlying t, or the type
+// it points to, if it is a named basic type such as `type Port int`. It
+// returns nil for other types and for named types that implement
+// sql.Scanner or encoding.TextUnmarshaler, which are scanned with their own
+// methods.
+func underlyingBasicType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	bt, ok := basicTypes[t.Kind()]
+	if !ok || t == bt || reflect.PointerTo(t).Implements(scannerInterface) || isTextUnmarshaler(t) {
+		return nil
+	}
+	return bt
+}
+
+// jsonScanner is a sql.Scanner that decodes a JSON column into a struct
+// field with the json option. A NULL or empty column sets the field to its
+// zero value unless merge is set, in which case the field is left unchanged.
+type jsonScanner struct {
+	field  *structField
+	target reflect.Value
+	merge  bool
+}
+
+// Scan decodes the JSON in src into the target field.
+func (js *jsonScanner) Scan(src any) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		if !js.merge {
+			js.target.Set(reflect.Zero(js.target.Type()))
+		}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot decode %s from JSON: unsupported column type %T", js.field.Desc(), src)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return js.Scan(nil)
+	}
+	// Decode into a new value so a failed decode leaves the field unchanged.
+	v := reflect.New(js.target.Type())
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return fmt.Errorf("cannot decode %s from JSON: %s", js.field.Desc(), err)
+	}
+	js.target.Set(v.Elem())
+	return nil
+}
+
+var textUnmarshalerInterface = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// isTextUnmarshaler returns true if results are scanned into values of type t,
+// or the type it points to, with its UnmarshalText method. Types that
+// implement sql.Scanner and time.Time are excluded as they are scanned
+// directly.
+func isTextUnmarshaler(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	pt := reflect.PointerTo(t)
+	return pt.Implements(textUnmarshalerInterface) && !pt.Implements(scannerInterface) && t != timeType
+}
+
+// textScanner is a sql.Scanner that scans a text column into a value whose
+// type implements encoding.TextUnmarshaler, or a pointer to one. A column of
+// another type is converted to the type of the value if possible. A NULL
+// column sets the target to its zero value, unless merge is set, in which case
+// the target is left unchanged.
+type textScanner struct {
+	target reflect.Value
+	merge  bool
+}
+
+// Scan unmarshals the text in src into the target.
+func (ts *textScanner) Scan(src any) error {
+	valType := ts.target.Type()
+	if valType.Kind() == reflect.Pointer {
+		valType = valType.Elem()
+	}
+	v := reflect.New(valType)
+	switch src := src.(type) {
+	case nil:
+		if ts.merge {
+			return nil
+		}
+		ts.target.Set(reflect.Zero(ts.target.Type()))
+		return nil
+	case []byte:
+		if err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText(src); err != nil {
+			return fmt.Errorf("cannot unmarshal text into %s: %s", valType, err)
+		}
+	case string:
+		if err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(src)); err != nil {
+			return fmt.Errorf("cannot unmarshal text into %s: %s", valType, err)
+		}
+	default:
+		sv := reflect.ValueOf(src)
+		if !sv.Type().ConvertibleTo(valType) {
+			return fmt.Errorf("cannot scan %T into %s", src, valType)
+		}
+		v.Elem().Set(sv.Convert(valType))
+	}
+	if ts.target.Kind() == reflect.Pointer {
+		ts.target.Set(v)
+	} else {
+		ts.target.Set(v.Elem())
+	}
+	return nil
+}
+
+// isByteArray returns true if t, or the type it points to, is a fixed-size
+// array of bytes, such as [16]byte, that is not scanned with a sql.Scanner or
+// encoding.TextUnmarshaler.
+func isByteArray(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Array && t.Elem().Kind() == reflect.Uint8 &&
+		!reflect.PointerTo(t).Implements(scannerInterface) && !isTextUnmarshaler(t)
+}
+
+// byteArrayScanner is a sql.Scanner that copies a blob or text column into a
+// fixed-size byte array, or a pointer to one. The column must have the same
+// length as the array, except that a 16 byte array can also be scanned from
+// the 36 character text form of a UUID. A NULL column sets the target to its
+// zero value unless merge is set, in which case the target is left unchanged.
+type byteArrayScanner struct {
+	target reflect.Value
+	merge  bool
+}
+
+// Scan copies the bytes in src into the target.
+func (bs *byteArrayScanner) Scan(src any) error {
+	arrayType := bs.target.Type()
+	if arrayType.Kind() == reflect.Pointer {
+		arrayType = arrayType.Elem()
+	}
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		if !bs.merge {
+			bs.target.Set(reflect.Zero(bs.target.Type()))
+		}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+		if arrayType.Len() == 16 && len(v) == 36 {
+			var err error
+			if data, err = parseUUID(v); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot scan %T into %s", src, arrayType)
+	}
+	if len(data) != arrayType.Len() {
+		return fmt.Errorf("cannot scan %d bytes into %s", len(data), arrayType)
+	}
+	array := reflect.New(arrayType)
+	reflect.Copy(array.Elem(), reflect.ValueOf(data))
+	if bs.target.Kind() == reflect.Pointer {
+		bs.target.Set(array)
 	} else {
-		var val reflect.Value
-		if !sp.scan.IsNil() {
-			val = sp.scan.Elem()
-		} else {
-			val = reflect.Zero(sp.original.Type())
+		bs.target.Set(array.Elem())
+	}
+	return nil
+}
+
+// parseUUID returns the bytes of a UUID in its text form, e.g.
+// "f81d4fae-7dec-11d0-a765-00a0c91e6bf6".
+func parseUUID(s string) ([]byte, error) {
+	if s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return nil, fmt.Errorf("cannot parse %q as UUID", s)
+	}
+	b, err := hex.DecodeString(s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:])
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %q as UUID", s)
+	}
+	return b, nil
+}
+
+// memberScanner is a sql.Scanner that passes the column value to the
+// MemberScanner of a struct member.
+type memberScanner struct {
+	member *scannerMember
+	dest   any
+	merge  bool
+}
+
+// Scan calls the MemberScanner with the struct and src.
+func (ms *memberScanner) Scan(src any) error {
+	if src == nil && ms.merge {
+		return nil
+	}
+	return ms.member.scanner(ms.dest, src)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// isTimeType returns true if t is time.Time or *time.Time.
+func isTimeType(t reflect.Type) bool {
+	return t == timeType || (t.Kind() == reflect.Pointer && t.Elem() == timeType)
+}
+
+// timeLayouts are the layouts tried when parsing a time stored as text with
+// no layout set on the field. They are the formats written by SQLite and its
+// Go drivers.
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	time.RFC3339Nano,
+}
+
+// formatTime returns the time.Time or *time.Time in val formatted in layout.
+// A nil pointer is returned as nil.
+func formatTime(val reflect.Value, layout string) any {
+	if val.Kind() == reflect.Pointer {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	return val.Interface().(time.Time).Format(layout)
+}
+
+// nullZeroScanner is a sql.Scanner that scans a column into a struct field
+// with the nullzero option whose type is a sql.Scanner. A NULL column sets the
+// field to its zero value unless merge is set, in which case the field is left
+// unchanged. Other values are scanned by the field.
+type nullZeroScanner struct {
+	target reflect.Value
+	merge  bool
+}
+
+// Scan passes src to the Scan method of the target unless it is NULL.
+func (ns *nullZeroScanner) Scan(src any) error {
+	if src == nil {
+		if !ns.merge {
+			ns.target.Set(reflect.Zero(ns.target.Type()))
+		}
+		return nil
+	}
+	return ns.target.Addr().Interface().(sql.Scanner).Scan(src)
+}
+
+// timeScanner is a sql.Scanner that scans a column into a time.Time or
+// *time.Time struct field. As well as a time.Time, the column can hold text,
+// which is parsed with the layout of the field or one of timeLayouts, or an
+// integer, which is read as Unix seconds. A NULL column sets the field to its
+// zero value unless merge is set, in which case the field is left unchanged.
+type timeScanner struct {
+	field  *structField
+	target reflect.Value
+	merge  bool
+}
+
+// Scan converts src to a time and sets the target field.
+func (ts *timeScanner) Scan(src any) error {
+	var t time.Time
+	switch v := src.(type) {
+	case nil:
+		if !ts.merge {
+			ts.target.Set(reflect.Zero(ts.target.Type()))
+		}
+		return nil
+	case time.Time:
+		t = v
+	case int64:
+		t = time.Unix(v, 0).UTC()
+	case []byte:
+		var err error
+		if t, err = ts.parse(string(v)); err != nil {
+			return err
+		}
+	case string:
+		var err error
+		if t, err = ts.parse(v); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("cannot scan %T into %s of type %s", src, ts.field.Desc(), ts.target.Type())
+	}
+	if ts.target.Kind() == reflect.Pointer {
+		ts.target.Set(reflect.ValueOf(&t))
+	} else {
+		ts.target.Set(reflect.ValueOf(t))
+	}
+	return nil
+}
+
+// parse parses s with the layout of the field, or with the first of
+// timeLayouts that matches if the field has no layout.
+func (ts *timeScanner) parse(s string) (time.Time, error) {
+	if ts.field.layout != "" {
+		t, err := time.Parse(ts.field.layout, s)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("cannot parse %s as time: %s", ts.field.Desc(), err)
+		}
+		return t, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
 		}
-		sp.original.Set(val)
 	}
+	return time.Time{}, fmt.Errorf("cannot parse %s as time: unknown time format %q", ts.field.Desc(), s)
 }
@@ -12,20 +12,28 @@ type TypeToValue = map[reflect.Type]reflect.Value
 
 // ValidateInputs takes the raw SQLair input arguments from the user and uses
 // reflection to check that they are valid. It returns a TypeToValue containing
-// the reflect.Value of the input arguments.
-func ValidateInputs(args []any) (TypeToValue, error) {
+// the reflect.Value of the input arguments. argTypes are the types of the
+// inputs of the query in the order they are used, see unnamedStructs.assign.
+func ValidateInputs(args []any, argTypes []reflect.Type) (TypeToValue, error) {
 	typeToValue := TypeToValue{}
+	unnamed := unnamedStructs{}
 	for _, arg := range args {
+		arg, name := unwrapNamedArg(arg)
 		v := reflect.ValueOf(arg)
 		if err := validateValue(v); err != nil {
 			return nil, err
 		}
-		v = reflect.Indirect(v)
+		if v.Kind() == reflect.Pointer {
+			v = v.Elem()
+			if err := validateValue(v); err != nil {
+				return nil, err
+			}
+		}
 		t := v.Type()
 		switch k := v.Kind(); k {
 		case reflect.Map, reflect.Struct:
-			if t.Name() == "" {
-				return nil, fmt.Errorf("cannot use anonymous %s", k)
+			if t.Name() == "" && name == "" {
+				return nil, fmt.Errorf("cannot use anonymous %s, name it with sqlair.Named", k)
 			}
 			if _, ok := typeToValue[reflect.SliceOf(t)]; ok {
 				return nil, typeAndSliceProvidedError(
@@ -35,15 +43,18 @@ func ValidateInputs(args []any) (TypeToValue, error) {
 					reflect.SliceOf(reflect.PointerTo(t)), t)
 			}
 		case reflect.Slice:
+			if isByteSlice(t) {
+				return nil, byteSliceArgError(t)
+			}
 			// If the slice has no name and its element type is map, struct or
 			// pointer then we assume it is for a bulk insert.
 			switch t.Elem().Kind() {
 			case reflect.Map, reflect.Struct:
-				if _, ok := typeToValue[t.Elem()]; t.Name() == "" && ok {
+				if _, ok := typeToValue[t.Elem()]; t.Name() == "" && (ok || unnamed.has(t.Elem())) {
 					return nil, typeAndSliceProvidedError(t, t.Elem())
 				}
 			case reflect.Pointer:
-				if _, ok := typeToValue[t.Elem().Elem()]; t.Name() == "" && ok {
+				if _, ok := typeToValue[t.Elem().Elem()]; t.Name() == "" && (ok || unnamed.has(t.Elem().Elem())) {
 					return nil, typeAndSliceProvidedError(t, t.Elem().Elem())
 				}
 			default:
@@ -56,11 +67,19 @@ func ValidateInputs(args []any) (TypeToValue, error) {
 		default:
 			return nil, fmt.Errorf("need supported value, got %s", k)
 		}
+		if name == "" && v.Kind() == reflect.Struct {
+			unnamed.add(v)
+			continue
+		}
+		t = argType(t, name)
 		if _, ok := typeToValue[t]; ok {
-			return nil, fmt.Errorf("type %q provided more than once", t.Name())
+			return nil, fmt.Errorf("type %q provided more than once", PrettyTypeName(t))
 		}
 		typeToValue[t] = v
 	}
+	if err := unnamed.assign(typeToValue, argTypes); err != nil {
+		return nil, err
+	}
 	return typeToValue, nil
 }
 
@@ -87,10 +106,13 @@ func checkDuplicate(tv TypeToValue, t reflect.Type) error {
 
 // ValidateOutputs takes the raw SQLair output arguments from the user and uses
 // reflection to check that they are valid. It returns a TypeToValue containing
-// the reflect.Value of the output arguments.
-func ValidateOutputs(args []any) (TypeToValue, error) {
+// the reflect.Value of the output arguments. argTypes are the types of the
+// outputs of the query in the order they are used, see unnamedStructs.assign.
+func ValidateOutputs(args []any, argTypes []reflect.Type) (TypeToValue, error) {
 	typeToValue := TypeToValue{}
+	unnamed := unnamedStructs{}
 	for _, arg := range args {
+		arg, name := unwrapNamedArg(arg)
 		v := reflect.ValueOf(arg)
 		if err := validateValue(v); err != nil {
 			return nil, err
@@ -105,16 +127,101 @@ func ValidateOutputs(args []any) (TypeToValue, error) {
 			if k != reflect.Struct && k != reflect.Map {
 				return nil, fmt.Errorf("need map or pointer to struct, got pointer to %s", k)
 			}
+			// A pointer to a nil map is given a new map to scan into.
+			if k == reflect.Map && v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
 		}
-		t := v.Type()
+		if name == "" && k == reflect.Struct {
+			unnamed.add(v)
+			continue
+		}
+		t := argType(v.Type(), name)
 		if _, ok := typeToValue[t]; ok {
-			return nil, fmt.Errorf("type %q provided more than once", t.Name())
+			return nil, fmt.Errorf("type %q provided more than once", PrettyTypeName(t))
 		}
 		typeToValue[t] = v
 	}
+	if err := unnamed.assign(typeToValue, argTypes); err != nil {
+		return nil, err
+	}
 	return typeToValue, nil
 }
 
+// unnamedStructs holds the struct arguments that are not wrapped in a
+// NamedArg, grouped by type in the order they are passed.
+type unnamedStructs struct {
+	types  []reflect.Type
+	values map[reflect.Type][]reflect.Value
+}
+
+// add adds the value of an unnamed struct argument.
+func (us *unnamedStructs) add(v reflect.Value) {
+	if us.values == nil {
+		us.values = map[reflect.Type][]reflect.Value{}
+	}
+	t := v.Type()
+	if _, ok := us.values[t]; !ok {
+		us.types = append(us.types, t)
+	}
+	us.values[t] = append(us.values[t], v)
+}
+
+// has returns true if an unnamed struct of type t has been added.
+func (us *unnamedStructs) has(t reflect.Type) bool {
+	return len(us.values[t]) > 0
+}
+
+// assign stores the unnamed struct arguments in typeToValue. A struct type
+// can be used in a query under several names given with NamedArg, such as
+// the employee and manager of a self join. The unnamed values of the type are
+// assigned to the names not already given a value in the order that argTypes
+// uses them. A single value is stored under its own type if the query uses
+// the type by its own name or does not use it at all.
+func (us *unnamedStructs) assign(typeToValue TypeToValue, argTypes []reflect.Type) error {
+	for _, t := range us.types {
+		vals := us.values[t]
+		var names []reflect.Type
+		usesOwnName := false
+		for _, at := range argTypes {
+			if BaseType(at) != t {
+				continue
+			}
+			if at == t {
+				usesOwnName = true
+			}
+			if _, ok := typeToValue[at]; ok || containsType(names, at) {
+				continue
+			}
+			names = append(names, at)
+		}
+		if len(vals) == 1 && (usesOwnName || len(names) == 0) {
+			if _, ok := typeToValue[t]; ok {
+				return fmt.Errorf("type %q provided more than once", PrettyTypeName(t))
+			}
+			typeToValue[t] = vals[0]
+			continue
+		}
+		if len(vals) > len(names) {
+			return fmt.Errorf("type %q provided more than once", PrettyTypeName(t))
+		}
+		for i, v := range vals {
+			typeToValue[names[i]] = v
+		}
+	}
+	return nil
+}
+
+// containsType returns true if ts contains t.
+func containsType(ts []reflect.Type, t reflect.Type) bool {
+	for _, other := range ts {
+		if other == t {
+			return true
+		}
+	}
+	return false
+}
+
 func validateValue(v reflect.Value) error {
 	switch v.Kind() {
 	case reflect.Invalid:
@@ -5,12 +5,17 @@ package typeinfo
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"sort"
 )
 
 var scannerInterface = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+var valuerInterface = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+var textMarshalerInterface = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
 
 // ValueLocator specifies how to locate a value in a SQLair argument type.
 type ValueLocator interface {
@@ -22,6 +27,9 @@ type ValueLocator interface {
 	// Identifier returns a string that uniquely identifies the ValueLocator in
 	// the query.
 	Identifier() string
+	// Member returns the name of the member of the argument type that the
+	// value is located at. It is empty if the value is not located by name.
+	Member() string
 }
 
 // Input is a locator for a Go value from SQLair input arguments to be used in
@@ -48,6 +56,9 @@ type Params struct {
 	// ArgTypeUsed is the type of the argument that was used to generate the
 	// params.
 	ArgTypeUsed reflect.Type
+	// Redact is true if the values must not be shown in errors or in
+	// rendered queries.
+	Redact bool
 }
 
 // newParams generates a new Params struct.
@@ -74,7 +85,10 @@ type Output interface {
 	// implement sql.Scanner, a pointer to them is generated and passed to
 	// Rows.Scan. If Scan has set this pointer to nil the value is zeroed by
 	// ScanProxy.OnSuccess.
-	LocateScanTarget(typeToValue TypeToValue) (any, *ScanProxy, error)
+	//
+	// If merge is true, a NULL column leaves the Go value unchanged. All
+	// values are then scanned through a pointer and a ScanProxy.
+	LocateScanTarget(typeToValue TypeToValue, merge bool) (any, *ScanProxy, error)
 }
 
 // mapKey specifies at which key to find a value in a particular map.
@@ -99,8 +113,12 @@ func (mk *mapKey) LocateParams(typeToValue TypeToValue) (*Params, error) {
 		if v.Kind() == reflect.Invalid {
 			return nil, fmt.Errorf("map %q does not contain key %q", mk.mapType.Name(), mk.name)
 		}
-		argType = m.Type()
-		vals = append(vals, v.Interface())
+		argType = mk.mapType
+		val, err := valuerParam(v, mk)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, val)
 		return newParams(vals, false, false, argType), nil
 	}
 	if ms, ok := locateBulkType(typeToValue, mk.mapType); ok {
@@ -122,9 +140,13 @@ func (mk *mapKey) LocateParams(typeToValue TypeToValue) (*Params, error) {
 			}
 			v := m.MapIndex(reflect.ValueOf(mk.name))
 			if v.Kind() == reflect.Invalid {
-				return nil, fmt.Errorf("map %q does not contain key %q", mk.mapType.Name(), mk.name)
+				return nil, fmt.Errorf("map in slice of %q at index %d does not contain key %q", mk.mapType.Name(), i, mk.name)
+			}
+			val, err := valuerParam(v, mk)
+			if err != nil {
+				return nil, err
 			}
-			vals = append(vals, v.Interface())
+			vals = append(vals, val)
 		}
 		argType = ms.Type()
 		return newParams(vals, false, true, argType), nil
@@ -135,26 +157,111 @@ func (mk *mapKey) LocateParams(typeToValue TypeToValue) (*Params, error) {
 // Desc returns a natural language description of the mapKey for use in error
 // messages.
 func (mk *mapKey) Desc() string {
-	return fmt.Sprintf("key %q of map %q", mk.name, mk.mapType.Name())
+	return fmt.Sprintf("key %q of map %q", mk.name, PrettyTypeName(mk.mapType))
 }
 
 // Identifier returns a string that uniquely identifies the map key in the
 // context of the query.
 func (mk *mapKey) Identifier() string {
-	return mk.mapType.Name() + "." + mk.name
+	return PrettyTypeName(mk.mapType) + "." + mk.name
+}
+
+// Member returns the key.
+func (mk *mapKey) Member() string {
+	return mk.name
 }
 
 // LocateScanTarget locates the map specified in mapKey from the provided
 // typeToValue map. It returns a pointer to pass to rows.Scan, and a ScanProxy
 // reference for setting the key value in the map once the pointer has been
 // scanned into.
-func (mk *mapKey) LocateScanTarget(typeToValue TypeToValue) (any, *ScanProxy, error) {
+func (mk *mapKey) LocateScanTarget(typeToValue TypeToValue, merge bool) (any, *ScanProxy, error) {
 	m, ok := typeToValue[mk.mapType]
 	if !ok {
 		return nil, nil, valueNotFoundError(typeToValue, mk.mapType)
 	}
-	scanVal := reflect.New(mk.mapType.Elem()).Elem()
-	return scanVal.Addr().Interface(), &ScanProxy{original: m, scan: scanVal, key: reflect.ValueOf(mk.name)}, nil
+	// A map with a concrete value type is scanned through a pointer so that
+	// a NULL column can be stored as the zero value of the type.
+	scanType := mk.mapType.Elem()
+	if isTextUnmarshaler(scanType) {
+		if scanType.Kind() != reflect.Pointer {
+			scanType = reflect.PointerTo(scanType)
+		}
+		scanVal := reflect.New(scanType).Elem()
+		ts := &textScanner{target: scanVal, merge: merge}
+		return ts, &ScanProxy{original: m, scan: scanVal, key: reflect.ValueOf(mk.name), merge: merge}, nil
+	}
+	if isByteArray(scanType) {
+		if scanType.Kind() != reflect.Pointer {
+			scanType = reflect.PointerTo(scanType)
+		}
+		scanVal := reflect.New(scanType).Elem()
+		bs := &byteArrayScanner{target: scanVal, merge: merge}
+		return bs, &ScanProxy{original: m, scan: scanVal, key: reflect.ValueOf(mk.name), merge: merge}, nil
+	}
+	if bt := underlyingBasicType(scanType); bt != nil {
+		// The driver converts the column to the underlying basic type which
+		// is then converted to the named type.
+		scanType = bt
+	}
+	if merge || (scanType.Kind() != reflect.Interface && scanType.Kind() != reflect.Pointer && !reflect.PointerTo(scanType).Implements(scannerInterface)) {
+		scanType = reflect.PointerTo(scanType)
+	}
+	scanVal := reflect.New(scanType).Elem()
+	return scanVal.Addr().Interface(), &ScanProxy{original: m, scan: scanVal, key: reflect.ValueOf(mk.name), merge: merge}, nil
+}
+
+// ColumnOutput is an Output whose target depends on the name of the result
+// column that it is scanned from. The name is only known once the query has
+// been run.
+type ColumnOutput interface {
+	Output
+	// ForColumn returns the Output for a result column with the given name.
+	ForColumn(name string) Output
+}
+
+// columnKey specifies a map in which to store a value at the key of the name
+// of its result column.
+type columnKey struct {
+	// column is the SQL of the column. It is used as the key if the name of
+	// the result column is not known.
+	column  string
+	mapType reflect.Type
+}
+
+// ArgType returns the type of the map the value is located in.
+func (ck *columnKey) ArgType() reflect.Type {
+	return ck.mapType
+}
+
+// Desc returns a natural language description of the columnKey for use in
+// error messages.
+func (ck *columnKey) Desc() string {
+	return fmt.Sprintf("column %q of map %q", ck.column, PrettyTypeName(ck.mapType))
+}
+
+// Identifier returns a string that uniquely identifies the columnKey in the
+// context of the query.
+func (ck *columnKey) Identifier() string {
+	return PrettyTypeName(ck.mapType) + "." + ck.column
+}
+
+// Member returns an empty string as the key is only known once the query has
+// been run.
+func (ck *columnKey) Member() string {
+	return ""
+}
+
+// LocateScanTarget locates the map specified in columnKey and returns a
+// pointer to scan the value at the key of the column SQL into.
+func (ck *columnKey) LocateScanTarget(typeToValue TypeToValue, merge bool) (any, *ScanProxy, error) {
+	return ck.ForColumn(ck.column).LocateScanTarget(typeToValue, merge)
+}
+
+// ForColumn returns the Output for the key of the given column name in the
+// map.
+func (ck *columnKey) ForColumn(name string) Output {
+	return &mapKey{name: name, mapType: ck.mapType}
 }
 
 // structField represents reflection information about a field of a particular
@@ -175,6 +282,51 @@ type structField struct {
 	// omitEmpty is true when "omitempty" is
 	// a property of the field's "db" tag.
 	omitEmpty bool
+
+	// nullZero is true when "nullzero" is a property of the field's "db"
+	// tag. The zero value of the field is stored in the database as NULL and
+	// NULL is read as the zero value.
+	nullZero bool
+
+	// readOnly is true when "readonly" is a property of the field's "db"
+	// tag. The field can only be used as an output.
+	readOnly bool
+
+	// redact is true when "redact" is a property of the field's "db" tag.
+	// Its values are not shown in errors or in rendered queries.
+	redact bool
+
+	// defaultValue is the value set with the "default=" option of the
+	// field's "db" tag. It is passed as the input in place of a zero value.
+	// It is invalid if the option is not set.
+	defaultValue reflect.Value
+
+	// json is true when "json" is a property of the field's "db" tag. The
+	// field is stored in the database encoded as JSON.
+	json bool
+
+	// layout is the time layout set with the "layout=" option of the field's
+	// "db" tag. The field is stored in the database as text in this layout.
+	layout string
+
+	// fromName is true if the field has no "db" tag and tag is generated
+	// from its name.
+	fromName bool
+}
+
+// checkOutput returns an error if results cannot be scanned into the field.
+// Drivers do not return a list of values for a column, so a slice field that
+// is not a byte slice must implement sql.Scanner or have the json option,
+// which decodes a JSON array column into it.
+func (f *structField) checkOutput() error {
+	t := f.structType.FieldByIndex(f.index).Type
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice && !f.json && !isByteSlice(t) && !reflect.PointerTo(t).Implements(scannerInterface) {
+		return fmt.Errorf("cannot scan into %s: slice type %s is not a sql.Scanner, use the json option to store it as a JSON array", f.Desc(), t)
+	}
+	return nil
 }
 
 // ArgType returns the type of the struct this field is located in.
@@ -190,13 +342,22 @@ func (f *structField) LocateParams(typeToValue TypeToValue) (*Params, error) {
 	var argType reflect.Type
 	var vals []any
 	if s, ok := typeToValue[f.structType]; ok {
-		val := s.FieldByIndex(f.index)
+		val, err := f.fieldValue(s)
+		if err != nil {
+			return nil, err
+		}
 		if val.IsZero() && f.omitEmpty {
 			omit = true
 		}
-		argType = s.Type()
-		vals = append(vals, val.Interface())
-		return newParams(vals, omit, false, argType), nil
+		param, err := f.param(val)
+		if err != nil {
+			return nil, err
+		}
+		argType = f.structType
+		vals = append(vals, param)
+		params := newParams(vals, omit, false, argType)
+		params.Redact = f.redact
+		return params, nil
 	}
 	if ss, ok := locateBulkType(typeToValue, f.structType); ok {
 		if ss.Len() == 0 {
@@ -213,7 +374,10 @@ func (f *structField) LocateParams(typeToValue TypeToValue) (*Params, error) {
 			}
 			// The slice has the correct type so there is no need to check the
 			// type of each element.
-			val := s.FieldByIndex(f.index)
+			val, err := f.fieldValue(s)
+			if err != nil {
+				return nil, err
+			}
 			if f.omitEmpty {
 				// If the omitemtpy flag is present, we expect either all rows to
 				// have a zero value, or all have a none zero value. If we have a
@@ -224,46 +388,328 @@ func (f *structField) LocateParams(typeToValue TypeToValue) (*Params, error) {
 					return nil, fmt.Errorf("got mix of zero and none zero values in %s which has the omitempty flag set, in a bulk insert, values must be all zero or all none zero", f.Desc())
 				}
 			}
+			param, err := f.param(val)
+			if err != nil {
+				return nil, err
+			}
 			argType = ss.Type()
-			vals = append(vals, val.Interface())
+			vals = append(vals, param)
 		}
-		return newParams(vals, omit, true, argType), nil
+		params := newParams(vals, omit, true, argType)
+		params.Redact = f.redact
+		return params, nil
 	}
 	return nil, valueNotFoundError(typeToValue, f.structType)
 }
 
+// fieldValue returns the value of the field within the struct s. An error is
+// returned if locating the field requires following a nil pointer.
+func (f *structField) fieldValue(s reflect.Value) (reflect.Value, error) {
+	val, err := s.FieldByIndexErr(f.index)
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("cannot locate %s: found nil pointer in path to field %q", f.Desc(), f.name)
+	}
+	return val, nil
+}
+
+// settableFieldValue returns the value of the field within the struct s to
+// scan a result into. Any nil pointers to structs in the path to the field are
+// set to new structs.
+func (f *structField) settableFieldValue(s reflect.Value) (reflect.Value, error) {
+	val := s
+	for i, x := range f.index {
+		if i > 0 && val.Kind() == reflect.Pointer {
+			if val.IsNil() {
+				if !val.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot locate %s: found unsettable nil pointer in path to field %q", f.Desc(), f.name)
+				}
+				val.Set(reflect.New(val.Type().Elem()))
+			}
+			val = val.Elem()
+		}
+		val = val.Field(x)
+	}
+	return val, nil
+}
+
+// param returns the query parameter for the field value val. If the field has
+// the json option, the value is encoded as JSON and a nil pointer, slice, map
+// or interface is passed as NULL. If the field has the layout option the time is formatted in the
+// layout. If the field implements driver.Valuer, such as sql.NullString, the
+// parameter is the result of its Value method. If the field has the nullzero
+// option, a zero value is passed as NULL. If the field has the default option,
+// a zero value is replaced by the default. If the field has the redact option,
+// errors do not include the reason, which may contain the value.
+func (f *structField) param(val reflect.Value) (any, error) {
+	param, err := f.unredactedParam(val)
+	if err != nil && f.redact {
+		return nil, fmt.Errorf("cannot get value of %s: %s", f.Desc(), Redacted)
+	}
+	return param, err
+}
+
+// unredactedParam returns the query parameter for the field value val as
+// described by param.
+func (f *structField) unredactedParam(val reflect.Value) (any, error) {
+	if f.defaultValue.IsValid() && val.IsZero() {
+		val = f.defaultValue
+	}
+	if f.nullZero && val.IsZero() {
+		return nil, nil
+	}
+	if f.layout != "" {
+		return formatTime(val, f.layout), nil
+	}
+	if !f.json {
+		return valuerParam(val, f)
+	}
+	switch val.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		if val.IsNil() {
+			return nil, nil
+		}
+	}
+	b, err := json.Marshal(val.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode %s as JSON: %s", f.Desc(), err)
+	}
+	return string(b), nil
+}
+
+// valuerParam returns the result of the Value method of val if it implements
+// driver.Valuer. Otherwise, if val implements encoding.TextMarshaler, such as
+// netip.Addr, it returns the marshalled text as a string. A fixed-size byte
+// array is returned as a byte slice. Any other value is returned as is. A nil pointer to a type that implements
+// either interface is passed as NULL. vl is the location of val used in error
+// messages.
+func valuerParam(val reflect.Value, vl ValueLocator) (any, error) {
+	if val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return nil, nil
+		}
+		val = val.Elem()
+	}
+	if val.Kind() == reflect.Pointer && val.IsNil() &&
+		(val.Type().Elem().Implements(valuerInterface) || isTextMarshaler(val.Type().Elem())) {
+		return nil, nil
+	}
+	if valuer, ok := val.Interface().(driver.Valuer); ok {
+		v, err := valuer.Value()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get value of %s: %s", vl.Desc(), err)
+		}
+		return v, nil
+	}
+	if isTextMarshaler(val.Type()) {
+		b, err := val.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, fmt.Errorf("cannot marshal text of %s: %s", vl.Desc(), err)
+		}
+		return string(b), nil
+	}
+	if val.Kind() == reflect.Pointer && val.Type().Elem().Kind() == reflect.Array && !val.IsNil() {
+		val = val.Elem()
+	}
+	if val.Kind() == reflect.Array && val.Type().Elem().Kind() == reflect.Uint8 {
+		// A fixed-size byte array, such as [16]byte, is passed as a blob.
+		b := make([]byte, val.Len())
+		reflect.Copy(reflect.ValueOf(b), val)
+		return b, nil
+	}
+	if bt := underlyingBasicType(val.Type()); bt != nil {
+		// A named basic type, such as `type Port int`, is passed as its
+		// underlying type. Types with methods are left for the driver, or
+		// the expr package, to recognise.
+		elem := val
+		if elem.Kind() == reflect.Pointer {
+			if elem.IsNil() {
+				return nil, nil
+			}
+			elem = elem.Elem()
+		}
+		if reflect.PointerTo(elem.Type()).NumMethod() == 0 {
+			return elem.Convert(bt).Interface(), nil
+		}
+	}
+	return val.Interface(), nil
+}
+
+// isTextMarshaler returns true if values of type t are passed to the database
+// as the text from their MarshalText method. time.Time is excluded as it is
+// supported by drivers directly.
+func isTextMarshaler(t reflect.Type) bool {
+	return t.Implements(textMarshalerInterface) && !isTimeType(t)
+}
+
 // Desc returns a natural language description of the struct field for use in
 // error messages.
 func (f *structField) Desc() string {
-	return fmt.Sprintf("tag %q of struct %q", f.tag, f.structType.Name())
+	return fmt.Sprintf("tag %q of struct %q", f.tag, PrettyTypeName(f.structType))
 }
 
 // Identifier returns a string that uniquely identifies the struct field in the
 // context of the query.
 func (f *structField) Identifier() string {
-	return f.structType.Name() + "." + f.tag
+	return PrettyTypeName(f.structType) + "." + f.tag
+}
+
+// Member returns the tag of the field.
+func (f *structField) Member() string {
+	return f.tag
 }
 
 // LocateScanTarget locates the struct specified in structField from the
 // provided typeToValue map. It returns a pointer for the target of rows.Scan,
 // and a ScanProxy reference in the event that we need to coerce that pointer
 // into a struct field.
-func (f *structField) LocateScanTarget(typeToValue TypeToValue) (any, *ScanProxy, error) {
+func (f *structField) LocateScanTarget(typeToValue TypeToValue, merge bool) (any, *ScanProxy, error) {
 	s, ok := typeToValue[f.structType]
 	if !ok {
 		return nil, nil, valueNotFoundError(typeToValue, f.structType)
 	}
-	val := s.FieldByIndex(f.index)
+	val, err := f.settableFieldValue(s)
+	if err != nil {
+		return nil, nil, err
+	}
 	if !val.CanSet() {
 		return nil, nil, fmt.Errorf("internal error: cannot set field %s of struct %s", f.name, f.structType.Name())
 	}
 
+	if f.json {
+		return &jsonScanner{field: f, target: val, merge: merge}, nil, nil
+	}
+	if isTimeType(val.Type()) {
+		return &timeScanner{field: f, target: val, merge: merge}, nil, nil
+	}
+	if isTextUnmarshaler(val.Type()) {
+		return &textScanner{target: val, merge: merge}, nil, nil
+	}
+	if isByteArray(val.Type()) {
+		return &byteArrayScanner{target: val, merge: merge}, nil, nil
+	}
+	// An interface field with methods must be a sql.Scanner, the value it
+	// holds is scanned into.
+	if val.Kind() == reflect.Interface && val.Type().NumMethod() > 0 {
+		if val.IsNil() {
+			return nil, nil, fmt.Errorf("cannot scan into %s: interface field holds no sql.Scanner", f.Desc())
+		}
+		return val.Interface(), nil, nil
+	}
+	// A sql.Scanner may not accept NULL, with the nullzero option it is not
+	// passed to the scanner.
+	if f.nullZero && val.Kind() != reflect.Pointer && reflect.PointerTo(val.Type()).Implements(scannerInterface) {
+		return &nullZeroScanner{target: val, merge: merge}, nil, nil
+	}
+	ptr, scanProxy := scanTarget(val, merge)
+	return ptr, scanProxy, nil
+}
+
+// scanTarget returns a pointer to pass to rows.Scan to scan into the settable
+// value val, along with a ScanProxy if val cannot be scanned into directly.
+// An empty interface value is scanned into a new *any and set to whatever the
+// driver returns.
+func scanTarget(val reflect.Value, merge bool) (any, *ScanProxy) {
+	if bt := underlyingBasicType(val.Type()); bt != nil {
+		// The driver converts the column to the underlying basic type which
+		// is then converted to the named type.
+		scanVal := reflect.New(reflect.PointerTo(bt)).Elem()
+		return scanVal.Addr().Interface(), &ScanProxy{original: val, scan: scanVal, merge: merge}
+	}
 	pt := reflect.PointerTo(val.Type())
-	if val.Type().Kind() != reflect.Pointer && !pt.Implements(scannerInterface) {
+	if merge || (val.Type().Kind() != reflect.Pointer && !pt.Implements(scannerInterface)) {
 		scanVal := reflect.New(pt).Elem()
-		return scanVal.Addr().Interface(), &ScanProxy{original: val, scan: scanVal}, nil
+		return scanVal.Addr().Interface(), &ScanProxy{original: val, scan: scanVal, merge: merge}
 	}
-	return val.Addr().Interface(), nil, nil
+	return val.Addr().Interface(), nil
+}
+
+// Redacted is shown in place of the values of members with the redact option.
+const Redacted = "[REDACTED]"
+
+// IsRedacted returns true if the values located by vl must not be shown in
+// errors or in rendered queries.
+func IsRedacted(vl ValueLocator) bool {
+	f, ok := vl.(*structField)
+	return ok && f.redact
+}
+
+// IsValueOutput returns true if the output argument is a pointer to a single
+// value, such as a *string, rather than to a struct or map with members. A
+// struct that implements sql.Scanner or is a time.Time, and a byte slice, are
+// single values.
+func IsValueOutput(outputArg any) bool {
+	v := reflect.ValueOf(outputArg)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return false
+	}
+	switch t := v.Type().Elem(); t.Kind() {
+	case reflect.Map, reflect.Interface:
+		return false
+	case reflect.Slice:
+		return isByteSlice(t)
+	case reflect.Struct:
+		return t == timeType || v.Type().Implements(scannerInterface)
+	case reflect.Pointer:
+		return t.Elem().Kind() != reflect.Struct && t.Elem().Kind() != reflect.Map
+	}
+	return true
+}
+
+// ValueScanTarget returns a pointer to pass to rows.Scan to scan into the
+// value pointed to by outputArg, which must satisfy IsValueOutput, along with
+// a ScanProxy if it cannot be scanned into directly. A NULL column sets the
+// value to its zero value unless merge is true.
+func ValueScanTarget(outputArg any, merge bool) (any, *ScanProxy) {
+	return scanTarget(reflect.ValueOf(outputArg).Elem(), merge)
+}
+
+// scannerMember represents a member of a struct that is set by a
+// MemberScanner when it is used as an output.
+type scannerMember struct {
+	// member is the name of the member.
+	member string
+
+	// structType is the reflected type of the struct.
+	structType reflect.Type
+
+	// scanner sets the member from a column value.
+	scanner MemberScanner
+}
+
+// ArgType returns the type of the struct the member belongs to.
+func (sm *scannerMember) ArgType() reflect.Type {
+	return sm.structType
+}
+
+// Desc returns a natural language description of the member for use in
+// error messages.
+func (sm *scannerMember) Desc() string {
+	return fmt.Sprintf("member %q of struct %q", sm.member, PrettyTypeName(sm.structType))
+}
+
+// Identifier returns a string that uniquely identifies the member in the
+// context of the query.
+func (sm *scannerMember) Identifier() string {
+	return PrettyTypeName(sm.structType) + "." + sm.member
+}
+
+// Member returns the name of the member.
+func (sm *scannerMember) Member() string {
+	return sm.member
+}
+
+// LocateScanTarget locates the struct the member belongs to in typeToValue
+// and returns a sql.Scanner that calls the MemberScanner with a pointer to
+// it. If merge is true a NULL column does not call the MemberScanner.
+func (sm *scannerMember) LocateScanTarget(typeToValue TypeToValue, merge bool) (any, *ScanProxy, error) {
+	s, ok := typeToValue[sm.structType]
+	if !ok {
+		return nil, nil, valueNotFoundError(typeToValue, sm.structType)
+	}
+	if !s.CanAddr() {
+		return nil, nil, fmt.Errorf("internal error: cannot address struct %s", sm.structType.Name())
+	}
+	return &memberScanner{member: sm, dest: s.Addr().Interface(), merge: merge}, nil, nil
 }
 
 // slice represents a slice input.
@@ -283,6 +729,11 @@ func (s *slice) Identifier() string {
 	return s.sliceType.Name() + "[:]"
 }
 
+// Member returns an empty string as a slice is used whole.
+func (s *slice) Member() string {
+	return ""
+}
+
 // ArgType is the type of the slice input to extract query parameters from.
 func (s *slice) ArgType() reflect.Type {
 	return s.sliceType
@@ -290,6 +741,14 @@ func (s *slice) ArgType() reflect.Type {
 
 // locateBulkType type looks for a slice of t in typeToValue.
 func locateBulkType(typeToValue TypeToValue, t reflect.Type) (reflect.Value, bool) {
+	// A named map argument cannot be used in a bulk insert. A named struct
+	// argument takes a slice of its type.
+	if at, ok := t.(aliasedType); ok {
+		if at.Kind() == reflect.Map {
+			return reflect.Value{}, false
+		}
+		t = at.Type
+	}
 	if bt, ok := typeToValue[reflect.SliceOf(t)]; ok {
 		return bt, true
 	}
@@ -313,7 +772,8 @@ func (s *slice) LocateParams(typeToValue TypeToValue) (*Params, error) {
 	return newParams(vals, false, false, s.sliceType), nil
 }
 
-// PrettyTypeName returns a human readable name for slices and pointers.
+// PrettyTypeName returns a human readable name for slices, pointers and
+// anonymous types.
 func PrettyTypeName(t reflect.Type) string {
 	if t.Name() == "" {
 		switch t.Kind() {
@@ -321,6 +781,8 @@ func PrettyTypeName(t reflect.Type) string {
 			return "[]" + PrettyTypeName(t.Elem())
 		case reflect.Pointer:
 			return "*" + PrettyTypeName(t.Elem())
+		case reflect.Struct, reflect.Map:
+			return t.String()
 		}
 	}
 	return t.Name()
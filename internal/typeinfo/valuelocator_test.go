@@ -4,7 +4,11 @@
 package typeinfo
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"reflect"
+	"time"
 
 	. "gopkg.in/check.v1"
 )
@@ -24,7 +28,7 @@ func (s *typeInfoSuite) TestLocateScanTargetMap(c *C) {
 	}
 	// Values in maps cannot be set directly. A proxy is set by rows.Scan then
 	// we set it with the OnSuccess function in our map.
-	ptr, scanProxy, err := output.LocateScanTarget(typeToValue)
+	ptr, scanProxy, err := output.LocateScanTarget(typeToValue, false)
 	c.Assert(err, IsNil)
 
 	// Check scanProxy has the expected values.
@@ -62,7 +66,7 @@ func (s *typeInfoSuite) TestLocateScanTargetStruct(c *C) {
 	output, err := argInfo.OutputMember("T", "foo")
 	c.Assert(err, IsNil)
 
-	ptr, scanProxy, err := output.LocateScanTarget(typeToValue)
+	ptr, scanProxy, err := output.LocateScanTarget(typeToValue, false)
 	c.Assert(err, IsNil)
 
 	// Check scanProxy has the expected values.
@@ -84,12 +88,207 @@ func (s *typeInfoSuite) TestLocateScanTargetStruct(c *C) {
 	output, err = argInfo.OutputMember("T", "bar")
 	c.Assert(err, IsNil)
 
-	ptr, scanProxy, err = output.LocateScanTarget(typeToValue)
+	ptr, scanProxy, err = output.LocateScanTarget(typeToValue, false)
 	c.Assert(err, IsNil)
 	c.Assert(scanProxy, IsNil)
 	c.Assert(ptr, FitsTypeOf, (**string)(nil))
 }
 
+func (s *typeInfoSuite) TestLocateScanTargetEmbeddedPointer(c *C) {
+	type Entity struct {
+		ID int `db:"id"`
+	}
+	type T struct {
+		*Entity
+		Name string `db:"name"`
+	}
+
+	argInfo, err := GenerateArgInfo([]any{T{}})
+	c.Assert(err, IsNil)
+	t := T{}
+	typeToValue := map[reflect.Type]reflect.Value{
+		reflect.TypeOf(t): reflect.ValueOf(&t).Elem(),
+	}
+
+	// A nil embedded pointer is set to a new struct to scan into.
+	output, err := argInfo.OutputMember("T", "id")
+	c.Assert(err, IsNil)
+	_, scanProxy, err := output.LocateScanTarget(typeToValue, false)
+	c.Assert(err, IsNil)
+	c.Assert(t.Entity, NotNil)
+	scanProxy.scan.Set(reflect.ValueOf(&[]int{7}[0]))
+	scanProxy.OnSuccess()
+	c.Check(t.ID, Equals, 7)
+
+	// An existing embedded struct is scanned into.
+	entity := t.Entity
+	_, _, err = output.LocateScanTarget(typeToValue, false)
+	c.Assert(err, IsNil)
+	c.Check(t.Entity, Equals, entity)
+}
+
+func (s *typeInfoSuite) TestLocateScanTargetTime(c *C) {
+	type T struct {
+		Created time.Time  `db:"created"`
+		Updated *time.Time `db:"updated"`
+		Day     time.Time  `db:"day,layout=02/01/2006"`
+	}
+	argInfo, err := GenerateArgInfo([]any{T{}})
+	c.Assert(err, IsNil)
+
+	expected := time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		summary string
+		member  string
+		src     any
+		err     string
+	}{{
+		summary: "time",
+		member:  "created",
+		src:     expected,
+	}, {
+		summary: "text",
+		member:  "created",
+		src:     "2023-01-02 15:04:05",
+	}, {
+		summary: "bytes with zone",
+		member:  "created",
+		src:     []byte("2023-01-02T15:04:05Z"),
+	}, {
+		summary: "unix seconds",
+		member:  "created",
+		src:     expected.Unix(),
+	}, {
+		summary: "pointer",
+		member:  "updated",
+		src:     "2023-01-02 15:04:05+00:00",
+	}, {
+		summary: "unknown format",
+		member:  "created",
+		src:     "yesterday",
+		err:     `cannot parse tag "created" of struct "T" as time: unknown time format "yesterday"`,
+	}, {
+		summary: "unsupported type",
+		member:  "created",
+		src:     1.5,
+		err:     `cannot scan float64 into tag "created" of struct "T" of type time.Time`,
+	}, {
+		summary: "layout mismatch",
+		member:  "day",
+		src:     "2023-01-02",
+		err:     `cannot parse tag "day" of struct "T" as time: .*`,
+	}}
+	for _, t := range tests {
+		v := T{}
+		typeToValue := map[reflect.Type]reflect.Value{reflect.TypeOf(v): reflect.ValueOf(&v).Elem()}
+		output, err := argInfo.OutputMember("T", t.member)
+		c.Assert(err, IsNil)
+		ptr, scanProxy, err := output.LocateScanTarget(typeToValue, false)
+		c.Assert(err, IsNil)
+		c.Assert(scanProxy, IsNil)
+		err = ptr.(sql.Scanner).Scan(t.src)
+		if t.err != "" {
+			c.Check(err, ErrorMatches, t.err, Commentf(t.summary))
+			continue
+		}
+		c.Assert(err, IsNil, Commentf(t.summary))
+		if t.member == "updated" {
+			c.Assert(v.Updated, NotNil, Commentf(t.summary))
+			c.Check(v.Updated.Equal(expected), Equals, true, Commentf(t.summary))
+		} else {
+			c.Check(v.Created.Equal(expected), Equals, true, Commentf(t.summary))
+		}
+	}
+
+	// The layout option is used to parse the field.
+	v := T{Updated: &expected}
+	typeToValue := map[reflect.Type]reflect.Value{reflect.TypeOf(v): reflect.ValueOf(&v).Elem()}
+	output, err := argInfo.OutputMember("T", "day")
+	c.Assert(err, IsNil)
+	ptr, _, err := output.LocateScanTarget(typeToValue, false)
+	c.Assert(err, IsNil)
+	c.Assert(ptr.(sql.Scanner).Scan("02/01/2023"), IsNil)
+	c.Check(v.Day, Equals, time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC))
+
+	// NULL sets a pointer field to nil.
+	output, err = argInfo.OutputMember("T", "updated")
+	c.Assert(err, IsNil)
+	ptr, _, err = output.LocateScanTarget(typeToValue, false)
+	c.Assert(err, IsNil)
+	c.Assert(ptr.(sql.Scanner).Scan(nil), IsNil)
+	c.Check(v.Updated, IsNil)
+
+	// The layout option formats the field when it is used as an input.
+	input, err := argInfo.InputMember("T", "day")
+	c.Assert(err, IsNil)
+	params, err := input.LocateParams(typeToValue)
+	c.Assert(err, IsNil)
+	c.Check(params.Vals, DeepEquals, []any{"02/01/2023"})
+}
+
+func (s *typeInfoSuite) TestIsValueOutput(c *C) {
+	var str *string
+	for _, v := range []any{new(int), new(string), &str, new([]byte), new(sql.NullString), new(time.Time)} {
+		c.Check(IsValueOutput(v), Equals, true, Commentf("%T", v))
+	}
+	var ts *TS
+	for _, v := range []any{1, "str", str, new(TS), &ts, new(M), &M{}, new([]int), new(any), nil} {
+		c.Check(IsValueOutput(v), Equals, false, Commentf("%T", v))
+	}
+}
+
+func (s *typeInfoSuite) TestLocateScanTargetMerge(c *C) {
+	type T struct {
+		Foo string  `db:"foo"`
+		Bar *string `db:"bar"`
+	}
+
+	argInfo, err := GenerateArgInfo([]any{T{}, M{}})
+	c.Assert(err, IsNil)
+
+	bar := "bar"
+	t := T{Foo: "foo", Bar: &bar}
+	m := M{"foo": "foo"}
+	typeToValue := map[reflect.Type]reflect.Value{
+		reflect.TypeOf(t): reflect.ValueOf(&t).Elem(),
+		reflect.TypeOf(m): reflect.ValueOf(m),
+	}
+
+	// When merging, a NULL column leaves the pointer passed to rows.Scan nil
+	// and the value is left unchanged.
+	for _, member := range []struct{ typeName, name string }{
+		{"T", "foo"}, {"T", "bar"}, {"M", "foo"},
+	} {
+		output, err := argInfo.OutputMember(member.typeName, member.name)
+		c.Assert(err, IsNil)
+		_, scanProxy, err := output.LocateScanTarget(typeToValue, true)
+		c.Assert(err, IsNil)
+		c.Assert(scanProxy, NotNil)
+		scanProxy.OnSuccess()
+	}
+	c.Assert(t, Equals, T{Foo: "foo", Bar: &bar})
+	c.Assert(m, DeepEquals, M{"foo": "foo"})
+
+	// A non-NULL column overwrites the value.
+	output, err := argInfo.OutputMember("T", "foo")
+	c.Assert(err, IsNil)
+	ptr, scanProxy, err := output.LocateScanTarget(typeToValue, true)
+	c.Assert(err, IsNil)
+	baz := "baz"
+	*ptr.(**string) = &baz
+	scanProxy.OnSuccess()
+	c.Assert(t.Foo, Equals, "baz")
+
+	output, err = argInfo.OutputMember("M", "foo")
+	c.Assert(err, IsNil)
+	ptr, scanProxy, err = output.LocateScanTarget(typeToValue, true)
+	c.Assert(err, IsNil)
+	var v any = "baz"
+	*ptr.(**any) = &v
+	scanProxy.OnSuccess()
+	c.Assert(m["foo"], Equals, "baz")
+}
+
 func (s *typeInfoSuite) TestLocateScanTargetError(c *C) {
 	type T struct {
 		Foo string `db:"foo"`
@@ -103,14 +302,14 @@ func (s *typeInfoSuite) TestLocateScanTargetError(c *C) {
 	c.Assert(err, IsNil)
 
 	// Check missing type error.
-	_, _, err = output.LocateScanTarget(map[reflect.Type]reflect.Value{})
+	_, _, err = output.LocateScanTarget(map[reflect.Type]reflect.Value{}, false)
 	c.Assert(err, ErrorMatches, `parameter with type "T" missing`)
 
 	output, err = argInfo.OutputMember("M", "baz")
 	c.Assert(err, IsNil)
 
 	// Check missing type error.
-	_, _, err = output.LocateScanTarget(map[reflect.Type]reflect.Value{})
+	_, _, err = output.LocateScanTarget(map[reflect.Type]reflect.Value{}, false)
 	c.Assert(err, ErrorMatches, `parameter with type "M" missing`)
 
 	// Check missing type with same name error.
@@ -122,7 +321,7 @@ func (s *typeInfoSuite) TestLocateScanTargetError(c *C) {
 	{
 		type M map[string]any
 		typeToValue := map[reflect.Type]reflect.Value{reflect.TypeOf(M{}): reflect.ValueOf(M{})}
-		_, _, err = output.LocateScanTarget(typeToValue)
+		_, _, err = output.LocateScanTarget(typeToValue, false)
 		c.Assert(err, ErrorMatches, `parameter with type "typeinfo.M" missing, have type with same name: "typeinfo.M"`)
 	}
 }
@@ -134,6 +333,18 @@ type TS struct {
 	Bar string `db:"bar, omitempty"`
 }
 type TT struct{}
+type TV struct {
+	Name sql.NullString `db:"name"`
+	Age  sql.NullInt64  `db:"age"`
+	Bad  badValuer      `db:"bad"`
+}
+
+type badValuer struct{}
+
+func (badValuer) Value() (driver.Value, error) {
+	return nil, errors.New("bad value")
+}
+
 type S []any
 type Sint []int
 
@@ -176,6 +387,46 @@ func (s *typeInfoSuite) TestLocateParams(c *C) {
 		expectedBulk: false,
 		expectedOmit: true,
 		expectedVals: []any{""},
+	}, {
+		summary:    "struct valuer",
+		typeSample: TV{},
+		arg:        TV{Name: sql.NullString{String: "Fred", Valid: true}},
+		input: func(ai ArgInfo) (Input, error) {
+			return ai.InputMember("TV", "name")
+		},
+		expectedBulk: false,
+		expectedOmit: false,
+		expectedVals: []any{"Fred"},
+	}, {
+		summary:    "struct valuer null",
+		typeSample: TV{},
+		arg:        TV{Name: sql.NullString{String: "Fred", Valid: true}},
+		input: func(ai ArgInfo) (Input, error) {
+			return ai.InputMember("TV", "age")
+		},
+		expectedBulk: false,
+		expectedOmit: false,
+		expectedVals: []any{nil},
+	}, {
+		summary:    "map valuer",
+		typeSample: M{},
+		arg:        M{"foo": sql.NullString{String: "Fred", Valid: true}, "bar": nil},
+		input: func(ai ArgInfo) (Input, error) {
+			return ai.InputMember("M", "foo")
+		},
+		expectedBulk: false,
+		expectedOmit: false,
+		expectedVals: []any{"Fred"},
+	}, {
+		summary:    "map bulk insert valuer",
+		typeSample: M{},
+		arg:        []M{{"foo": sql.NullString{String: "Fred", Valid: true}}, {"foo": sql.NullString{}}},
+		input: func(ai ArgInfo) (Input, error) {
+			return ai.InputMember("M", "foo")
+		},
+		expectedBulk: true,
+		expectedOmit: false,
+		expectedVals: []any{"Fred", nil},
 	}, {
 		summary:    "int slice",
 		typeSample: Sint{},
@@ -284,6 +535,22 @@ func (s *typeInfoSuite) TestLocateParamsError(c *C) {
 			return ai.InputMember("M", "baz")
 		},
 		err: `map "M" does not contain key "baz"`,
+	}, {
+		summary:    "struct valuer error",
+		typeSample: TV{},
+		arg:        TV{},
+		input: func(ai ArgInfo) (Input, error) {
+			return ai.InputMember("TV", "bad")
+		},
+		err: `cannot get value of tag "bad" of struct "TV": bad value`,
+	}, {
+		summary:    "map valuer error",
+		typeSample: M{},
+		arg:        M{"foo": badValuer{}},
+		input: func(ai ArgInfo) (Input, error) {
+			return ai.InputMember("M", "foo")
+		},
+		err: `cannot get value of key "foo" of map "M": bad value`,
 	}, {
 		summary:    "missing map type",
 		typeSample: M{},
@@ -311,11 +578,11 @@ func (s *typeInfoSuite) TestLocateParamsError(c *C) {
 	}, {
 		summary:    "map bulk insert invalid key",
 		typeSample: M{},
-		arg:        []M{{"foo": "bar"}},
+		arg:        []M{{"foo": "bar", "baz": 1}, {"foo": "bar"}},
 		input: func(ai ArgInfo) (Input, error) {
 			return ai.InputMember("M", "baz")
 		},
-		err: `map "M" does not contain key "baz"`,
+		err: `map in slice of "M" at index 1 does not contain key "baz"`,
 	}, {
 		summary:    "map bulk insert nil map in slice",
 		typeSample: M{},
@@ -390,3 +657,27 @@ func (s *typeInfoSuite) TestLocateParamsError(c *C) {
 		c.Check(err.Error(), Equals, t.err)
 	}
 }
+
+func (s *typeInfoSuite) TestLocateScanTargetColumnOutput(c *C) {
+	type T struct {
+		Foo string `db:"foo"`
+	}
+
+	argInfo, err := GenerateArgInfo([]any{T{}, M{}})
+	c.Assert(err, IsNil)
+
+	output, err := argInfo.ColumnOutput("M", "count(*)")
+	c.Assert(err, IsNil)
+	c.Check(output.Identifier(), Equals, "M.count(*)")
+
+	m := M{}
+	typeToValue := map[reflect.Type]reflect.Value{reflect.TypeOf(m): reflect.ValueOf(m)}
+	ptr, scanProxy, err := output.ForColumn("count").LocateScanTarget(typeToValue, false)
+	c.Assert(err, IsNil)
+	*ptr.(*any) = int64(4)
+	scanProxy.OnSuccess()
+	c.Check(m, DeepEquals, M{"count": int64(4)})
+
+	_, err = argInfo.ColumnOutput("T", "count(*)")
+	c.Assert(err, ErrorMatches, `cannot read "count\(\*\)" into asterisk of struct, a map is required`)
+}
@@ -0,0 +1,53 @@
+// Copyright 2024 Canonical Ltd.
+// Licensed under Apache 2.0, see LICENCE file for details.
+
+package sqlair
+
+import "strings"
+
+// likeEscaper escapes the LIKE wildcards, and the escape character itself,
+// with a backslash.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// LikePattern is a pattern for the LIKE operator built from text that is
+// matched literally, so any % and _ characters in the text are not wildcards.
+// When a LikePattern is used as a query input it is passed to the database
+// with the characters escaped, and the placeholder in the SQL is followed by
+// ESCAPE '\'. The input must therefore be the whole right hand side of the
+// LIKE operator:
+//
+//	search := struct{ Pattern sqlair.LikePattern `db:"pattern"` }{sqlair.LikeContains("50%")}
+//	stmt := sqlair.MustPrepare("SELECT &Product.* FROM product WHERE name LIKE $Search.pattern", Product{}, sqlair.Named("Search", search))
+//
+// LikePattern cannot be used with MySQL unless the NO_BACKSLASH_ESCAPES SQL
+// mode is set, as '\' is not a complete string literal there. SQLite has no
+// default escape character and PostgreSQL uses backslash by default, both
+// accept the ESCAPE clause written by SQLair.
+type LikePattern struct {
+	pattern string
+}
+
+// EscapedPattern returns the pattern passed to the database.
+func (p LikePattern) EscapedPattern() string {
+	return p.pattern
+}
+
+// Like returns a pattern that matches values equal to s.
+func Like(s string) LikePattern {
+	return LikePattern{pattern: likeEscaper.Replace(s)}
+}
+
+// LikePrefix returns a pattern that matches values starting with s.
+func LikePrefix(s string) LikePattern {
+	return LikePattern{pattern: likeEscaper.Replace(s) + "%"}
+}
+
+// LikeSuffix returns a pattern that matches values ending with s.
+func LikeSuffix(s string) LikePattern {
+	return LikePattern{pattern: "%" + likeEscaper.Replace(s)}
+}
+
+// LikeContains returns a pattern that matches values containing s.
+func LikeContains(s string) LikePattern {
+	return LikePattern{pattern: "%" + likeEscaper.Replace(s) + "%"}
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 Canonical Ltd.
+// Licensed under Apache 2.0, see LICENCE file for details.
+
+package sqlair
+
+import "container/list"
+
+// lruCache holds up to a fixed number of values by key. When it is full,
+// adding a value evicts the least recently used one. It is not safe for
+// concurrent use.
+type lruCache[K comparable, V any] struct {
+	size int
+	// order holds the entries from the most to the least recently used.
+	order   *list.List
+	entries map[K]*list.Element
+	// onEvict, if not nil, is called with each value removed from the
+	// cache.
+	onEvict func(V)
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// newLRUCache returns a cache holding up to size values.
+func newLRUCache[K comparable, V any](size int, onEvict func(V)) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		size:    size,
+		order:   list.New(),
+		entries: map[K]*list.Element{},
+		onEvict: onEvict,
+	}
+}
+
+// get returns the value for the key and marks it as the most recently used.
+func (c *lruCache[K, V]) get(key K) (V, bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry[K, V]).value, true
+}
+
+// add sets the value for the key, evicting the least recently used value if
+// the cache is full.
+func (c *lruCache[K, V]) add(key K, value V) {
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*lruEntry[K, V])
+		if c.onEvict != nil {
+			c.onEvict(entry.value)
+		}
+		entry.value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// clear removes all the values from the cache.
+func (c *lruCache[K, V]) clear() {
+	for c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+}
+
+// keys returns the keys of the values in the cache from the most to the least
+// recently used.
+func (c *lruCache[K, V]) keys() []K {
+	keys := make([]K, 0, c.order.Len())
+	for elem := c.order.Front(); elem != nil; elem = elem.Next() {
+		keys = append(keys, elem.Value.(*lruEntry[K, V]).key)
+	}
+	return keys
+}
+
+// len returns the number of values in the cache.
+func (c *lruCache[K, V]) len() int {
+	return c.order.Len()
+}
+
+func (c *lruCache[K, V]) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*lruEntry[K, V])
+	delete(c.entries, entry.key)
+	if c.onEvict != nil {
+		c.onEvict(entry.value)
+	}
+}
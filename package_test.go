@@ -4,13 +4,21 @@
 package sqlair_test
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/netip"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	. "gopkg.in/check.v1"
@@ -58,6 +66,11 @@ type Person struct {
 
 type Manager Person
 
+type PersonAndAddress struct {
+	ID      int     `db:"id"`
+	Address Address `db:"address"`
+}
+
 type District struct{}
 
 type CustomMap map[string]any
@@ -100,6 +113,61 @@ func (svs *ScannerValuerString) Value() (driver.Value, error) {
 	return svs.S, nil
 }
 
+// Status is stored in the database as an integer code.
+type Status string
+
+func (s Status) Value() (driver.Value, error) {
+	switch s {
+	case "active":
+		return int64(1), nil
+	case "inactive":
+		return int64(0), nil
+	}
+	return nil, fmt.Errorf("unknown status %q", string(s))
+}
+
+// Colour is stored in the database as its name.
+type Colour int
+
+const (
+	Red Colour = iota
+	Green
+)
+
+func (c Colour) MarshalText() ([]byte, error) {
+	switch c {
+	case Red:
+		return []byte("red"), nil
+	case Green:
+		return []byte("green"), nil
+	}
+	return nil, fmt.Errorf("unknown colour %d", int(c))
+}
+
+func (c *Colour) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "red":
+		*c = Red
+	case "green":
+		*c = Green
+	default:
+		return fmt.Errorf("unknown colour %q", string(text))
+	}
+	return nil
+}
+
+// Size is stored in the database as a number of bytes and has a text form
+// that is not used for queries.
+type Size int64
+
+func (s Size) Value() (driver.Value, error) {
+	return int64(s), nil
+}
+
+func (s Size) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%dB", int64(s))), nil
+}
+
 var fred = Person{Name: "Fred", ID: 30, Postcode: 1000}
 var mark = Person{Name: "Mark", ID: 20, Postcode: 1500}
 var mary = Person{Name: "Mary", ID: 40, Postcode: 3500}
@@ -153,6 +221,20 @@ func personAndAddressDB(c *C) ([]string, *sqlair.DB, error) {
 	return []string{"person", "address"}, db, nil
 }
 
+// createTableDB returns the test database with the table created from its
+// name and column definitions.
+func createTableDB(c *C, table string, columns string) (*sqlair.DB, error) {
+	db, err := openTestDB()
+	c.Assert(err, IsNil)
+
+	createTable, err := sqlair.Prepare("CREATE TABLE " + table + " (" + columns + ")")
+	c.Assert(err, IsNil)
+	err = db.Query(nil, createTable).Run()
+	c.Assert(err, IsNil)
+
+	return db, nil
+}
+
 func (s *PackageSuite) TestValidIterGet(c *C) {
 	type StringMap map[string]string
 	type unexportedMap map[string]any
@@ -415,7 +497,14 @@ func (s *PackageSuite) TestIterGetErrors(c *C) {
 		types:   []any{Person{}},
 		inputs:  []any{},
 		outputs: []any{&Person{}},
-		err:     `cannot get result: query uses "&Person" outside of result context`,
+		err:     `cannot get result: query uses "&Person" outside of result context: no result column for tag "id" of struct "Person", unmatched result columns: "id"`,
+	}, {
+		summary: "output expr in a subquery with other columns",
+		query:   "SELECT p.name, 1 FROM person AS p WHERE EXISTS (SELECT &Person.* FROM person)",
+		types:   []any{Person{}},
+		inputs:  []any{},
+		outputs: []any{&Person{}},
+		err:     `cannot get result: query uses "&Person" outside of result context: no result column for tag "address_id" of struct "Person", tag "id" of struct "Person", tag "name" of struct "Person", unmatched result columns: "name", "1"`,
 	}}
 
 	tables, db, err := personAndAddressDB(c)
@@ -470,6 +559,20 @@ func (s *PackageSuite) TestValidGet(c *C) {
 		inputs:   []any{sqlair.M{"p1": fred.Postcode}},
 		outputs:  []any{sqlair.M{}},
 		expected: []any{sqlair.M{"name": fred.Name}},
+	}, {
+		summary:  "select into pointer to map",
+		query:    "SELECT &M.name FROM person WHERE address_id = $M.p1",
+		types:    []any{sqlair.M{}},
+		inputs:   []any{&sqlair.M{"p1": fred.Postcode}},
+		outputs:  []any{&sqlair.M{}},
+		expected: []any{&sqlair.M{"name": fred.Name}},
+	}, {
+		summary:  "select into pointer to nil map",
+		query:    "SELECT &M.name FROM person WHERE address_id = $M.p1",
+		types:    []any{sqlair.M{}},
+		inputs:   []any{sqlair.M{"p1": fred.Postcode}},
+		outputs:  []any{new(sqlair.M)},
+		expected: []any{&sqlair.M{"name": fred.Name}},
 	}, {
 		summary:  "lower case struct",
 		query:    "SELECT &unexportedStruct.* FROM person",
@@ -484,6 +587,13 @@ func (s *PackageSuite) TestValidGet(c *C) {
 		inputs:   []any{},
 		outputs:  []any{sqlair.M{}},
 		expected: []any{sqlair.M{"avg": float64(2625), "name": "Fred"}},
+	}, {
+		summary:  "select into nested struct",
+		query:    "SELECT (p.id, a.id, a.street) AS (&PersonAndAddress.id, &PersonAndAddress.address.id, &PersonAndAddress.address.street) FROM person AS p JOIN address AS a ON p.address_id = a.id WHERE p.id = $Person.id",
+		types:    []any{PersonAndAddress{}, Person{}},
+		inputs:   []any{fred},
+		outputs:  []any{&PersonAndAddress{}},
+		expected: []any{&PersonAndAddress{ID: fred.ID, Address: Address{ID: mainStreet.ID, Street: mainStreet.Street}}},
 	}}
 
 	tables, db, err := personAndAddressDB(c)
@@ -529,7 +639,14 @@ func (s *PackageSuite) TestGetErrors(c *C) {
 		types:   []any{Person{}},
 		inputs:  []any{},
 		outputs: []any{&Person{}},
-		err:     "cannot get results: output variables provided but not referenced in query",
+		err:     `cannot get results: output variables provided but not referenced in query, use an output expression such as "&Person.\*" to read columns into Person`,
+	}, {
+		summary: "select asterisk with no outputs",
+		query:   "SELECT * FROM person",
+		types:   []any{},
+		inputs:  []any{},
+		outputs: []any{sqlair.M{}},
+		err:     `cannot get results: output variables provided but not referenced in query, use an output expression such as "&M.\*" to read columns into M`,
 	}, {
 		summary: "key not in map",
 		query:   "SELECT &M.name FROM person WHERE address_id = $M.p1",
@@ -597,6 +714,13 @@ func (s *PackageSuite) TestValidGetAll(c *C) {
 		inputs:   []any{mark},
 		slices:   []any{&[]sqlair.M{}, &[]CustomMap{}},
 		expected: []any{&[]sqlair.M{{"name": mark.Name}}, &[]CustomMap{{"id": int64(mark.ID)}}},
+	}, {
+		summary:  "select into pointers to maps",
+		query:    "SELECT &M.name FROM person WHERE name = $M.name",
+		types:    []any{sqlair.M{}},
+		inputs:   []any{&sqlair.M{"name": mark.Name}},
+		slices:   []any{&[]*sqlair.M{}},
+		expected: []any{&[]*sqlair.M{{"name": mark.Name}}},
 	}, {
 		summary:  "GetAll returns no error when there are no outputs",
 		query:    `INSERT INTO person (name) VALUES ($M.name)`,
@@ -670,33 +794,33 @@ func (s *PackageSuite) TestGetAllErrors(c *C) {
 		slices:  []any{&[]*Address{}},
 		err:     `cannot get result: parameter with type "Person" missing \(have "Address"\)`,
 	}, {
-		summary: "wrong slice type (int)",
+		summary: "slice of values with several output columns",
 		query:   "SELECT * AS &Person.* FROM person",
 		types:   []any{Person{}},
 		inputs:  []any{},
 		slices:  []any{&[]int{}},
-		err:     `need slice of structs/maps, got slice of int`,
+		err:     `cannot get result: cannot scan into \*int: query must have one output column, found 3`,
 	}, {
-		summary: "wrong slice type (pointer to int)",
+		summary: "slice of pointers to values with several output columns",
 		query:   "SELECT * AS &Person.* FROM person",
 		types:   []any{Person{}},
 		inputs:  []any{},
 		slices:  []any{&[]*int{}},
-		err:     `need slice of structs/maps, got slice of pointer to int`,
+		err:     `cannot get result: cannot scan into \*\*int: query must have one output column, found 3`,
 	}, {
-		summary: "wrong slice type (pointer to map)",
-		query:   "SELECT &M.name FROM person",
-		types:   []any{sqlair.M{}},
+		summary: "wrong slice type (slice)",
+		query:   "SELECT * AS &Person.* FROM person",
+		types:   []any{Person{}},
 		inputs:  []any{},
-		slices:  []any{&[]*sqlair.M{}},
-		err:     `need slice of structs/maps, got slice of pointer to map`,
+		slices:  []any{&[][]int{}},
+		err:     `need slice of structs/maps, got slice of slice`,
 	}, {
 		summary: "output not referenced in query",
 		query:   "SELECT name FROM person",
 		types:   []any{},
 		inputs:  []any{},
 		slices:  []any{&[]Person{}},
-		err:     `output variables provided but not referenced in query`,
+		err:     `output variables provided but not referenced in query, use an output expression such as "&Person.\*" to read columns into Person`,
 	}, {
 		summary: "nothing returned",
 		query:   "SELECT &Person.* FROM person WHERE id = $Person.id",
@@ -830,6 +954,54 @@ func (s *PackageSuite) TestRunBulkInsert(c *C) {
 	c.Check(checkAddresses, DeepEquals, addresses)
 }
 
+func (s *PackageSuite) TestBulkInsertMaps(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	// One set of values is inserted for each map in the slice.
+	insertStmt := sqlair.MustPrepare("INSERT INTO person (name, id, address_id) VALUES ($M.*)", sqlair.M{})
+	people := []sqlair.M{
+		{"name": "Jim", "id": 70, "address_id": 500},
+		{"name": "Ann", "id": 60, "address_id": 1000},
+	}
+	c.Assert(db.Query(nil, insertStmt, people).Run(), IsNil)
+
+	var checkPeople []Person
+	selectStmt := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE id >= 60 ORDER BY id DESC", Person{})
+	c.Assert(db.Query(nil, selectStmt).GetAll(&checkPeople), IsNil)
+	c.Check(checkPeople, DeepEquals, []Person{{ID: 70, Name: "Jim", Postcode: 500}, {ID: 60, Name: "Ann", Postcode: 1000}})
+
+	// The first map missing a column is reported.
+	people = []sqlair.M{
+		{"name": "Mary", "id": 40, "address_id": 3500},
+		{"name": "James", "id": 35},
+	}
+	err = db.Query(nil, insertStmt, people).Run()
+	c.Assert(err, ErrorMatches, `invalid input parameter: map in slice of "M" at index 1 does not contain key "address_id"`)
+}
+
+func (s *PackageSuite) TestOutcomeBulkUpsert(c *C) {
+	db, err := createTableDB(c, "person", "name text, id integer PRIMARY KEY, address_id integer, email text")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "person")
+
+	insertStmt := sqlair.MustPrepare("INSERT INTO person (*) VALUES ($Person.*)", Person{})
+	c.Assert(db.Query(nil, insertStmt, fred).Run(), IsNil)
+
+	// In SQLite an inserted row and an updated row are both counted once.
+	upsertStmt := sqlair.MustPrepare(`
+		INSERT INTO person (*) VALUES ($Person.*)
+		ON CONFLICT (id) DO UPDATE SET name = excluded.name`, Person{})
+	outcome := sqlair.Outcome{}
+	renamed := fred
+	renamed.Name = "Frederick"
+	c.Assert(db.Query(nil, upsertStmt, []Person{renamed, mark}).Get(&outcome), IsNil)
+	rowsAffected, err := outcome.Result().RowsAffected()
+	c.Assert(err, IsNil)
+	c.Check(rowsAffected, Equals, int64(2))
+}
+
 func (s *PackageSuite) TestOutcome(c *C) {
 	tables, db, err := personAndAddressDB(c)
 	c.Assert(err, IsNil)
@@ -1137,6 +1309,146 @@ func (s *PackageSuite) TestTransactionErrors(c *C) {
 	}
 }
 
+func (s *PackageSuite) TestTransactionOptions(c *C) {
+	rc := &recordingConnector{}
+	db := sqlair.NewDB(sql.OpenDB(rc))
+	defer db.PlainDB().Close()
+	ctx := context.Background()
+
+	for _, opts := range []*sqlair.TXOptions{
+		nil,
+		sqlair.ReadOnly(),
+		sqlair.Serializable(),
+		{Isolation: sqlair.LevelReadCommitted, ReadOnly: true},
+	} {
+		tx, err := db.Begin(ctx, opts)
+		c.Assert(err, IsNil)
+		c.Assert(tx.Commit(), IsNil)
+	}
+	c.Check(rc.txOptions, DeepEquals, []driver.TxOptions{
+		{},
+		{ReadOnly: true},
+		{Isolation: driver.IsolationLevel(sql.LevelSerializable)},
+		{Isolation: driver.IsolationLevel(sql.LevelReadCommitted), ReadOnly: true},
+	})
+
+	// The SQLite driver accepts both options.
+	tables, sqliteDB, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, sqliteDB, tables...)
+
+	stmt := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE id = $Person.id", Person{})
+	for _, opts := range []*sqlair.TXOptions{sqlair.ReadOnly(), sqlair.Serializable()} {
+		tx, err := sqliteDB.Begin(ctx, opts)
+		c.Assert(err, IsNil)
+		p := Person{ID: fred.ID}
+		c.Assert(tx.Query(ctx, stmt, p).Get(&p), IsNil)
+		c.Check(p, Equals, fred)
+		c.Assert(tx.Commit(), IsNil)
+	}
+}
+
+func (s *PackageSuite) TestTransactionSavepoints(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	insertStmt := sqlair.MustPrepare("INSERT INTO person (*) VALUES ($Person.*)", Person{})
+	selectStmt := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE id > 80 ORDER BY id", Person{})
+	derek := Person{ID: 85, Name: "Derek", Postcode: 8000}
+	edna := Person{ID: 86, Name: "Edna", Postcode: 8000}
+	frank := Person{ID: 87, Name: "Frank", Postcode: 8000}
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx, nil)
+	c.Assert(err, IsNil)
+	c.Assert(tx.Query(ctx, insertStmt, derek).Run(), IsNil)
+	c.Assert(tx.Savepoint("before_edna"), IsNil)
+	c.Assert(tx.Query(ctx, insertStmt, edna).Run(), IsNil)
+	c.Assert(tx.RollbackTo("before_edna"), IsNil)
+	c.Assert(tx.Query(ctx, insertStmt, frank).Run(), IsNil)
+	c.Assert(tx.Release("before_edna"), IsNil)
+
+	// The savepoint no longer exists after it is released.
+	err = tx.RollbackTo("before_edna")
+	c.Assert(err, ErrorMatches, "no such savepoint: before_edna")
+	err = tx.Savepoint("bad name; DROP TABLE person")
+	c.Assert(err, ErrorMatches, `invalid savepoint name "bad name; DROP TABLE person"`)
+	c.Assert(tx.Commit(), IsNil)
+
+	var people []Person
+	c.Assert(db.Query(ctx, selectStmt).GetAll(&people), IsNil)
+	c.Check(people, DeepEquals, []Person{derek, frank})
+
+	// Savepoint methods return ErrTXDone once the transaction is over.
+	c.Assert(tx.Savepoint("sp"), Equals, sqlair.ErrTXDone)
+	c.Assert(tx.RollbackTo("sp"), Equals, sqlair.ErrTXDone)
+	c.Assert(tx.Release("sp"), Equals, sqlair.ErrTXDone)
+}
+
+func (s *PackageSuite) TestTransactionBatch(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	insertStmt := sqlair.MustPrepare("INSERT INTO person (*) VALUES ($Person.*)", Person{})
+	updateStmt := sqlair.MustPrepare("UPDATE person SET address_id = $M.address_id WHERE id > 80", sqlair.M{})
+	selectStmt := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE id > 80 ORDER BY id", Person{})
+	derek := Person{ID: 85, Name: "Derek", Postcode: 8000}
+	edna := Person{ID: 86, Name: "Edna", Postcode: 8000}
+	ctx := context.Background()
+
+	// The statements are run in order and their results are combined.
+	tx, err := db.Begin(ctx, nil)
+	c.Assert(err, IsNil)
+	outcome, err := tx.Run(insertStmt, derek).Then(insertStmt, edna).Then(updateStmt, sqlair.M{"address_id": 9000}).Outcome()
+	c.Assert(err, IsNil)
+	rowsAffected, err := outcome.Result().RowsAffected()
+	c.Assert(err, IsNil)
+	c.Check(rowsAffected, Equals, int64(4))
+	c.Assert(tx.Commit(), IsNil)
+
+	var people []Person
+	c.Assert(db.Query(ctx, selectStmt).GetAll(&people), IsNil)
+	c.Check(people, DeepEquals, []Person{{ID: 85, Name: "Derek", Postcode: 9000}, {ID: 86, Name: "Edna", Postcode: 9000}})
+
+	// The statements after a failure are not run.
+	deleteStmt := sqlair.MustPrepare("DELETE FROM person WHERE id > 80")
+	tx, err = db.Begin(ctx, nil)
+	c.Assert(err, IsNil)
+	batch := tx.Run(deleteStmt).Then(updateStmt, Person{}).Then(insertStmt, derek)
+	c.Assert(batch.Err(), ErrorMatches, `cannot run statement 2 of batch: invalid input parameter: parameter with type "M" missing \(have "Person"\)`)
+	outcome, err = batch.Outcome()
+	c.Assert(err, Equals, batch.Err())
+	rowsAffected, err = outcome.Result().RowsAffected()
+	c.Assert(err, IsNil)
+	c.Check(rowsAffected, Equals, int64(2))
+	c.Assert(tx.Rollback(), IsNil)
+
+	people = nil
+	c.Assert(db.Query(ctx, selectStmt).GetAll(&people), IsNil)
+	c.Check(people, HasLen, 2)
+
+	// A batch cannot be run once the transaction is over.
+	err = tx.Run(deleteStmt).Err()
+	c.Check(errors.Is(err, sqlair.ErrTXDone), Equals, true)
+
+	// Each statement is run with the context of the transaction.
+	cancelCtx, cancel := context.WithCancel(ctx)
+	tx, err = db.Begin(cancelCtx, nil)
+	c.Assert(err, IsNil)
+	batch = tx.Run(deleteStmt)
+	c.Assert(batch.Err(), IsNil)
+	cancel()
+	err = batch.Then(insertStmt, derek).Err()
+	c.Check(errors.Is(err, context.Canceled), Equals, true, Commentf("%v", err))
+	_ = tx.Rollback()
+
+	people = nil
+	c.Assert(db.Query(ctx, selectStmt).GetAll(&people), IsNil)
+	c.Check(people, HasLen, 2)
+}
+
 func (s *PackageSuite) TestTransactionWithOneConn(c *C) {
 	tables, db, err := personAndAddressDB(c)
 	c.Assert(err, IsNil)
@@ -1217,7 +1529,7 @@ func (s *PackageSuite) TestIterMethodOrder(c *C) {
 		c.Fatal("expected true, got false")
 	}
 	err = iter.Get(&p)
-	c.Assert(err, ErrorMatches, `cannot get result: sql: Scan error on column index 0, name "_sqlair_0": converting driver.Value type string \("Fred"\) to a int: invalid syntax`)
+	c.Assert(err, ErrorMatches, `cannot get result: cannot scan column "name" into tag "id" of struct "Person": converting driver.Value type string \("Fred"\) to a int: invalid syntax`)
 	err = iter.Close()
 	c.Assert(err, IsNil)
 }
@@ -1371,3 +1683,3197 @@ func (s *PackageSuite) TestScannerValuerInterfaces(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(svs, DeepEquals, ScannerValuerStruct{ScannerValuerInt: &ScannerValuerInt{F: 1000}})
 }
+
+func (s *PackageSuite) TestNamedAnonymousArgs(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	filter := struct {
+		ID int `db:"id"`
+	}{ID: fred.ID}
+	stmt, err := sqlair.Prepare("SELECT &Person.* FROM person WHERE id = $Filter.id AND name = $Extra.name",
+		Person{}, sqlair.Named("Filter", filter), sqlair.Named("Extra", map[string]any{}))
+	c.Assert(err, IsNil)
+
+	p := Person{}
+	err = db.Query(nil, stmt, sqlair.Named("Filter", filter), sqlair.Named("Extra", map[string]any{"name": fred.Name})).Get(&p)
+	c.Assert(err, IsNil)
+	c.Check(p, Equals, fred)
+
+	// Anonymous values must be wrapped in Named.
+	err = db.Query(nil, stmt, filter, sqlair.Named("Extra", map[string]any{"name": fred.Name})).Get(&p)
+	c.Assert(err, ErrorMatches, "invalid input parameter: cannot use anonymous struct, name it with sqlair.Named")
+}
+
+func (s *PackageSuite) TestPreparePointerSamples(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	// The pointers passed to Get can be used as the type samples.
+	var p Person
+	m := sqlair.M{}
+	stmt, err := sqlair.Prepare("SELECT p.* AS &Person.*, a.district AS &M.district FROM person p JOIN address a ON a.id = p.address_id WHERE p.name = $M.name", &p, &m)
+	c.Assert(err, IsNil)
+	c.Assert(db.Query(nil, stmt, sqlair.M{"name": "Fred"}).Get(&p, &m), IsNil)
+	c.Check(p, Equals, fred)
+	c.Check(m, DeepEquals, sqlair.M{"district": "Happy Land"})
+
+	stmt = sqlair.MustPrepare("INSERT INTO person (*) VALUES ($Person.*)", &Person{})
+	c.Assert(db.Query(nil, stmt, Person{ID: 50, Name: "Ptr"}).Run(), IsNil)
+
+	_, err = sqlair.Prepare("SELECT &Person.* FROM person", (*Person)(nil))
+	c.Assert(err, ErrorMatches, "cannot prepare statement: need supported value, got nil pointer to struct")
+}
+
+func (s *PackageSuite) TestNamedOneOffTypes(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+	defer sqlair.ResetRegisteredTypes()
+
+	// An anonymous struct can be registered under a name and scanned into
+	// without being named again.
+	type row = struct {
+		Name   string `db:"name"`
+		Street string `db:"street"`
+	}
+	c.Assert(sqlair.RegisterType(sqlair.Named("Row", row{})), IsNil)
+	stmt := sqlair.MustPrepare("SELECT p.name AS &Row.name, a.street AS &Row.street FROM person p JOIN address a ON p.address_id = a.id ORDER BY p.name")
+	var rows []row
+	c.Assert(db.Query(nil, stmt).GetAll(&rows), IsNil)
+	c.Check(rows, DeepEquals, []row{{"Fred", "Main Street"}, {"Mark", "Church Road"}, {"Mary", "Station Lane"}})
+
+	// Registering the name again for the same type has no effect, but it
+	// cannot be registered for another type.
+	c.Assert(sqlair.RegisterType(sqlair.Named("Row", row{})), IsNil)
+	err = sqlair.RegisterType(sqlair.Named("Row", struct {
+		ID int `db:"id"`
+	}{}))
+	c.Assert(err, ErrorMatches, `cannot register types: cannot register type "struct { ID int .* }" with name "Row", type "struct { Name string .*; Street string .* }" is registered with the same name`)
+
+	// A local struct with the name of a package type is told apart by
+	// naming it.
+	type Person struct {
+		Name string `db:"name"`
+	}
+	_, err = sqlair.Prepare("SELECT &Person.* FROM person", Person{}, fred)
+	c.Assert(err, ErrorMatches, `cannot prepare statement: two types found with name "Person": "sqlair_test.Person" and "sqlair_test.Person", name one of them with sqlair.Named`)
+	localStmt := sqlair.MustPrepare("SELECT &LocalPerson.* FROM person WHERE id = $Person.id", sqlair.Named("LocalPerson", Person{}), fred)
+	var p Person
+	c.Assert(db.Query(nil, localStmt, fred).Get(&p), IsNil)
+	c.Check(p, Equals, Person{Name: "Fred"})
+}
+
+func (s *PackageSuite) TestMapAliases(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	updateStmt := sqlair.MustPrepare("UPDATE person SET name = $Update.name WHERE id = $Filter.id",
+		sqlair.As("Filter", sqlair.M{}), sqlair.As("Update", sqlair.M{}))
+	err = db.Query(nil, updateStmt, sqlair.As("Filter", sqlair.M{"id": 30}), sqlair.As("Update", sqlair.M{"name": "Frederick"})).Run()
+	c.Assert(err, IsNil)
+
+	selectStmt := sqlair.MustPrepare("SELECT name AS &Result.name FROM person WHERE id = $Filter.id",
+		sqlair.As("Filter", sqlair.M{}), sqlair.As("Result", sqlair.M{}))
+	result := sqlair.M{}
+	err = db.Query(nil, selectStmt, sqlair.As("Filter", sqlair.M{"id": 30})).Get(sqlair.As("Result", result))
+	c.Assert(err, IsNil)
+	c.Check(result, DeepEquals, sqlair.M{"name": "Frederick"})
+
+	// An aliased map is not found by its type name.
+	err = db.Query(nil, updateStmt, sqlair.M{"id": 30}, sqlair.As("Update", sqlair.M{"name": "Fred"})).Run()
+	c.Assert(err, ErrorMatches, `invalid input parameter: parameter with type "Filter" missing \(have "M", "Update"\)`)
+
+	c.Check(updateStmt.Inputs(), DeepEquals, []sqlair.TypeRef{
+		{Type: reflect.TypeOf(sqlair.M{}), Member: "name"},
+		{Type: reflect.TypeOf(sqlair.M{}), Member: "id"},
+	})
+}
+
+func (s *PackageSuite) TestPrepareBackslashEscapes(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	_, err = sqlair.Prepare(`SELECT &Person.* FROM person WHERE name = 'O\'Donnell'`, Person{})
+	c.Assert(err, ErrorMatches, "cannot parse expression: column 54: missing closing quote in string literal")
+
+	_, err = sqlair.Prepare(`SELECT &Person.* FROM person WHERE name = 'O\'Donnell'`, Person{}, sqlair.BackslashEscapes())
+	c.Assert(err, IsNil)
+
+	// The escaped backslash must not escape the closing quote.
+	stmt, err := sqlair.Prepare(`SELECT &Person.* FROM person WHERE name != 'a\\' AND id = $Person.id`, Person{}, sqlair.BackslashEscapes())
+	c.Assert(err, IsNil)
+	p := Person{}
+	err = db.Query(nil, stmt, fred).Get(&p)
+	c.Assert(err, IsNil)
+	c.Check(p, Equals, fred)
+}
+
+func (s *PackageSuite) TestPrepareLimits(c *C) {
+	query := "SELECT &Person.* FROM person WHERE id = $Person.id OR name = $Person.name"
+
+	_, err := sqlair.Prepare(query, Person{}, sqlair.MaxQueryLength(20))
+	c.Assert(err, ErrorMatches, "cannot parse expression: query is 73 bytes long, more than the limit of 20 bytes")
+	_, err = sqlair.Prepare(query, Person{}, sqlair.MaxExpressions(2))
+	c.Assert(err, ErrorMatches, "cannot parse expression: column 62: query has more than 2 expressions")
+	_, err = sqlair.PrepareTypes(query, []reflect.Type{reflect.TypeOf(Person{})}, sqlair.MaxExpressions(2))
+	c.Assert(err, ErrorMatches, "cannot parse expression: column 62: query has more than 2 expressions")
+
+	// The default limits can be lifted.
+	long := "SELECT * FROM person WHERE " + strings.Repeat("name = 'Fred' OR ", 1<<16) + "id = $Person.id"
+	_, err = sqlair.Prepare(long, Person{})
+	c.Assert(err, ErrorMatches, "cannot parse expression: query is .* bytes long, more than the limit of 1048576 bytes")
+	_, err = sqlair.Prepare(long, Person{}, sqlair.MaxQueryLength(0))
+	c.Assert(err, IsNil)
+}
+
+func (s *PackageSuite) TestPrepareTypes(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	query := "SELECT &Person.* FROM person WHERE id = $Person.id"
+	stmt, err := sqlair.PrepareTypes(query, []reflect.Type{reflect.TypeOf(Person{})})
+	c.Assert(err, IsNil)
+	c.Check(stmt.Fingerprint(), Equals, sqlair.MustPrepare(query, Person{}).Fingerprint())
+
+	p := Person{}
+	err = db.Query(nil, stmt, fred).Get(&p)
+	c.Assert(err, IsNil)
+	c.Check(p, Equals, fred)
+
+	_, err = sqlair.PrepareTypes(`SELECT &Person.* FROM person WHERE name = 'O\'Donnell'`, []reflect.Type{reflect.TypeOf(Person{})}, sqlair.BackslashEscapes())
+	c.Assert(err, IsNil)
+
+	// Prepare options apply as they do with Prepare.
+	stmt, err = sqlair.PrepareTypes("SELECT name, &Person.id FROM person WHERE id = $Person.id", []reflect.Type{reflect.TypeOf(Person{})}, sqlair.StrictColumns(true))
+	c.Assert(err, IsNil)
+	err = db.Query(nil, stmt, fred).Get(&p)
+	c.Assert(err, ErrorMatches, `cannot get result: result columns not read into any output: "name", .*`)
+
+	_, err = sqlair.PrepareTypes(query, nil)
+	c.Assert(err, ErrorMatches, `cannot prepare statement: output expression: parameter with type "Person" missing: &Person.\*`)
+
+	_, err = sqlair.PrepareTypes(query, []reflect.Type{reflect.TypeOf(&Person{})})
+	c.Assert(err, ErrorMatches, "cannot prepare statement: need non-pointer type, got pointer to struct")
+}
+
+func (s *PackageSuite) TestBufferedIterWithOneConn(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+	db.PlainDB().SetMaxOpenConns(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	selectStmt := sqlair.MustPrepare("SELECT &Person.* FROM person ORDER BY id", Person{})
+	getStmt := sqlair.MustPrepare("SELECT &Address.* FROM address WHERE id = $Person.address_id", Person{}, Address{})
+
+	// A buffered query releases the only connection before iteration so
+	// other queries can be run whilst iterating.
+	var people []Person
+	iter := db.Query(ctx, selectStmt, sqlair.Buffered()).Iter()
+	for iter.Next() {
+		p := Person{}
+		c.Assert(iter.Get(&p), IsNil)
+		people = append(people, p)
+		a := Address{}
+		err := db.Query(ctx, getStmt, p).Get(&a)
+		if !errors.Is(err, sqlair.ErrNoRows) {
+			c.Assert(err, IsNil)
+		}
+	}
+	c.Assert(iter.Close(), IsNil)
+	c.Check(people, DeepEquals, []Person{mark, fred, dave, mary})
+
+	// Buffered queries work with Get and GetAll.
+	people = nil
+	err = db.Query(ctx, selectStmt, sqlair.Buffered()).GetAll(&people)
+	c.Assert(err, IsNil)
+	c.Check(people, DeepEquals, []Person{mark, fred, dave, mary})
+
+	// A DB with warnings warns once about unbuffered iterators.
+	var warnings []string
+	warnDB := sqlair.NewDB(db.PlainDB(), sqlair.WithWarnings(func(message string) {
+		warnings = append(warnings, message)
+	}))
+	c.Assert(warnDB.Query(ctx, selectStmt).GetAll(&people), IsNil)
+	iter = warnDB.Query(ctx, selectStmt, sqlair.Buffered()).Iter()
+	c.Assert(iter.Close(), IsNil)
+	c.Check(warnings, HasLen, 0)
+	for i := 0; i < 2; i++ {
+		iter = warnDB.Query(ctx, selectStmt).Iter()
+		c.Assert(iter.Close(), IsNil)
+	}
+	c.Check(warnings, DeepEquals, []string{"iterating over query results on a database with a single connection blocks other queries until the iterator is closed, use sqlair.Buffered() to avoid deadlocks"})
+}
+
+func (s *PackageSuite) TestBufferedConversions(c *C) {
+	type Row struct {
+		ID      int64           `db:"id"`
+		Count   uint8           `db:"count"`
+		Price   float32         `db:"price"`
+		Label   string          `db:"label"`
+		Flag    bool            `db:"flag"`
+		Data    []byte          `db:"data"`
+		Content json.RawMessage `db:"content"`
+		Note    *string         `db:"note"`
+		Colour  Colour          `db:"colour"`
+		Name    sql.NullString  `db:"name"`
+		Any     any             `db:"any"`
+	}
+	db, err := openTestDB()
+	c.Assert(err, IsNil)
+
+	// Buffered results are decoded in the same way as unbuffered ones.
+	stmt := sqlair.MustPrepare(`
+		SELECT 7 AS &Row.id, '12' AS &Row.count, 1.5 AS &Row.price, 42 AS &Row.label,
+		       1 AS &Row.flag, x'0102' AS &Row.data, CAST('{"a":1}' AS BLOB) AS &Row.content,
+		       NULL AS &Row.note, 1 AS &Row.colour, NULL AS &Row.name, 'x' AS &Row.any`, Row{})
+	var want, got Row
+	c.Assert(db.Query(nil, stmt).Get(&want), IsNil)
+	c.Assert(db.Query(nil, stmt, sqlair.Buffered()).Get(&got), IsNil)
+	c.Check(got, DeepEquals, want)
+	c.Check(got, DeepEquals, Row{ID: 7, Count: 12, Price: 1.5, Label: "42", Flag: true, Data: []byte{1, 2}, Content: json.RawMessage(`{"a":1}`), Colour: Green, Any: "x"})
+
+	// Conversion errors name the column.
+	stmt = sqlair.MustPrepare("SELECT 'many' AS &Row.count", Row{})
+	err = db.Query(nil, stmt).Get(&got)
+	c.Assert(err, NotNil)
+	bufferedErr := db.Query(nil, stmt, sqlair.Buffered()).Get(&got)
+	c.Assert(bufferedErr, NotNil)
+	c.Check(bufferedErr.Error(), Equals, err.Error())
+}
+
+func (s *PackageSuite) TestInsertAsteriskWithMapKey(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	insertStmt := sqlair.MustPrepare("INSERT INTO person (*) VALUES ($Person.*, $M.email)", Person{}, sqlair.M{})
+	selectStmt := sqlair.MustPrepare("SELECT email AS &M.email FROM person WHERE id = $Person.id", Person{}, sqlair.M{})
+
+	derek := Person{ID: 85, Name: "Derek", Postcode: 8000}
+	err = db.Query(nil, insertStmt, derek, sqlair.M{"email": "derek@example.com"}).Run()
+	c.Assert(err, IsNil)
+
+	m := sqlair.M{}
+	err = db.Query(nil, selectStmt, derek).Get(m)
+	c.Assert(err, IsNil)
+	c.Check(m["email"], Equals, "derek@example.com")
+
+	_, err = sqlair.Prepare("INSERT INTO person (*) VALUES ($Person.*, $M.id)", Person{}, sqlair.M{})
+	c.Assert(err, ErrorMatches, `cannot prepare statement: input expression: column "id" is provided by both Person.\* and M.id: .*`)
+}
+
+func (s *PackageSuite) TestInsertLiteralValues(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	// Literal values are kept as they are between the inputs, including in
+	// bulk inserts.
+	insertStmt := sqlair.MustPrepare("INSERT INTO person (id, name, address_id, email) VALUES ($Person.id, $Person.name, 1000 + 1, lower('NEW@EXAMPLE.COM'))", Person{})
+	err = db.Query(nil, insertStmt, []Person{{ID: 40, Name: "Ann"}, {ID: 41, Name: "Bob"}}).Run()
+	c.Assert(err, IsNil)
+
+	// An input inside a value is bound where it is.
+	coalesceStmt := sqlair.MustPrepare("INSERT INTO person (id, name, address_id, email) VALUES ($Person.id, coalesce(nullif($Person.name, ''), 'unknown'), 1001, 'x')", Person{})
+	err = db.Query(nil, coalesceStmt, Person{ID: 42}).Run()
+	c.Assert(err, IsNil)
+
+	selectStmt := sqlair.MustPrepare("SELECT &Person.*, email AS &M.email FROM person WHERE address_id = 1001 ORDER BY id", Person{}, sqlair.M{})
+	var people []Person
+	var emails []sqlair.M
+	c.Assert(db.Query(nil, selectStmt).GetAll(&people, &emails), IsNil)
+	c.Check(people, DeepEquals, []Person{{ID: 40, Name: "Ann", Postcode: 1001}, {ID: 41, Name: "Bob", Postcode: 1001}, {ID: 42, Name: "unknown", Postcode: 1001}})
+	c.Check(emails, DeepEquals, []sqlair.M{{"email": "new@example.com"}, {"email": "new@example.com"}, {"email": "x"}})
+}
+
+func (s *PackageSuite) TestNamedMapTypes(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	// Map types with the same underlying type are distinct arguments.
+	type PersonAttrs map[string]any
+	type AddressAttrs map[string]any
+	stmt := sqlair.MustPrepare(`
+		SELECT p.name AS &PersonAttrs.name, a.street AS &AddressAttrs.street
+		FROM person AS p JOIN address AS a ON p.address_id = a.id
+		WHERE p.id = $PersonAttrs.id AND a.district = $AddressAttrs.district`, PersonAttrs{}, AddressAttrs{})
+	personAttrs := PersonAttrs{"id": 30}
+	addressAttrs := AddressAttrs{"district": "Happy Land"}
+	c.Assert(db.Query(nil, stmt, personAttrs, addressAttrs).Get(personAttrs, addressAttrs), IsNil)
+	c.Check(personAttrs, DeepEquals, PersonAttrs{"id": 30, "name": "Fred"})
+	c.Check(addressAttrs, DeepEquals, AddressAttrs{"district": "Happy Land", "street": "Main Street"})
+
+	err = db.Query(nil, stmt, personAttrs, sqlair.M{"district": "Happy Land"}).Run()
+	c.Assert(err, ErrorMatches, `invalid input parameter: parameter with type "AddressAttrs" missing \(have "M", "PersonAttrs"\)`)
+}
+
+func (s *PackageSuite) TestInlineExecAndGet(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+	ctx := context.Background()
+
+	derek := Person{ID: 85, Name: "Derek", Postcode: 8000}
+	result, err := db.Exec(ctx, "INSERT INTO person (*) VALUES ($Person.*)", &derek)
+	c.Assert(err, IsNil)
+	n, err := result.RowsAffected()
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, int64(1))
+
+	// Bulk inserts take a slice of the argument type.
+	others := []Person{{ID: 86, Name: "Ed", Postcode: 8000}, {ID: 87, Name: "Flo", Postcode: 8000}}
+	_, err = db.Exec(ctx, "INSERT INTO person (*) VALUES ($Person.*)", others)
+	c.Assert(err, IsNil)
+
+	// The output argument can share a type with the input arguments.
+	for _, want := range append(others, derek) {
+		p := Person{ID: want.ID}
+		err = db.Get(ctx, &p, "SELECT &Person.* FROM person WHERE id = $Person.id", p)
+		c.Assert(err, IsNil)
+		c.Check(p, Equals, want)
+	}
+
+	var p Person
+	err = db.Get(ctx, &p, "SELECT &Person.* FROM person WHERE name = $M.name", sqlair.M{"name": "Fred"}, sqlair.WithQueryID("get-fred"))
+	c.Assert(err, IsNil)
+	c.Check(p, Equals, fred)
+
+	err = db.Get(ctx, &p, "SELECT &Person.* FROM person WHERE name = $M.name", sqlair.M{"name": "Nobody"})
+	c.Check(errors.Is(err, sqlair.ErrNoRows), Equals, true)
+
+	// Errors preparing the query are returned as a PrepareError.
+	var pe *sqlair.PrepareError
+	_, err = db.Exec(ctx, "DELETE FROM person WHERE id = $Person.id", sqlair.M{})
+	c.Assert(errors.As(err, &pe), Equals, true)
+	c.Check(pe.Query, Equals, "DELETE FROM person WHERE id = $Person.id")
+	c.Check(err, ErrorMatches, `cannot prepare statement: input expression: parameter with type "Person" missing.*`)
+
+	err = db.Get(ctx, &p, "SELECT &Person.* FROM person WHERE name = 'unterminated")
+	c.Assert(errors.As(err, &pe), Equals, true)
+	c.Check(err, ErrorMatches, `cannot parse expression: .*missing closing quote in string literal`)
+
+	// Errors running the query are not.
+	_, err = db.Exec(ctx, "INSERT INTO missing (*) VALUES ($Person.*)", derek)
+	c.Assert(err, NotNil)
+	c.Check(errors.As(err, &pe), Equals, false)
+
+	// Statements cached with one prepare option are not reused with another.
+	p = Person{}
+	err = db.Get(ctx, &p, "SELECT name, &Person.id FROM person WHERE id = $Person.id", fred, sqlair.StrictColumns(false))
+	c.Assert(err, IsNil)
+	c.Check(p.ID, Equals, fred.ID)
+	err = db.Get(ctx, &p, "SELECT name, &Person.id FROM person WHERE id = $Person.id", fred, sqlair.StrictColumns(true))
+	c.Check(err, ErrorMatches, `cannot get result: result columns not read into any output: "name", .*`)
+
+	// The cache is bounded so queries built dynamically do not fill it.
+	for i := 0; i < 1100; i++ {
+		_, err = db.Exec(ctx, fmt.Sprintf("UPDATE person SET name = name WHERE id = %d", i))
+		c.Assert(err, IsNil)
+	}
+	c.Check(sqlair.InlineStmtCacheLen(db), Equals, 1000)
+}
+
+func (s *PackageSuite) TestCaseExpressionColumns(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	type Located struct {
+		Name     string `db:"name"`
+		Location string `db:"location"`
+	}
+
+	stmt, err := sqlair.Prepare(`
+		SELECT (name, CASE WHEN address_id = $Person.address_id THEN 'home' ELSE 'away, far' END) AS (&Located.name, &Located.location)
+		FROM person
+		WHERE id >= $M.min
+		ORDER BY id`,
+		Person{}, Located{}, sqlair.M{},
+	)
+	c.Assert(err, IsNil)
+
+	var located []Located
+	err = db.Query(nil, stmt, Person{Postcode: 4500}, sqlair.M{"min": 30}).GetAll(&located)
+	c.Assert(err, IsNil)
+	c.Check(located, DeepEquals, []Located{
+		{Name: "Fred", Location: "away, far"},
+		{Name: "Dave", Location: "home"},
+		{Name: "Mary", Location: "away, far"},
+	})
+
+	// The input and output can share a single CASE expression.
+	stmt, err = sqlair.Prepare(`
+		SELECT CASE WHEN address_id = $Person.address_id THEN name ELSE 'nobody' END AS &Located.name
+		FROM person
+		WHERE id = $M.id`,
+		Person{}, Located{}, sqlair.M{},
+	)
+	c.Assert(err, IsNil)
+
+	var l Located
+	err = db.Query(nil, stmt, Person{Postcode: 1500}, sqlair.M{"id": 20}).Get(&l)
+	c.Assert(err, IsNil)
+	c.Check(l.Name, Equals, "Mark")
+}
+
+func (s *PackageSuite) TestByteSliceColumns(c *C) {
+	type Document struct {
+		ID      int             `db:"id"`
+		Data    []byte          `db:"data"`
+		Content json.RawMessage `db:"content"`
+	}
+	db, err := createTableDB(c, "document", "id integer, data blob, content blob")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "document")
+
+	docs := []Document{{
+		ID:      1,
+		Data:    []byte{0xde, 0xad, 0xbe, 0xef},
+		Content: json.RawMessage(`{"key":"value"}`),
+	}, {
+		ID: 2,
+	}}
+	insertStmt := sqlair.MustPrepare("INSERT INTO document (*) VALUES ($Document.*)", Document{})
+	for _, doc := range docs {
+		c.Assert(db.Query(nil, insertStmt, doc).Run(), IsNil)
+	}
+
+	// Byte slices are bound as single parameters and scanned as single
+	// values.
+	selectStmt := sqlair.MustPrepare("SELECT &Document.* FROM document WHERE data = $Document.data", Document{})
+	got := Document{}
+	err = db.Query(nil, selectStmt, docs[0]).Get(&got)
+	c.Assert(err, IsNil)
+	c.Check(got, DeepEquals, docs[0])
+
+	// NULL blobs are scanned as nil.
+	selectStmt = sqlair.MustPrepare("SELECT &Document.* FROM document WHERE id = $Document.id", Document{})
+	got = Document{Data: []byte{1}, Content: json.RawMessage("{}")}
+	err = db.Query(nil, selectStmt, docs[1]).Get(&got)
+	c.Assert(err, IsNil)
+	c.Check(got, DeepEquals, docs[1])
+
+	// Byte slices can be map values.
+	mapStmt := sqlair.MustPrepare("SELECT &M.data FROM document WHERE data = $M.data", sqlair.M{})
+	m := sqlair.M{}
+	err = db.Query(nil, mapStmt, sqlair.M{"data": docs[0].Data}).Get(m)
+	c.Assert(err, IsNil)
+	c.Check(m["data"], DeepEquals, docs[0].Data)
+
+	// Byte slices cannot be used as arguments on their own.
+	_, err = sqlair.Prepare("SELECT data FROM document WHERE data IN ($Blob[:])", json.RawMessage{})
+	c.Assert(err, ErrorMatches, "cannot prepare statement: cannot use byte slice .* as an argument, byte slices can only be used as struct fields or map values")
+}
+
+func (s *PackageSuite) TestLargeBlobs(c *C) {
+	type Blob []byte
+	type Attachment struct {
+		ID      int    `db:"id"`
+		Payload []byte `db:"payload"`
+		Thumb   Blob   `db:"thumb"`
+	}
+	db, err := createTableDB(c, "attachment", "id integer, payload blob, thumb blob")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "attachment")
+
+	payload := make([]byte, 1<<20)
+	for i := range payload {
+		payload[i] = byte(i * 7)
+	}
+	attachments := []Attachment{
+		{ID: 1, Payload: payload, Thumb: Blob{1, 2, 3}},
+		{ID: 2, Payload: bytes.Repeat([]byte{0xff}, 1<<20), Thumb: Blob{4, 5, 6}},
+	}
+	insertStmt := sqlair.MustPrepare("INSERT INTO attachment (*) VALUES ($Attachment.*)", Attachment{})
+	c.Assert(db.Query(nil, insertStmt, attachments).Run(), IsNil)
+
+	// The scanned bytes are copied so they can be kept after moving to the
+	// next row.
+	selectStmt := sqlair.MustPrepare("SELECT &Attachment.* FROM attachment ORDER BY id", Attachment{})
+	iter := db.Query(nil, selectStmt).Iter()
+	var got []Attachment
+	for iter.Next() {
+		var a Attachment
+		c.Assert(iter.Get(&a), IsNil)
+		got = append(got, a)
+	}
+	c.Assert(iter.Close(), IsNil)
+	c.Assert(got, HasLen, 2)
+	c.Check(bytes.Equal(got[0].Payload, attachments[0].Payload), Equals, true)
+	c.Check(bytes.Equal(got[1].Payload, attachments[1].Payload), Equals, true)
+	c.Check(got[0].Thumb, DeepEquals, attachments[0].Thumb)
+	c.Check(got[1].Thumb, DeepEquals, attachments[1].Thumb)
+
+	// sql.RawBytes is only valid until the next row is read.
+	type RawAttachment struct {
+		Payload sql.RawBytes `db:"payload"`
+	}
+	_, err = sqlair.Prepare("SELECT &RawAttachment.* FROM attachment", RawAttachment{})
+	c.Assert(err, ErrorMatches, `cannot prepare statement: field "Payload" of struct RawAttachment has type sql.RawBytes which is only valid until the next row is read, use \[\]byte`)
+}
+
+func (s *PackageSuite) TestStatementFingerprint(c *C) {
+	stmt1 := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE id = $Person.id", Person{})
+	stmt2 := sqlair.MustPrepare(`
+		SELECT &Person.*
+		FROM   person
+		WHERE  id = $Person.id`, Person{})
+	stmt3 := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE name = $Person.name", Person{})
+
+	c.Check(stmt1.Fingerprint(), Equals, stmt2.Fingerprint())
+	c.Check(stmt1.Fingerprint(), Not(Equals), stmt3.Fingerprint())
+}
+
+func (s *PackageSuite) TestStatementRender(c *C) {
+	stmt := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE name = $Person.name AND id IN ($S[:])", Person{}, sqlair.S{})
+	query, params, err := stmt.Render(Person{Name: "Fred"}, sqlair.S{30, 40})
+	c.Assert(err, IsNil)
+	c.Check(query, Equals, "SELECT address_id AS _sqlair_0, id AS _sqlair_1, name AS _sqlair_2 FROM person WHERE name = @sqlair_0 AND id IN (@sqlair_1, @sqlair_2)")
+	c.Check(params, DeepEquals, []any{
+		sql.Named("sqlair_0", "Fred"),
+		sql.Named("sqlair_1", 30),
+		sql.Named("sqlair_2", 40),
+	})
+
+	// A bulk insert has a row of placeholders for each element.
+	stmt = sqlair.MustPrepare("INSERT INTO person (name, id) VALUES ($Person.name, $Person.id)", Person{})
+	query, params, err = stmt.Render([]Person{{ID: 1, Name: "Jim"}, {ID: 2, Name: "Joe"}})
+	c.Assert(err, IsNil)
+	c.Check(query, Equals, "INSERT INTO person (name, id) VALUES (@sqlair_0, @sqlair_2), (@sqlair_1, @sqlair_3)")
+	c.Check(params, HasLen, 4)
+
+	_, _, err = stmt.Render()
+	c.Assert(err, ErrorMatches, `invalid input parameter: parameter with type "Person" missing`)
+}
+
+func (s *PackageSuite) TestRedact(c *C) {
+	db, err := createTableDB(c, "account", "name text, token text, pin text")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "account")
+
+	type Account struct {
+		Name  string `db:"name"`
+		Token string `db:"token,redact"`
+	}
+	const secret = "s3cr3t-token"
+
+	// The value is passed to the database but not rendered.
+	insertStmt := sqlair.MustPrepare("INSERT INTO account (*) VALUES ($Account.*)", Account{})
+	account := Account{Name: "fred", Token: secret}
+	query, params, err := insertStmt.Render(account)
+	c.Assert(err, IsNil)
+	c.Check(params, DeepEquals, []any{sql.Named("sqlair_0", "fred"), sql.Named("sqlair_1", "[REDACTED]")})
+	c.Check(strings.Contains(fmt.Sprint(query, params), secret), Equals, false)
+	c.Assert(db.Query(nil, insertStmt, account).Run(), IsNil)
+
+	var got Account
+	selectStmt := sqlair.MustPrepare("SELECT &Account.* FROM account WHERE name = $Account.name", Account{})
+	c.Assert(db.Query(nil, selectStmt, Account{Name: "fred"}).Get(&got), IsNil)
+	c.Check(got, Equals, account)
+
+	// Errors scanning a column into the field do not contain the value.
+	type Pin struct {
+		Pin int `db:"pin,redact"`
+	}
+	updateStmt := sqlair.MustPrepare("UPDATE account SET pin = $M.pin", sqlair.M{})
+	c.Assert(db.Query(nil, updateStmt, sqlair.M{"pin": secret}).Run(), IsNil)
+	pinStmt := sqlair.MustPrepare("SELECT &Pin.* FROM account", Pin{})
+	err = db.Query(nil, pinStmt).Get(&Pin{})
+	c.Assert(err, ErrorMatches, `cannot get result: cannot scan column "pin" into tag "pin" of struct "Pin": \[REDACTED\]`)
+	c.Check(strings.Contains(err.Error(), secret), Equals, false)
+}
+
+func (s *PackageSuite) TestParamStyles(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	insertStmt := sqlair.MustPrepare("INSERT INTO person (*) VALUES ($Person.*)", Person{})
+	selectStmt := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE name = $Person.name AND id IN ($S[:])", Person{}, sqlair.S{})
+	deleteStmt := sqlair.MustPrepare("DELETE FROM person WHERE name = $Person.name", Person{})
+
+	styles := []sqlair.DBOption{
+		sqlair.WithParamStyle(sqlair.At),
+		sqlair.WithParamStyle(sqlair.Colon),
+		sqlair.WithParamStyle(sqlair.Dollar),
+		sqlair.WithParamStyle(sqlair.Question),
+		sqlair.WithParamPrefix(":"),
+	}
+	for _, style := range styles {
+		styledDB := sqlair.NewDB(db.PlainDB(), style)
+		jim := []Person{{ID: 50, Name: "Jim", Postcode: 1000}, {ID: 51, Name: "Jim", Postcode: 1500}}
+		err := styledDB.Query(nil, insertStmt, jim).Run()
+		c.Assert(err, IsNil)
+
+		var people []Person
+		err = styledDB.Query(nil, selectStmt, Person{Name: "Jim"}, sqlair.S{50, 51}).GetAll(&people)
+		c.Assert(err, IsNil)
+		c.Check(people, DeepEquals, jim)
+
+		// Transactions use the style of the DB.
+		tx, err := styledDB.Begin(nil, nil)
+		c.Assert(err, IsNil)
+		err = tx.Query(nil, deleteStmt, Person{Name: "Jim"}).Run()
+		c.Assert(err, IsNil)
+		c.Assert(tx.Commit(), IsNil)
+	}
+
+	// SQL that clashes with the parameter placeholders is rejected.
+	stmt := sqlair.MustPrepare("SELECT name FROM person WHERE id = :sqlair_0 AND name = $Person.name", Person{})
+	err = sqlair.NewDB(db.PlainDB(), sqlair.WithParamStyle(sqlair.Colon)).Query(nil, stmt, fred).Run()
+	c.Assert(err, ErrorMatches, `invalid input parameter: query contains ":sqlair_" which clashes with the query parameter placeholders`)
+}
+
+func (s *PackageSuite) TestMarkerPrefix(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	insertStmt := sqlair.MustPrepare("INSERT INTO person (*) VALUES ($Person.*)", Person{})
+	selectStmt := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE name = $Person.name ORDER BY id", Person{})
+	mapStmt := sqlair.MustPrepare("SELECT &M.* FROM person WHERE id = $Person.id", Person{}, sqlair.M{})
+
+	for _, prefix := range []string{"myapp", "myapp_"} {
+		prefixDB := sqlair.NewDB(db.PlainDB(), sqlair.WithMarkerPrefix(prefix))
+		jim := []Person{{ID: 50, Name: "Jim", Postcode: 1000}, {ID: 51, Name: "Jim", Postcode: 1500}}
+		c.Assert(prefixDB.Query(nil, insertStmt, jim).Run(), IsNil)
+
+		var people []Person
+		c.Assert(prefixDB.Query(nil, selectStmt, Person{Name: "Jim"}).GetAll(&people), IsNil)
+		c.Check(people, DeepEquals, jim)
+
+		m := sqlair.M{}
+		c.Assert(prefixDB.Query(nil, mapStmt, Person{ID: 50}).Get(&m), IsNil)
+		c.Check(m["name"], Equals, "Jim")
+
+		// Transactions use the prefix of the DB.
+		tx, err := prefixDB.Begin(nil, nil)
+		c.Assert(err, IsNil)
+		deleteStmt := sqlair.MustPrepare("DELETE FROM person WHERE name = $Person.name", Person{})
+		c.Assert(tx.Query(nil, deleteStmt, Person{Name: "Jim"}).Run(), IsNil)
+		c.Assert(tx.Commit(), IsNil)
+	}
+
+	// The prefix must be a lower case name.
+	err = sqlair.NewDB(db.PlainDB(), sqlair.WithMarkerPrefix("my-app")).Query(nil, selectStmt, fred).GetAll(&[]Person{})
+	c.Assert(err, ErrorMatches, `invalid marker prefix: invalid marker "my-app": .*`)
+}
+
+func (s *PackageSuite) TestRepeatedInputMembers(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	// The same member can be referenced several times, with or without
+	// reusing the parameter.
+	stmt := sqlair.MustPrepare(`
+		SELECT &Person.* FROM person
+		WHERE name = $Person.name OR id = $Person.id OR (address_id = 1000 AND name = $Person.name)
+		ORDER BY id`, Person{})
+	for _, opts := range [][]sqlair.DBOption{
+		nil,
+		{sqlair.WithReusedParams()},
+		{sqlair.WithReusedParams(), sqlair.WithParamStyle(sqlair.Colon)},
+		{sqlair.WithParamStyle(sqlair.Question), sqlair.WithReusedParams()},
+	} {
+		var people []Person
+		err := sqlair.NewDB(db.PlainDB(), opts...).Query(nil, stmt, Person{ID: 20, Name: "Fred"}).GetAll(&people)
+		c.Assert(err, IsNil)
+		c.Check(people, DeepEquals, []Person{mark, fred})
+	}
+}
+
+func (s *PackageSuite) TestAllowUnusedArgs(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	stmt := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE id = $Person.id", Person{}, Address{})
+	positionalStmt := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE id = $1", Person{})
+
+	// Unused arguments are rejected by default.
+	err = db.Query(nil, stmt, Person{ID: 30}, Address{}).Get(&Person{})
+	c.Assert(err, ErrorMatches, `invalid input parameter: argument of type "Address" not used by query`)
+
+	// They are ignored with the query option.
+	p := Person{}
+	err = db.Query(nil, stmt, Person{ID: 30}, Address{}, sqlair.AllowUnusedArgs()).Get(&p)
+	c.Assert(err, IsNil)
+	c.Check(p, Equals, fred)
+	p = Person{}
+	err = db.Query(nil, positionalStmt, 30, "unused", sqlair.AllowUnusedArgs()).Get(&p)
+	c.Assert(err, IsNil)
+	c.Check(p, Equals, fred)
+
+	// They are ignored in every query on a DB with the option.
+	lenientDB := sqlair.NewDB(db.PlainDB(), sqlair.WithAllowUnusedArgs())
+	p = Person{}
+	err = lenientDB.Query(nil, stmt, Person{ID: 20}, Address{}, sqlair.M{}).Get(&p)
+	c.Assert(err, IsNil)
+	c.Check(p, Equals, mark)
+
+	tx, err := lenientDB.Begin(nil, nil)
+	c.Assert(err, IsNil)
+	p = Person{}
+	err = tx.Query(nil, stmt, Person{ID: 40}, Address{}).Get(&p)
+	c.Assert(err, IsNil)
+	c.Check(p, Equals, mary)
+	c.Assert(tx.Commit(), IsNil)
+
+	// Arguments used by the query must still be passed.
+	err = lenientDB.Query(nil, stmt, Address{}).Get(&p)
+	c.Assert(err, ErrorMatches, `invalid input parameter: parameter with type "Person" missing \(have "Address"\)`)
+}
+
+func (s *PackageSuite) TestAllowUnmappedColumns(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	interleaved := sqlair.MustPrepare("SELECT name, id AS &Person.id, email, address_id AS &Person.address_id FROM person WHERE id = $Person.id", Person{})
+	star := sqlair.MustPrepare("SELECT *, &Person.name FROM person WHERE id = $Person.id", Person{})
+	counts := sqlair.MustPrepare("SELECT name, count(*) AS &M.*, p.* AS &M.* FROM person p WHERE id = $Person.id", Person{}, sqlair.M{})
+
+	// Result columns not read into outputs are skipped by default.
+	var p Person
+	c.Assert(db.Query(nil, interleaved, fred).Get(&p), IsNil)
+	c.Check(p, Equals, Person{ID: 30, Postcode: 1000})
+
+	// They are rejected on a strict DB.
+	strictDB := sqlair.NewDB(db.PlainDB(), sqlair.WithStrictColumns())
+	err = strictDB.Query(nil, interleaved, fred).Get(&p)
+	c.Assert(err, ErrorMatches, `cannot get result: result columns not read into any output: "name", "email", read them with output expressions or use sqlair.AllowUnmappedColumns to skip them`)
+	err = strictDB.Query(nil, star, fred).Get(&p)
+	c.Assert(err, ErrorMatches, `cannot get result: result columns not read into any output: "name", "id", "address_id", "email", .*`)
+	err = strictDB.Query(nil, counts, fred).Get(sqlair.M{})
+	c.Assert(err, ErrorMatches, `cannot get result: result columns not read into any output: "name", .*`)
+	var people []Person
+	err = strictDB.Query(nil, interleaved, mark).GetAll(&people)
+	c.Assert(err, ErrorMatches, `.*result columns not read into any output: "name", "email", .*`)
+
+	// The query option skips them on a strict DB.
+	p = Person{}
+	c.Assert(strictDB.Query(nil, interleaved, fred, sqlair.AllowUnmappedColumns()).Get(&p), IsNil)
+	c.Check(p, Equals, Person{ID: 30, Postcode: 1000})
+	p = Person{}
+	c.Assert(strictDB.Query(nil, star, fred, sqlair.AllowUnmappedColumns()).Get(&p), IsNil)
+	c.Check(p, Equals, Person{Name: "Fred"})
+	m := sqlair.M{}
+	c.Assert(strictDB.Query(nil, counts, fred, sqlair.AllowUnmappedColumns()).Get(m), IsNil)
+	c.Check(m, DeepEquals, sqlair.M{"count(*)": int64(1), "name": "Fred", "id": int64(30), "address_id": int64(1000), "email": nil})
+
+	// Every row of a result set is read once its columns have been checked.
+	tx, err := strictDB.Begin(nil, nil)
+	c.Assert(err, IsNil)
+	all := sqlair.MustPrepare("SELECT &Person.* FROM person ORDER BY id", Person{})
+	iter := tx.Query(nil, all).Iter()
+	people = nil
+	for iter.Next() {
+		p = Person{}
+		c.Assert(iter.Get(&p), IsNil)
+		people = append(people, p)
+	}
+	c.Assert(iter.Close(), IsNil)
+	c.Check(people, HasLen, 4)
+	c.Assert(tx.Commit(), IsNil)
+}
+
+func (s *PackageSuite) TestStrictColumnsStatement(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	query := "SELECT name, id AS &Person.id FROM person WHERE id = $Person.id"
+	lenient := sqlair.MustPrepare(query, Person{}, sqlair.StrictColumns(false))
+	strict := sqlair.MustPrepare(query, Person{}, sqlair.StrictColumns(true))
+	strictDB := sqlair.NewDB(db.PlainDB(), sqlair.WithStrictColumns())
+
+	// A lenient statement skips the columns on a strict DB.
+	var p Person
+	c.Assert(strictDB.Query(nil, lenient, fred).Get(&p), IsNil)
+	c.Check(p, Equals, Person{ID: 30})
+	tx, err := strictDB.Begin(nil, nil)
+	c.Assert(err, IsNil)
+	p = Person{}
+	c.Assert(tx.Query(nil, lenient, mark).Get(&p), IsNil)
+	c.Check(p, Equals, Person{ID: 20})
+	c.Assert(tx.Commit(), IsNil)
+
+	// A strict statement rejects them on a default DB.
+	err = db.Query(nil, strict, fred).Get(&p)
+	c.Assert(err, ErrorMatches, `cannot get result: result columns not read into any output: "name", .*`)
+	var people []Person
+	err = db.Query(nil, strict, fred).GetAll(&people)
+	c.Assert(err, ErrorMatches, `.*result columns not read into any output: "name", .*`)
+
+	// The query option still skips them for a single query.
+	p = Person{}
+	c.Assert(db.Query(nil, strict, fred, sqlair.AllowUnmappedColumns()).Get(&p), IsNil)
+	c.Check(p, Equals, Person{ID: 30})
+}
+
+func (s *PackageSuite) TestPrepareContext(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	cachedDB := sqlair.NewDB(db.PlainDB(), sqlair.WithStmtCache())
+	ctx := context.Background()
+
+	// The SQL of the statement is prepared on the database straight away.
+	stmt, err := cachedDB.PrepareContext(ctx, "SELECT &Person.* FROM person WHERE name = $M.name", Person{}, sqlair.M{})
+	c.Assert(err, IsNil)
+	c.Check(sqlair.CachedStmtSQL(cachedDB), DeepEquals, []string{
+		"SELECT address_id AS _sqlair_0, id AS _sqlair_1, name AS _sqlair_2 FROM person WHERE name = @sqlair_0",
+	})
+	var p Person
+	c.Assert(cachedDB.Query(ctx, stmt, sqlair.M{"name": "Fred"}).Get(&p), IsNil)
+	c.Check(p, Equals, fred)
+
+	// Queries whose SQL depends on their inputs are prepared when run, in
+	// transactions too.
+	ids, err := cachedDB.PrepareContext(ctx, "SELECT &Person.* FROM person WHERE id IN ($S[:]) ORDER BY id", Person{}, sqlair.S{})
+	c.Assert(err, IsNil)
+	c.Check(sqlair.CachedStmtSQL(cachedDB), HasLen, 1)
+	tx, err := cachedDB.Begin(ctx, nil)
+	c.Assert(err, IsNil)
+	var people []Person
+	c.Assert(tx.Query(ctx, ids, sqlair.S{20, 30}).GetAll(&people), IsNil)
+	c.Check(people, DeepEquals, []Person{mark, fred})
+	c.Assert(tx.Commit(), IsNil)
+	c.Check(sqlair.CachedStmtSQL(cachedDB), HasLen, 2)
+
+	// Running the query again uses the cached statement.
+	people = nil
+	c.Assert(cachedDB.Query(ctx, ids, sqlair.S{20, 30}).GetAll(&people), IsNil)
+	c.Check(people, DeepEquals, []Person{mark, fred})
+	c.Check(sqlair.CachedStmtSQL(cachedDB), HasLen, 2)
+
+	// Errors in the query are returned as a PrepareError.
+	var pe *sqlair.PrepareError
+	_, err = cachedDB.PrepareContext(ctx, "SELECT &Person.* FROM person WHERE id = $Address.id", Person{})
+	c.Assert(errors.As(err, &pe), Equals, true)
+
+	// Errors from the database are not.
+	_, err = cachedDB.PrepareContext(ctx, "SELECT &Person.* FROM missing", Person{})
+	c.Assert(err, ErrorMatches, "cannot prepare statement on database: no such table: missing")
+	c.Check(errors.As(err, &pe), Equals, false)
+
+	// A done context stops the statement being prepared.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = cachedDB.PrepareContext(cancelled, "SELECT &Person.* FROM person", Person{})
+	c.Assert(err, ErrorMatches, "cannot prepare statement: context canceled")
+	c.Check(errors.Is(err, context.Canceled), Equals, true)
+	c.Check(errors.As(err, &pe), Equals, false)
+
+	// Without the cache nothing is prepared on the database.
+	stmt, err = db.PrepareContext(ctx, "SELECT &Person.* FROM missing", Person{})
+	c.Assert(err, IsNil)
+	c.Check(sqlair.CachedStmtSQL(db), HasLen, 0)
+}
+
+func (s *PackageSuite) TestStmtCacheEviction(c *C) {
+	// A database file is used so that queries can run on several
+	// connections while rows are being read.
+	sqldb, err := sql.Open("sqlite3", filepath.Join(c.MkDir(), "test.db"))
+	c.Assert(err, IsNil)
+	cachedDB := sqlair.NewDB(sqldb, sqlair.WithStmtCache())
+	_, err = cachedDB.Exec(nil, "CREATE TABLE person (name text, id integer, address_id integer, email text)")
+	c.Assert(err, IsNil)
+	for _, p := range []Person{mark, fred, dave, mary} {
+		_, err = cachedDB.Exec(nil, "INSERT INTO person (*) VALUES ($Person.*)", p)
+		c.Assert(err, IsNil)
+	}
+
+	all := sqlair.MustPrepare("SELECT &Person.* FROM person ORDER BY id", Person{})
+	iter := cachedDB.Query(nil, all).Iter()
+	c.Assert(iter.Next(), Equals, true)
+	var p Person
+	c.Assert(iter.Get(&p), IsNil)
+	c.Check(p, Equals, mark)
+
+	// The least recently used statements are evicted once the cache is
+	// full.
+	for i := 0; i < 300; i++ {
+		stmt := sqlair.MustPrepare(fmt.Sprintf("SELECT &Person.* FROM person WHERE id = %d", 1000+i), Person{})
+		err := cachedDB.Query(nil, stmt).Get(&Person{})
+		c.Assert(errors.Is(err, sqlair.ErrNoRows), Equals, true)
+	}
+	cached := sqlair.CachedStmtSQL(cachedDB)
+	c.Check(cached, HasLen, 256)
+	for _, sql := range cached {
+		c.Check(sql, Not(Equals), "SELECT address_id AS _sqlair_0, id AS _sqlair_1, name AS _sqlair_2 FROM person ORDER BY id")
+	}
+
+	// Closing an evicted statement does not affect the rows read with it.
+	var people []Person
+	for iter.Next() {
+		c.Assert(iter.Get(&p), IsNil)
+		people = append(people, p)
+	}
+	c.Assert(iter.Close(), IsNil)
+	c.Check(people, DeepEquals, []Person{fred, dave, mary})
+
+	// Closing the DB closes the cached statements.
+	c.Assert(cachedDB.Close(), IsNil)
+	c.Check(sqlair.CachedStmtSQL(cachedDB), HasLen, 0)
+	err = cachedDB.Query(nil, all).GetAll(&people)
+	c.Check(err, ErrorMatches, "sql: database is closed")
+}
+
+func (s *PackageSuite) TestGetAllMaxRows(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	stmt := sqlair.MustPrepare("SELECT &Person.* FROM person ORDER BY id", Person{})
+
+	// Results within the limit are read as usual.
+	var people []Person
+	c.Assert(db.Query(nil, stmt).GetAll(&people, sqlair.MaxRows(len(allPeople))), IsNil)
+	c.Check(people, HasLen, len(allPeople))
+
+	// Results over the limit are an error and the slice is left unchanged.
+	people = nil
+	err = db.Query(nil, stmt).GetAll(&people, sqlair.MaxRows(2))
+	c.Assert(err, ErrorMatches, "too many rows: query returned more than 2 rows")
+	c.Check(errors.Is(err, sqlair.ErrTooManyRows), Equals, true)
+	c.Check(people, IsNil)
+
+	// An error closing the results is returned alongside.
+	rc := &recordingConnector{resultSets: []resultSet{{
+		columns: []string{"_sqlair_0", "_sqlair_1", "_sqlair_2"},
+		rows:    [][]driver.Value{{int64(1000), int64(30), "Fred"}, {int64(1500), int64(20), "Mark"}},
+	}}, closeErr: errors.New("connection lost")}
+	err = sqlair.NewDB(sql.OpenDB(rc)).Query(nil, stmt).GetAll(&people, sqlair.MaxRows(1))
+	c.Assert(err, ErrorMatches, "too many rows: query returned more than 1 rows, and cannot close results: connection lost")
+	c.Check(errors.Is(err, sqlair.ErrTooManyRows), Equals, true)
+
+	// Or they can be truncated, the option can come before the Outcome.
+	var outcome sqlair.Outcome
+	var ids []int
+	idStmt := sqlair.MustPrepare("SELECT &Person.id FROM person ORDER BY id", Person{})
+	c.Assert(db.Query(nil, idStmt).GetAll(sqlair.TruncateRows(), &outcome, &ids, sqlair.MaxRows(2)), IsNil)
+	c.Check(ids, DeepEquals, []int{20, 30})
+	c.Check(outcome.Result(), IsNil)
+
+	// A limit of zero is no limit.
+	people = nil
+	c.Assert(db.Query(nil, stmt).GetAll(&people, sqlair.MaxRows(0)), IsNil)
+	c.Check(people, HasLen, len(allPeople))
+
+	// No rows is still ErrNoRows.
+	err = db.Query(nil, sqlair.MustPrepare("SELECT &Person.* FROM person WHERE id = 0", Person{})).GetAll(&people, sqlair.MaxRows(1))
+	c.Check(errors.Is(err, sqlair.ErrNoRows), Equals, true)
+}
+
+func (s *PackageSuite) TestForEachInto(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	stmt := sqlair.MustPrepare("SELECT &Person.* FROM person ORDER BY id", Person{})
+	var p Person
+	var people []Person
+	err = db.Query(nil, stmt).ForEachInto(&p, func() error {
+		people = append(people, p)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Check(people, DeepEquals, []Person{mark, fred, dave, mary})
+	c.Check(db.PlainDB().Stats().InUse, Equals, 0)
+
+	// Iteration stops at the first error returned by the callback, and the
+	// results are closed.
+	errStop := errors.New("stop")
+	calls := 0
+	err = db.Query(nil, stmt).ForEachInto(&p, func() error {
+		calls++
+		if p.ID == fred.ID {
+			return errStop
+		}
+		return nil
+	})
+	c.Assert(errors.Is(err, errStop), Equals, true)
+	c.Check(calls, Equals, 2)
+	c.Check(db.PlainDB().Stats().InUse, Equals, 0)
+
+	// Maps can be decoded into, and no rows is not an error.
+	m := sqlair.M{}
+	mapStmt := sqlair.MustPrepare("SELECT name AS &M.name FROM person WHERE id > $M.id", sqlair.M{})
+	err = db.Query(nil, mapStmt, sqlair.M{"id": 100}).ForEachInto(m, func() error {
+		c.Fatalf("unexpected row")
+		return nil
+	})
+	c.Assert(err, IsNil)
+
+	// Errors decoding a row are returned.
+	err = db.Query(nil, stmt).ForEachInto(&Address{}, func() error { return nil })
+	c.Assert(err, ErrorMatches, `cannot get result: parameter with type "Person" missing \(have "Address"\)`)
+	c.Check(db.PlainDB().Stats().InUse, Equals, 0)
+	err = db.Query(nil, sqlair.MustPrepare("SELECT * FROM person")).ForEachInto(&p, func() error { return nil })
+	c.Assert(err, ErrorMatches, `output variables provided but not referenced in query, .*`)
+}
+
+func (s *PackageSuite) TestReservedMarkerPrefix(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	// An alias that collides with the output marker columns would be read
+	// into the output in place of its column.
+	_, err = sqlair.Prepare("SELECT id AS _sqlair_0, &Person.name FROM person", Person{})
+	c.Assert(err, ErrorMatches, `cannot prepare statement: column alias "_sqlair_0" uses reserved prefix _sqlair_`)
+
+	// The prefix can appear in string literals, comments and other names.
+	stmt, err := sqlair.Prepare(`
+		SELECT &Person.name, id AS my_sqlair_0 FROM person -- _sqlair_1
+		WHERE name <> '_sqlair_2' AND id = $Person.id`, Person{})
+	c.Assert(err, IsNil)
+	var p Person
+	c.Assert(db.Query(nil, stmt, fred).Get(&p), IsNil)
+	c.Check(p.Name, Equals, "Fred")
+}
+
+func (s *PackageSuite) TestJSONTagOption(c *C) {
+	type Settings struct {
+		Theme  string   `json:"theme"`
+		Labels []string `json:"labels"`
+	}
+	type Account struct {
+		ID       int       `db:"id"`
+		Settings Settings  `db:"settings,json"`
+		Extra    *Settings `db:"extra,json"`
+	}
+	db, err := createTableDB(c, "account", "id integer, settings text, extra text")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "account")
+
+	account := Account{ID: 1, Settings: Settings{Theme: "dark", Labels: []string{"a", "b"}}}
+	insertStmt := sqlair.MustPrepare("INSERT INTO account (*) VALUES ($Account.*)", Account{})
+	c.Assert(db.Query(nil, insertStmt, account).Run(), IsNil)
+
+	// The field is stored as JSON text and a nil pointer as NULL.
+	rawStmt := sqlair.MustPrepare("SELECT (settings, extra) AS (&M.*) FROM account", sqlair.M{})
+	m := sqlair.M{}
+	c.Assert(db.Query(nil, rawStmt).Get(m), IsNil)
+	c.Check(m["settings"], Equals, `{"theme":"dark","labels":["a","b"]}`)
+	c.Check(m["extra"], IsNil)
+
+	selectStmt := sqlair.MustPrepare("SELECT &Account.* FROM account", Account{})
+	got := Account{Extra: &Settings{Theme: "light"}}
+	c.Assert(db.Query(nil, selectStmt).Get(&got), IsNil)
+	c.Check(got, DeepEquals, account)
+
+	// Invalid JSON in the column is reported when scanning.
+	updateStmt := sqlair.MustPrepare("UPDATE account SET extra = 'not json'")
+	c.Assert(db.Query(nil, updateStmt).Run(), IsNil)
+	err = db.Query(nil, selectStmt).Get(&got)
+	c.Assert(err, ErrorMatches, `.*cannot decode tag "extra" of struct "Account" from JSON: invalid character .*`)
+}
+
+func (s *PackageSuite) TestJSONTagOptionNullsAndOmitEmpty(c *C) {
+	type Settings struct {
+		Theme string `json:"theme"`
+	}
+	type Record struct {
+		ID       int            `db:"id"`
+		Tags     []string       `db:"tags,json"`
+		Meta     map[string]int `db:"meta,json"`
+		Plain    Settings       `db:"plain,json"`
+		Settings Settings       `db:"settings,json,omitempty"`
+	}
+	db, err := createTableDB(c, "record", "id integer, tags text, meta text, plain text, settings text DEFAULT '{\"theme\":\"default\"}'")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "record")
+
+	// Nil slices and maps are stored as NULL and a zero struct as JSON. A
+	// zero struct with omitempty is left out so the column default is used.
+	insertStmt := sqlair.MustPrepare("INSERT INTO record (*) VALUES ($Record.*)", Record{})
+	c.Assert(db.Query(nil, insertStmt, Record{ID: 1}).Run(), IsNil)
+	rawStmt := sqlair.MustPrepare("SELECT (tags, meta, plain, settings) AS (&M.*) FROM record WHERE id = 1", sqlair.M{})
+	m := sqlair.M{}
+	c.Assert(db.Query(nil, rawStmt).Get(m), IsNil)
+	c.Check(m, DeepEquals, sqlair.M{"tags": nil, "meta": nil, "plain": `{"theme":""}`, "settings": `{"theme":"default"}`})
+
+	// Empty slices and maps are stored as JSON.
+	c.Assert(db.Query(nil, insertStmt, Record{ID: 2, Tags: []string{}, Meta: map[string]int{}}).Run(), IsNil)
+
+	// A zero value with omitempty cannot be input explicitly.
+	explicitStmt := sqlair.MustPrepare("INSERT INTO record (id, settings) VALUES ($Record.id, $Record.settings)", Record{})
+	err = db.Query(nil, explicitStmt, Record{ID: 3}).Run()
+	c.Assert(err, ErrorMatches, `invalid input parameter: tag "settings" of struct "Record" has zero value and has the omitempty flag but the value is explicitly input`)
+
+	// NULL and empty columns are read as the zero value.
+	updateStmt := sqlair.MustPrepare("UPDATE record SET plain = '', settings = NULL WHERE id = 1")
+	c.Assert(db.Query(nil, updateStmt).Run(), IsNil)
+	selectStmt := sqlair.MustPrepare("SELECT &Record.* FROM record WHERE id = $Record.id", Record{})
+	got := Record{ID: 1, Tags: []string{"old"}, Meta: map[string]int{"old": 1}, Plain: Settings{"old"}, Settings: Settings{"old"}}
+	c.Assert(db.Query(nil, selectStmt, got).Get(&got), IsNil)
+	c.Check(got, DeepEquals, Record{ID: 1})
+
+	got = Record{ID: 2}
+	c.Assert(db.Query(nil, selectStmt, got).Get(&got), IsNil)
+	c.Check(got, DeepEquals, Record{ID: 2, Tags: []string{}, Meta: map[string]int{}, Settings: Settings{"default"}})
+}
+
+func (s *PackageSuite) TestJSONSliceFields(c *C) {
+	type Scores []int
+	type Item struct {
+		ID     int      `db:"id"`
+		Tags   []string `db:"tags,json"`
+		Scores Scores   `db:"scores,json"`
+	}
+	db, err := createTableDB(c, "item", "id integer, tags text, scores text")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "item")
+
+	items := []Item{
+		{ID: 1, Tags: []string{"red", "round"}, Scores: Scores{3, 5}},
+		{ID: 2, Tags: []string{"blue"}},
+	}
+	insertStmt := sqlair.MustPrepare("INSERT INTO item (*) VALUES ($Item.*)", Item{})
+	c.Assert(db.Query(nil, insertStmt, items).Run(), IsNil)
+
+	var got []Item
+	selectStmt := sqlair.MustPrepare("SELECT &Item.* FROM item ORDER BY id", Item{})
+	c.Assert(db.Query(nil, selectStmt).GetAll(&got), IsNil)
+	c.Check(got, DeepEquals, items)
+
+	// A slice field is a single JSON input while a slice argument is
+	// expanded in an IN clause.
+	matchStmt := sqlair.MustPrepare(`
+SELECT &Item.* FROM item
+WHERE tags = $Item.tags OR id IN ($S[:])`, Item{}, sqlair.S{})
+	_, params, err := matchStmt.Render(Item{Tags: []string{"blue"}}, sqlair.S{3, 4})
+	c.Assert(err, IsNil)
+	c.Check(params, DeepEquals, []any{sql.Named("sqlair_0", `["blue"]`), sql.Named("sqlair_1", 3), sql.Named("sqlair_2", 4)})
+	got = nil
+	c.Assert(db.Query(nil, matchStmt, Item{Tags: []string{"blue"}}, sqlair.S{1}).GetAll(&got), IsNil)
+	c.Check(got, DeepEquals, items)
+
+	// The elements of the JSON array can be queried in SQL.
+	var ids []int
+	elemStmt := sqlair.MustPrepare("SELECT item.id AS &M.id FROM item, json_each(item.tags) WHERE json_each.value = $M.tag", sqlair.M{})
+	c.Assert(db.Query(nil, elemStmt, sqlair.M{"tag": "round"}).GetAll(&ids), IsNil)
+	c.Check(ids, DeepEquals, []int{1})
+
+	// Without the json option a slice field cannot be scanned into.
+	type Plain struct {
+		ID   int      `db:"id"`
+		Tags []string `db:"tags"`
+	}
+	_, err = sqlair.Prepare("SELECT &Plain.* FROM item", Plain{})
+	c.Assert(err, ErrorMatches, `cannot prepare statement: output expression: cannot scan into tag "tags" of struct "Plain": slice type \[\]string is not a sql.Scanner, use the json option to store it as a JSON array: &Plain.\*`)
+}
+
+func (s *PackageSuite) TestMergeInto(c *C) {
+	db, err := createTableDB(c, "patch", "id integer, name text, nick text, note text, tags text, label text, alias text, colour text, count integer")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "patch")
+
+	type Patch struct {
+		ID        int            `db:"id"`
+		Name      string         `db:"name"`
+		Nick      *string        `db:"nick"`
+		Note      sql.NullString `db:"note"`
+		Tags      []string       `db:"tags,json"`
+		Untouched string         `db:"untouched"`
+		// Fields with the nullzero option, which read a NULL column as
+		// the zero value without MergeInto.
+		Label  string           `db:"label,nullzero"`
+		Alias  *string          `db:"alias,nullzero"`
+		Colour Colour           `db:"colour,nullzero"`
+		Count  ScannerValuerInt `db:"count,nullzero"`
+	}
+
+	insertNullsStmt := sqlair.MustPrepare("INSERT INTO patch (id) VALUES (1)")
+	c.Assert(db.Query(nil, insertNullsStmt).Run(), IsNil)
+	insertStmt := sqlair.MustPrepare("INSERT INTO patch (id, name, nick, note, tags, label, alias, colour, count) VALUES (2, 'new', 'newnick', 'newnote', '[\"b\"]', 'newlabel', 'newalias', 'red', 7)")
+	c.Assert(db.Query(nil, insertStmt).Run(), IsNil)
+
+	// The untouched column is not in the results.
+	selectStmt := sqlair.MustPrepare("SELECT (id, name, nick, note, tags, label, alias, colour, count) AS (&Patch.*) FROM patch WHERE id = $Patch.id", Patch{})
+
+	nick := "oldnick"
+	alias := "oldalias"
+	existing := func(id int) Patch {
+		return Patch{
+			ID:        id,
+			Name:      "old",
+			Nick:      &nick,
+			Note:      sql.NullString{String: "oldnote", Valid: true},
+			Tags:      []string{"a"},
+			Untouched: "untouched",
+			Label:     "oldlabel",
+			Alias:     &alias,
+			Colour:    Green,
+			Count:     ScannerValuerInt{F: 5},
+		}
+	}
+
+	// Without MergeInto, NULL columns zero non-pointer fields, set pointer
+	// fields to nil and are passed to sql.Scanner fields, unless they have
+	// the nullzero option, in which case they are zeroed. Absent columns
+	// leave the field unchanged.
+	p := existing(1)
+	c.Assert(db.Query(nil, selectStmt, p).Get(&p), IsNil)
+	c.Check(p, DeepEquals, Patch{ID: 1, Untouched: "untouched"})
+
+	// With MergeInto, NULL columns leave every kind of field unchanged,
+	// including plain, pointer and scanner fields with the nullzero option.
+	p = existing(1)
+	c.Assert(db.Query(nil, selectStmt, p, sqlair.MergeInto()).Get(&p), IsNil)
+	c.Check(p, DeepEquals, existing(1))
+	c.Check(p.Nick, Equals, &nick)
+	c.Check(p.Alias, Equals, &alias)
+
+	// Columns that are not NULL overwrite the fields.
+	p = existing(2)
+	c.Assert(db.Query(nil, selectStmt, p, sqlair.MergeInto()).Get(&p), IsNil)
+	newNick := "newnick"
+	newAlias := "newalias"
+	c.Check(p, DeepEquals, Patch{
+		ID:        2,
+		Name:      "new",
+		Nick:      &newNick,
+		Note:      sql.NullString{String: "newnote", Valid: true},
+		Tags:      []string{"b"},
+		Untouched: "untouched",
+		Label:     "newlabel",
+		Alias:     &newAlias,
+		Colour:    Red,
+		Count:     ScannerValuerInt{F: 7},
+	})
+	// The values pointed to by the old pointers are not written through.
+	c.Check(nick, Equals, "oldnick")
+	c.Check(alias, Equals, "oldalias")
+
+	// Map keys behave in the same way.
+	mapStmt := sqlair.MustPrepare("SELECT (name, nick) AS (&M.name, &M.nick) FROM patch WHERE id = $M.id", sqlair.M{})
+	m := sqlair.M{"id": 1, "name": "old"}
+	c.Assert(db.Query(nil, mapStmt, m, sqlair.MergeInto()).Get(m), IsNil)
+	c.Check(m, DeepEquals, sqlair.M{"id": 1, "name": "old"})
+	c.Assert(db.Query(nil, mapStmt, m).Get(m), IsNil)
+	c.Check(m, DeepEquals, sqlair.M{"id": 1, "name": nil, "nick": nil})
+	m = sqlair.M{"id": 2, "name": "old"}
+	c.Assert(db.Query(nil, mapStmt, m, sqlair.MergeInto()).Get(m), IsNil)
+	c.Check(m, DeepEquals, sqlair.M{"id": 2, "name": "new", "nick": "newnick"})
+}
+
+// recordingConnector is a database/sql connector for a driver that records
+// the SQL, query ID and context of each statement run on it, and the options
+// of each transaction begun on it. Queries return resultSets if it is set.
+type recordingConnector struct {
+	queries    []recordedQuery
+	ctxs       []context.Context
+	txOptions  []driver.TxOptions
+	resultSets []resultSet
+	// closeErr is returned when the rows of a result set are closed.
+	closeErr error
+}
+
+type recordedQuery struct {
+	sql     string
+	queryID string
+}
+
+func (rc *recordingConnector) Connect(context.Context) (driver.Conn, error) {
+	return &recordingConn{rc: rc}, nil
+}
+
+func (rc *recordingConnector) Driver() driver.Driver {
+	return nil
+}
+
+type recordingConn struct {
+	rc *recordingConnector
+}
+
+func (c *recordingConn) record(ctx context.Context, query string) {
+	id, _ := sqlair.QueryIDFromContext(ctx)
+	c.rc.queries = append(c.rc.queries, recordedQuery{sql: query, queryID: id})
+	c.rc.ctxs = append(c.rc.ctxs, ctx)
+}
+
+func (c *recordingConn) QueryContext(ctx context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.record(ctx, query)
+	if c.rc.resultSets != nil {
+		return &resultSetRows{sets: c.rc.resultSets, closeErr: c.rc.closeErr}, nil
+	}
+	return &emptyRows{}, nil
+}
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.record(ctx, query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *recordingConn) BeginTx(_ context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.rc.txOptions = append(c.rc.txOptions, opts)
+	return recordingTx{}, nil
+}
+
+type recordingTx struct{}
+
+func (recordingTx) Commit() error {
+	return nil
+}
+
+func (recordingTx) Rollback() error {
+	return nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string {
+	return []string{"_sqlair_0"}
+}
+
+func (emptyRows) Close() error {
+	return nil
+}
+
+func (emptyRows) Next([]driver.Value) error {
+	return io.EOF
+}
+
+// resultSet is a result set returned by a recordingConn.
+type resultSet struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+// resultSetRows are driver rows made up of several result sets.
+type resultSetRows struct {
+	sets     []resultSet
+	row      int
+	closeErr error
+}
+
+func (r *resultSetRows) Columns() []string {
+	return r.sets[0].columns
+}
+
+func (r *resultSetRows) Close() error {
+	return r.closeErr
+}
+
+func (r *resultSetRows) Next(dest []driver.Value) error {
+	if r.row >= len(r.sets[0].rows) {
+		return io.EOF
+	}
+	copy(dest, r.sets[0].rows[r.row])
+	r.row++
+	return nil
+}
+
+func (r *resultSetRows) HasNextResultSet() bool {
+	return len(r.sets) > 1
+}
+
+func (r *resultSetRows) NextResultSet() error {
+	if len(r.sets) <= 1 {
+		return io.EOF
+	}
+	r.sets = r.sets[1:]
+	r.row = 0
+	return nil
+}
+
+func (s *PackageSuite) TestQueryIDs(c *C) {
+	rc := &recordingConnector{}
+	selectStmt := sqlair.MustPrepare("SELECT &Person.name FROM person;", Person{})
+	updateStmt := sqlair.MustPrepare("UPDATE person SET name = 'Fred'")
+
+	// Queries have no ID by default.
+	db := sqlair.NewDB(sql.OpenDB(rc))
+	err := db.Query(nil, selectStmt).Get(&Person{})
+	c.Assert(err, Equals, sqlair.ErrNoRows)
+	c.Check(rc.queries[0], Equals, recordedQuery{sql: "SELECT name AS _sqlair_0 FROM person;"})
+
+	// An ID from the context is propagated to the driver and the errors.
+	rc.queries = nil
+	ctx := sqlair.ContextWithQueryID(context.Background(), "request-1")
+	err = db.Query(ctx, selectStmt).Get(&Person{})
+	c.Assert(err, ErrorMatches, "query request-1: sql: no rows in result set")
+	c.Check(errors.Is(err, sqlair.ErrNoRows), Equals, true)
+	var qe *sqlair.QueryError
+	c.Assert(errors.As(err, &qe), Equals, true)
+	c.Check(qe.QueryID, Equals, "request-1")
+	err = db.Query(ctx, updateStmt).Run()
+	c.Assert(err, IsNil)
+	c.Check(rc.queries, DeepEquals, []recordedQuery{
+		{sql: "SELECT name AS _sqlair_0 FROM person;", queryID: "request-1"},
+		{sql: "UPDATE person SET name = 'Fred'", queryID: "request-1"},
+	})
+
+	// The query option takes precedence over the context.
+	rc.queries = nil
+	err = db.Query(ctx, updateStmt, sqlair.WithQueryID("query-1")).Run()
+	c.Assert(err, IsNil)
+	c.Check(rc.queries, DeepEquals, []recordedQuery{{sql: "UPDATE person SET name = 'Fred'", queryID: "query-1"}})
+
+	// Errors from iteration are wrapped only once.
+	iter := db.Query(nil, selectStmt, sqlair.WithQueryID("query-2")).Iter()
+	c.Assert(iter.Get(&Person{}), ErrorMatches, "query query-2: cannot get result: cannot call Get before Next unless getting outcome")
+	c.Assert(iter.Close(), IsNil)
+	err = db.Query(nil, selectStmt, sqlair.WithQueryID("query-3")).GetAll(&[]Person{}, &[]Address{})
+	c.Assert(err, ErrorMatches, "query query-3: sql: no rows in result set")
+
+	// Generated IDs are unique and are appended to the SQL as a comment.
+	rc.queries = nil
+	db = sqlair.NewDB(sql.OpenDB(rc), sqlair.WithQueryIDs(), sqlair.WithQueryIDComments())
+	c.Assert(db.Query(nil, updateStmt).Run(), IsNil)
+	c.Assert(db.Query(nil, updateStmt).Run(), IsNil)
+	c.Assert(errors.Is(db.Query(nil, selectStmt).Get(&Person{}), sqlair.ErrNoRows), Equals, true)
+	c.Assert(rc.queries, HasLen, 3)
+	id1, id2 := rc.queries[0].queryID, rc.queries[1].queryID
+	c.Check(id1, Not(Equals), "")
+	c.Check(id1, Not(Equals), id2)
+	c.Check(rc.queries[0].sql, Equals, "UPDATE person SET name = 'Fred' /* sqlair_query_id: "+id1+" */")
+	c.Check(rc.queries[2].sql, Equals, "SELECT name AS _sqlair_0 FROM person /* sqlair_query_id: "+rc.queries[2].queryID+" */;")
+
+	// Query IDs cannot close the comment early.
+	rc.queries = nil
+	c.Assert(db.Query(nil, updateStmt, sqlair.WithQueryID("a */ DROP TABLE person; /*")).Run(), IsNil)
+	c.Check(rc.queries[0].sql, Equals, "UPDATE person SET name = 'Fred' /* sqlair_query_id: a * / DROP TABLE person; /* */")
+}
+
+func (s *PackageSuite) TestQueryIDCommentsSQLite(c *C) {
+	tables, sqlairDB, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, sqlairDB, tables...)
+
+	db := sqlair.NewDB(sqlairDB.PlainDB(), sqlair.WithQueryIDComments())
+	stmt := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE name = $Person.name;", Person{})
+	p := Person{}
+	err = db.Query(nil, stmt, fred, sqlair.WithQueryID("request-1")).Get(&p)
+	c.Assert(err, IsNil)
+	c.Check(p, Equals, fred)
+}
+
+func (s *PackageSuite) TestTracer(c *C) {
+	tables, sqlairDB, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, sqlairDB, tables...)
+
+	var infos []sqlair.QueryInfo
+	tracer := sqlair.TracerFunc(func(info sqlair.QueryInfo) {
+		infos = append(infos, info)
+	})
+	db := sqlair.NewDB(sqlairDB.PlainDB(), sqlair.WithTracer(tracer))
+
+	// A query with outputs reports the rows read.
+	var people []Person
+	selectStmt := sqlair.MustPrepare("SELECT &Person.* FROM person", Person{})
+	c.Assert(db.Query(nil, selectStmt, sqlair.WithQueryID("query-1")).GetAll(&people), IsNil)
+	c.Assert(infos, HasLen, 1)
+	c.Check(infos[0].SQL, Equals, "SELECT address_id AS _sqlair_0, id AS _sqlair_1, name AS _sqlair_2 FROM person")
+	c.Check(infos[0].QueryID, Equals, "query-1")
+	c.Check(infos[0].Rows, Equals, int64(len(allPeople)))
+	c.Check(infos[0].Err, IsNil)
+	c.Check(infos[0].Start.IsZero(), Equals, false)
+	c.Check(infos[0].Duration > 0, Equals, true)
+
+	// A query without outputs reports the rows affected.
+	updateStmt := sqlair.MustPrepare("UPDATE person SET name = 'Joe' WHERE id > $Person.id", Person{})
+	c.Assert(db.Query(nil, updateStmt, Person{ID: 30}).Run(), IsNil)
+	c.Assert(infos, HasLen, 2)
+	c.Check(infos[1].Rows, Equals, int64(2))
+
+	// No rows is not an error of the query.
+	getStmt := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE id = $Person.id", Person{})
+	c.Assert(db.Query(nil, getStmt, Person{ID: 999}).Get(&Person{}), Equals, sqlair.ErrNoRows)
+	c.Assert(infos, HasLen, 3)
+	c.Check(infos[2].Rows, Equals, int64(0))
+	c.Check(infos[2].Err, IsNil)
+
+	// Errors from the database and from decoding the results are reported.
+	badStmt := sqlair.MustPrepare("SELECT &Person.* FROM no_such_table", Person{})
+	c.Assert(db.Query(nil, badStmt).Get(&Person{}), ErrorMatches, "no such table: no_such_table")
+	c.Assert(infos, HasLen, 4)
+	c.Check(infos[3].Err, ErrorMatches, "no such table: no_such_table")
+	err = db.Query(nil, selectStmt).Get(&Address{})
+	c.Assert(err, NotNil)
+	c.Assert(infos, HasLen, 5)
+	c.Check(infos[4].Err, Equals, err)
+
+	// Queries that are not sent to the database are not traced.
+	c.Assert(db.Query(nil, getStmt).Get(&Person{}), NotNil)
+	c.Check(infos, HasLen, 5)
+
+	// Queries in transactions and on an Iterator are traced once closed.
+	tx, err := db.Begin(nil, nil)
+	c.Assert(err, IsNil)
+	iter := tx.Query(nil, selectStmt).Iter()
+	c.Assert(iter.Next(), Equals, true)
+	c.Check(infos, HasLen, 5)
+	c.Assert(iter.Close(), IsNil)
+	c.Assert(iter.Close(), IsNil)
+	c.Assert(tx.Commit(), IsNil)
+	c.Assert(infos, HasLen, 6)
+	c.Check(infos[5].Rows, Equals, int64(1))
+}
+
+func (s *PackageSuite) TestTrailingSemicolonAndComments(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	// The query is run in the same way with or without the semicolon and
+	// comments, including when a query ID comment is added.
+	commentDB := sqlair.NewDB(db.PlainDB(), sqlair.WithQueryIDComments())
+	for _, query := range []string{
+		"SELECT &Person.* FROM person WHERE name = $Person.name",
+		"SELECT &Person.* FROM person WHERE name = $Person.name;",
+		"SELECT &Person.* FROM person WHERE name = $Person.name; -- get fred",
+		"SELECT &Person.* FROM person WHERE name = $Person.name;\n/* get fred */\n",
+	} {
+		stmt, err := sqlair.Prepare(query, Person{})
+		c.Assert(err, IsNil)
+		p := Person{}
+		c.Assert(db.Query(nil, stmt, fred).Get(&p), IsNil)
+		c.Check(p, Equals, fred)
+		p = Person{}
+		c.Assert(commentDB.Query(nil, stmt, fred, sqlair.WithQueryID("request-1")).Get(&p), IsNil)
+		c.Check(p, Equals, fred)
+	}
+
+	_, err = sqlair.Prepare("SELECT &Person.* FROM person; DELETE FROM person", Person{})
+	c.Assert(err, ErrorMatches, "cannot parse expression: column 29: multiple statements are not supported")
+
+	// Semicolons inside the body of a single statement do not end it.
+	trigger := sqlair.MustPrepare("-- audit\nCREATE TRIGGER person_audit AFTER DELETE ON person BEGIN DELETE FROM address WHERE id = old.address_id; END;")
+	c.Assert(db.Query(nil, trigger).Run(), IsNil)
+	defer func() {
+		c.Assert(db.Query(nil, sqlair.MustPrepare("DROP TRIGGER person_audit")).Run(), IsNil)
+	}()
+	for _, query := range []string{
+		"CREATE OR REPLACE TRIGGER t AFTER INSERT ON person BEGIN SELECT 1; END;",
+		"CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END",
+	} {
+		_, err = sqlair.Prepare(query)
+		c.Check(err, IsNil)
+	}
+}
+
+func (s *PackageSuite) TestInputsAdjacentToOperators(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	stmt := sqlair.MustPrepare(`SELECT &Person.* FROM person WHERE name LIKE $M.prefix||'%' AND id+$M.offset=$M.id`, Person{}, sqlair.M{})
+	p := Person{}
+	err = db.Query(nil, stmt, sqlair.M{"prefix": "Fr", "offset": 5, "id": 35}).Get(&p)
+	c.Assert(err, IsNil)
+	c.Check(p, Equals, fred)
+}
+
+func (s *PackageSuite) TestFunctionCallIntoMapAsterisk(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	// The key is the name of the column reported by the database.
+	stmt := sqlair.MustPrepare("SELECT count(*) AS &M.*, max(id) AS &M.* FROM person", sqlair.M{})
+	m := sqlair.M{}
+	err = db.Query(nil, stmt).Get(m)
+	c.Assert(err, IsNil)
+	c.Check(m, DeepEquals, sqlair.M{"count(*)": int64(4), "max(id)": int64(40)})
+
+	stmt = sqlair.MustPrepare("SELECT &Person.name, count(*) AS &M.* FROM person GROUP BY name ORDER BY name", Person{}, sqlair.M{})
+	var people []Person
+	var counts []sqlair.M
+	err = db.Query(nil, stmt).GetAll(&people, &counts)
+	c.Assert(err, IsNil)
+	c.Check(people, HasLen, 4)
+	c.Check(counts[0], DeepEquals, sqlair.M{"count(*)": int64(1)})
+}
+
+func (s *PackageSuite) TestAllColumnsIntoMap(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	stmt := sqlair.MustPrepare("SELECT &M.* FROM person WHERE id = $Person.id", sqlair.M{}, Person{})
+	m := sqlair.M{}
+	c.Assert(db.Query(nil, stmt, fred).Get(m), IsNil)
+	c.Check(m, DeepEquals, sqlair.M{"name": "Fred", "id": int64(30), "address_id": int64(1000), "email": nil})
+
+	// The columns of a table can be read alongside other outputs.
+	type Row map[string]string
+	stmt = sqlair.MustPrepare(`
+		SELECT p.id AS &Person.id, a.* AS &Row.*, p.name AS &M.name
+		FROM person p JOIN address a ON p.address_id = a.id
+		ORDER BY p.id`, Person{}, Row{}, sqlair.M{})
+	var people []Person
+	var rows []Row
+	var names []sqlair.M
+	c.Assert(db.Query(nil, stmt).GetAll(&people, &rows, &names), IsNil)
+	c.Check(people, DeepEquals, []Person{{ID: 20}, {ID: 30}, {ID: 40}})
+	c.Check(rows, DeepEquals, []Row{
+		{"id": "1500", "district": "Sad World", "street": "Church Road"},
+		{"id": "1000", "district": "Happy Land", "street": "Main Street"},
+		{"id": "3500", "district": "Ambivalent Commons", "street": "Station Lane"},
+	})
+	c.Check(names, DeepEquals, []sqlair.M{{"name": "Mark"}, {"name": "Fred"}, {"name": "Mary"}})
+
+	// A column name cannot be stored in the map twice.
+	stmt = sqlair.MustPrepare("SELECT &M.* FROM person p JOIN address a ON p.address_id = a.id", sqlair.M{})
+	err = db.Query(nil, stmt).Get(sqlair.M{})
+	c.Assert(err, ErrorMatches, `cannot get result: cannot read result column "id" into column "\*" of map "M" more than once, select the columns of one table`)
+}
+
+func (s *PackageSuite) TestReturningIntoMap(c *C) {
+	db, err := createTableDB(c, "account", "id integer PRIMARY KEY AUTOINCREMENT, name text, status text DEFAULT 'new', name_length integer GENERATED ALWAYS AS (length(name)), audited integer")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "account")
+
+	type Account struct {
+		Name string `db:"name"`
+	}
+
+	// Every returned column is stored at the name reported by the database,
+	// including those assigned by the database.
+	insertStmt := sqlair.MustPrepare("INSERT INTO account (name) VALUES ($Account.name) RETURNING &M.*", Account{}, sqlair.M{})
+	m := sqlair.M{}
+	c.Assert(db.Query(nil, insertStmt, Account{Name: "Ann"}).Get(m), IsNil)
+	c.Check(m, DeepEquals, sqlair.M{"id": int64(1), "name": "Ann", "status": "new", "name_length": int64(3), "audited": nil})
+
+	// A bulk insert returns a map for each row.
+	var rows []sqlair.M
+	c.Assert(db.Query(nil, insertStmt, []Account{{Name: "Bob"}, {Name: "Cleo"}}).GetAll(&rows), IsNil)
+	c.Check(rows, DeepEquals, []sqlair.M{
+		{"id": int64(2), "name": "Bob", "status": "new", "name_length": int64(3), "audited": nil},
+		{"id": int64(3), "name": "Cleo", "status": "new", "name_length": int64(4), "audited": nil},
+	})
+
+	// The map can be read alongside other outputs, and from an UPDATE.
+	updateStmt := sqlair.MustPrepare("UPDATE account SET audited = 1 WHERE id = $M.id RETURNING &Account.name, &M.*", Account{}, sqlair.M{})
+	var a Account
+	m = sqlair.M{}
+	c.Assert(db.Query(nil, updateStmt, sqlair.M{"id": 2}).Get(&a, m), IsNil)
+	c.Check(a, Equals, Account{Name: "Bob"})
+	c.Check(m["audited"], Equals, int64(1))
+	c.Check(m, HasLen, 5)
+}
+
+func (s *PackageSuite) TestGetStructAndMap(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	stmt := sqlair.MustPrepare(`
+		SELECT p.* AS &Person.*, count(a.id) AS &M.total, a.street AS &M.street
+		FROM person p LEFT JOIN address a ON p.address_id = a.id
+		WHERE p.id = $Person.id GROUP BY p.id`, Person{}, sqlair.M{})
+
+	// The arguments can be passed in any order.
+	var p Person
+	m := sqlair.M{}
+	c.Assert(db.Query(nil, stmt, fred).Get(&p, m), IsNil)
+	c.Check(p, Equals, fred)
+	c.Check(m, DeepEquals, sqlair.M{"total": int64(1), "street": "Main Street"})
+	p = Person{}
+	var mp sqlair.M
+	c.Assert(db.Query(nil, stmt, dave).Get(&mp, &p), IsNil)
+	c.Check(p, Equals, dave)
+	c.Check(mp, DeepEquals, sqlair.M{"total": int64(0), "street": nil})
+
+	var people []Person
+	var ms []sqlair.M
+	c.Assert(db.Query(nil, stmt, mark).GetAll(&ms, &people), IsNil)
+	c.Check(people, DeepEquals, []Person{mark})
+	c.Check(ms, DeepEquals, []sqlair.M{{"total": int64(1), "street": "Church Road"}})
+
+	// Both the struct and the map must be passed, and only once.
+	err = db.Query(nil, stmt, fred).Get(&p)
+	c.Assert(err, ErrorMatches, `cannot get result: parameter with type "M" missing \(have "Person"\)`)
+	err = db.Query(nil, stmt, fred).Get(&p, m, sqlair.M{})
+	c.Assert(err, ErrorMatches, `cannot get result: type "M" provided more than once`)
+}
+
+func (s *PackageSuite) TestStatementInputsAndOutputs(c *C) {
+	personType := reflect.TypeOf(Person{})
+	addressType := reflect.TypeOf(Address{})
+	mType := reflect.TypeOf(sqlair.M{})
+	sType := reflect.TypeOf(sqlair.S{})
+
+	stmt := sqlair.MustPrepare(`
+SELECT p.* AS &Person.*, a.district AS &Address.district, count(*) AS &M.*
+FROM person AS p JOIN address AS a ON p.address_id = a.id
+WHERE p.name = $Person.name AND a.id IN ($S[:]) AND p.id = $M.id AND p.name != $Person.name`,
+		Person{}, Address{}, sqlair.M{}, sqlair.S{})
+	c.Check(stmt.Inputs(), DeepEquals, []sqlair.TypeRef{
+		{Type: personType, Member: "name"},
+		{Type: sType, Member: ""},
+		{Type: mType, Member: "id"},
+	})
+	c.Check(stmt.Outputs(), DeepEquals, []sqlair.TypeRef{
+		{Type: personType, Member: "address_id"},
+		{Type: personType, Member: "id"},
+		{Type: personType, Member: "name"},
+		{Type: addressType, Member: "district"},
+		{Type: mType, Member: ""},
+	})
+
+	stmt = sqlair.MustPrepare("INSERT INTO person (name, id, address_id) VALUES ($Person.name, $Person.id, 7)", Person{})
+	c.Check(stmt.Inputs(), DeepEquals, []sqlair.TypeRef{
+		{Type: personType, Member: "name"},
+		{Type: personType, Member: "id"},
+	})
+	c.Check(stmt.Outputs(), HasLen, 0)
+}
+
+func (s *PackageSuite) TestCompoundSelectSameOutputs(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	// The result columns of a compound SELECT are named by the first SELECT so
+	// only its outputs are scanned into.
+	stmt := sqlair.MustPrepare(`
+WITH low AS (SELECT id FROM person WHERE id < $Person.id)
+SELECT &Person.* FROM person WHERE id IN (SELECT id FROM low)
+UNION
+SELECT &Person.* FROM person WHERE name = $Person.name
+ORDER BY id`, Person{})
+	c.Check(stmt.Outputs(), HasLen, 3)
+
+	var people []Person
+	err = db.Query(nil, stmt, Person{ID: 35, Name: "Mary"}).GetAll(&people)
+	c.Assert(err, IsNil)
+	c.Check(people, DeepEquals, []Person{mark, fred, mary})
+}
+
+func (s *PackageSuite) TestQueryWithTimeout(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	stmt := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE id = $Person.id", Person{})
+	p := Person{}
+	err = db.Query(nil, stmt, fred).WithTimeout(time.Minute).Get(&p)
+	c.Assert(err, IsNil)
+	c.Check(p, Equals, fred)
+
+	err = db.Query(nil, stmt, fred).WithTimeout(time.Nanosecond).Get(&p)
+	c.Assert(errors.Is(err, context.DeadlineExceeded), Equals, true, Commentf("err: %v", err))
+
+	// The derived context is cancelled once the results have been read.
+	rc := &recordingConnector{}
+	recDB := sqlair.NewDB(sql.OpenDB(rc))
+	iter := recDB.Query(nil, stmt, fred).WithTimeout(time.Minute).Iter()
+	c.Assert(rc.ctxs, HasLen, 1)
+	_, ok := rc.ctxs[0].Deadline()
+	c.Check(ok, Equals, true)
+	c.Check(rc.ctxs[0].Err(), IsNil)
+	c.Assert(iter.Close(), IsNil)
+	c.Check(rc.ctxs[0].Err(), Equals, context.Canceled)
+
+	updateStmt := sqlair.MustPrepare("UPDATE person SET name = 'Fred'")
+	err = recDB.Query(nil, updateStmt).WithTimeout(time.Minute).Run()
+	c.Assert(err, IsNil)
+	c.Assert(rc.ctxs, HasLen, 2)
+	c.Check(rc.ctxs[1].Err(), Equals, context.Canceled)
+
+	var people []Person
+	err = recDB.Query(nil, stmt, fred).WithTimeout(time.Minute).GetAll(&people)
+	c.Assert(err, Equals, sqlair.ErrNoRows)
+	c.Assert(rc.ctxs, HasLen, 3)
+	c.Check(rc.ctxs[2].Err(), Equals, context.Canceled)
+}
+
+func (s *PackageSuite) TestFieldNames(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	type Resident struct {
+		ID        int `db:"id"`
+		Name      string
+		AddressID int
+	}
+	_, err = sqlair.Prepare("SELECT &Resident.* FROM person WHERE name = $Resident.name", Resident{})
+	c.Assert(err, ErrorMatches, `cannot prepare statement: input expression: type "Resident" has no "name" db tag: \$Resident.name`)
+
+	stmt, err := sqlair.Prepare("SELECT &Resident.* FROM person WHERE name = $Resident.name", Resident{}, sqlair.FieldNames())
+	c.Assert(err, IsNil)
+	var r Resident
+	c.Assert(db.Query(nil, stmt, Resident{Name: "Fred"}).Get(&r), IsNil)
+	c.Check(r, Equals, Resident{ID: 30, Name: "Fred", AddressID: 1000})
+
+	type Clash struct {
+		Name     string
+		Nickname string `db:"name"`
+	}
+	_, err = sqlair.Prepare("SELECT &Clash.* FROM person", Clash{}, sqlair.FieldNames())
+	c.Assert(err, ErrorMatches, `cannot prepare statement: name "name" of field "Name" collides with db tag of field "Nickname" of struct "Clash"`)
+}
+
+func (s *PackageSuite) TestUntaggedFieldsDB(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	type Resident struct {
+		ID        int `db:"id"`
+		Name      string
+		AddressID int
+	}
+	untaggedDB := sqlair.NewDB(db.PlainDB(), sqlair.WithUntaggedFields())
+
+	// Statements prepared by the DB include the untagged fields.
+	var r Resident
+	c.Assert(untaggedDB.Get(nil, &r, "SELECT &Resident.* FROM person WHERE name = $Resident.name", Resident{Name: "Fred"}), IsNil)
+	c.Check(r, Equals, Resident{ID: 30, Name: "Fred", AddressID: 1000})
+	stmt, err := untaggedDB.PrepareContext(nil, "SELECT &Resident.* FROM person WHERE address_id = $Resident.address_id", Resident{})
+	c.Assert(err, IsNil)
+	var residents []Resident
+	c.Assert(untaggedDB.Query(nil, stmt, Resident{AddressID: 1500}).GetAll(&residents), IsNil)
+	c.Check(residents, DeepEquals, []Resident{{ID: 20, Name: "Mark", AddressID: 1500}})
+
+	// Tagged fields are unchanged.
+	var p Person
+	c.Assert(untaggedDB.Get(nil, &p, "SELECT &Person.* FROM person WHERE id = $Person.id", Person{ID: 30}), IsNil)
+	c.Check(p, Equals, fred)
+
+	// Without the option the fields are only included in statements
+	// prepared with FieldNames, which are cached separately.
+	query := "SELECT &Resident.* FROM person WHERE name = $Resident.name"
+	r = Resident{}
+	c.Assert(db.Get(nil, &r, query, Resident{Name: "Fred"}, sqlair.FieldNames()), IsNil)
+	c.Check(r, Equals, Resident{ID: 30, Name: "Fred", AddressID: 1000})
+	err = db.Get(nil, &r, query, Resident{Name: "Fred"})
+	c.Assert(err, ErrorMatches, `cannot prepare statement: input expression: type "Resident" has no "name" db tag: \$Resident.name`)
+}
+
+func (s *PackageSuite) TestRegisterType(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+	defer sqlair.ResetRegisteredTypes()
+
+	c.Assert(sqlair.RegisterType(Person{}, Address{}), IsNil)
+	stmt, err := sqlair.Prepare("SELECT p.* AS &Person.*, a.* AS &Address.* FROM person AS p JOIN address AS a ON p.address_id = a.id WHERE p.id = $Person.id")
+	c.Assert(err, IsNil)
+	p, a := Person{}, Address{}
+	c.Assert(db.Query(nil, stmt, fred).Get(&p, &a), IsNil)
+	c.Check(p, Equals, fred)
+	c.Check(a, Equals, mainStreet)
+
+	// Type samples passed to Prepare are used alongside registered types.
+	stmt, err = sqlair.Prepare("SELECT &Person.* FROM person WHERE name = $M.name", sqlair.M{})
+	c.Assert(err, IsNil)
+	c.Assert(db.Query(nil, stmt, sqlair.M{"name": "Fred"}).Get(&p), IsNil)
+	c.Check(p, Equals, fred)
+
+	err = sqlair.RegisterType(sqlair.Named("Person", Manager{}))
+	c.Assert(err, ErrorMatches, `cannot register types: cannot register type "sqlair_test.Manager" with name "Person", type "sqlair_test.Person" is registered with the same name`)
+}
+
+func (s *PackageSuite) TestNextResultSet(c *C) {
+	_, err := sqlair.Prepare("SELECT &Person.* FROM person; SELECT &Address.* FROM address", Person{}, Address{})
+	c.Assert(err, ErrorMatches, "cannot parse expression: column 29: multiple statements are not supported")
+
+	stmt, err := sqlair.Prepare("SELECT &Person.* FROM person; SELECT &Address.* FROM address", Person{}, Address{}, sqlair.MultipleStatements())
+	c.Assert(err, IsNil)
+
+	rc := &recordingConnector{resultSets: []resultSet{{
+		columns: []string{"_sqlair_0", "_sqlair_1", "_sqlair_2"},
+		rows:    [][]driver.Value{{int64(1000), int64(30), "Fred"}, {int64(1500), int64(20), "Mark"}},
+	}, {
+		columns: []string{"_sqlair_3", "_sqlair_4", "_sqlair_5"},
+		rows:    [][]driver.Value{{"Happy Land", int64(1000), "Main Street"}},
+	}}}
+	db := sqlair.NewDB(sql.OpenDB(rc))
+	iter := db.Query(nil, stmt).Iter()
+	var people []Person
+	for iter.Next() {
+		p := Person{}
+		c.Assert(iter.Get(&p), IsNil)
+		people = append(people, p)
+	}
+	c.Check(people, DeepEquals, []Person{fred, mark})
+
+	// The outputs of the first statement are not in the next result set.
+	c.Assert(iter.NextResultSet(), Equals, true)
+	c.Assert(iter.Next(), Equals, true)
+	c.Check(iter.Get(&Person{}), ErrorMatches, `cannot get result: parameter with type "Address" missing \(have "Person"\)`)
+	a := Address{}
+	c.Assert(iter.Get(&a), IsNil)
+	c.Check(a, Equals, Address{ID: 1000, District: "Happy Land", Street: "Main Street"})
+	c.Check(iter.Next(), Equals, false)
+
+	c.Check(iter.NextResultSet(), Equals, false)
+	c.Assert(iter.Close(), IsNil)
+
+	// Buffered queries keep every result set.
+	iter = db.Query(nil, stmt, sqlair.Buffered()).Iter()
+	people = nil
+	for iter.Next() {
+		p := Person{}
+		c.Assert(iter.Get(&p), IsNil)
+		people = append(people, p)
+	}
+	c.Check(people, DeepEquals, []Person{fred, mark})
+	c.Assert(iter.NextResultSet(), Equals, true)
+	c.Assert(iter.Next(), Equals, true)
+	a = Address{}
+	c.Assert(iter.Get(&a), IsNil)
+	c.Check(a, Equals, Address{ID: 1000, District: "Happy Land", Street: "Main Street"})
+	c.Check(iter.Next(), Equals, false)
+	c.Check(iter.NextResultSet(), Equals, false)
+	c.Assert(iter.Close(), IsNil)
+}
+
+func (s *PackageSuite) TestMapColumns(c *C) {
+	db, err := createTableDB(c, "staff", "staff_id integer, staff_name text, staff_address_id integer")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "staff")
+	insertStmt := sqlair.MustPrepare("INSERT INTO staff VALUES ($Person.id, $Person.name, $Person.address_id)", Person{})
+	c.Assert(db.Query(nil, insertStmt, fred).Run(), IsNil)
+
+	staffColumns := sqlair.MapColumns("Person", func(typeName string, memberTag string) string {
+		return "staff_" + memberTag
+	})
+	stmt, err := sqlair.Prepare("SELECT &Person.* FROM staff", Person{}, staffColumns)
+	c.Assert(err, IsNil)
+	p := Person{}
+	c.Assert(db.Query(nil, stmt).Get(&p), IsNil)
+	c.Check(p, Equals, fred)
+
+	stmt, err = sqlair.PrepareTypes("SELECT s.* AS &Person.* FROM staff AS s", []reflect.Type{reflect.TypeOf(Person{})}, staffColumns)
+	c.Assert(err, IsNil)
+	p = Person{}
+	c.Assert(db.Query(nil, stmt).Get(&p), IsNil)
+	c.Check(p, Equals, fred)
+
+	p = Person{}
+	c.Assert(db.Get(nil, &p, "SELECT &Person.* FROM staff", staffColumns), IsNil)
+	c.Check(p, Equals, fred)
+
+	// Without the mapper the tags are used as columns.
+	err = db.Get(nil, &p, "SELECT &Person.* FROM staff")
+	c.Assert(err, ErrorMatches, ".*no such column: address_id")
+
+	_, err = sqlair.Prepare("SELECT &Person.* FROM staff", Person{}, sqlair.MapColumns("Address", nil))
+	c.Assert(err, ErrorMatches, `cannot prepare statement: parameter with type "Address" missing \(have "Person"\)`)
+}
+
+func (s *PackageSuite) TestColumnOrder(c *C) {
+	sqlairDB, err := createTableDB(c, "membership", "tenant text, user_id integer, role text, PRIMARY KEY (tenant, user_id)")
+	c.Assert(err, IsNil)
+	defer dropTables(c, sqlairDB, "membership")
+	var infos []sqlair.QueryInfo
+	tracer := sqlair.TracerFunc(func(info sqlair.QueryInfo) {
+		infos = append(infos, info)
+	})
+	db := sqlair.NewDB(sqlairDB.PlainDB(), sqlair.WithTracer(tracer))
+
+	type Membership struct {
+		Tenant string `db:"tenant"`
+		UserID int    `db:"user_id"`
+		Role   string `db:"role"`
+	}
+	member := Membership{Tenant: "acme", UserID: 1, Role: "admin"}
+
+	// By default the columns are sorted by tag.
+	insertStmt := sqlair.MustPrepare("INSERT INTO membership (*) VALUES ($Membership.*)", Membership{})
+	c.Assert(db.Query(nil, insertStmt, member).Run(), IsNil)
+	c.Check(infos[len(infos)-1].SQL, Equals, "INSERT INTO membership (role, tenant, user_id) VALUES (@sqlair_0, @sqlair_1, @sqlair_2)")
+
+	// With the option they are in the order the fields are declared, for
+	// both inputs and outputs.
+	declared := sqlair.WithColumnOrder(sqlair.DeclarationOrder)
+	insertStmt = sqlair.MustPrepare("INSERT INTO membership (*) VALUES ($Membership.*)", Membership{}, declared)
+	c.Assert(db.Query(nil, insertStmt, Membership{Tenant: "acme", UserID: 2}).Run(), IsNil)
+	c.Check(infos[len(infos)-1].SQL, Equals, "INSERT INTO membership (tenant, user_id, role) VALUES (@sqlair_0, @sqlair_1, @sqlair_2)")
+
+	var got []Membership
+	selectStmt := sqlair.MustPrepare("SELECT &Membership.* FROM membership ORDER BY user_id", Membership{}, declared)
+	c.Assert(db.Query(nil, selectStmt).GetAll(&got), IsNil)
+	c.Check(infos[len(infos)-1].SQL, Equals, "SELECT tenant AS _sqlair_0, user_id AS _sqlair_1, role AS _sqlair_2 FROM membership ORDER BY user_id")
+	c.Check(got, DeepEquals, []Membership{member, {Tenant: "acme", UserID: 2}})
+
+	// The option applies to statements prepared by the DB.
+	_, err = db.Exec(nil, "INSERT INTO membership (*) VALUES ($Membership.*)", Membership{Tenant: "acme", UserID: 3}, declared)
+	c.Assert(err, IsNil)
+	c.Check(infos[len(infos)-1].SQL, Equals, "INSERT INTO membership (tenant, user_id, role) VALUES (@sqlair_0, @sqlair_1, @sqlair_2)")
+	_, err = db.Exec(nil, "INSERT INTO membership (*) VALUES ($Membership.*)", Membership{Tenant: "acme", UserID: 4})
+	c.Assert(err, IsNil)
+	c.Check(infos[len(infos)-1].SQL, Equals, "INSERT INTO membership (role, tenant, user_id) VALUES (@sqlair_0, @sqlair_1, @sqlair_2)")
+}
+
+func (s *PackageSuite) TestRegisterScanner(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	// The name is read into the struct in upper case and a computed column
+	// is read with a scanner for a member that is not a tag.
+	upperName := sqlair.RegisterScanner("Person", "name", func(dest any, v any) error {
+		name, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expected string, got %T", v)
+		}
+		dest.(*Person).Name = strings.ToUpper(name)
+		return nil
+	})
+	doublePostcode := sqlair.RegisterScanner("Person", "double_postcode", func(dest any, v any) error {
+		dest.(*Person).Postcode = int(v.(int64) / 2)
+		return nil
+	})
+	stmt, err := sqlair.Prepare("SELECT &Person.* FROM person WHERE id = $Person.id", Person{}, upperName)
+	c.Assert(err, IsNil)
+	p := Person{}
+	c.Assert(db.Query(nil, stmt, fred).Get(&p), IsNil)
+	c.Check(p, Equals, Person{ID: 30, Name: "FRED", Postcode: 1000})
+
+	p = Person{}
+	err = db.Get(nil, &p, "SELECT address_id * 2 AS &Person.double_postcode FROM person WHERE id = 30", doublePostcode)
+	c.Assert(err, IsNil)
+	c.Check(p, Equals, Person{Postcode: 1000})
+
+	// Errors from the scanner name the member.
+	err = db.Get(nil, &p, "SELECT id AS &Person.name FROM person WHERE id = 30", upperName)
+	c.Assert(err, ErrorMatches, `cannot get result: cannot scan column "id" into member "name" of struct "Person": expected string, got int64`)
+}
+
+func (s *PackageSuite) TestEmbeddedStructPointer(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	type Entity struct {
+		ID int `db:"id"`
+	}
+	type Employee struct {
+		*Entity
+		Name string `db:"name"`
+	}
+
+	// Results are scanned into a new embedded struct if the pointer is nil.
+	stmt := sqlair.MustPrepare("SELECT &Employee.* FROM person WHERE id = $Employee.id", Employee{})
+	e := Employee{}
+	err = db.Query(nil, stmt, Employee{Entity: &Entity{ID: 30}}).Get(&e)
+	c.Assert(err, IsNil)
+	c.Check(e, DeepEquals, Employee{Entity: &Entity{ID: 30}, Name: "Fred"})
+
+	// An input cannot be read through a nil embedded pointer.
+	err = db.Query(nil, stmt, Employee{}).Get(&e)
+	c.Assert(err, ErrorMatches, `invalid input parameter: cannot locate tag "id" of struct "Employee": found nil pointer in path to field "Entity.ID"`)
+}
+
+func (s *PackageSuite) TestPrefixedStructFields(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	type Row struct {
+		P Person  `db:"p_,prefix"`
+		A Address `db:"a_,prefix"`
+	}
+	stmt, err := sqlair.Prepare(`
+		SELECT &Row.* FROM (
+			SELECT p.id AS p_id, p.name AS p_name, p.address_id AS p_address_id,
+			       a.id AS a_id, a.district AS a_district, a.street AS a_street
+			FROM person AS p JOIN address AS a ON p.address_id = a.id
+		)
+		WHERE a_street = $Row.a_street`, Row{})
+	c.Assert(err, IsNil)
+
+	var rows []Row
+	err = db.Query(nil, stmt, Row{A: Address{Street: "Main Street"}}).GetAll(&rows)
+	c.Assert(err, IsNil)
+	c.Check(rows, DeepEquals, []Row{{P: fred, A: mainStreet}})
+}
+
+func (s *PackageSuite) TestPositionalInputs(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	stmt := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE id = $1", Person{})
+	p := Person{}
+	c.Assert(db.Query(nil, stmt, 30).Get(&p), IsNil)
+	c.Check(p, Equals, fred)
+
+	// Positional inputs can be mixed with typed inputs.
+	stmt = sqlair.MustPrepare("SELECT &Person.* FROM person WHERE address_id = $Address.id AND name = $1", Person{}, Address{})
+	var people []Person
+	c.Assert(db.Query(nil, stmt, "Fred", mainStreet).GetAll(&people), IsNil)
+	c.Check(people, DeepEquals, []Person{fred})
+
+	p = Person{}
+	c.Assert(db.Get(nil, &p, "SELECT &Person.* FROM person WHERE name = $1", "Mark"), IsNil)
+	c.Check(p, Equals, mark)
+
+	_, err = db.Exec(nil, "UPDATE person SET name = $2 WHERE id = $1", 30, "Frederick")
+	c.Assert(err, IsNil)
+	c.Assert(db.Get(nil, &p, "SELECT &Person.* FROM person WHERE id = $1", 30), IsNil)
+	c.Check(p.Name, Equals, "Frederick")
+
+	err = db.Query(nil, sqlair.MustPrepare("SELECT &Person.* FROM person WHERE id = $2", Person{}), 30).Get(&p)
+	c.Assert(err, ErrorMatches, `invalid input parameter: missing positional argument \$2, got 1 positional arguments`)
+}
+
+func (s *PackageSuite) TestScanErrorNamesColumn(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	// The column that cannot be scanned is found amongst the others.
+	stmt := sqlair.MustPrepare("SELECT &Person.name, p.name AS &Address.id FROM person AS p WHERE id = 30", Person{}, Address{})
+	err = db.Query(nil, stmt).Get(&Person{}, &Address{})
+	c.Assert(err, ErrorMatches, `cannot get result: cannot scan column "p.name" into tag "id" of struct "Address": converting driver.Value type string \("Fred"\) to a int: invalid syntax`)
+
+	// The column is found without scanning the row again.
+	scanned := 0
+	countScans := sqlair.RegisterScanner("Person", "name", func(dest any, v any) error {
+		scanned++
+		return nil
+	})
+	stmt = sqlair.MustPrepare("SELECT &Person.name, p.name AS &Address.id FROM person AS p WHERE id = 30", Person{}, Address{}, countScans)
+	err = db.Query(nil, stmt).Get(&Person{}, &Address{})
+	c.Assert(err, ErrorMatches, `cannot get result: cannot scan column "p.name" into tag "id" of struct "Address": .*`)
+	c.Check(scanned, Equals, 1)
+
+	// The same column is named for buffered queries.
+	err = db.Query(nil, stmt, sqlair.Buffered()).Get(&Person{}, &Address{})
+	c.Assert(err, ErrorMatches, `cannot get result: cannot scan column "p.name" into tag "id" of struct "Address": .*`)
+}
+
+func (s *PackageSuite) TestPointerFields(c *C) {
+	db, err := createTableDB(c, "contact", "id integer DEFAULT 7, nickname text, seen timestamp")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "contact")
+
+	type Contact struct {
+		ID       *int       `db:"id,omitempty"`
+		Nickname *string    `db:"nickname"`
+		Seen     *time.Time `db:"seen"`
+	}
+	id, nickname, seen := 1, "Freddy", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// A nil pointer is inserted as NULL and counts as empty for omitempty.
+	insertStmt := sqlair.MustPrepare("INSERT INTO contact (*) VALUES ($Contact.*)", Contact{})
+	c.Assert(db.Query(nil, insertStmt, Contact{}).Run(), IsNil)
+	c.Assert(db.Query(nil, insertStmt, Contact{ID: &id, Nickname: &nickname, Seen: &seen}).Run(), IsNil)
+
+	// A NULL column is scanned as a nil pointer.
+	var contacts []Contact
+	selectStmt := sqlair.MustPrepare("SELECT &Contact.* FROM contact ORDER BY id", Contact{})
+	c.Assert(db.Query(nil, selectStmt).GetAll(&contacts), IsNil)
+	c.Assert(contacts, HasLen, 2)
+	c.Check(*contacts[0].ID, Equals, 1)
+	c.Check(*contacts[0].Nickname, Equals, "Freddy")
+	c.Check(contacts[0].Seen.Equal(seen), Equals, true)
+	c.Check(*contacts[1].ID, Equals, 7)
+	c.Check(contacts[1].Nickname, IsNil)
+	c.Check(contacts[1].Seen, IsNil)
+
+	type BadContact struct {
+		Nickname **string `db:"nickname"`
+	}
+	_, err = sqlair.Prepare("SELECT &BadContact.* FROM contact", BadContact{})
+	c.Assert(err, ErrorMatches, `cannot prepare statement: field "Nickname" of struct BadContact has unsupported double pointer type \*\*string`)
+}
+
+func (s *PackageSuite) TestNullTypes(c *C) {
+	db, err := createTableDB(c, "nullable", "s text, i64 integer, i32 integer, i16 integer, b integer, f real, t timestamp, by integer")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "nullable")
+
+	type Nullable struct {
+		S   sql.NullString  `db:"s"`
+		I64 sql.NullInt64   `db:"i64"`
+		I32 sql.NullInt32   `db:"i32"`
+		I16 sql.NullInt16   `db:"i16"`
+		B   sql.NullBool    `db:"b"`
+		F   sql.NullFloat64 `db:"f"`
+		T   sql.NullTime    `db:"t"`
+		By  sql.NullByte    `db:"by"`
+	}
+	valid := Nullable{
+		S:   sql.NullString{String: "Fred", Valid: true},
+		I64: sql.NullInt64{Int64: 64, Valid: true},
+		I32: sql.NullInt32{Int32: 32, Valid: true},
+		I16: sql.NullInt16{Int16: 16, Valid: true},
+		B:   sql.NullBool{Bool: true, Valid: true},
+		F:   sql.NullFloat64{Float64: 1.5, Valid: true},
+		T:   sql.NullTime{Time: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Valid: true},
+		By:  sql.NullByte{Byte: 8, Valid: true},
+	}
+
+	insertStmt := sqlair.MustPrepare("INSERT INTO nullable (*) VALUES ($Nullable.*)", Nullable{})
+	c.Assert(db.Query(nil, insertStmt, valid).Run(), IsNil)
+	c.Assert(db.Query(nil, insertStmt, Nullable{}).Run(), IsNil)
+
+	// Invalid values are inserted as NULL.
+	countStmt := sqlair.MustPrepare("SELECT count(*) AS &M.count FROM nullable WHERE s IS NULL AND i64 IS NULL AND t IS NULL", sqlair.M{})
+	m := sqlair.M{}
+	c.Assert(db.Query(nil, countStmt).Get(m), IsNil)
+	c.Check(m["count"], Equals, int64(1))
+
+	var rows []Nullable
+	selectStmt := sqlair.MustPrepare("SELECT &Nullable.* FROM nullable ORDER BY s IS NULL", Nullable{})
+	c.Assert(db.Query(nil, selectStmt).GetAll(&rows), IsNil)
+	c.Check(rows, DeepEquals, []Nullable{valid, {}})
+
+	// A valid value can be used as a query input.
+	var got Nullable
+	whereStmt := sqlair.MustPrepare("SELECT &Nullable.* FROM nullable WHERE i64 = $Nullable.i64", Nullable{})
+	c.Assert(db.Query(nil, whereStmt, valid).Get(&got), IsNil)
+	c.Check(got, DeepEquals, valid)
+}
+
+func (s *PackageSuite) TestValuerInputs(c *C) {
+	db, err := createTableDB(c, "account", "id integer, status integer")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "account")
+
+	type Account struct {
+		ID     int    `db:"id"`
+		Status Status `db:"status"`
+	}
+	insertStmt := sqlair.MustPrepare("INSERT INTO account (*) VALUES ($Account.*)", Account{})
+	c.Assert(db.Query(nil, insertStmt, Account{ID: 1, Status: "active"}).Run(), IsNil)
+
+	mapInsertStmt := sqlair.MustPrepare("INSERT INTO account (id, status) VALUES ($M.id, $M.status)", sqlair.M{})
+	c.Assert(db.Query(nil, mapInsertStmt, sqlair.M{"id": 2, "status": Status("inactive")}).Run(), IsNil)
+
+	var rows []sqlair.M
+	selectStmt := sqlair.MustPrepare("SELECT (id, status) AS (&M.*) FROM account ORDER BY id", sqlair.M{})
+	c.Assert(db.Query(nil, selectStmt).GetAll(&rows), IsNil)
+	c.Check(rows, DeepEquals, []sqlair.M{{"id": int64(1), "status": int64(1)}, {"id": int64(2), "status": int64(0)}})
+
+	// Errors from Value are reported with the member that holds the value.
+	err = db.Query(nil, insertStmt, Account{ID: 3, Status: "deleted"}).Run()
+	c.Assert(err, ErrorMatches, `invalid input parameter: cannot get value of tag "status" of struct "Account": unknown status "deleted"`)
+	err = db.Query(nil, mapInsertStmt, sqlair.M{"id": 3, "status": Status("deleted")}).Run()
+	c.Assert(err, ErrorMatches, `invalid input parameter: cannot get value of key "status" of map "M": unknown status "deleted"`)
+}
+
+func (s *PackageSuite) TestTimeColumns(c *C) {
+	db, err := createTableDB(c, "event", "id integer, created text, seen integer, day text")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "event")
+
+	type Event struct {
+		ID      int        `db:"id"`
+		Created time.Time  `db:"created"`
+		Seen    *time.Time `db:"seen"`
+		Day     time.Time  `db:"day,layout=02/01/2006"`
+	}
+	created := time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	// Times stored as text and as Unix seconds are converted.
+	_, err = db.Exec(nil, "INSERT INTO event VALUES (1, '2023-01-02 15:04:05', 1672671845, '02/01/2023')")
+	c.Assert(err, IsNil)
+	var e Event
+	selectStmt := sqlair.MustPrepare("SELECT &Event.* FROM event WHERE id = $Event.id", Event{})
+	c.Assert(db.Query(nil, selectStmt, Event{ID: 1}).Get(&e), IsNil)
+	c.Check(e.Created, Equals, created)
+	c.Assert(e.Seen, NotNil)
+	c.Check(*e.Seen, Equals, created)
+	c.Check(e.Day, Equals, time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC))
+
+	// Times are passed to the driver as inputs, except for fields with a
+	// layout which are formatted in it.
+	insertStmt := sqlair.MustPrepare("INSERT INTO event (*) VALUES ($Event.*)", Event{})
+	c.Assert(db.Query(nil, insertStmt, Event{ID: 2, Created: created, Day: created}).Run(), IsNil)
+	m := sqlair.M{}
+	c.Assert(db.Query(nil, sqlair.MustPrepare("SELECT day AS &M.day FROM event WHERE id = 2", sqlair.M{})).Get(m), IsNil)
+	c.Check(m["day"], Equals, "02/01/2023")
+
+	e = Event{}
+	c.Assert(db.Query(nil, selectStmt, Event{ID: 2}).Get(&e), IsNil)
+	c.Check(e.Created.Equal(created), Equals, true)
+	c.Check(e.Seen, IsNil)
+	c.Check(e.Day, Equals, time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC))
+}
+
+func (s *PackageSuite) TestLikePattern(c *C) {
+	db, err := createTableDB(c, "product", "name text")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "product")
+
+	type Product struct {
+		Name string `db:"name"`
+	}
+	products := []Product{{"50% off"}, {"500 off"}, {"a_b"}, {"axb"}, {`back\slash`}, {"off 50%"}}
+	insertStmt := sqlair.MustPrepare("INSERT INTO product (*) VALUES ($Product.*)", Product{})
+	c.Assert(db.Query(nil, insertStmt, products).Run(), IsNil)
+
+	type Search struct {
+		Pattern sqlair.LikePattern `db:"pattern"`
+	}
+	selectStmt := sqlair.MustPrepare("SELECT &Product.* FROM product WHERE name LIKE $Search.pattern ORDER BY name", Product{}, Search{})
+	tests := []struct {
+		pattern  sqlair.LikePattern
+		expected []Product
+	}{
+		{sqlair.Like("a_b"), []Product{{"a_b"}}},
+		{sqlair.LikePrefix("50%"), []Product{{"50% off"}}},
+		{sqlair.LikeSuffix("50%"), []Product{{"off 50%"}}},
+		{sqlair.LikeContains("50%"), []Product{{"50% off"}, {"off 50%"}}},
+		{sqlair.LikeContains(`\`), []Product{{`back\slash`}}},
+	}
+	for _, t := range tests {
+		var got []Product
+		err := db.Query(nil, selectStmt, Search{Pattern: t.pattern}).GetAll(&got)
+		c.Assert(err, IsNil)
+		c.Check(got, DeepEquals, t.expected, Commentf("pattern %q", t.pattern.EscapedPattern()))
+	}
+
+	// A pattern can be used as a positional input.
+	var p Product
+	c.Assert(db.Get(nil, &p, "SELECT &Product.* FROM product WHERE name LIKE $1", sqlair.LikePrefix("a_")), IsNil)
+	c.Check(p, Equals, Product{"a_b"})
+}
+
+func (s *PackageSuite) TestGetAllValues(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	var names []string
+	stmt := sqlair.MustPrepare("SELECT &Person.name FROM person ORDER BY name", Person{})
+	c.Assert(db.Query(nil, stmt).GetAll(&names), IsNil)
+	c.Check(names, DeepEquals, []string{"Dave", "Fred", "Mark", "Mary"})
+
+	// Columns that are not outputs are ignored.
+	var ids []int
+	stmt = sqlair.MustPrepare("SELECT name, id AS &Person.id FROM person ORDER BY id", Person{})
+	c.Assert(db.Query(nil, stmt).GetAll(&ids), IsNil)
+	c.Check(ids, DeepEquals, []int{20, 30, 35, 40})
+
+	// NULL is scanned as nil into pointers and as the zero value otherwise.
+	var emails []*string
+	stmt = sqlair.MustPrepare("SELECT email AS &M.email FROM person WHERE id = 30", sqlair.M{})
+	c.Assert(db.Query(nil, stmt).GetAll(&emails), IsNil)
+	c.Check(emails, DeepEquals, []*string{nil})
+	var nullEmails []sql.NullString
+	c.Assert(db.Query(nil, stmt).GetAll(&nullEmails), IsNil)
+	c.Check(nullEmails, DeepEquals, []sql.NullString{{}})
+
+	// A single value can be read with Get and with an iterator.
+	var name string
+	stmt = sqlair.MustPrepare("SELECT &Person.name FROM person WHERE id = $Person.id", Person{})
+	c.Assert(db.Query(nil, stmt, fred).Get(&name), IsNil)
+	c.Check(name, Equals, "Fred")
+	iter := db.Query(nil, stmt, mark).Iter()
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Get(&name), IsNil)
+	c.Check(name, Equals, "Mark")
+	c.Assert(iter.Close(), IsNil)
+
+	err = db.Query(nil, sqlair.MustPrepare("SELECT &Person.* FROM person", Person{})).GetAll(&names)
+	c.Assert(err, ErrorMatches, `cannot get result: cannot scan into \*string: query must have one output column, found 3`)
+	// A column read into a map by its name can be read as a value.
+	var count int
+	c.Assert(db.Query(nil, sqlair.MustPrepare("SELECT count(*) AS &M.* FROM person", sqlair.M{})).Get(&count), IsNil)
+	c.Check(count, Equals, 4)
+}
+
+func (s *PackageSuite) TestGetValue(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	countStmt := sqlair.MustPrepare("SELECT count(*) AS &M.count FROM person", sqlair.M{})
+	var count int
+	c.Assert(db.Query(nil, countStmt).Get(&count), IsNil)
+	c.Check(count, Equals, 4)
+
+	// Types that implement sql.Scanner are scanned into directly.
+	var nullCount sql.NullInt64
+	c.Assert(db.Query(nil, countStmt).Get(&nullCount), IsNil)
+	c.Check(nullCount, Equals, sql.NullInt64{Int64: 4, Valid: true})
+	var sv ScannerValuerInt
+	c.Assert(db.Query(nil, countStmt).Get(&sv), IsNil)
+	c.Check(sv.F, Equals, 4)
+
+	// A query with no rows returns ErrNoRows.
+	stmt := sqlair.MustPrepare("SELECT &Person.id FROM person WHERE name = 'Nobody'", Person{})
+	c.Assert(db.Query(nil, stmt).Get(&count), Equals, sqlair.ErrNoRows)
+
+	// The query must have one output column.
+	stmt = sqlair.MustPrepare("SELECT &Person.id, &Person.name FROM person", Person{})
+	err = db.Query(nil, stmt).Get(&count)
+	c.Assert(err, ErrorMatches, `cannot get result: cannot scan into \*int: query must have one output column, found 2`)
+	stmt = sqlair.MustPrepare("SELECT count(*) FROM person")
+	err = db.Query(nil, stmt).Get(&count)
+	c.Assert(err, ErrorMatches, `cannot get results: output variables provided but not referenced in query`)
+}
+
+func (s *PackageSuite) TestConcreteMapValues(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	type Counts map[string]int64
+	type Names map[string]string
+	stmt := sqlair.MustPrepare("SELECT count(*) AS &Counts.total, max(id) AS &Counts.max FROM person WHERE address_id >= $Counts.address_id", Counts{})
+	counts := Counts{"address_id": 1000}
+	c.Assert(db.Query(nil, stmt, counts).Get(counts), IsNil)
+	c.Check(counts, DeepEquals, Counts{"address_id": 1000, "total": 4, "max": 40})
+
+	// The column is converted to the value type of the map.
+	stmt = sqlair.MustPrepare("SELECT id AS &Names.id, name AS &Names.name FROM person WHERE id = 30", Names{})
+	names := Names{}
+	c.Assert(db.Query(nil, stmt).Get(names), IsNil)
+	c.Check(names, DeepEquals, Names{"id": "30", "name": "Fred"})
+
+	// NULL is stored as the zero value of the value type.
+	stmt = sqlair.MustPrepare("SELECT NULL AS &Counts.total", Counts{})
+	counts = Counts{"total": 5}
+	c.Assert(db.Query(nil, stmt).Get(counts), IsNil)
+	c.Check(counts, DeepEquals, Counts{"total": 0})
+
+	// A column that cannot be converted is reported with the key.
+	stmt = sqlair.MustPrepare("SELECT name AS &Counts.total FROM person WHERE id = 30", Counts{})
+	err = db.Query(nil, stmt).Get(Counts{})
+	c.Assert(err, ErrorMatches, `cannot get result: cannot scan column "name" into key "total" of map "Counts": converting driver.Value type string \("Fred"\) to a int64: invalid syntax`)
+}
+
+func (s *PackageSuite) TestExpressionOutputs(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	// The SQL before "AS" is kept as the source of the output column.
+	stmt := sqlair.MustPrepare(`
+		SELECT lower(name) COLLATE NOCASE AS &Person.name,
+		       substr(name, 1, 2) || $M.suffix AS &M.short,
+		       id || '' COLLATE "BINARY" AS &M.id
+		FROM person
+		WHERE id = $Person.id`, Person{}, sqlair.M{})
+	p := Person{}
+	m := sqlair.M{}
+	c.Assert(db.Query(nil, stmt, Person{ID: 30}, sqlair.M{"suffix": "!"}).Get(&p, m), IsNil)
+	c.Check(p, Equals, Person{Name: "fred"})
+	c.Check(m, DeepEquals, sqlair.M{"short": "Fr!", "id": "30"})
+}
+
+func (s *PackageSuite) TestSubqueryOutputs(c *C) {
+	tables, db, err := personAndAddressDB(c)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, tables...)
+
+	// A parenthesised subquery is kept as the source of the output column,
+	// however deeply its parentheses are nested.
+	stmt := sqlair.MustPrepare(`
+		SELECT (SELECT max(id) FROM person WHERE address_id = $Person.address_id) AS &M.maxid,
+		       (SELECT count(*) FROM (SELECT id FROM person WHERE (name) IN ((')'), ($M.name)))) AS &M.named,
+		       p.* AS &Person.*
+		FROM person AS p
+		WHERE p.id = $Person.id`, Person{}, sqlair.M{})
+	p := Person{}
+	m := sqlair.M{}
+	c.Assert(db.Query(nil, stmt, Person{ID: 30, Postcode: 1000}, sqlair.M{"name": "Mark"}).Get(&p, m), IsNil)
+	c.Check(p, Equals, fred)
+	c.Check(m, DeepEquals, sqlair.M{"maxid": int64(30), "named": int64(1)})
+}
+
+func (s *PackageSuite) TestInterfaceFields(c *C) {
+	db, err := createTableDB(c, "attribute", "key text, value")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "attribute")
+
+	type Attribute struct {
+		Key   string `db:"key"`
+		Value any    `db:"value"`
+	}
+	insertStmt := sqlair.MustPrepare("INSERT INTO attribute (*) VALUES ($Attribute.*)", Attribute{})
+	attrs := []Attribute{{Key: "a", Value: int64(1)}, {Key: "b", Value: "two"}, {Key: "c", Value: []byte{3}}, {Key: "d", Value: nil}}
+	c.Assert(db.Query(nil, insertStmt, attrs).Run(), IsNil)
+
+	// The field is set to whatever the driver returns.
+	var got []Attribute
+	selectStmt := sqlair.MustPrepare("SELECT &Attribute.* FROM attribute ORDER BY key", Attribute{})
+	c.Assert(db.Query(nil, selectStmt).GetAll(&got), IsNil)
+	c.Check(got, DeepEquals, attrs)
+
+	// An interface with methods can only be scanned into if it is a
+	// sql.Scanner, in which case the value it holds is scanned into.
+	type ScannerAttribute struct {
+		Value sql.Scanner `db:"value"`
+	}
+	stmt := sqlair.MustPrepare("SELECT &ScannerAttribute.* FROM attribute WHERE key = 'a'", ScannerAttribute{})
+	scannerAttr := ScannerAttribute{Value: &sql.NullInt64{}}
+	c.Assert(db.Query(nil, stmt).Get(&scannerAttr), IsNil)
+	c.Check(scannerAttr.Value, DeepEquals, &sql.NullInt64{Int64: 1, Valid: true})
+	err = db.Query(nil, stmt).Get(&ScannerAttribute{})
+	c.Assert(err, ErrorMatches, `cannot get result: cannot scan into tag "value" of struct "ScannerAttribute": interface field holds no sql.Scanner`)
+
+	type StringerAttribute struct {
+		Value fmt.Stringer `db:"value"`
+	}
+	_, err = sqlair.Prepare("SELECT &StringerAttribute.* FROM attribute", StringerAttribute{})
+	c.Assert(err, ErrorMatches, `cannot prepare statement: field "Value" of struct StringerAttribute has interface type fmt.Stringer with methods that is not a sql.Scanner`)
+}
+
+func (s *PackageSuite) TestNullZero(c *C) {
+	db, err := createTableDB(c, "member", "id integer, nickname text, visits integer, joined timestamp, colour text")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "member")
+
+	type Member struct {
+		ID       int       `db:"id"`
+		Nickname string    `db:"nickname,nullzero"`
+		Visits   int       `db:"visits,nullzero"`
+		Joined   time.Time `db:"joined,nullzero"`
+		Colour   Colour    `db:"colour,nullzero"`
+	}
+	joined := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	members := []Member{
+		{ID: 1, Nickname: "Al", Visits: 3, Joined: joined, Colour: Green},
+		{ID: 2},
+	}
+	insertStmt := sqlair.MustPrepare("INSERT INTO member (*) VALUES ($Member.*)", Member{})
+	c.Assert(db.Query(nil, insertStmt, members[0]).Run(), IsNil)
+	c.Assert(db.Query(nil, insertStmt, members[1]).Run(), IsNil)
+
+	// Zero values are stored as NULL.
+	var nulls []int
+	nullStmt := sqlair.MustPrepare("SELECT id AS &Member.id FROM member WHERE nickname IS NULL AND visits IS NULL AND joined IS NULL AND colour IS NULL", Member{})
+	c.Assert(db.Query(nil, nullStmt).GetAll(&nulls), IsNil)
+	c.Check(nulls, DeepEquals, []int{2})
+
+	// NULL columns are read as the zero value, including into a text
+	// unmarshaler that would otherwise reject NULL.
+	var got []Member
+	selectStmt := sqlair.MustPrepare("SELECT &Member.* FROM member ORDER BY id", Member{})
+	c.Assert(db.Query(nil, selectStmt).GetAll(&got), IsNil)
+	c.Assert(got, HasLen, 2)
+	c.Check(got[0].Joined.Equal(joined), Equals, true)
+	got[0].Joined = joined
+	c.Check(got, DeepEquals, members)
+
+	// The zero value of an input expression is passed as NULL too.
+	var ids []int
+	matchStmt := sqlair.MustPrepare("SELECT id AS &Member.id FROM member WHERE nickname IS $Member.nickname", Member{})
+	c.Assert(db.Query(nil, matchStmt, Member{}).GetAll(&ids), IsNil)
+	c.Check(ids, DeepEquals, []int{2})
+	c.Assert(db.Query(nil, matchStmt, Member{Nickname: "Al"}).GetAll(&ids), IsNil)
+	c.Check(ids, DeepEquals, []int{2, 1})
+
+	// Bulk inserts store the zero values of each row as NULL.
+	c.Assert(db.Query(nil, insertStmt, []Member{{ID: 3, Nickname: "Bo"}, {ID: 4, Visits: 1}}).Run(), IsNil)
+	nulls = nil
+	nicknameStmt := sqlair.MustPrepare("SELECT id AS &Member.id FROM member WHERE nickname IS NULL ORDER BY id", Member{})
+	c.Assert(db.Query(nil, nicknameStmt).GetAll(&nulls), IsNil)
+	c.Check(nulls, DeepEquals, []int{2, 4})
+}
+
+func (s *PackageSuite) TestReadOnly(c *C) {
+	db, err := createTableDB(c, "ticket", "id integer, title text, status text DEFAULT 'open'")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "ticket")
+
+	type Ticket struct {
+		ID     int    `db:"id"`
+		Title  string `db:"title"`
+		Status string `db:"status,readonly"`
+	}
+
+	// The read only column is left out of the insert so the database
+	// fills in its default.
+	insertStmt := sqlair.MustPrepare("INSERT INTO ticket (*) VALUES ($Ticket.*)", Ticket{})
+	c.Assert(db.Query(nil, insertStmt, Ticket{ID: 1, Title: "Fix", Status: "closed"}).Run(), IsNil)
+	c.Assert(db.Query(nil, insertStmt, []Ticket{{ID: 2, Title: "Test"}, {ID: 3, Title: "Ship"}}).Run(), IsNil)
+
+	var got []Ticket
+	selectStmt := sqlair.MustPrepare("SELECT &Ticket.* FROM ticket ORDER BY id", Ticket{})
+	c.Assert(db.Query(nil, selectStmt).GetAll(&got), IsNil)
+	c.Check(got, DeepEquals, []Ticket{
+		{ID: 1, Title: "Fix", Status: "open"},
+		{ID: 2, Title: "Test", Status: "open"},
+		{ID: 3, Title: "Ship", Status: "open"},
+	})
+
+	// The read only field cannot be used in an explicit input expression.
+	_, err = sqlair.Prepare("UPDATE ticket SET status = $Ticket.status WHERE id = $Ticket.id", Ticket{})
+	c.Assert(err, ErrorMatches, `cannot prepare statement: input expression: cannot use tag "status" of struct "Ticket" as an input, it has the readonly option: \$Ticket.status`)
+}
+
+func (s *PackageSuite) TestDefaultTag(c *C) {
+	db, err := createTableDB(c, "job", "id integer, status text, priority integer, colour text")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "job")
+
+	type Job struct {
+		ID       int    `db:"id"`
+		Status   string `db:"status,default=pending"`
+		Priority int    `db:"priority,default=5"`
+		Colour   Colour `db:"colour,default=green"`
+	}
+
+	// Zero values are stored as the default, in single and bulk inserts.
+	insertStmt := sqlair.MustPrepare("INSERT INTO job (*) VALUES ($Job.*)", Job{})
+	c.Assert(db.Query(nil, insertStmt, Job{ID: 1}).Run(), IsNil)
+	c.Assert(db.Query(nil, insertStmt, []Job{{ID: 2, Status: "done", Priority: 1}, {ID: 3}}).Run(), IsNil)
+
+	var got []Job
+	selectStmt := sqlair.MustPrepare("SELECT &Job.* FROM job ORDER BY id", Job{})
+	c.Assert(db.Query(nil, selectStmt).GetAll(&got), IsNil)
+	c.Check(got, DeepEquals, []Job{
+		{ID: 1, Status: "pending", Priority: 5, Colour: Green},
+		{ID: 2, Status: "done", Priority: 1, Colour: Green},
+		{ID: 3, Status: "pending", Priority: 5, Colour: Green},
+	})
+
+	// Updates store the default too.
+	updateStmt := sqlair.MustPrepare("UPDATE job SET status = $Job.status WHERE id = $Job.id", Job{})
+	c.Assert(db.Query(nil, updateStmt, Job{ID: 2}).Run(), IsNil)
+	var job Job
+	getStmt := sqlair.MustPrepare("SELECT &Job.* FROM job WHERE id = $Job.id", Job{})
+	c.Assert(db.Query(nil, getStmt, Job{ID: 2}).Get(&job), IsNil)
+	c.Check(job.Status, Equals, "pending")
+
+	// Inputs that are compared rather than stored do not use the default.
+	var ids []int
+	whereStmt := sqlair.MustPrepare("SELECT &Job.id FROM job WHERE status = $Job.status OR priority = $Job.priority", Job{})
+	err = db.Query(nil, whereStmt, Job{}).GetAll(&ids)
+	c.Check(errors.Is(err, sqlair.ErrNoRows), Equals, true)
+	ids = nil
+	c.Assert(db.Query(nil, whereStmt, Job{Status: "pending"}).GetAll(&ids), IsNil)
+	c.Check(ids, DeepEquals, []int{1, 2, 3})
+
+	// The same field can be stored with the default and compared without.
+	resetStmt := sqlair.MustPrepare("UPDATE job SET status = $Job.status WHERE status = $Job.status OR id = $Job.id", Job{})
+	rendered, params, err := resetStmt.Render(Job{ID: 1})
+	c.Assert(err, IsNil)
+	c.Check(rendered, Equals, "UPDATE job SET status = @sqlair_0 WHERE status = @sqlair_1 OR id = @sqlair_2")
+	c.Check(params, DeepEquals, []any{sql.Named("sqlair_0", "pending"), sql.Named("sqlair_1", ""), sql.Named("sqlair_2", 1)})
+
+	// Keywords in subqueries and string literals do not end the SET clause.
+	for _, query := range []string{
+		"UPDATE job SET colour = (SELECT colour FROM job WHERE id = 2), priority = $Job.priority WHERE id = $Job.id",
+		"UPDATE job SET status = 'WHERE', priority = $Job.priority WHERE id = $Job.id",
+	} {
+		stmt := sqlair.MustPrepare(query, Job{})
+		_, params, err := stmt.Render(Job{ID: 1})
+		c.Assert(err, IsNil)
+		c.Check(params, DeepEquals, []any{sql.Named("sqlair_0", 5), sql.Named("sqlair_1", 1)}, Commentf("query: %s", query))
+		c.Assert(db.Query(nil, stmt, Job{ID: 1}).Run(), IsNil)
+		c.Assert(db.Query(nil, getStmt, Job{ID: 1}).Get(&job), IsNil)
+		c.Check(job.Priority, Equals, 5)
+	}
+
+	// The default must be a value of the type of the field.
+	type BadJob struct {
+		Priority int `db:"priority,default=high"`
+	}
+	_, err = sqlair.Prepare("INSERT INTO job (*) VALUES ($BadJob.*)", BadJob{})
+	c.Assert(err, ErrorMatches, `cannot prepare statement: cannot use default option on field BadJob.Priority: cannot parse "high" as int`)
+}
+
+func (s *PackageSuite) TestTextMarshalerInputs(c *C) {
+	db, err := createTableDB(c, "device", "name text, addr text, colour text, size")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "device")
+
+	type Device struct {
+		Name   string     `db:"name"`
+		Addr   netip.Addr `db:"addr"`
+		Colour *Colour    `db:"colour"`
+		Size   Size       `db:"size"`
+	}
+	type Row struct {
+		Name   string         `db:"name"`
+		Addr   string         `db:"addr"`
+		Colour sql.NullString `db:"colour"`
+		Size   int64          `db:"size"`
+	}
+	green := Green
+	insertStmt := sqlair.MustPrepare("INSERT INTO device (*) VALUES ($Device.*)", Device{})
+	devices := []Device{
+		{Name: "router", Addr: netip.MustParseAddr("192.168.0.1"), Colour: &green, Size: 64},
+		{Name: "phone", Addr: netip.MustParseAddr("::1")},
+	}
+	c.Assert(db.Query(nil, insertStmt, devices).Run(), IsNil)
+
+	// The text is stored unless the type implements driver.Valuer. A nil
+	// pointer is stored as NULL.
+	var rows []Row
+	selectStmt := sqlair.MustPrepare("SELECT &Row.* FROM device", Row{})
+	c.Assert(db.Query(nil, selectStmt).GetAll(&rows), IsNil)
+	c.Check(rows, DeepEquals, []Row{
+		{Name: "router", Addr: "192.168.0.1", Colour: sql.NullString{String: "green", Valid: true}, Size: 64},
+		{Name: "phone", Addr: "::1"},
+	})
+
+	// Map values are marshalled too.
+	filterStmt := sqlair.MustPrepare("SELECT &Row.* FROM device WHERE addr = $M.addr", Row{}, sqlair.M{})
+	row := Row{}
+	c.Assert(db.Query(nil, filterStmt, sqlair.M{"addr": netip.MustParseAddr("::1")}).Get(&row), IsNil)
+	c.Check(row.Name, Equals, "phone")
+
+	// Errors are reported with the location of the value.
+	blue := Colour(7)
+	err = db.Query(nil, insertStmt, Device{Name: "tablet", Colour: &blue}).Run()
+	c.Assert(err, ErrorMatches, `invalid input parameter: cannot marshal text of tag "colour" of struct "Device": unknown colour 7`)
+}
+
+func (s *PackageSuite) TestTextUnmarshalerOutputs(c *C) {
+	db, err := createTableDB(c, "device", "name text, addr text, colour")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "device")
+	insertStmt := sqlair.MustPrepare(`
+		INSERT INTO device VALUES
+		('router', '192.168.0.1', 'green'),
+		('phone', '::1', NULL),
+		('tablet', 'nowhere', 1)`)
+	c.Assert(db.Query(nil, insertStmt).Run(), IsNil)
+
+	type Device struct {
+		Name   string     `db:"name"`
+		Addr   netip.Addr `db:"addr"`
+		Colour *Colour    `db:"colour"`
+	}
+	stmt := sqlair.MustPrepare("SELECT &Device.* FROM device WHERE name = $Device.name", Device{})
+	d := Device{Name: "router"}
+	c.Assert(db.Query(nil, stmt, d).Get(&d), IsNil)
+	green := Green
+	c.Check(d, DeepEquals, Device{Name: "router", Addr: netip.MustParseAddr("192.168.0.1"), Colour: &green})
+
+	// A NULL column sets a pointer field to nil.
+	d = Device{Name: "phone", Colour: &green}
+	c.Assert(db.Query(nil, stmt, d).Get(&d), IsNil)
+	c.Check(d, DeepEquals, Device{Name: "phone", Addr: netip.MustParseAddr("::1")})
+
+	// Unmarshalling errors name the column and the field.
+	d = Device{Name: "tablet"}
+	err = db.Query(nil, stmt, d).Get(&d)
+	c.Assert(err, ErrorMatches, `cannot get result: cannot scan column "addr" into tag "addr" of struct "Device": cannot unmarshal text into netip.Addr: ParseAddr\("nowhere"\): unable to parse IP`)
+
+	// A NULL column sets a field that is not a pointer to its zero value,
+	// like other fields that cannot be nil.
+	type Paint struct {
+		Colour Colour `db:"colour"`
+	}
+	paintStmt := sqlair.MustPrepare("SELECT &Paint.* FROM device WHERE name = $M.name", Paint{}, sqlair.M{})
+	p := Paint{Colour: Green}
+	c.Assert(db.Query(nil, paintStmt, sqlair.M{"name": "phone"}).Get(&p), IsNil)
+	c.Check(p, Equals, Paint{})
+
+	// Columns that are not text are converted to the type of the field.
+	p = Paint{}
+	c.Assert(db.Query(nil, paintStmt, sqlair.M{"name": "tablet"}).Get(&p), IsNil)
+	c.Check(p, Equals, Paint{Colour: Green})
+
+	// Map values are unmarshalled too.
+	type Addrs map[string]netip.Addr
+	addrStmt := sqlair.MustPrepare("SELECT addr AS &Addrs.router FROM device WHERE name = 'router'", Addrs{})
+	addrs := Addrs{}
+	c.Assert(db.Query(nil, addrStmt).Get(addrs), IsNil)
+	c.Check(addrs, DeepEquals, Addrs{"router": netip.MustParseAddr("192.168.0.1")})
+
+	// A NULL column is stored as the zero value of the map value type.
+	type Colours map[string]Colour
+	colourStmt := sqlair.MustPrepare("SELECT colour AS &Colours.phone FROM device WHERE name = 'phone'", Colours{})
+	colours := Colours{}
+	c.Assert(db.Query(nil, colourStmt).Get(colours), IsNil)
+	c.Check(colours, DeepEquals, Colours{"phone": Colour(0)})
+}
+
+func (s *PackageSuite) TestByteArrays(c *C) {
+	db, err := createTableDB(c, "item", "id, code")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "item")
+
+	type UUID [16]byte
+	type Item struct {
+		ID   UUID     `db:"id"`
+		Code *[4]byte `db:"code"`
+	}
+	id := UUID{0xf8, 0x1d, 0x4f, 0xae, 0x7d, 0xec, 0x11, 0xd0, 0xa7, 0x65, 0x00, 0xa0, 0xc9, 0x1e, 0x6b, 0xf6}
+	code := [4]byte{1, 2, 3, 4}
+	insertStmt := sqlair.MustPrepare("INSERT INTO item (*) VALUES ($Item.*)", Item{})
+	c.Assert(db.Query(nil, insertStmt, []Item{{ID: id, Code: &code}, {ID: UUID{1}}}).Run(), IsNil)
+
+	// Arrays are stored as blobs and a nil pointer as NULL.
+	rawStmt := sqlair.MustPrepare("SELECT (id, code) AS (&M.*) FROM item", sqlair.M{})
+	var rows []sqlair.M
+	c.Assert(db.Query(nil, rawStmt).GetAll(&rows), IsNil)
+	c.Check(rows, DeepEquals, []sqlair.M{
+		{"id": id[:], "code": code[:]},
+		{"id": []byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, "code": nil},
+	})
+
+	selectStmt := sqlair.MustPrepare("SELECT &Item.* FROM item WHERE id = $Item.id", Item{})
+	item := Item{ID: id}
+	c.Assert(db.Query(nil, selectStmt, item).Get(&item), IsNil)
+	c.Check(item, DeepEquals, Item{ID: id, Code: &code})
+	item = Item{ID: UUID{1}, Code: &code}
+	c.Assert(db.Query(nil, selectStmt, item).Get(&item), IsNil)
+	c.Check(item, DeepEquals, Item{ID: UUID{1}})
+
+	// A 16 byte array can be read from the text form of a UUID.
+	textStmt := sqlair.MustPrepare("SELECT 'f81d4fae-7dec-11d0-a765-00a0c91e6bf6' AS &Item.id", Item{})
+	item = Item{}
+	c.Assert(db.Query(nil, textStmt).Get(&item), IsNil)
+	c.Check(item.ID, Equals, id)
+
+	type Codes map[string][4]byte
+	codeStmt := sqlair.MustPrepare("SELECT code AS &Codes.code FROM item WHERE code IS NOT NULL", Codes{})
+	codes := Codes{}
+	c.Assert(db.Query(nil, codeStmt).Get(codes), IsNil)
+	c.Check(codes, DeepEquals, Codes{"code": code})
+
+	// The column must have the length of the array.
+	shortStmt := sqlair.MustPrepare("SELECT x'0102' AS &Item.code", Item{})
+	err = db.Query(nil, shortStmt).Get(&item)
+	c.Assert(err, ErrorMatches, `cannot get result: cannot scan column "code" into tag "code" of struct "Item": cannot scan 2 bytes into \[4\]uint8`)
+}
+
+func (s *PackageSuite) TestExplicitNull(c *C) {
+	db, err := createTableDB(c, "contact", "id integer, nickname text, score integer")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "contact")
+
+	insertStmt := sqlair.MustPrepare("INSERT INTO contact (id, nickname, score) VALUES ($M.*)", sqlair.M{})
+	c.Assert(db.Query(nil, insertStmt, []sqlair.M{
+		{"id": 1, "nickname": "Fred", "score": 10},
+		{"id": 2, "nickname": sqlair.Null, "score": sqlair.Null},
+	}).Run(), IsNil)
+
+	type Update struct {
+		ID    int `db:"id"`
+		Score any `db:"score"`
+	}
+	updateStmt := sqlair.MustPrepare("UPDATE contact SET nickname = $M.nickname, score = $Update.score WHERE id = $Update.id", sqlair.M{}, Update{})
+	c.Assert(db.Query(nil, updateStmt, sqlair.M{"nickname": sqlair.Null}, Update{ID: 1, Score: sqlair.Null}).Run(), IsNil)
+
+	type Contact struct {
+		ID       int     `db:"id"`
+		Nickname *string `db:"nickname"`
+		Score    *int    `db:"score"`
+	}
+	var contacts []Contact
+	selectStmt := sqlair.MustPrepare("SELECT &Contact.* FROM contact ORDER BY id", Contact{})
+	c.Assert(db.Query(nil, selectStmt).GetAll(&contacts), IsNil)
+	c.Check(contacts, DeepEquals, []Contact{{ID: 1}, {ID: 2}})
+
+	// The parameter is nil.
+	_, params, err := updateStmt.Render(sqlair.M{"nickname": sqlair.Null}, Update{ID: 1, Score: sqlair.Null})
+	c.Assert(err, IsNil)
+	c.Check(params, DeepEquals, []any{sql.Named("sqlair_0", nil), sql.Named("sqlair_1", nil), sql.Named("sqlair_2", 1)})
+}
+
+type ModelUUID string
+type Port int
+type Ratio float64
+type Enabled bool
+
+func (s *PackageSuite) TestQuotedColumnNames(c *C) {
+	db, err := createTableDB(c, "legacy", `id integer, "json.path" text, "Mixed Case" text, cost$ integer, "p_json.path" text`)
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "legacy")
+
+	type Path struct {
+		Value string `db:"\"json.path\""`
+	}
+	type Legacy struct {
+		ID     int    `db:"id"`
+		Path   string `db:"\"json.path\""`
+		Mixed  string `db:"\"Mixed Case\""`
+		Cost   int    `db:"cost$"`
+		Nested Path   `db:"p_,prefix"`
+	}
+	row := Legacy{ID: 1, Path: "$.a.b", Mixed: "Yes", Cost: 10, Nested: Path{Value: "$.c"}}
+
+	// Quoted tags round trip through asterisk expressions.
+	insertStmt := sqlair.MustPrepare("INSERT INTO legacy (*) VALUES ($Legacy.*)", Legacy{})
+	c.Assert(db.Query(nil, insertStmt, row).Run(), IsNil)
+	var got Legacy
+	selectStmt := sqlair.MustPrepare("SELECT l.* AS &Legacy.* FROM legacy l", Legacy{})
+	c.Assert(db.Query(nil, selectStmt).Get(&got), IsNil)
+	c.Check(got, Equals, row)
+
+	// They are referred to with their quotes in expressions.
+	updateStmt := sqlair.MustPrepare(`UPDATE legacy SET "json.path" = $Legacy."json.path", cost$ = $Legacy.cost$ WHERE "Mixed Case" = $Legacy."Mixed Case"`, Legacy{})
+	c.Assert(db.Query(nil, updateStmt, Legacy{Path: "$.d", Mixed: "Yes", Cost: 20}).Run(), IsNil)
+	got = Legacy{}
+	columnsStmt := sqlair.MustPrepare(`SELECT l."Mixed Case" AS &Legacy."Mixed Case", &Legacy."json.path", &Legacy.cost$ FROM legacy l`, Legacy{})
+	c.Assert(db.Query(nil, columnsStmt).Get(&got), IsNil)
+	c.Check(got, Equals, Legacy{Path: "$.d", Mixed: "Yes", Cost: 20})
+}
+
+func (s *PackageSuite) TestNamedBasicTypes(c *C) {
+	db, err := createTableDB(c, "service", "model_uuid text, port integer, ratio real, enabled boolean")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "service")
+
+	type Service struct {
+		ModelUUID ModelUUID `db:"model_uuid"`
+		Port      Port      `db:"port"`
+		Ratio     Ratio     `db:"ratio"`
+		Enabled   *Enabled  `db:"enabled"`
+	}
+	enabled := Enabled(true)
+	insertStmt := sqlair.MustPrepare("INSERT INTO service (*) VALUES ($Service.*)", Service{})
+	c.Assert(db.Query(nil, insertStmt, Service{ModelUUID: "uuid-1", Port: 8080, Ratio: 0.5, Enabled: &enabled}).Run(), IsNil)
+
+	// The inputs are passed as their underlying types.
+	_, params, err := insertStmt.Render(Service{ModelUUID: "uuid-1", Port: 8080, Ratio: 0.5, Enabled: &enabled})
+	c.Assert(err, IsNil)
+	c.Check(params, DeepEquals, []any{sql.Named("sqlair_0", true), sql.Named("sqlair_1", "uuid-1"), sql.Named("sqlair_2", 8080), sql.Named("sqlair_3", 0.5)})
+
+	var service Service
+	selectStmt := sqlair.MustPrepare("SELECT &Service.* FROM service", Service{})
+	c.Assert(db.Query(nil, selectStmt).Get(&service), IsNil)
+	c.Check(service, DeepEquals, Service{ModelUUID: "uuid-1", Port: 8080, Ratio: 0.5, Enabled: &enabled})
+
+	// Columns are converted to the underlying type of the field.
+	type Converted struct {
+		Port    ModelUUID `db:"port"`
+		Ratio   Port      `db:"model_uuid"`
+		Enabled Enabled   `db:"enabled"`
+	}
+	c.Assert(db.Query(nil, sqlair.MustPrepare("UPDATE service SET model_uuid = '42'")).Run(), IsNil)
+	var converted Converted
+	convertedStmt := sqlair.MustPrepare("SELECT &Converted.* FROM service", Converted{})
+	c.Assert(db.Query(nil, convertedStmt).Get(&converted), IsNil)
+	c.Check(converted, Equals, Converted{Port: "8080", Ratio: 42, Enabled: true})
+
+	// Map values of named types are converted in the same way.
+	type Ports map[string]Port
+	type Names map[string]ModelUUID
+	type Flags map[string]Enabled
+	type Ratios map[string]*Ratio
+	ports, names, flags, ratios := Ports{}, Names{}, Flags{}, Ratios{}
+	mapStmt := sqlair.MustPrepare("SELECT (port, model_uuid) AS (&Ports.*), port AS &Names.port, enabled AS &Flags.enabled, port AS &Ratios.port FROM service", Ports{}, Names{}, Flags{}, Ratios{})
+	c.Assert(db.Query(nil, mapStmt).Get(ports, names, flags, ratios), IsNil)
+	ratio := Ratio(8080)
+	c.Check(ports, DeepEquals, Ports{"port": 8080, "model_uuid": 42})
+	c.Check(names, DeepEquals, Names{"port": "8080"})
+	c.Check(flags, DeepEquals, Flags{"enabled": true})
+	c.Check(ratios, DeepEquals, Ratios{"port": &ratio})
+
+	_, params, err = sqlair.MustPrepare("SELECT &Service.* FROM service WHERE port = $M.port", Service{}, sqlair.M{}).Render(sqlair.M{"port": Port(8080)})
+	c.Assert(err, IsNil)
+	c.Check(params, DeepEquals, []any{sql.Named("sqlair_0", 8080)})
+
+	// A single value output of a named type.
+	var port Port
+	c.Assert(db.Query(nil, sqlair.MustPrepare("SELECT port AS &M.port FROM service", sqlair.M{})).Get(&port), IsNil)
+	c.Check(port, Equals, Port(8080))
+}
+
+func (s *PackageSuite) TestSameStructTwice(c *C) {
+	db, err := createTableDB(c, "staff", "id integer, name text, address_id integer, manager_id integer")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "staff")
+	insertStmt := sqlair.MustPrepare(`
+INSERT INTO staff (id, name, address_id, manager_id) VALUES
+(1, 'Alastair', 10, NULL),
+(2, 'Ed', 20, 1),
+(3, 'Marco', 30, 1)`)
+	c.Assert(db.Query(nil, insertStmt).Run(), IsNil)
+
+	// The same struct type is given two names for the two sides of the join.
+	selfJoinStmt := sqlair.MustPrepare(`
+SELECT e.* AS &Employee.*, m.* AS &Boss.*
+FROM staff e JOIN staff m ON e.manager_id = m.id
+WHERE e.id = $Employee.id`, sqlair.Named("Employee", Person{}), sqlair.Named("Boss", Person{}))
+
+	// Unnamed arguments of the type are assigned to the names in the order
+	// the names are used in the query.
+	var emp, boss Person
+	c.Assert(db.Query(nil, selfJoinStmt, Person{ID: 2}).Get(&emp, &boss), IsNil)
+	c.Check(emp, Equals, Person{ID: 2, Name: "Ed", Postcode: 20})
+	c.Check(boss, Equals, Person{ID: 1, Name: "Alastair", Postcode: 10})
+
+	// Named arguments can be given in any order.
+	emp, boss = Person{}, Person{}
+	c.Assert(db.Query(nil, selfJoinStmt, sqlair.Named("Employee", Person{ID: 3})).Get(sqlair.Named("Boss", &boss), sqlair.Named("Employee", &emp)), IsNil)
+	c.Check(emp, Equals, Person{ID: 3, Name: "Marco", Postcode: 30})
+	c.Check(boss, Equals, Person{ID: 1, Name: "Alastair", Postcode: 10})
+
+	var emps, bosses []Person
+	allStmt := sqlair.MustPrepare(`
+SELECT m.* AS &Boss.*, e.* AS &Employee.*
+FROM staff e JOIN staff m ON e.manager_id = m.id
+WHERE e.id IN ($Employee.id, $Other.id)
+ORDER BY e.id`, sqlair.Named("Employee", Person{}), sqlair.Named("Other", Person{}), sqlair.Named("Boss", Person{}))
+	c.Assert(db.Query(nil, allStmt, Person{ID: 2}, Person{ID: 3}).GetAll(&bosses, &emps), IsNil)
+	c.Check(emps, DeepEquals, []Person{{ID: 2, Name: "Ed", Postcode: 20}, {ID: 3, Name: "Marco", Postcode: 30}})
+	c.Check(bosses, DeepEquals, []Person{{ID: 1, Name: "Alastair", Postcode: 10}, {ID: 1, Name: "Alastair", Postcode: 10}})
+
+	// There cannot be more unnamed arguments than names.
+	err = db.Query(nil, selfJoinStmt, Person{ID: 2}).Get(&emp, &boss, &Person{})
+	c.Assert(err, ErrorMatches, `cannot get result: type "Person" provided more than once`)
+}
+
+type Level int
+
+func (l Level) String() string {
+	return [...]string{"debug", "info", "warning"}[l]
+}
+
+func (s *PackageSuite) TestIntegerBackedNamedTypes(c *C) {
+	db, err := createTableDB(c, "job", "name text, timeout_ns integer, level integer, retry_level integer")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "job")
+
+	type Job struct {
+		Name       string        `db:"name"`
+		Timeout    time.Duration `db:"timeout_ns"`
+		Level      Level         `db:"level"`
+		RetryLevel *Level        `db:"retry_level"`
+	}
+	warning := Level(2)
+	jobs := []Job{
+		{Name: "backup", Timeout: 90 * time.Second, Level: 1, RetryLevel: &warning},
+		{Name: "cleanup", Timeout: time.Millisecond},
+	}
+	insertStmt := sqlair.MustPrepare("INSERT INTO job (*) VALUES ($Job.*)", Job{})
+	c.Assert(db.Query(nil, insertStmt, jobs).Run(), IsNil)
+
+	var got []Job
+	selectStmt := sqlair.MustPrepare("SELECT &Job.* FROM job WHERE timeout_ns > $Job.timeout_ns ORDER BY name", Job{})
+	c.Assert(db.Query(nil, selectStmt, Job{Timeout: 0}).GetAll(&got), IsNil)
+	c.Check(got, DeepEquals, jobs)
+
+	var timeouts []time.Duration
+	timeoutStmt := sqlair.MustPrepare("SELECT timeout_ns AS &M.timeout_ns FROM job ORDER BY name", sqlair.M{})
+	c.Assert(db.Query(nil, timeoutStmt).GetAll(&timeouts), IsNil)
+	c.Check(timeouts, DeepEquals, []time.Duration{90 * time.Second, time.Millisecond})
+
+	type Levels map[string]Level
+	levels := Levels{}
+	levelStmt := sqlair.MustPrepare("SELECT (level, retry_level) AS (&Levels.*) FROM job WHERE name = $M.name", Levels{}, sqlair.M{})
+	c.Assert(db.Query(nil, levelStmt, sqlair.M{"name": "cleanup"}).Get(levels), IsNil)
+	c.Check(levels, DeepEquals, Levels{"level": 0, "retry_level": 0})
+
+	type Timeouts map[string]time.Duration
+	timeoutMap := Timeouts{}
+	mapStmt := sqlair.MustPrepare("SELECT (timeout_ns, level) AS (&Timeouts.*) FROM job WHERE name = $M.name", Timeouts{}, sqlair.M{})
+	c.Assert(db.Query(nil, mapStmt, sqlair.M{"name": "backup"}).Get(timeoutMap), IsNil)
+	c.Check(timeoutMap, DeepEquals, Timeouts{"timeout_ns": 90 * time.Second, "level": time.Duration(1)})
+}
+
+type Box[T any] struct {
+	ID    int `db:"id"`
+	Value T   `db:"value"`
+}
+
+func (s *PackageSuite) TestGenericTypes(c *C) {
+	db, err := createTableDB(c, "box", "id integer, value text")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "box")
+
+	// An instantiated generic type has no name that can be used in a query.
+	_, err = sqlair.Prepare("SELECT &Box.* FROM box", Box[int]{})
+	c.Assert(err, ErrorMatches, `cannot prepare statement: cannot use generic type "Box\[int\]" without a name, name it with sqlair.Named`)
+
+	// Once named it can be used like any other struct. Arguments are matched
+	// by type so only the type samples need to be named.
+	insertStmt := sqlair.MustPrepare("INSERT INTO box (*) VALUES ($IntBox.*)", sqlair.Named("IntBox", Box[int]{}))
+	c.Assert(db.Query(nil, insertStmt, Box[int]{ID: 1, Value: 10}).Run(), IsNil)
+	c.Assert(db.Query(nil, insertStmt, sqlair.Named("IntBox", Box[int]{ID: 2, Value: 20})).Run(), IsNil)
+
+	var boxes []Box[string]
+	selectStmt := sqlair.MustPrepare("SELECT &StringBox.* FROM box ORDER BY id", sqlair.Named("StringBox", Box[string]{}))
+	c.Assert(db.Query(nil, selectStmt).GetAll(&boxes), IsNil)
+	c.Check(boxes, DeepEquals, []Box[string]{{ID: 1, Value: "10"}, {ID: 2, Value: "20"}})
+
+	// Different instantiations can be used together under different names.
+	var intBox Box[int]
+	var stringBox Box[string]
+	bothStmt := sqlair.MustPrepare("SELECT id AS &IntBox.id, value AS &IntBox.value, &StringBox.value FROM box WHERE id = $IntBox.id",
+		sqlair.Named("IntBox", Box[int]{}), sqlair.Named("StringBox", Box[string]{}))
+	c.Assert(db.Query(nil, bothStmt, Box[int]{ID: 2}).Get(&intBox, &stringBox), IsNil)
+	c.Check(intBox, Equals, Box[int]{ID: 2, Value: 20})
+	c.Check(stringBox, Equals, Box[string]{Value: "20"})
+}
+
+type contactBase struct {
+	ID int `db:"id"`
+}
+
+func (s *PackageSuite) TestUnexportedEmbeddedFields(c *C) {
+	db, err := createTableDB(c, "contact", "id integer, nickname text")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "contact")
+
+	// The tagged fields of an unexported embedded struct are used.
+	type Contact struct {
+		contactBase
+		Nickname string `db:"nickname"`
+	}
+	insertStmt := sqlair.MustPrepare("INSERT INTO contact (*) VALUES ($Contact.*)", Contact{})
+	c.Assert(db.Query(nil, insertStmt, Contact{contactBase{ID: 1}, "Fred"}).Run(), IsNil)
+
+	var contact Contact
+	selectStmt := sqlair.MustPrepare("SELECT &Contact.* FROM contact", Contact{})
+	c.Assert(db.Query(nil, selectStmt).Get(&contact), IsNil)
+	c.Check(contact, Equals, Contact{contactBase{ID: 1}, "Fred"})
+
+	// Tagged fields that cannot be set are reported at Prepare.
+	type Secret struct {
+		ID       int    `db:"id"`
+		nickname string `db:"nickname"`
+	}
+	_, err = sqlair.Prepare("SELECT &Secret.* FROM contact", Secret{})
+	c.Assert(err, ErrorMatches, `cannot prepare statement: field "nickname" of struct Secret not exported`)
+
+	type PointerContact struct {
+		*contactBase
+		Nickname string `db:"nickname"`
+	}
+	_, err = sqlair.Prepare("SELECT &PointerContact.* FROM contact", PointerContact{})
+	c.Assert(err, ErrorMatches, `cannot prepare statement: field "contactBase.ID" of struct PointerContact has db tag but embedded pointer "contactBase" is not exported`)
+}
+
+func (s *PackageSuite) TestInsertDefaultValues(c *C) {
+	db, err := createTableDB(c, "person", "id integer DEFAULT 7, name text DEFAULT 'Nobody', address_id integer, email text")
+	c.Assert(err, IsNil)
+	defer dropTables(c, db, "person")
+
+	insertStmt, err := sqlair.Prepare("INSERT INTO person DEFAULT VALUES")
+	c.Assert(err, IsNil)
+	c.Assert(db.Query(nil, insertStmt).Run(), IsNil)
+
+	// An unused argument is reported as unused.
+	err = db.Query(nil, insertStmt, Person{}).Run()
+	c.Assert(err, ErrorMatches, `invalid input parameter: argument of type "Person" not used by query`)
+
+	returningStmt, err := sqlair.Prepare("INSERT INTO person DEFAULT VALUES RETURNING &Person.*", Person{})
+	c.Assert(err, IsNil)
+	p := Person{}
+	c.Assert(db.Query(nil, returningStmt).Get(&p), IsNil)
+	c.Check(p, Equals, Person{ID: 7, Name: "Nobody"})
+
+	var people []Person
+	selectStmt := sqlair.MustPrepare("SELECT &Person.* FROM person", Person{})
+	c.Assert(db.Query(nil, selectStmt).GetAll(&people), IsNil)
+	c.Check(people, HasLen, 2)
+}
@@ -0,0 +1,154 @@
+// Copyright 2024 Canonical Ltd.
+// Licensed under Apache 2.0, see LICENCE file for details.
+
+package sqlair
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/canonical/sqlair/internal/expr"
+)
+
+// queryIDKey is the context key for query IDs.
+type queryIDKey struct{}
+
+// ContextWithQueryID returns a copy of ctx carrying the query ID id. Queries
+// built with the returned context use id as their query ID.
+func ContextWithQueryID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, queryIDKey{}, id)
+}
+
+// QueryIDFromContext returns the query ID carried by ctx, if any. The context
+// passed to the database driver when a query with an ID is run carries its
+// ID, so it can be used by driver level tracing and metrics.
+func QueryIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(queryIDKey{}).(string)
+	return id, ok
+}
+
+// contextWithQueryID returns a copy of ctx carrying id unless id is empty or
+// ctx already carries it.
+func contextWithQueryID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	if ctxID, ok := QueryIDFromContext(ctx); ok && ctxID == id {
+		return ctx
+	}
+	return ContextWithQueryID(ctx, id)
+}
+
+// WithQueryID sets the ID of a query. It takes precedence over an ID carried
+// by the query context.
+func WithQueryID(id string) QueryOption {
+	return func(qc *queryConfig) {
+		qc.id = id
+	}
+}
+
+// WithQueryIDs makes the DB generate an ID for each query that is not given
+// one with [WithQueryID] or [ContextWithQueryID]. Generated IDs are unique
+// within the process.
+func WithQueryIDs() DBOption {
+	return func(dc *dbConfig) {
+		dc.queryIDs = true
+	}
+}
+
+// WithQueryIDComments makes the DB append the ID of each query with one to its
+// SQL in a trailing comment, e.g. /* sqlair_query_id: 2f1a9c3e-1 */. This makes
+// the ID visible in the logs of the database.
+func WithQueryIDComments() DBOption {
+	return func(dc *dbConfig) {
+		dc.queryIDComments = true
+	}
+}
+
+// queryIDPrefix makes generated query IDs unique to this process.
+var queryIDPrefix = func() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "sqlair"
+	}
+	return hex.EncodeToString(b)
+}()
+
+// queryIDCount is the number of query IDs generated.
+var queryIDCount uint64
+
+// newQueryID generates a query ID unique within the process.
+func newQueryID() string {
+	n := atomic.AddUint64(&queryIDCount, 1)
+	return queryIDPrefix + "-" + strconv.FormatUint(n, 36)
+}
+
+// queryID returns the ID for a query with the given context and options. It
+// returns the empty string if the query has no ID.
+func (dc *dbConfig) queryID(ctx context.Context, qc *queryConfig) string {
+	if qc.id != "" {
+		return qc.id
+	}
+	if id, ok := QueryIDFromContext(ctx); ok {
+		return id
+	}
+	if dc.queryIDs {
+		return newQueryID()
+	}
+	return ""
+}
+
+// querySQL returns the SQL to send to the database for the query with the
+// given ID.
+func (dc *dbConfig) querySQL(pq *expr.PrimedQuery, id string) string {
+	if !dc.queryIDComments || id == "" {
+		return pq.SQL()
+	}
+	// Put the comment before any trailing semicolon so it stays part of the
+	// statement.
+	sql := strings.TrimRight(pq.SQL(), " \t\r\n")
+	semicolon := ""
+	if strings.HasSuffix(sql, ";") {
+		sql, semicolon = sql[:len(sql)-1], ";"
+	}
+	// Make sure the ID cannot close the comment early.
+	id = strings.ReplaceAll(id, "*/", "* /")
+	return sql + " /* sqlair_query_id: " + id + " */" + semicolon
+}
+
+// QueryError is returned by queries that have an ID. It wraps the error that
+// occurred with the ID of the query.
+type QueryError struct {
+	// QueryID is the ID of the query that failed.
+	QueryID string
+	// Err is the error returned by the query.
+	Err error
+}
+
+// Error returns the error message prefixed with the query ID.
+func (e *QueryError) Error() string {
+	return "query " + e.QueryID + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// wrapQueryError wraps err in a QueryError if the query has an ID and err is
+// not already wrapped.
+func wrapQueryError(id string, err error) error {
+	if id == "" || err == nil {
+		return err
+	}
+	var qe *QueryError
+	if errors.As(err, &qe) && qe.QueryID == id {
+		return err
+	}
+	return &QueryError{QueryID: id, Err: err}
+}
@@ -6,11 +6,18 @@ package sqlair
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
+	"unicode"
 
 	"github.com/canonical/sqlair/internal/expr"
+	"github.com/canonical/sqlair/internal/typeinfo"
 )
 
 // M is a convenience type that can be used in input and output expressions to
@@ -32,9 +39,63 @@ type M map[string]any
 // SQLair to pass a slice of input values.
 type S []any
 
+// Named associates a name with a value so that the value can be referenced
+// by that name in SQLair expressions instead of by the name of its type. This
+// allows anonymous structs and maps to be used as type samples and arguments.
+// Maps and structs of the same type given different names are different
+// arguments, so a struct can be used on both sides of a self join. Arguments
+// of a struct type that are not named are assigned to its names in the order
+// the names are first used in the query. Instantiated generic types, such as
+// Box[int], must be named to be used as type samples.
+//
+// Example:
+//
+//	filter := struct{ ID int `db:"id"` }{ID: 5}
+//	stmt := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE id = $Filter.id", Person{}, sqlair.Named("Filter", filter))
+//	err := db.Query(ctx, stmt, sqlair.Named("Filter", filter)).Get(&p)
+//
+//	stmt := sqlair.MustPrepare("SELECT e.* AS &Employee.*, m.* AS &Boss.* FROM person e JOIN person m ON e.manager_id = m.id",
+//		sqlair.Named("Employee", Person{}), sqlair.Named("Boss", Person{}))
+//	err := db.Query(ctx, stmt).Get(&employee, &boss)
+func Named(name string, value any) any {
+	return typeinfo.NamedArg{Name: name, Value: value}
+}
+
+// As names a map argument so that several maps of the same type can be used
+// in one query, each referenced by its own name. It is the same as [Named].
+//
+// Example:
+//
+//	stmt := sqlair.MustPrepare("UPDATE person SET name = $Update.name WHERE id = $Filter.id", sqlair.As("Filter", sqlair.M{}), sqlair.As("Update", sqlair.M{}))
+//	err := db.Query(ctx, stmt, sqlair.As("Filter", sqlair.M{"id": 30}), sqlair.As("Update", sqlair.M{"name": "Fred"})).Run()
+func As(name string, m any) any {
+	return Named(name, m)
+}
+
+// Null is passed to the database as NULL when it is the value of a map key or
+// of an interface struct field used as an input, whatever the type of the
+// column.
+//
+// Example:
+//
+//	err := db.Query(ctx, stmt, sqlair.M{"id": 30, "nickname": sqlair.Null}).Run()
+var Null driver.Valuer = null{}
+
+// null is the type of Null.
+type null struct{}
+
+// Value returns nil so that the database receives NULL.
+func (null) Value() (driver.Value, error) {
+	return nil, nil
+}
+
 var ErrNoRows = sql.ErrNoRows
 var ErrTXDone = sql.ErrTxDone
 
+// ErrTooManyRows is returned by [Query.GetAll] when the query returns more
+// rows than allowed by [MaxRows].
+var ErrTooManyRows = errors.New("too many rows")
+
 // Statement represents a parsed SQLair statement ready to be run on a database.
 // A statement can be used with any [DB].
 type Statement struct {
@@ -42,24 +103,342 @@ type Statement struct {
 	// generate query values from the input arguments when the Statement is run
 	// on a database.
 	te *expr.TypeBoundExpr
+	// strictColumns, if not nil, overrides whether the database the
+	// Statement is run on rejects result columns not read into any output.
+	strictColumns *bool
+	// multipleStatements is true if the statement may be made up of several
+	// statements.
+	multipleStatements bool
+}
+
+// PrepareOption configures how a query is prepared. Options can be passed to
+// [Prepare] amongst the type samples.
+type PrepareOption func(*prepareConfig)
+
+// prepareConfig holds the configuration set by the PrepareOptions passed to
+// Prepare. Fields added here must also be added to prepareKey.
+type prepareConfig struct {
+	parserOptions expr.ParserOptions
+	bindOptions   expr.BindOptions
+	strictColumns *bool
+}
+
+// prepareKey is the comparable form of a prepareConfig. Statements prepared
+// from the same query and type samples with equal keys are the same.
+type prepareKey struct {
+	parserOptions    expr.ParserOptions
+	fieldNames       bool
+	declarationOrder bool
+	strictColumnsSet bool
+	strictColumns    bool
+}
+
+// key returns the comparable form of the configuration. It returns false if
+// the configuration holds column mappers or scanners, which are functions and
+// cannot be compared.
+func (pc *prepareConfig) key() (prepareKey, bool) {
+	if len(pc.bindOptions.ColumnMappers) != 0 || len(pc.bindOptions.Scanners) != 0 {
+		return prepareKey{}, false
+	}
+	key := prepareKey{
+		parserOptions:    pc.parserOptions,
+		fieldNames:       pc.bindOptions.FieldNames,
+		declarationOrder: pc.bindOptions.DeclarationOrder,
+	}
+	if pc.strictColumns != nil {
+		key.strictColumnsSet = true
+		key.strictColumns = *pc.strictColumns
+	}
+	return key, true
+}
+
+// BackslashEscapes enables MySQL style backslash escapes in quoted string
+// literals, e.g. 'O\'Donnell'. By default, only the standard SQL escape of a
+// doubled up quote is recognised.
+func BackslashEscapes() PrepareOption {
+	return func(pc *prepareConfig) {
+		pc.parserOptions.BackslashEscapes = true
+	}
+}
+
+// StrictColumns sets whether running the statement returns an error when
+// decoding a row with result columns that are not read into any output,
+// overriding the setting of the database it is run on. Passing true rejects
+// such columns even on a database created without [WithStrictColumns], and
+// passing false skips them even on a database created with it. The
+// [AllowUnmappedColumns] query option still applies to a single query.
+func StrictColumns(strict bool) PrepareOption {
+	return func(pc *prepareConfig) {
+		pc.strictColumns = &strict
+	}
+}
+
+// MaxQueryLength sets the maximum length in bytes of a query that can be
+// prepared. Longer queries are rejected without being parsed. A length of
+// zero or less means there is no limit. The default limit is 1 MiB.
+func MaxQueryLength(length int) PrepareOption {
+	return func(pc *prepareConfig) {
+		if length <= 0 {
+			length = -1
+		}
+		pc.parserOptions.MaxQueryLength = length
+	}
+}
+
+// MaxExpressions sets the maximum number of SQLair input and output
+// expressions in a query that can be prepared. A number of zero or less means
+// there is no limit. The default limit is 65536.
+func MaxExpressions(n int) PrepareOption {
+	return func(pc *prepareConfig) {
+		if n <= 0 {
+			n = -1
+		}
+		pc.parserOptions.MaxExpressions = n
+	}
+}
+
+// MultipleStatements allows a query to be made up of several statements
+// separated by semicolons. Each statement that returns rows produces its own
+// result set, which is read by moving to it with [Iterator.NextResultSet].
+// Output expressions are placed in the statement whose result set they are
+// decoded from, and the same outputs can be used in each statement. The
+// database driver must support multiple result sets.
+func MultipleStatements() PrepareOption {
+	return func(pc *prepareConfig) {
+		pc.parserOptions.MultipleStatements = true
+	}
+}
+
+// FieldNames maps exported struct fields with no db tag to the snake case of
+// their field names, e.g. a field FullName is referenced as
+// "$Person.full_name". By default, fields with no db tag are ignored. Fields
+// with a db tag always use their tag and it is an error for a generated name
+// to be the same as a tag.
+func FieldNames() PrepareOption {
+	return func(pc *prepareConfig) {
+		pc.bindOptions.FieldNames = true
+	}
+}
+
+// ColumnOrder specifies the order of the columns generated for the members of
+// a struct type selected with an asterisk, e.g. "&Person.*" or "INSERT INTO
+// person (*) VALUES ($Person.*)".
+type ColumnOrder int
+
+const (
+	// SortedOrder orders the columns by the db tags of the members. This is
+	// the default.
+	SortedOrder ColumnOrder = iota
+	// DeclarationOrder orders the columns as the fields of the struct are
+	// declared. The fields of an embedded struct take the place of the
+	// embedded field.
+	DeclarationOrder
+)
+
+// WithColumnOrder sets the order of the columns generated for the members of
+// struct types selected with an asterisk. By default they are sorted by db
+// tag. Columns that are not generated from an asterisk are in the order they
+// are written in the query.
+func WithColumnOrder(order ColumnOrder) PrepareOption {
+	return func(pc *prepareConfig) {
+		pc.bindOptions.DeclarationOrder = order == DeclarationOrder
+	}
+}
+
+// MapColumns sets the function used to generate the columns of the members of
+// a struct type when they are selected with an asterisk, e.g. "&Person.*".
+// The type is given by the name it is referred to by in the query. The mapper
+// is passed the type name and the db tag of each member and returns the
+// column to select it from. By default the column is the db tag. This allows
+// one struct to be used with tables that name their columns differently.
+func MapColumns(typeName string, mapper func(typeName string, memberTag string) string) PrepareOption {
+	return func(pc *prepareConfig) {
+		if pc.bindOptions.ColumnMappers == nil {
+			pc.bindOptions.ColumnMappers = map[string]typeinfo.ColumnMapper{}
+		}
+		pc.bindOptions.ColumnMappers[typeName] = mapper
+	}
+}
+
+// RegisterScanner sets a function used to scan a result column into a member
+// of a struct type, where the type is given by the name it is referred to by
+// in the query. The scanner is passed a pointer to the struct and the value
+// of the column as returned by the driver, which can be nil. This allows a
+// column to be transformed when it is read, or read using setter methods.
+//
+// If the member is a db tag of the struct then the scanner is used in place
+// of setting the tagged field, including when the struct is selected with an
+// asterisk. Otherwise the member can only be used in output expressions that
+// name it, e.g. "&Person.full_name".
+//
+// Example:
+//
+//	stmt := sqlair.MustPrepare("SELECT first || ' ' || last AS &Person.full_name FROM person", Person{},
+//		sqlair.RegisterScanner("Person", "full_name", func(dest any, v any) error {
+//			s, ok := v.(string)
+//			if !ok {
+//				return fmt.Errorf("expected string, got %T", v)
+//			}
+//			return dest.(*Person).SetFullName(s)
+//		}))
+func RegisterScanner(typeName string, member string, scanner func(dest any, v any) error) PrepareOption {
+	return func(pc *prepareConfig) {
+		if pc.bindOptions.Scanners == nil {
+			pc.bindOptions.Scanners = map[string]map[string]typeinfo.MemberScanner{}
+		}
+		if pc.bindOptions.Scanners[typeName] == nil {
+			pc.bindOptions.Scanners[typeName] = map[string]typeinfo.MemberScanner{}
+		}
+		pc.bindOptions.Scanners[typeName][member] = scanner
+	}
+}
+
+// RegisterType registers sample instantiations of types so that they can be
+// used in the SQLair expressions of any query without being passed to
+// [Prepare]. Type samples passed to Prepare are used alongside the registered
+// types and take precedence over a registered type with the same name. It is
+// an error to register two different types with the same name, such as types
+// named Person from two packages. A type sample wrapped in [Named] is
+// registered under that name, which allows anonymous structs to be
+// registered.
+//
+// Example:
+//
+//	err := sqlair.RegisterType(Person{}, Address{})
+//	stmt := sqlair.MustPrepare("SELECT &Person.* FROM person WHERE address_id = $Address.id")
+func RegisterType(typeSamples ...any) error {
+	if err := typeinfo.RegisterTypes(typeSamples); err != nil {
+		return fmt.Errorf("cannot register types: %s", err)
+	}
+	return nil
+}
+
+// extractPrepareOptions removes any PrepareOptions from the type samples and
+// returns the configuration they specify along with the remaining type
+// samples.
+func extractPrepareOptions(typeSamples []any) (*prepareConfig, []any) {
+	pc := &prepareConfig{}
+	var samples []any
+	for _, ts := range typeSamples {
+		if opt, ok := ts.(PrepareOption); ok {
+			opt(pc)
+			continue
+		}
+		samples = append(samples, ts)
+	}
+	return pc, samples
 }
 
 // Prepare validates SQLair expressions in the query and generates a
 // [Statement].
 // The type samples must contain an instance of every type mentioned in the
 // SQLair expressions in the query. These are used only for type information.
+// A pointer to an instance, such as the one later passed to [Query.Get], may
+// be used in place of the instance. Nil pointers are rejected.
+// Any [PrepareOption] values passed amongst the type samples configure how
+// the query is prepared.
+// The query must be a single SQL statement unless the [MultipleStatements]
+// option is passed. Semicolons inside BEGIN ... END and CASE ... END blocks,
+// such as those in the body of a trigger, and inside dollar quoted strings,
+// such as $$ ... $$ function bodies in PostgreSQL, do not end the statement.
+// Any comments following a final semicolon are dropped.
 func Prepare(query string, typeSamples ...any) (*Statement, error) {
-	parser := expr.NewParser()
+	pc, typeSamples := extractPrepareOptions(typeSamples)
+	return prepare(query, pc, typeSamples)
+}
+
+// prepare generates a Statement from the query with the given configuration
+// and type samples.
+func prepare(query string, pc *prepareConfig, typeSamples []any) (*Statement, error) {
+	return prepareWith(query, pc, func(pe *expr.ParsedExpr) (*expr.TypeBoundExpr, error) {
+		return pe.BindTypesWithOptions(pc.bindOptions, typeSamples...)
+	})
+}
+
+// PrepareTypes is the same as [Prepare] except that it takes the types
+// mentioned in the SQLair expressions directly rather than samples of them.
+// This avoids constructing values of the types.
+func PrepareTypes(query string, types []reflect.Type, opts ...PrepareOption) (*Statement, error) {
+	pc := &prepareConfig{}
+	for _, opt := range opts {
+		opt(pc)
+	}
+	return prepareWith(query, pc, func(pe *expr.ParsedExpr) (*expr.TypeBoundExpr, error) {
+		return pe.BindReflectTypesWithOptions(pc.bindOptions, types)
+	})
+}
+
+// prepareWith generates a Statement from the query with the given
+// configuration, binding the types of the parsed query with bindTypes.
+func prepareWith(query string, pc *prepareConfig, bindTypes func(*expr.ParsedExpr) (*expr.TypeBoundExpr, error)) (*Statement, error) {
+	parser := expr.NewParserWithOptions(pc.parserOptions)
 	parsedExpr, err := parser.Parse(query)
 	if err != nil {
 		return nil, err
 	}
-	typedExpr, err := parsedExpr.BindTypes(typeSamples...)
+	typedExpr, err := bindTypes(parsedExpr)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Statement{te: typedExpr}, nil
+	return &Statement{te: typedExpr, strictColumns: pc.strictColumns, multipleStatements: pc.parserOptions.MultipleStatements}, nil
+}
+
+// Fingerprint returns a hash of the structure of the statement and the SQL it
+// generates independent of the input arguments. Changes to whitespace in the
+// query outside of string literals do not change the fingerprint, while
+// changes to the SQL or to the types and members used do.
+//
+// The fingerprint of a statement is stable across patch releases of SQLair.
+// Any change to fingerprints in a minor or major release is noted in the
+// release notes.
+func (s *Statement) Fingerprint() string {
+	return s.te.Fingerprint()
+}
+
+// TypeRef refers to a member of a Go type used in a [Statement].
+type TypeRef struct {
+	// Type is the type of the argument.
+	Type reflect.Type
+	// Member is the db tag of a struct field or the key of a map. It is empty
+	// for slices and for results read into a map at the key of the column
+	// name.
+	Member string
+}
+
+// Inputs returns the members of the Go types used as inputs to the statement.
+// Each member is listed once, in the order it first appears in the query.
+func (s *Statement) Inputs() []TypeRef {
+	var refs []TypeRef
+	for _, input := range s.te.Inputs() {
+		refs = append(refs, TypeRef{Type: typeinfo.BaseType(input.ArgType()), Member: input.Member()})
+	}
+	return refs
+}
+
+// Outputs returns the members of the Go types that the results of the
+// statement are read into, in the order they appear in the query.
+func (s *Statement) Outputs() []TypeRef {
+	var refs []TypeRef
+	for _, output := range s.te.Outputs() {
+		refs = append(refs, TypeRef{Type: typeinfo.BaseType(output.ArgType()), Member: output.Member()})
+	}
+	return refs
+}
+
+// Render binds the input arguments to the statement in the same way as
+// [DB.Query] and returns the SQL and the parameters that would be passed to the
+// database, without running the query. Slices are expanded and bulk inserts
+// generate a row of placeholders per element. The placeholders are written in
+// the default parameter style. The values of struct fields with the redact
+// option are replaced by the string "[REDACTED]".
+func (s *Statement) Render(inputArgs ...any) (sql string, params []any, err error) {
+	config, inputArgs := extractQueryOptions(inputArgs)
+	pq, err := s.te.BindInputsWithStyle(config.paramStyle(expr.DefaultParamStyle), inputArgs...)
+	if err != nil {
+		return "", nil, err
+	}
+	return pq.SQL(), pq.RedactedParams(), nil
 }
 
 // MustPrepare is the same as [Prepare] except that it panics on error.
@@ -73,11 +452,202 @@ func MustPrepare(query string, typeSamples ...any) *Statement {
 
 type DB struct {
 	sqldb *sql.DB
+	// config is set by the DBOptions passed to NewDB.
+	config dbConfig
+	// inlineStmts caches the statements prepared by DB.Exec and DB.Get by
+	// their query and configuration.
+	inlineStmts      *lruCache[inlineKey, []inlineStmt]
+	inlineStmtsMutex sync.Mutex
+	// stmts caches the statements prepared on the database. It is nil if
+	// the DB was not created with WithStmtCache.
+	stmts *stmtCache
+	// singleConnWarning ensures the warning about iterating on a database
+	// with a single connection is only given once.
+	singleConnWarning sync.Once
+}
+
+// DBOption configures a [DB]. Options are passed to [NewDB].
+type DBOption func(*dbConfig)
+
+// dbConfig holds the configuration set by the DBOptions passed to NewDB.
+// Transactions started on a DB share its configuration.
+type dbConfig struct {
+	// paramStyle specifies how query parameters are written in the SQL sent
+	// to the database.
+	paramStyle expr.ParamStyle
+	// queryIDs is true if an ID is generated for queries not given one.
+	queryIDs bool
+	// queryIDComments is true if query IDs are appended to the SQL in a
+	// comment.
+	queryIDComments bool
+	// tracer is told about each query run. It is nil if queries are not
+	// traced.
+	tracer Tracer
+	// strictColumns is true if result columns not read into any output are
+	// an error.
+	strictColumns bool
+	// stmtCache is true if the statements prepared on the database are
+	// cached.
+	stmtCache bool
+	// untaggedFields is true if the statements prepared by the DB reference
+	// struct fields with no db tag by the snake case of their names.
+	untaggedFields bool
+	// warn is called with warnings about how the DB is used. It is nil if
+	// warnings are not reported.
+	warn func(message string)
+	// err is the error from an invalid DBOption. It is returned by the
+	// queries run on the DB.
+	err error
+}
+
+// ParamStyle specifies how query parameters are written in the SQL that
+// SQLair sends to the database.
+type ParamStyle int
+
+const (
+	// At writes named parameters of the form @sqlair_0. This is the default.
+	At ParamStyle = iota
+	// Colon writes named parameters of the form :sqlair_0.
+	Colon
+	// Dollar writes named parameters of the form $sqlair_0.
+	Dollar
+	// Question writes positional parameters of the form ?. The parameters
+	// are passed to the database in order rather than by name. Queries that
+	// contain a ? outside of quotes, such as the PostgreSQL JSON operators
+	// ?, ?| and ?&, cannot be run in this style.
+	Question
+)
+
+// WithParamStyle sets the style of the query parameters in the SQL sent to
+// the database. It should be used with drivers that do not accept the
+// default style.
+func WithParamStyle(style ParamStyle) DBOption {
+	return func(dc *dbConfig) {
+		dc.paramStyle.Prefix, dc.paramStyle.Positional = "", false
+		switch style {
+		case Colon:
+			dc.paramStyle.Prefix = ":"
+		case Dollar:
+			dc.paramStyle.Prefix = "$"
+		case Question:
+			dc.paramStyle.Positional = true
+		default:
+			dc.paramStyle.Prefix = expr.DefaultParamStyle.Prefix
+		}
+	}
+}
+
+// WithParamPrefix sets the prefix written before the name of each named query
+// parameter in the SQL sent to the database, e.g. ":" for :sqlair_0.
+func WithParamPrefix(prefix string) DBOption {
+	return func(dc *dbConfig) {
+		dc.paramStyle.Prefix, dc.paramStyle.Positional = prefix, false
+	}
+}
+
+// WithMarkerPrefix sets the name that the query parameters and the output
+// marker columns in the SQL sent to the database start with. By default they
+// are named "sqlair", e.g. @sqlair_0 and _sqlair_0, and with the prefix
+// "myapp" they are @myapp_0 and _myapp_0. A trailing underscore in the prefix
+// is ignored so "myapp_" is the same as "myapp". The prefix must be written in
+// lower case letters, digits and underscores, otherwise queries run on the DB
+// return an error.
+func WithMarkerPrefix(prefix string) DBOption {
+	return func(dc *dbConfig) {
+		marker := strings.TrimSuffix(prefix, "_")
+		if err := expr.CheckMarker(marker); err != nil {
+			dc.err = fmt.Errorf("invalid marker prefix: %s", err)
+			return
+		}
+		dc.paramStyle.Marker = marker
+	}
+}
+
+// WithReusedParams passes an input member that appears more than once in a
+// query, e.g. $Person.name in "WHERE a = $Person.name OR b = $Person.name", to
+// the database as a single named parameter. By default each appearance is
+// passed as a separate parameter with the same value. It has no effect with
+// the Question parameter style.
+func WithReusedParams() DBOption {
+	return func(dc *dbConfig) {
+		dc.paramStyle.ReuseParams = true
+	}
+}
+
+// WithAllowUnusedArgs makes queries ignore input arguments whose types are not
+// used by the query. By default passing such an argument is an error. The
+// [AllowUnusedArgs] query option does the same for a single query.
+func WithAllowUnusedArgs() DBOption {
+	return func(dc *dbConfig) {
+		dc.paramStyle.AllowUnusedArgs = true
+	}
+}
+
+// WithStrictColumns makes queries return an error when decoding a row with
+// result columns that are not read into any output, such as those of a
+// "SELECT *" written alongside output expressions. The error lists the
+// columns. By default such columns are skipped. The [StrictColumns] prepare
+// option overrides this for a statement and the [AllowUnmappedColumns] query
+// option skips the columns for a single query.
+func WithStrictColumns() DBOption {
+	return func(dc *dbConfig) {
+		dc.strictColumns = true
+	}
+}
+
+// WithUntaggedFields makes the statements prepared by the DB with [DB.Exec],
+// [DB.Get] and [DB.PrepareContext] include struct fields with no db tag, as
+// if the [FieldNames] option was passed to each of them. Statements prepared
+// with [Prepare] are not affected.
+func WithUntaggedFields() DBOption {
+	return func(dc *dbConfig) {
+		dc.untaggedFields = true
+	}
+}
+
+// WithWarnings makes the DB call warn with warnings about how it is used that
+// are likely to cause problems. A warning is given when an [Iterator] over a
+// query that is not [Buffered] is created on a database that only allows a
+// single open connection, such as dqlite, since other queries on the database
+// then block until the Iterator is closed.
+func WithWarnings(warn func(message string)) DBOption {
+	return func(dc *dbConfig) {
+		dc.warn = warn
+	}
+}
+
+// prepareConfig returns the configuration set by the PrepareOptions with
+// the options of the DB applied.
+func (dc *dbConfig) prepareConfig(pc *prepareConfig) *prepareConfig {
+	if dc.untaggedFields {
+		pc.bindOptions.FieldNames = true
+	}
+	return pc
 }
 
 // NewDB creates a new [sqlair.DB] from a [sql.DB].
-func NewDB(sqldb *sql.DB) *DB {
-	return &DB{sqldb: sqldb}
+func NewDB(sqldb *sql.DB, opts ...DBOption) *DB {
+	db := &DB{
+		sqldb:       sqldb,
+		config:      dbConfig{paramStyle: expr.DefaultParamStyle},
+		inlineStmts: newLRUCache[inlineKey, []inlineStmt](inlineStmtCacheSize, nil),
+	}
+	for _, opt := range opts {
+		opt(&db.config)
+	}
+	if db.config.stmtCache {
+		db.stmts = newStmtCache(sqldb)
+	}
+	return db
+}
+
+// Close closes the statements cached on a DB created with [WithStmtCache] and
+// then closes the underlying database.
+func (db *DB) Close() error {
+	if db.stmts != nil {
+		db.stmts.close()
+	}
+	return db.sqldb.Close()
 }
 
 // PlainDB returns the underlying database object.
@@ -85,23 +655,166 @@ func (db *DB) PlainDB() *sql.DB {
 	return db.sqldb
 }
 
+// QueryOption configures how a query is run. Options can be passed to
+// [DB.Query] and [TX.Query] amongst the input arguments.
+type QueryOption func(*queryConfig)
+
+// queryConfig holds the configuration set by the QueryOptions passed to a
+// query.
+type queryConfig struct {
+	// buffered is true if the query results should be read into memory
+	// before they are iterated over.
+	buffered bool
+	// id is the query ID set with the WithQueryID option.
+	id string
+	// merge is true if NULL columns should leave the existing values of the
+	// output arguments unchanged.
+	merge bool
+	// allowUnusedArgs is true if input arguments not used by the query
+	// should be ignored.
+	allowUnusedArgs bool
+	// allowUnmappedColumns is true if result columns not read into any
+	// output should be skipped whatever the setting of the statement or
+	// database.
+	allowUnmappedColumns bool
+	// strictColumns is true if result columns not read into any output are
+	// an error. It is set by inherit.
+	strictColumns bool
+}
+
+// Buffered makes the query read all of its results into memory as soon as it
+// is run, releasing the database connection before the results are decoded.
+// The results can still be read with [Query.Iter], [Query.Get] and
+// [Query.GetAll].
+//
+// Buffered should be used when iterating over results on a database with a
+// single connection (e.g. dqlite), otherwise other queries on the database
+// will block until the [Iterator] is closed.
+func Buffered() QueryOption {
+	return func(qc *queryConfig) {
+		qc.buffered = true
+	}
+}
+
+// MergeInto makes the query decode its results into the output arguments
+// without clobbering values that the results do not provide. Columns that are
+// not NULL overwrite the value they are read into, NULL columns leave the
+// existing value unchanged, as do columns that are not in the results.
+//
+// Without MergeInto, a NULL column sets a pointer field to nil and any other
+// field to its zero value.
+func MergeInto() QueryOption {
+	return func(qc *queryConfig) {
+		qc.merge = true
+	}
+}
+
+// AllowUnusedArgs makes the query ignore input arguments whose types are not
+// used by the query rather than returning an error. This is useful when the
+// arguments passed are a superset of those the query needs.
+func AllowUnusedArgs() QueryOption {
+	return func(qc *queryConfig) {
+		qc.allowUnusedArgs = true
+	}
+}
+
+// AllowUnmappedColumns makes the query skip result columns that are not read
+// into any output, as it does by default, when the statement or database is
+// strict about them. This is useful when the SQL returns more columns than the
+// query reads, e.g. "SELECT *, &Person.id FROM person".
+func AllowUnmappedColumns() QueryOption {
+	return func(qc *queryConfig) {
+		qc.allowUnmappedColumns = true
+	}
+}
+
+// inherit sets the options of the query that are set on its statement or
+// database. Options set on the statement take precedence over those set on
+// the database.
+func (qc *queryConfig) inherit(s *Statement, dc *dbConfig) {
+	switch {
+	case qc.allowUnmappedColumns:
+		qc.strictColumns = false
+	case s.strictColumns != nil:
+		qc.strictColumns = *s.strictColumns
+	default:
+		qc.strictColumns = dc.strictColumns
+	}
+}
+
+// paramStyle returns the parameter style to bind the inputs of a query with,
+// taking into account the options of the query.
+func (qc *queryConfig) paramStyle(style expr.ParamStyle) expr.ParamStyle {
+	if qc.allowUnusedArgs {
+		style.AllowUnusedArgs = true
+	}
+	return style
+}
+
+// extractQueryOptions removes any QueryOptions from the input arguments and
+// returns the configuration they specify along with the remaining input
+// arguments.
+func extractQueryOptions(inputArgs []any) (*queryConfig, []any) {
+	qc := &queryConfig{}
+	var args []any
+	for _, arg := range inputArgs {
+		if opt, ok := arg.(QueryOption); ok {
+			opt(qc)
+			continue
+		}
+		args = append(args, arg)
+	}
+	return qc, args
+}
+
 // Query represents a query on a database. It is designed to be run once.
 type Query struct {
 	// run executes the Query against the DB or the TX.
-	run func(context.Context) (*sql.Rows, sql.Result, error)
-	ctx context.Context
-	err error
-	pq  *expr.PrimedQuery
+	run    func(context.Context) (*sql.Rows, sql.Result, error)
+	ctx    context.Context
+	err    error
+	pq     *expr.PrimedQuery
+	config *queryConfig
+	// db is the database the query is run on. It is nil if the query is run
+	// in a transaction.
+	db *DB
+	// id identifies the query in errors, on the context passed to the driver
+	// and optionally in the SQL. It is empty if the query has no ID.
+	id string
+	// timeout limits the time the query runs for. It is zero if there is no
+	// timeout.
+	timeout time.Duration
+	// sql is the SQL sent to the database.
+	sql string
+	// tracer is told about the query once it has run. It is nil if the
+	// query is not traced.
+	tracer Tracer
 }
 
 // Iterator is used to iterate over the results of the query.
 type Iterator struct {
 	pq      *expr.PrimedQuery
-	rows    *sql.Rows
+	rows    resultRows
 	cols    []string
 	err     error
 	result  sql.Result
 	started bool
+	// queryID is the ID of the query being iterated over, if it has one.
+	queryID string
+	// merge is true if NULL columns leave the existing values of the output
+	// arguments unchanged.
+	merge bool
+	// strictColumns is true if result columns not read into any output are
+	// an error. columnsChecked is true once the columns of the current result
+	// set have been checked.
+	strictColumns  bool
+	columnsChecked bool
+	// cancel releases the context derived for a query with a timeout. It
+	// is nil if the query has no timeout.
+	cancel context.CancelFunc
+	// trace is the trace of the query, it is nil if the query is not traced
+	// or the trace has ended.
+	trace *queryTrace
 }
 
 // Query builds a new query from a context, a [Statement] and the input
@@ -112,21 +825,53 @@ func (db *DB) Query(ctx context.Context, s *Statement, inputArgs ...any) *Query
 		ctx = context.Background()
 	}
 
-	pq, err := s.te.BindInputs(inputArgs...)
+	if db.config.err != nil {
+		return &Query{ctx: ctx, err: db.config.err}
+	}
+
+	config, inputArgs := extractQueryOptions(inputArgs)
+	config.inherit(s, &db.config)
+	id := db.config.queryID(ctx, config)
+	ctx = contextWithQueryID(ctx, id)
+	pq, err := s.te.BindInputsWithStyle(config.paramStyle(db.config.paramStyle), inputArgs...)
 	if err != nil {
-		return &Query{ctx: ctx, err: err}
+		return &Query{ctx: ctx, err: err, id: id}
 	}
+	sqlStr := db.config.querySQL(pq, id)
 
 	run := func(innerCtx context.Context) (rows *sql.Rows, result sql.Result, err error) {
+		if useStmtCache(db.stmts, s, pq, sqlStr) {
+			return db.stmts.run(innerCtx, nil, sqlStr, pq)
+		}
 		if pq.HasOutputs() {
-			rows, err = db.sqldb.QueryContext(innerCtx, pq.SQL(), pq.Params()...)
+			rows, err = db.sqldb.QueryContext(innerCtx, sqlStr, pq.Params()...)
 		} else {
-			result, err = db.sqldb.ExecContext(innerCtx, pq.SQL(), pq.Params()...)
+			result, err = db.sqldb.ExecContext(innerCtx, sqlStr, pq.Params()...)
 		}
 		return rows, result, err
 	}
 
-	return &Query{pq: pq, run: run, ctx: ctx, err: nil}
+	return &Query{pq: pq, run: run, ctx: ctx, err: nil, config: config, db: db, id: id, sql: sqlStr, tracer: db.config.tracer}
+}
+
+// warnSingleConn warns, once, if the database only allows a single open
+// connection since an unbuffered Iterator holds the connection until it is
+// closed.
+func (db *DB) warnSingleConn() {
+	if db.config.warn == nil || db.sqldb.Stats().MaxOpenConnections != 1 {
+		return
+	}
+	db.singleConnWarning.Do(func() {
+		db.config.warn("iterating over query results on a database with a single connection blocks other queries until the iterator is closed, use sqlair.Buffered() to avoid deadlocks")
+	})
+}
+
+// WithTimeout sets a timeout for running the query. The query is run with a
+// context derived from the one it was built with which is cancelled after the
+// timeout, or once the query's results have been read.
+func (q *Query) WithTimeout(timeout time.Duration) *Query {
+	q.timeout = timeout
+	return q
 }
 
 // Run is used to run a query on a database and disregard any results.
@@ -137,11 +882,21 @@ func (q *Query) Run() error {
 
 // Get runs the query and decodes the first row returned into the provided output
 // arguments. It returns [ErrNoRows] if output arguments were provided but no
-// results were found.
+// results were found. Maps may be passed by pointer, in which case a nil map
+// is replaced with a new one. Structs and maps can be passed together in any
+// order, each column is decoded into the argument of the type named in its
+// output expression.
 //
 // A pointer to an empty [Outcome] struct may be provided as the first output
 // variable to fill it with information about query execution.
-func (q *Query) Get(outputArgs ...any) error {
+//
+// If the query has a single output column, a pointer to a single value such as
+// a *string may be passed instead of the output type. The output column is
+// scanned into it.
+func (q *Query) Get(outputArgs ...any) (err error) {
+	defer func() {
+		err = wrapQueryError(q.id, err)
+	}()
 	if q.err != nil {
 		return q.err
 	}
@@ -153,11 +908,10 @@ func (q *Query) Get(outputArgs ...any) error {
 		}
 	}
 	if !q.pq.HasOutputs() && len(outputArgs) > 0 {
-		return fmt.Errorf("cannot get results: output variables provided but not referenced in query")
+		return fmt.Errorf("cannot get results: %s", noOutputsError(outputArgs))
 	}
 
-	var err error
-	iter := q.Iter()
+	iter := q.iter()
 	if outcome != nil {
 		err = iter.Get(outcome)
 	}
@@ -177,25 +931,82 @@ func (q *Query) Get(outputArgs ...any) error {
 	return err
 }
 
+// noOutputsError returns the error for output arguments passed to a query
+// with no output expressions, such as "SELECT * FROM person". If the first
+// argument is a struct or map, or a slice of them, an output expression for it
+// is suggested.
+func noOutputsError(outputArgs []any) error {
+	var name string
+	if na, ok := outputArgs[0].(typeinfo.NamedArg); ok {
+		name = na.Name
+	} else {
+		t := reflect.TypeOf(outputArgs[0])
+		for t != nil && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice) {
+			t = t.Elem()
+		}
+		if t != nil && (t.Kind() == reflect.Struct || t.Kind() == reflect.Map) && !typeinfo.IsValueOutput(reflect.New(t).Interface()) {
+			name = t.Name()
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("output variables provided but not referenced in query")
+	}
+	return fmt.Errorf(`output variables provided but not referenced in query, use an output expression such as "&%s.*" to read columns into %s`, name, name)
+}
+
 // Iter returns an [Iterator] to iterate through the results row by row.
 // [Iterator.Close] must be run once iteration is finished.
+//
+// Unless the query is [Buffered], the Iterator holds a database connection
+// until it is closed. On a database with a single connection, such as dqlite,
+// other queries block until then. A DB created with [WithWarnings] warns about
+// this.
 func (q *Query) Iter() *Iterator {
+	if q.err == nil && q.db != nil && !q.config.buffered && q.pq.HasOutputs() {
+		q.db.warnSingleConn()
+	}
+	return q.iter()
+}
+
+// iter runs the query and returns an Iterator over the results.
+func (q *Query) iter() *Iterator {
 	if q.err != nil {
-		return &Iterator{err: q.err}
+		return &Iterator{err: q.err, queryID: q.id}
+	}
+
+	ctx := q.ctx
+	var cancel context.CancelFunc
+	if q.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, q.timeout)
 	}
 
 	var cols []string
-	rows, result, err := q.run(q.ctx)
-	if q.pq.HasOutputs() {
+	var rows resultRows
+	trace := newQueryTrace(q.tracer, q.sql, q.id)
+	sqlRows, result, err := q.run(ctx)
+	if q.pq.HasOutputs() && err == nil {
+		if q.config.buffered {
+			rows, err = bufferRows(sqlRows)
+		} else {
+			rows = sqlRows
+		}
 		if err == nil { // if err IS nil
 			cols, err = rows.Columns()
 		}
 	}
 	if err != nil {
-		return &Iterator{pq: q.pq, err: err}
+		if cancel != nil {
+			cancel()
+		}
+		return &Iterator{pq: q.pq, err: err, queryID: q.id, trace: trace}
+	}
+	if rows == nil && cancel != nil {
+		// The statement has been executed, there are no rows to read.
+		cancel()
+		cancel = nil
 	}
 
-	return &Iterator{pq: q.pq, rows: rows, cols: cols, err: err, result: result}
+	return &Iterator{pq: q.pq, rows: rows, cols: cols, err: err, result: result, queryID: q.id, merge: q.config.merge, strictColumns: q.config.strictColumns, cancel: cancel, trace: trace}
 }
 
 // Next prepares the next row for [Iterator.Get]. If an error occurs during
@@ -205,7 +1016,38 @@ func (iter *Iterator) Next() bool {
 	if iter.err != nil || iter.rows == nil {
 		return false
 	}
-	return iter.rows.Next()
+	if !iter.rows.Next() {
+		return false
+	}
+	if iter.trace != nil {
+		iter.trace.info.Rows++
+	}
+	return true
+}
+
+// NextResultSet moves the iterator to the next result set of a query made up
+// of several statements, see [MultipleStatements]. The rows of the result set
+// are then read with [Iterator.Next] and [Iterator.Get], which decode them
+// into the outputs of the statement that produced it. NextResultSet returns
+// false if there is no further result set or an error occurred, in which case
+// the error is returned by [Iterator.Close].
+func (iter *Iterator) NextResultSet() bool {
+	if iter.err != nil || iter.rows == nil {
+		return false
+	}
+	if !iter.rows.NextResultSet() {
+		iter.err = iter.rows.Err()
+		return false
+	}
+	cols, err := iter.rows.Columns()
+	if err != nil {
+		iter.err = err
+		return false
+	}
+	iter.cols = cols
+	iter.columnsChecked = false
+	iter.started = false
+	return true
 }
 
 // Get decodes the result from the previous [Iterator.Next] call into the
@@ -215,12 +1057,18 @@ func (iter *Iterator) Next() bool {
 // struct may be passed to Get as the only argument to fill it information
 // about query execution.
 func (iter *Iterator) Get(outputArgs ...any) (err error) {
+	defer func() {
+		err = wrapQueryError(iter.queryID, err)
+	}()
 	if iter.err != nil {
 		return iter.err
 	}
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("cannot get result: %s", err)
+			if iter.trace != nil && iter.trace.err == nil {
+				iter.trace.err = err
+			}
 		}
 	}()
 
@@ -238,33 +1086,125 @@ func (iter *Iterator) Get(outputArgs ...any) (err error) {
 		return fmt.Errorf("iteration ended")
 	}
 
-	ptrs, onSuccess, err := iter.pq.ScanArgs(iter.cols, outputArgs)
+	ptrs, onSuccess, err := iter.pq.ScanArgs(iter.cols, outputArgs, iter.merge)
 	if err != nil {
 		return err
 	}
+	if iter.strictColumns && !iter.columnsChecked {
+		if err := iter.pq.CheckColumnsMapped(iter.cols); err != nil {
+			return err
+		}
+		iter.columnsChecked = true
+	}
 	if err := iter.rows.Scan(ptrs...); err != nil {
-		return err
+		return iter.scanError(err)
 	}
 	onSuccess()
 	return nil
 }
 
+// scanError returns an error naming the column of the current row that could
+// not be scanned. The column is found from the index in the error returned by
+// database/sql, rather than by scanning the row again, as scanning can have
+// side effects.
+func (iter *Iterator) scanError(err error) error {
+	var i int
+	if _, scanErr := fmt.Sscanf(err.Error(), "sql: Scan error on column index %d,", &i); scanErr != nil {
+		return err
+	}
+	return iter.pq.ScanError(iter.cols, i, err)
+}
+
 // Close finishes the iteration and returns any errors encountered. Close can
 // be called multiple times on the [Iterator] and the same error will be
 // returned.
-func (iter *Iterator) Close() error {
+func (iter *Iterator) Close() (err error) {
+	defer func() {
+		err = wrapQueryError(iter.queryID, err)
+	}()
+	defer func() {
+		iter.endTrace(err)
+	}()
 	iter.started = true
 	if iter.rows == nil {
 		return iter.err
 	}
-	err := iter.rows.Close()
+	err = iter.rows.Close()
 	iter.rows = nil
+	if iter.cancel != nil {
+		iter.cancel()
+		iter.cancel = nil
+	}
 	if iter.err != nil {
 		return iter.err
 	}
 	return err
 }
 
+// endTrace tells the tracer of the query that it has finished with the error
+// err, or the first error decoding its results. It does nothing if the query
+// is not traced or the trace has already ended.
+func (iter *Iterator) endTrace(err error) {
+	trace := iter.trace
+	if trace == nil {
+		return
+	}
+	iter.trace = nil
+	trace.info.Duration = time.Since(trace.info.Start)
+	if err == nil {
+		err = trace.err
+	}
+	trace.info.Err = err
+	if iter.result != nil {
+		if n, err := iter.result.RowsAffected(); err == nil {
+			trace.info.Rows = n
+		}
+	}
+	trace.tracer.OnQuery(trace.info)
+}
+
+// ForEachInto runs the query, decodes each row of the results into dest and
+// calls fn after each row is decoded. dest is reused for every row, it is an
+// output argument as passed to [Query.Get], e.g. a *Person. Iteration stops at
+// the first error, either from decoding a row or returned by fn, which is then
+// returned by ForEachInto. The results are always closed before ForEachInto
+// returns. Unlike [Query.Get], no rows is not an error.
+//
+// For example:
+//
+//	var p Person
+//	err := db.Query(ctx, stmt).ForEachInto(&p, func() error {
+//		fmt.Println(p.Name)
+//		return nil
+//	})
+func (q *Query) ForEachInto(dest any, fn func() error) (err error) {
+	defer func() {
+		err = wrapQueryError(q.id, err)
+	}()
+	if q.err != nil {
+		return q.err
+	}
+	if !q.pq.HasOutputs() {
+		return noOutputsError([]any{dest})
+	}
+
+	iter := q.Iter()
+	defer func() {
+		if cerr := iter.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	for iter.Next() {
+		if err := iter.Get(dest); err != nil {
+			return err
+		}
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Outcome holds metadata about executed queries, and can be provided as the
 // first output argument to any of the Get methods to populate it with
 // information about the query execution.
@@ -274,21 +1214,91 @@ type Outcome struct {
 
 // Result returns a [sql.Result] containing information about the query
 // execution. If no result is set then Result returns nil.
+//
+// For a bulk insert RowsAffected is the total for the whole statement, the
+// value is reported by the driver and is not broken down by row. In SQLite it
+// is the value of changes(), in an upsert a row that is inserted and a row
+// that is updated both count as one change, so the two cannot be told apart.
+// To find out what happened to each row, return a column from the statement
+// with RETURNING that records it where the database supports one, for
+// example (xmax = 0) in PostgreSQL is true for inserted rows.
 func (o *Outcome) Result() sql.Result {
 	return o.result
 }
 
+// GetAllOption configures how [Query.GetAll] reads the results of a query.
+// Options can be passed to GetAll amongst the slice arguments.
+type GetAllOption func(*getAllConfig)
+
+// getAllConfig holds the configuration set by the GetAllOptions passed to
+// GetAll.
+type getAllConfig struct {
+	// maxRows is the maximum number of rows read. It is zero if there is no
+	// limit.
+	maxRows int
+	// truncate is true if rows after the first maxRows are discarded rather
+	// than causing an error.
+	truncate bool
+}
+
+// MaxRows limits the number of rows [Query.GetAll] reads into memory. If the
+// query returns more rows, GetAll stops reading and returns an error wrapping
+// [ErrTooManyRows], leaving the slices unchanged. A limit of zero or less
+// means there is no limit, which is the default.
+func MaxRows(max int) GetAllOption {
+	return func(gc *getAllConfig) {
+		if max < 0 {
+			max = 0
+		}
+		gc.maxRows = max
+	}
+}
+
+// TruncateRows makes [Query.GetAll] keep the rows within the limit set by
+// [MaxRows] and discard the rest rather than returning an error.
+func TruncateRows() GetAllOption {
+	return func(gc *getAllConfig) {
+		gc.truncate = true
+	}
+}
+
+// extractGetAllOptions removes the GetAllOptions from the slice arguments
+// and returns the configuration they set.
+func extractGetAllOptions(sliceArgs []any) (*getAllConfig, []any) {
+	gc := &getAllConfig{}
+	var args []any
+	for _, arg := range sliceArgs {
+		if opt, ok := arg.(GetAllOption); ok {
+			opt(gc)
+			continue
+		}
+		args = append(args, arg)
+	}
+	return gc, args
+}
+
 // GetAll iterates over the query and scans all rows into the provided slices.
 // sliceArgs must contain pointers to slices of each of the output types.
 // A pointer to an empty [Outcome] struct may be provided as the first output
 // variable to get information about query execution.
 //
+// If the query has a single output column, a pointer to a slice of single
+// values may be passed instead, e.g. a *[]string for "SELECT &Person.name FROM
+// person". The output column of each row is appended to it.
+//
+// [GetAllOption] values, such as [MaxRows], can be passed amongst the slice
+// arguments to limit the number of rows read.
+//
 // [ErrNoRows] will be returned if no rows are found.
 func (q *Query) GetAll(sliceArgs ...any) (err error) {
+	defer func() {
+		err = wrapQueryError(q.id, err)
+	}()
 	if q.err != nil {
 		return q.err
 	}
 
+	gc, sliceArgs := extractGetAllOptions(sliceArgs)
 	if len(sliceArgs) > 0 {
 		if outcome, ok := sliceArgs[0].(*Outcome); ok {
 			outcome.result = nil
@@ -296,7 +1306,7 @@ func (q *Query) GetAll(sliceArgs ...any) (err error) {
 		}
 	}
 	if !q.pq.HasOutputs() && len(sliceArgs) > 0 {
-		return fmt.Errorf("output variables provided but not referenced in query")
+		return noOutputsError(sliceArgs)
 	}
 	// Check slice inputs are valid using reflection.
 	var slicePtrVals = []reflect.Value{}
@@ -318,21 +1328,42 @@ func (q *Query) GetAll(sliceArgs ...any) (err error) {
 	}
 
 	// Iterate over the query results.
-	rowsReturned := false
-	iter := q.Iter()
+	rowsReturned := 0
+	iter := q.iter()
 	for iter.Next() {
-		rowsReturned = true
+		if gc.maxRows > 0 && rowsReturned == gc.maxRows {
+			if gc.truncate {
+				break
+			}
+			err := fmt.Errorf("%w: query returned more than %d rows", ErrTooManyRows, gc.maxRows)
+			if cerr := iter.Close(); cerr != nil {
+				err = fmt.Errorf("%w, and cannot close results: %s", err, cerr)
+			}
+			return err
+		}
+		rowsReturned++
 		var outputArgs = []any{}
 		for _, sliceVal := range sliceVals {
 			elemType := sliceVal.Type().Elem()
 			var outputArg reflect.Value
+			if len(sliceVals) == 1 && typeinfo.IsValueOutput(reflect.New(elemType).Interface()) {
+				// A slice of single values, such as []string, is filled
+				// from the one output column of the query.
+				outputArgs = append(outputArgs, reflect.New(elemType).Interface())
+				continue
+			}
 			switch elemType.Kind() {
 			case reflect.Pointer:
-				if elemType.Elem().Kind() != reflect.Struct {
+				switch elemType.Elem().Kind() {
+				case reflect.Struct:
+					outputArg = reflect.New(elemType.Elem())
+				case reflect.Map:
+					outputArg = reflect.New(elemType.Elem())
+					outputArg.Elem().Set(reflect.MakeMap(elemType.Elem()))
+				default:
 					iter.Close()
 					return fmt.Errorf("need slice of structs/maps, got slice of pointer to %s", elemType.Elem().Kind())
 				}
-				outputArg = reflect.New(elemType.Elem())
 			case reflect.Struct:
 				outputArg = reflect.New(elemType)
 			case reflect.Map:
@@ -348,6 +1379,10 @@ func (q *Query) GetAll(sliceArgs ...any) (err error) {
 			return err
 		}
 		for i, outputArg := range outputArgs {
+			if len(sliceVals) == 1 && typeinfo.IsValueOutput(outputArg) {
+				sliceVals[i] = reflect.Append(sliceVals[i], reflect.ValueOf(outputArg).Elem())
+				continue
+			}
 			switch k := sliceVals[i].Type().Elem().Kind(); k {
 			case reflect.Pointer, reflect.Map:
 				sliceVals[i] = reflect.Append(sliceVals[i], reflect.ValueOf(outputArg))
@@ -362,7 +1397,7 @@ func (q *Query) GetAll(sliceArgs ...any) (err error) {
 	err = iter.Close()
 	if err != nil {
 		return err
-	} else if !rowsReturned && q.pq.HasOutputs() {
+	} else if rowsReturned == 0 && q.pq.HasOutputs() {
 		return ErrNoRows
 	}
 
@@ -377,6 +1412,13 @@ func (q *Query) GetAll(sliceArgs ...any) (err error) {
 type TX struct {
 	sqltx *sql.Tx
 	done  int32
+	// config is inherited from the DB the transaction was started on.
+	config dbConfig
+	// ctx is the context the transaction was started with. It is used for
+	// the statements run by savepoint methods.
+	ctx context.Context
+	// stmts is the statement cache of the DB the transaction was started on.
+	stmts *stmtCache
 }
 
 func (tx *TX) isDone() bool {
@@ -391,7 +1433,8 @@ func (tx *TX) setDone() error {
 }
 
 // Begin starts a transaction. A transaction must be ended
-// with a [TX.Commit] or [TX.Rollback].
+// with a [TX.Commit] or [TX.Rollback]. If opts is nil the default options are
+// used, see [ReadOnly] and [Serializable] for the common cases.
 func (db *DB) Begin(ctx context.Context, opts *TXOptions) (*TX, error) {
 	if ctx == nil {
 		ctx = context.Background()
@@ -400,7 +1443,7 @@ func (db *DB) Begin(ctx context.Context, opts *TXOptions) (*TX, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &TX{sqltx: sqltx}, nil
+	return &TX{sqltx: sqltx, config: db.config, ctx: ctx, stmts: db.stmts}, nil
 }
 
 // Commit commits the transaction.
@@ -421,7 +1464,60 @@ func (tx *TX) Rollback() error {
 	return err
 }
 
+// Savepoint creates a savepoint with the given name within the transaction.
+// The transaction can be rolled back to the savepoint with [TX.RollbackTo].
+func (tx *TX) Savepoint(name string) error {
+	return tx.runSavepointStmt("SAVEPOINT ", name)
+}
+
+// RollbackTo rolls the transaction back to the named savepoint. The savepoint
+// remains active and can be rolled back to again.
+func (tx *TX) RollbackTo(name string) error {
+	return tx.runSavepointStmt("ROLLBACK TO SAVEPOINT ", name)
+}
+
+// Release removes the named savepoint, keeping the changes made since it was
+// created as part of the transaction.
+func (tx *TX) Release(name string) error {
+	return tx.runSavepointStmt("RELEASE SAVEPOINT ", name)
+}
+
+// runSavepointStmt runs the SQL command followed by the savepoint name in the
+// transaction.
+func (tx *TX) runSavepointStmt(command string, name string) error {
+	if tx.isDone() {
+		return ErrTXDone
+	}
+	if !validSavepointName(name) {
+		return fmt.Errorf("invalid savepoint name %q", name)
+	}
+	stmt, err := Prepare(command + name)
+	if err != nil {
+		return err
+	}
+	return tx.Query(tx.ctx, stmt).Run()
+}
+
+// validSavepointName returns true if name is made up of letters, digits and
+// underscores and does not start with a digit.
+func validSavepointName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if !(unicode.IsLetter(c) || c == '_' || (i > 0 && unicode.IsDigit(c))) {
+			return false
+		}
+	}
+	return true
+}
+
 // TXOptions holds the transaction options to be used in [DB.Begin].
+//
+// Not all drivers honor the options. The SQLite driver
+// (github.com/mattn/go-sqlite3) and the dqlite driver ignore both of them:
+// SQLite transactions are always serializable and read-only transactions are
+// not enforced.
 type TXOptions struct {
 	// Isolation is the transaction isolation level.
 	// If zero, the driver or database's default level is used.
@@ -429,6 +1525,31 @@ type TXOptions struct {
 	ReadOnly  bool
 }
 
+// The isolation levels that can be used in [TXOptions]. They are the same as
+// those defined in database/sql.
+const (
+	LevelDefault         = sql.LevelDefault
+	LevelReadUncommitted = sql.LevelReadUncommitted
+	LevelReadCommitted   = sql.LevelReadCommitted
+	LevelWriteCommitted  = sql.LevelWriteCommitted
+	LevelRepeatableRead  = sql.LevelRepeatableRead
+	LevelSnapshot        = sql.LevelSnapshot
+	LevelSerializable    = sql.LevelSerializable
+	LevelLinearizable    = sql.LevelLinearizable
+)
+
+// ReadOnly returns the options for a read-only transaction with the default
+// isolation level.
+func ReadOnly() *TXOptions {
+	return &TXOptions{ReadOnly: true}
+}
+
+// Serializable returns the options for a transaction with the serializable
+// isolation level.
+func Serializable() *TXOptions {
+	return &TXOptions{Isolation: LevelSerializable}
+}
+
 func (txopts *TXOptions) plainTXOptions() *sql.TxOptions {
 	if txopts == nil {
 		return nil
@@ -447,19 +1568,31 @@ func (tx *TX) Query(ctx context.Context, s *Statement, inputArgs ...any) *Query
 		return &Query{ctx: ctx, err: ErrTXDone}
 	}
 
-	pq, err := s.te.BindInputs(inputArgs...)
+	if tx.config.err != nil {
+		return &Query{ctx: ctx, err: tx.config.err}
+	}
+
+	config, inputArgs := extractQueryOptions(inputArgs)
+	config.inherit(s, &tx.config)
+	id := tx.config.queryID(ctx, config)
+	ctx = contextWithQueryID(ctx, id)
+	pq, err := s.te.BindInputsWithStyle(config.paramStyle(tx.config.paramStyle), inputArgs...)
 	if err != nil {
-		return &Query{ctx: ctx, err: err}
+		return &Query{ctx: ctx, err: err, id: id}
 	}
+	sqlStr := tx.config.querySQL(pq, id)
 
 	run := func(innerCtx context.Context) (rows *sql.Rows, result sql.Result, err error) {
+		if useStmtCache(tx.stmts, s, pq, sqlStr) {
+			return tx.stmts.run(innerCtx, tx.sqltx, sqlStr, pq)
+		}
 		if pq.HasOutputs() {
-			rows, err = tx.sqltx.QueryContext(innerCtx, pq.SQL(), pq.Params()...)
+			rows, err = tx.sqltx.QueryContext(innerCtx, sqlStr, pq.Params()...)
 		} else {
-			result, err = tx.sqltx.ExecContext(innerCtx, pq.SQL(), pq.Params()...)
+			result, err = tx.sqltx.ExecContext(innerCtx, sqlStr, pq.Params()...)
 		}
 		return rows, result, err
 	}
 
-	return &Query{pq: pq, ctx: ctx, run: run, err: nil}
+	return &Query{pq: pq, ctx: ctx, run: run, err: nil, config: config, id: id, sql: sqlStr, tracer: tx.config.tracer}
 }
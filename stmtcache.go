@@ -0,0 +1,232 @@
+// Copyright 2024 Canonical Ltd.
+// Licensed under Apache 2.0, see LICENCE file for details.
+
+package sqlair
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/canonical/sqlair/internal/expr"
+)
+
+// WithStmtCache makes the DB prepare the SQL of each query on the database
+// and keep the prepared statement for later queries that generate the same
+// SQL. Transactions started on the DB use the cached statements too.
+//
+// The cache holds up to 256 statements. When it is full, the least recently
+// used statement is closed to make room for a new one, so queries whose SQL
+// varies from run to run, such as bulk inserts of varying numbers of rows,
+// only use the cache well if they have few variations. Queries with ID
+// comments and statements prepared with [MultipleStatements] are not cached.
+// The cached statements are closed by [DB.Close].
+func WithStmtCache() DBOption {
+	return func(dc *dbConfig) {
+		dc.stmtCache = true
+	}
+}
+
+// stmtCacheSize is the number of statements held in a statement cache.
+const stmtCacheSize = 256
+
+// stmtCache holds the statements prepared on a database by the SQL they were
+// prepared from.
+type stmtCache struct {
+	sqldb *sql.DB
+	mutex sync.Mutex
+	stmts *lruCache[string, *cachedStmt]
+	// closed is true once the cache has been closed, statements prepared
+	// after that are not cached.
+	closed bool
+}
+
+// cachedStmt is a statement in a stmtCache.
+type cachedStmt struct {
+	stmt *sql.Stmt
+	// users is the number of queries that are starting with the statement.
+	users int
+	// evicted is true once the statement has been removed from the cache.
+	// It is closed when it has no more users.
+	evicted bool
+}
+
+// newStmtCache returns an empty statement cache for the database.
+func newStmtCache(sqldb *sql.DB) *stmtCache {
+	return &stmtCache{
+		sqldb: sqldb,
+		stmts: newLRUCache[string](stmtCacheSize, func(cs *cachedStmt) {
+			cs.evicted = true
+			if cs.users == 0 {
+				cs.stmt.Close()
+			}
+		}),
+	}
+}
+
+// stmt returns the prepared statement for the SQL, preparing it on the
+// database under the context if it is not in the cache. The statement must
+// be released once the query using it has started.
+func (sc *stmtCache) stmt(ctx context.Context, sqlStr string) (*cachedStmt, error) {
+	sc.mutex.Lock()
+	cs, ok := sc.stmts.get(sqlStr)
+	if ok {
+		cs.users++
+	}
+	sc.mutex.Unlock()
+	if ok {
+		return cs, nil
+	}
+
+	// The statement is prepared without holding the lock so that a slow
+	// prepare does not hold up queries using other statements.
+	stmt, err := sc.sqldb.PrepareContext(ctx, sqlStr)
+	if err != nil {
+		return nil, err
+	}
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	if cs, ok := sc.stmts.get(sqlStr); ok {
+		// Another query prepared the same SQL in the meantime.
+		stmt.Close()
+		cs.users++
+		return cs, nil
+	}
+	cs = &cachedStmt{stmt: stmt, users: 1}
+	if sc.closed {
+		cs.evicted = true
+	} else {
+		sc.stmts.add(sqlStr, cs)
+	}
+	return cs, nil
+}
+
+// release marks the query using the statement as started. A statement that
+// has been evicted from the cache is closed once it has no more users.
+func (sc *stmtCache) release(cs *cachedStmt) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	cs.users--
+	if cs.evicted && cs.users == 0 {
+		cs.stmt.Close()
+	}
+}
+
+// close closes all the statements in the cache. Statements used by queries
+// that are starting are closed once the queries have started.
+func (sc *stmtCache) close() {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	sc.closed = true
+	sc.stmts.clear()
+}
+
+// run runs the query using the cached statement for its SQL. If tx is not nil
+// the statement is run in the transaction.
+func (sc *stmtCache) run(ctx context.Context, tx *sql.Tx, sqlStr string, pq *expr.PrimedQuery) (rows *sql.Rows, result sql.Result, err error) {
+	cs, err := sc.stmt(ctx, sqlStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Closing a statement once the query has started does not affect the
+	// rows it returns.
+	defer sc.release(cs)
+	stmt := cs.stmt
+	if tx != nil {
+		// The transaction specific statement is closed when the
+		// transaction ends.
+		stmt = tx.StmtContext(ctx, stmt)
+	}
+	if pq.HasOutputs() {
+		rows, err = stmt.QueryContext(ctx, pq.Params()...)
+	} else {
+		result, err = stmt.ExecContext(ctx, pq.Params()...)
+	}
+	return rows, result, err
+}
+
+// useStmtCache returns true if the query should be run with a cached
+// statement. Query ID comments make the SQL of every query different so
+// queries with them are not cached.
+func useStmtCache(sc *stmtCache, s *Statement, pq *expr.PrimedQuery, sqlStr string) bool {
+	return sc != nil && !s.multipleStatements && sqlStr == pq.SQL()
+}
+
+// PrepareContext is the same as [Prepare] except that the options of the DB,
+// such as [WithUntaggedFields], apply and, on a DB created with
+// [WithStmtCache], it also prepares the SQL generated by the statement on the
+// database under the context and caches the prepared statement for the
+// queries run with it. Preparing on the database can be cancelled with the
+// context.
+//
+// If the query cannot be prepared, a [*PrepareError] is returned. If the
+// context is done before the statement is prepared on the database, the error
+// of the context is returned.
+//
+// The SQL is generated with empty values of the input types. If the SQL a
+// query generates depends on its input values, e.g. with slice inputs or bulk
+// inserts, or the input values cannot be generated, e.g. with loose positional
+// inputs, the SQL is instead prepared on the database when the query is first
+// run.
+func (db *DB) PrepareContext(ctx context.Context, query string, typeSamples ...any) (*Statement, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("cannot prepare statement: %w", err)
+	}
+	pc, typeSamples := extractPrepareOptions(typeSamples)
+	s, err := prepare(query, db.config.prepareConfig(pc), typeSamples)
+	if err != nil {
+		return nil, &PrepareError{Query: query, Err: err}
+	}
+	if db.stmts == nil || s.multipleStatements {
+		return s, nil
+	}
+	pq, ok := sampleQuery(s, db.config.paramStyle)
+	if !ok {
+		return s, nil
+	}
+	cs, err := db.stmts.stmt(ctx, pq.SQL())
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("cannot prepare statement: %w", ctxErr)
+		}
+		return nil, fmt.Errorf("cannot prepare statement on database: %w", err)
+	}
+	db.stmts.release(cs)
+	return s, nil
+}
+
+// sampleQuery binds the statement to empty values of its input types. It
+// returns false if such values cannot be generated for the inputs.
+func sampleQuery(s *Statement, style expr.ParamStyle) (*expr.PrimedQuery, bool) {
+	samples := map[reflect.Type]reflect.Value{}
+	var args []any
+	for _, input := range s.te.Inputs() {
+		t := input.ArgType()
+		sample, ok := samples[t]
+		if !ok {
+			switch t.Kind() {
+			case reflect.Struct:
+				sample = reflect.New(t).Elem()
+			case reflect.Map:
+				sample = reflect.MakeMap(t)
+			default:
+				return nil, false
+			}
+			samples[t] = sample
+			args = append(args, sample.Interface())
+		}
+		if t.Kind() == reflect.Map {
+			sample.SetMapIndex(reflect.ValueOf(input.Member()).Convert(t.Key()), reflect.Zero(t.Elem()))
+		}
+	}
+	pq, err := s.te.BindInputsWithStyle(style, args...)
+	if err != nil {
+		return nil, false
+	}
+	return pq, true
+}
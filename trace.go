@@ -0,0 +1,68 @@
+// Copyright 2024 Canonical Ltd.
+// Licensed under Apache 2.0, see LICENCE file for details.
+
+package sqlair
+
+import "time"
+
+// Tracer is told about each query run on a DB, for example to record metrics
+// or spans. It is set with [WithTracer].
+type Tracer interface {
+	// OnQuery is called once a query has finished, when its results have
+	// been read or the [Iterator] over them has been closed. It may be called
+	// from several goroutines at once.
+	OnQuery(info QueryInfo)
+}
+
+// TracerFunc is a function that can be used as a [Tracer].
+type TracerFunc func(info QueryInfo)
+
+// OnQuery calls f(info).
+func (f TracerFunc) OnQuery(info QueryInfo) {
+	f(info)
+}
+
+// QueryInfo describes a query that was run on the database.
+type QueryInfo struct {
+	// SQL is the SQL sent to the database.
+	SQL string
+	// QueryID is the ID of the query, or the empty string if it has none.
+	QueryID string
+	// Start is the time the query was sent to the database.
+	Start time.Time
+	// Duration is the time from sending the query to the database until it
+	// finished, including the time taken to read its results.
+	Duration time.Duration
+	// Rows is the number of rows read for a query with output expressions.
+	// For other queries it is the number of rows affected, as reported by the
+	// driver.
+	Rows int64
+	// Err is the error the query finished with, or nil if it succeeded.
+	// [ErrNoRows] is not an error of the query.
+	Err error
+}
+
+// WithTracer makes the DB, and transactions started on it, tell tracer about
+// each query run. Queries that fail before they are sent to the database,
+// such as those with invalid input arguments, are not traced.
+func WithTracer(tracer Tracer) DBOption {
+	return func(dc *dbConfig) {
+		dc.tracer = tracer
+	}
+}
+
+// queryTrace collects the information about a query for its Tracer.
+type queryTrace struct {
+	tracer Tracer
+	info   QueryInfo
+	// err is the first error decoding the results of the query.
+	err error
+}
+
+// newQueryTrace starts a trace of a query. It returns nil if tracer is nil.
+func newQueryTrace(tracer Tracer, sql string, id string) *queryTrace {
+	if tracer == nil {
+		return nil
+	}
+	return &queryTrace{tracer: tracer, info: QueryInfo{SQL: sql, QueryID: id, Start: time.Now()}}
+}